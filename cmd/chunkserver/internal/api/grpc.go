@@ -3,6 +3,7 @@ package api
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"net"
 
@@ -20,6 +21,9 @@ type StorageServiceServer interface {
 	Upload(context.Context, *UploadRequest) (*UploadResponse, error)
 	Download(context.Context, *DownloadRequest) (*DownloadResponse, error)
 	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	Stat(context.Context, *StatRequest) (*StatResponse, error)
+	Exists(context.Context, *ExistsRequest) (*ExistsResponse, error)
+	List(context.Context, *ListRequest) (*ListResponse, error)
 	InitMultipartUpload(context.Context, *InitMultipartUploadRequest) (*InitMultipartUploadResponse, error)
 	UploadPart(context.Context, *UploadPartRequest) (*UploadPartResponse, error)
 	CompleteMultipartUpload(context.Context, *CompleteMultipartUploadRequest) (*CompleteMultipartUploadResponse, error)
@@ -57,6 +61,47 @@ type DeleteResponse struct {
 	Error   string
 }
 
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime int64 // Unix秒
+	Digest  string
+}
+
+type StatRequest struct {
+	FileID string
+	Token  string
+}
+
+type StatResponse struct {
+	Object *ObjectInfo
+	Found  bool
+	Error  string
+}
+
+type ExistsRequest struct {
+	FileID string
+	Token  string
+}
+
+type ExistsResponse struct {
+	Exists bool
+	Error  string
+}
+
+type ListRequest struct {
+	Prefix string
+	Marker string
+	Limit  int32
+	Token  string
+}
+
+type ListResponse struct {
+	Objects    []*ObjectInfo
+	NextMarker string
+	Error      string
+}
+
 type InitMultipartUploadRequest struct {
 	FileID   string
 	Filename string
@@ -190,6 +235,65 @@ func (s *GRPCServer) Delete(ctx context.Context, req *DeleteRequest) (*DeleteRes
 	return &DeleteResponse{Success: true}, nil
 }
 
+// Stat 实现Stat RPC方法
+func (s *GRPCServer) Stat(ctx context.Context, req *StatRequest) (*StatResponse, error) {
+	// 验证清单令牌
+	if err := s.service.VerifyInventoryToken(req.Token); err != nil {
+		return &StatResponse{Error: err.Error()}, nil
+	}
+
+	info, err := s.service.Stat(ctx, req.FileID)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return &StatResponse{Found: false}, nil
+	}
+	if err != nil {
+		return &StatResponse{Error: err.Error()}, nil
+	}
+	return &StatResponse{Object: toGRPCObjectInfo(*info), Found: true}, nil
+}
+
+// Exists 实现Exists RPC方法
+func (s *GRPCServer) Exists(ctx context.Context, req *ExistsRequest) (*ExistsResponse, error) {
+	// 验证清单令牌
+	if err := s.service.VerifyInventoryToken(req.Token); err != nil {
+		return &ExistsResponse{Error: err.Error()}, nil
+	}
+
+	exists, err := s.service.Exists(ctx, req.FileID)
+	if err != nil {
+		return &ExistsResponse{Error: err.Error()}, nil
+	}
+	return &ExistsResponse{Exists: exists}, nil
+}
+
+// List 实现List RPC方法
+func (s *GRPCServer) List(ctx context.Context, req *ListRequest) (*ListResponse, error) {
+	// 验证清单令牌
+	if err := s.service.VerifyInventoryToken(req.Token); err != nil {
+		return &ListResponse{Error: err.Error()}, nil
+	}
+
+	result, err := s.service.List(ctx, req.Prefix, req.Marker, int(req.Limit))
+	if err != nil {
+		return &ListResponse{Error: err.Error()}, nil
+	}
+	objects := make([]*ObjectInfo, len(result.Objects))
+	for i, obj := range result.Objects {
+		objects[i] = toGRPCObjectInfo(obj)
+	}
+	return &ListResponse{Objects: objects, NextMarker: result.NextMarker}, nil
+}
+
+// toGRPCObjectInfo 转换对象信息
+func toGRPCObjectInfo(info storage.ObjectInfo) *ObjectInfo {
+	return &ObjectInfo{
+		Key:     info.Key,
+		Size:    info.Size,
+		ModTime: info.ModTime.Unix(),
+		Digest:  info.Digest,
+	}
+}
+
 // InitMultipartUpload 实现InitMultipartUpload RPC方法
 func (s *GRPCServer) InitMultipartUpload(ctx context.Context, req *InitMultipartUploadRequest) (*InitMultipartUploadResponse, error) {
 	// 验证令牌
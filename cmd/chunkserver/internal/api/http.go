@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -49,6 +50,12 @@ func NewHTTPServer(service *service.StorageServiceImpl, redis *redis.Client, por
 		apiGroup.GET("/file/:id", handleFileDownload(service))
 		apiGroup.DELETE("/file/:id", handleFileDelete(service))
 
+		// 对象清单API（需清单令牌）
+		objectGroup := apiGroup.Group("/objects", requireInventoryToken(service))
+		objectGroup.GET("", handleListObjects(service))
+		objectGroup.GET("/:id", handleStatObject(service))
+		objectGroup.HEAD("/:id", handleObjectExists(service))
+
 		// 分片上传API
 		apiGroup.POST("/multipart/init", handleInitMultipart(service))
 		apiGroup.POST("/multipart/part", handleUploadPart(service))
@@ -176,6 +183,13 @@ func handleFileDownload(service *service.StorageServiceImpl) gin.HandlerFunc {
 
 		// 读取文件内容
 		data, err := service.Read(c.Request.Context(), fileID)
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    3,
+				"message": err.Error(),
+			})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"code":    4,
@@ -217,6 +231,84 @@ func handleFileDelete(service *service.StorageServiceImpl) gin.HandlerFunc {
 	}
 }
 
+// 校验对象清单令牌
+func requireInventoryToken(service *service.StorageServiceImpl) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := service.VerifyInventoryToken(c.Query("token")); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"code":    2,
+				"message": err.Error(),
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// 处理对象元信息查询
+func handleStatObject(service *service.StorageServiceImpl) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		info, err := service.Stat(c.Request.Context(), c.Param("id"))
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    3,
+				"message": err.Error(),
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    4,
+				"message": fmt.Sprintf("查询对象失败: %v", err),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    0,
+			"message": "查询成功",
+			"data":    info,
+		})
+	}
+}
+
+// 处理对象存在性查询，仅通过状态码返回结果
+func handleObjectExists(service *service.StorageServiceImpl) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		exists, err := service.Exists(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusOK)
+	}
+}
+
+// 处理对象分页列举
+func handleListObjects(service *service.StorageServiceImpl) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "0"))
+		result, err := service.List(c.Request.Context(), c.Query("prefix"), c.Query("marker"), limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    4,
+				"message": fmt.Sprintf("列举对象失败: %v", err),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    0,
+			"message": "查询成功",
+			"data":    result,
+		})
+	}
+}
+
 // 处理初始化分片上传请求
 func handleInitMultipart(service *service.StorageServiceImpl) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -264,9 +356,11 @@ func handleInitMultipart(service *service.StorageServiceImpl) gin.HandlerFunc {
 			token = fmt.Sprintf("internal_%s", fileID)
 
 			// 将token保存到Redis，以便后续验证
-			ctx := context.Background()
-			tokenKey := fmt.Sprintf("chunk:token:%s", token)
-			service.GetRedisClient().Set(ctx, tokenKey, fileID, 24*time.Hour)
+			if rdb := service.GetRedisClient(); rdb != nil {
+				ctx := context.Background()
+				tokenKey := fmt.Sprintf("chunk:token:%s", token)
+				rdb.Set(ctx, tokenKey, fileID, 24*time.Hour)
+			}
 		} else {
 			// 处理查询参数
 			filename = c.Query("filename")
@@ -657,6 +751,13 @@ func handleDirectDownload(service *service.StorageServiceImpl) gin.HandlerFunc {
 
 		// 读取文件内容
 		data, err := service.Read(c.Request.Context(), fileID)
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    5,
+				"message": err.Error(),
+			})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"code":    4,
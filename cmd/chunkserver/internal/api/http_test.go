@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"cloudDrive/cmd/chunkserver/internal/service"
+	"cloudDrive/internal/storage"
+	"cloudDrive/internal/storage/storagetest"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newInProcessChunkServer 启动进程内块存储服务，返回指向它的客户端
+func newInProcessChunkServer(t *testing.T, backend storage.Storage) storage.Storage {
+	gin.SetMode(gin.TestMode)
+	srv := NewHTTPServer(service.NewStorageService(backend, nil), nil, 0)
+	ts := httptest.NewServer(srv.server.Handler)
+	t.Cleanup(ts.Close)
+
+	client, err := storage.NewChunkServerStorage(ts.URL, nil, t.TempDir())
+	if err != nil {
+		t.Fatalf("创建块存储客户端失败: %v", err)
+	}
+	return client
+}
+
+func TestChunkServerStorageConformance_LocalBackend(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return newInProcessChunkServer(t, &storage.LocalFileStorage{Dir: t.TempDir()})
+	})
+}
+
+func TestChunkServerStorageConformance_MemoryBackend(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return newInProcessChunkServer(t, storage.NewMemoryStorage())
+	})
+}
@@ -8,6 +8,8 @@ import (
 	"strings"
 	"time"
 
+	"cloudDrive/internal/storage"
+
 	"github.com/spf13/viper"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
@@ -29,15 +31,13 @@ type Config struct {
 	} `mapstructure:"redis"`
 
 	Storage struct {
-		Type     string `mapstructure:"type"`
-		LocalDir string `mapstructure:"local_dir"`
-		Minio    struct {
-			Endpoint  string `mapstructure:"endpoint"`
-			AccessKey string `mapstructure:"access_key"`
-			SecretKey string `mapstructure:"secret_key"`
-			Bucket    string `mapstructure:"bucket"`
-			UseSSL    bool   `mapstructure:"use_ssl"`
-		} `mapstructure:"minio"`
+		storage.BackendConfig `mapstructure:",squash"`
+
+		// DualWrite 迁移切换窗口内的双写配置，写入主存储后同步一份到Secondary
+		DualWrite struct {
+			Enabled   bool                  `mapstructure:"enabled"`
+			Secondary storage.BackendConfig `mapstructure:"secondary"`
+		} `mapstructure:"dual_write"`
 	} `mapstructure:"storage"`
 
 	Security struct {
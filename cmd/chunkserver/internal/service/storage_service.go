@@ -7,8 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
-	"strconv"
 	"time"
 
 	"cloudDrive/internal/storage"
@@ -24,6 +24,11 @@ type StorageService interface {
 	Read(ctx context.Context, key string) ([]byte, error)
 	Delete(ctx context.Context, key string) error
 
+	// 对象清单操作
+	Stat(ctx context.Context, key string) (*storage.ObjectInfo, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	List(ctx context.Context, prefix string, marker string, limit int) (*storage.ListResult, error)
+
 	// 分片上传操作
 	InitMultipartUpload(ctx context.Context, fileID string, filename string) (string, error)
 	UploadPart(ctx context.Context, uploadID string, partNumber int, partData io.Reader) (string, error)
@@ -32,6 +37,7 @@ type StorageService interface {
 
 	// 验证令牌
 	VerifyToken(ctx context.Context, token string, operation string) (map[string]interface{}, error)
+	VerifyInventoryToken(token string) error
 
 	// 计算文件哈希
 	CalculateFileHash(filePath string) (string, error)
@@ -71,6 +77,21 @@ func (s *StorageServiceImpl) Delete(ctx context.Context, key string) error {
 	return s.storage.Delete(ctx, key)
 }
 
+// Stat 查询对象元信息
+func (s *StorageServiceImpl) Stat(ctx context.Context, key string) (*storage.ObjectInfo, error) {
+	return s.storage.Stat(ctx, key)
+}
+
+// Exists 判断对象是否存在
+func (s *StorageServiceImpl) Exists(ctx context.Context, key string) (bool, error) {
+	return s.storage.Exists(ctx, key)
+}
+
+// List 分页列举对象
+func (s *StorageServiceImpl) List(ctx context.Context, prefix string, marker string, limit int) (*storage.ListResult, error) {
+	return s.storage.List(ctx, prefix, marker, limit)
+}
+
 // InitMultipartUpload 初始化分片上传
 func (s *StorageServiceImpl) InitMultipartUpload(ctx context.Context, fileID string, filename string) (string, error) {
 	return s.storage.InitMultipartUpload(ctx, fileID, filename)
@@ -86,77 +107,73 @@ func (s *StorageServiceImpl) CompleteMultipartUpload(ctx context.Context, upload
 	return s.storage.CompleteMultipartUpload(ctx, uploadID, parts)
 }
 
-// ListParts 列出已上传的分片
+// ListParts 列出已上传的分片，由存储后端记录分片状态
 func (s *StorageServiceImpl) ListParts(ctx context.Context, uploadID string) ([]int, error) {
-	// 检查存储接口是否实现了ListUploadedParts方法
-	if chunkStorage, ok := s.storage.(*storage.ChunkServerStorage); ok {
-		return chunkStorage.ListUploadedParts(ctx, uploadID)
-	}
-
-	// 对于其他存储类型，可以从redis或其他地方获取分片信息
-	key := fmt.Sprintf("chunk:multipart:%s:parts", uploadID)
-	result, err := s.redis.SMembers(ctx, key).Result()
+	parts, err := s.storage.ListUploadedParts(ctx, uploadID)
 	if err != nil {
-		if err == redis.Nil {
-			return []int{}, nil
-		}
 		return nil, fmt.Errorf("获取分片列表失败: %v", err)
 	}
-
-	// 将字符串转换为整数
-	parts := make([]int, 0, len(result))
-	for _, partStr := range result {
-		partNum, err := strconv.Atoi(partStr)
-		if err != nil {
-			continue
-		}
-		parts = append(parts, partNum)
-	}
-
 	return parts, nil
 }
 
 // VerifyToken 验证令牌
+// 优先查Redis中缓存的令牌；未命中或Redis不可用时退回JWT校验
 func (s *StorageServiceImpl) VerifyToken(ctx context.Context, token string, operation string) (map[string]interface{}, error) {
-	// 从Redis获取令牌信息
 	key := fmt.Sprintf("chunk:token:%s", token)
-	val, err := s.redis.Get(ctx, key).Result()
-	if err == nil {
-		// 对于新的令牌格式，值就是fileID
-		tokenInfo := map[string]interface{}{
-			"file_id": val,
+	if s.redis != nil {
+		val, err := s.redis.Get(ctx, key).Result()
+		if err == nil {
+			// 对于新的令牌格式，值就是fileID
+			tokenInfo := map[string]interface{}{
+				"file_id": val,
+			}
+			return tokenInfo, nil
+		}
+		if err != redis.Nil {
+			log.Printf("查询令牌缓存失败，使用JWT校验: %v", err)
 		}
-		return tokenInfo, nil
 	}
 
-	// 如果Redis中没有找到令牌，尝试使用JWT验证
-	if err == redis.Nil {
-		// 尝试解析JWT令牌
-		tokenClaims, err := parseJWTToken(token)
-		if err != nil {
-			return nil, errors.New("令牌无效或已过期")
-		}
+	// 尝试解析JWT令牌
+	tokenClaims, err := parseJWTToken(token)
+	if err != nil {
+		return nil, errors.New("令牌无效或已过期")
+	}
 
-		// 检查令牌是否过期
-		if exp, ok := tokenClaims["exp"].(float64); ok {
-			if time.Now().Unix() > int64(exp) {
-				return nil, errors.New("令牌已过期")
-			}
+	// 检查令牌是否过期
+	if exp, ok := tokenClaims["exp"].(float64); ok {
+		if time.Now().Unix() > int64(exp) {
+			return nil, errors.New("令牌已过期")
 		}
+	}
 
-		// 从JWT中获取fileID
-		fileID, ok := tokenClaims["file_id"].(string)
-		if !ok || fileID == "" {
-			return nil, errors.New("无效的文件ID")
-		}
+	// 从JWT中获取fileID
+	fileID, ok := tokenClaims["file_id"].(string)
+	if !ok || fileID == "" {
+		return nil, errors.New("无效的文件ID")
+	}
 
-		// 将令牌信息保存到Redis，有效期1小时
+	// 将令牌信息保存到Redis，有效期1小时
+	if s.redis != nil {
 		s.redis.Set(ctx, key, fileID, time.Hour)
-
-		return tokenClaims, nil
 	}
 
-	return nil, fmt.Errorf("验证令牌失败: %v", err)
+	return tokenClaims, nil
+}
+
+// VerifyInventoryToken 验证对象清单令牌，要求为未过期且scope为inventory的JWT
+func (s *StorageServiceImpl) VerifyInventoryToken(token string) error {
+	if token == "" {
+		return errors.New("缺少令牌")
+	}
+	claims, err := parseJWTToken(token)
+	if err != nil {
+		return errors.New("令牌无效或已过期")
+	}
+	if scope, _ := claims["scope"].(string); scope != storage.InventoryTokenScope {
+		return errors.New("令牌无权访问对象清单")
+	}
+	return nil
 }
 
 // parseJWTToken 解析JWT令牌
@@ -200,7 +217,7 @@ func (s *StorageServiceImpl) CalculateFileHash(filePath string) (string, error)
 	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
-// GetRedisClient 获取Redis客户端
+// GetRedisClient 获取Redis客户端，未配置Redis时返回nil
 func (s *StorageServiceImpl) GetRedisClient() *redis.Client {
 	return s.redis
 }
@@ -68,29 +68,28 @@ func main() {
 	log.Println("成功连接到Redis")
 
 	// 初始化存储后端
-	var storageBackend storage.Storage
+	if cfg.Storage.Type != "local" && cfg.Storage.Type != "minio" {
+		log.Fatalf("不支持的存储类型: %s", cfg.Storage.Type)
+	}
+	storageBackend, err := storage.NewBackend(cfg.Storage.BackendConfig)
+	if err != nil {
+		log.Fatalf("初始化存储失败: %v", err)
+	}
 	switch cfg.Storage.Type {
 	case "local":
-		// 创建本地存储实例
-		localStorage := &storage.LocalFileStorage{Dir: cfg.Storage.LocalDir}
-		storageBackend = localStorage
 		log.Printf("使用本地文件存储: %s", cfg.Storage.LocalDir)
 	case "minio":
-		// 创建MinIO存储实例
-		minioStorage, err := storage.NewMinioStorage(
-			cfg.Storage.Minio.Endpoint,
-			cfg.Storage.Minio.AccessKey,
-			cfg.Storage.Minio.SecretKey,
-			cfg.Storage.Minio.Bucket,
-			cfg.Storage.Minio.UseSSL,
-		)
+		log.Printf("使用MinIO存储: %s", cfg.Storage.Minio.Endpoint)
+	}
+
+	// 迁移切换窗口内启用双写
+	if cfg.Storage.DualWrite.Enabled {
+		secondary, err := storage.NewBackend(cfg.Storage.DualWrite.Secondary)
 		if err != nil {
-			log.Fatalf("初始化MinIO存储失败: %v", err)
+			log.Fatalf("初始化双写副存储失败: %v", err)
 		}
-		storageBackend = minioStorage
-		log.Printf("使用MinIO存储: %s", cfg.Storage.Minio.Endpoint)
-	default:
-		log.Fatalf("不支持的存储类型: %s", cfg.Storage.Type)
+		storageBackend = storage.NewDualWriteStorage(storageBackend, secondary)
+		log.Printf("已启用双写，副存储类型: %s", cfg.Storage.DualWrite.Secondary.Type)
 	}
 
 	// 创建存储服务
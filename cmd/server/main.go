@@ -1,12 +1,16 @@
 package main
 
 import (
+	"cloudDrive/internal/archive"
+	"cloudDrive/internal/cache"
 	"cloudDrive/internal/discovery"
 	"cloudDrive/internal/file"
+	"cloudDrive/internal/fulltext"
 	"cloudDrive/internal/handler"
 	"cloudDrive/internal/logger"
 	"cloudDrive/internal/middleware"
 	"cloudDrive/internal/storage"
+	"cloudDrive/internal/task"
 	"cloudDrive/internal/user"
 	"context"
 	"flag"
@@ -159,10 +163,22 @@ func main() {
 		log.Fatalf("数据库连接失败: %v", err)
 	}
 	// 自动迁移用户表和文件表，并捕获错误
-	err = db.AutoMigrate(&user.User{}, &file.File{}, &file.FileContent{}, &file.UserRoot{}, &file.Share{})
+	err = db.AutoMigrate(&user.User{}, &file.File{}, &file.FileAncestor{}, &file.FileNameToken{}, &file.Tag{}, &file.FileTag{}, &file.Favorite{}, &file.FileMeta{}, &file.SearchIndexVersion{}, &file.FileContent{}, &fulltext.ContentIndex{}, &fulltext.ContentTerm{}, &file.UserRoot{}, &file.Share{}, &file.FileVersion{}, &file.VersionPolicy{}, &file.SavedSearch{}, &file.PendingBlob{}, &task.Task{})
 	if err != nil {
 		log.Fatalf("AutoMigrate failed: %v", err)
 	}
+	// 升级后为已有文件补全目录树闭包表
+	if n, err := file.BackfillAncestors(db); err != nil {
+		log.Fatalf("补全目录树失败: %v", err)
+	} else if n > 0 {
+		log.Printf("已补全 %d 个文件的目录树记录", n)
+	}
+	// 为已有文件补全文件名搜索索引和扩展名
+	if n, err := file.BackfillSearchIndex(db); err != nil {
+		log.Fatalf("补全搜索索引失败: %v", err)
+	} else if n > 0 {
+		log.Printf("已补全 %d 个文件的搜索索引", n)
+	}
 
 	// 创建gin实例，不使用默认中间件
 	r := gin.New()
@@ -323,11 +339,78 @@ func main() {
 		logger.Info("监控指标收集器已启动", &logger.LogFields{})
 	}
 
+	// 定期按用户策略清理过期的历史版本
+	backgroundCache := cache.New(redisClient)
+	go handler.StartVersionRetention(ctx, db, backgroundCache, time.Hour)
+
+	// 回收站保留期限和配额策略，定期彻底删除过期的回收站文件
+	if viper.IsSet("recycle") {
+		if err := viper.UnmarshalKey("recycle", &file.DefaultRecyclePolicy); err != nil {
+			log.Fatalf("解析回收站配置失败: %v", err)
+		}
+	}
+	go handler.StartRecyclePurge(ctx, db, backgroundCache, time.Hour)
+
+	// 异步任务（解压等），启动时将上次未完成的任务标记为失败
+	taskManager := task.NewManager(db, viper.GetInt("tasks.workers"))
+	if err := taskManager.RecoverInterrupted(); err != nil {
+		log.Printf("恢复中断任务失败: %v", err)
+	}
+	defer taskManager.Shutdown()
+	if viper.IsSet("extract") {
+		if err := viper.UnmarshalKey("extract", &archive.DefaultLimits); err != nil {
+			log.Fatalf("解析解压限制配置失败: %v", err)
+		}
+	}
+
+	// 故障注入（仅用于弹性测试）：可由本地配置开启，或指定etcd key动态下发
+	var faultConfig storage.FaultConfig
+	if err := viper.UnmarshalKey("storage.fault_injection", &faultConfig); err != nil {
+		log.Fatalf("解析故障注入配置失败: %v", err)
+	}
+	faultEtcdKey := viper.GetString("storage.fault_injection.etcd_key")
+	if faultConfig.Enabled || faultEtcdKey != "" {
+		faultStorage := storage.NewFaultInjectingStorage(storageInst, faultConfig)
+		if faultEtcdKey != "" {
+			if err := faultStorage.WatchEtcd(ctx, []string{*etcdEndpoint}, faultEtcdKey); err != nil {
+				log.Printf("监听故障注入配置失败: %v", err)
+			}
+		}
+		storageInst = faultStorage
+		log.Printf("存储故障注入已挂载，enabled=%v", faultStorage.Config().Enabled)
+	}
+
+	// 磁盘读缓存：对象以hash为key且不可变，热点文件无需每次从块存储拉取
+	if viper.GetBool("storage.read_cache.enabled") {
+		cacheDir := viper.GetString("storage.read_cache.dir")
+		if cacheDir == "" {
+			cacheDir = filepath.Join(os.TempDir(), "clouddrive_read_cache")
+		}
+		maxBytes := viper.GetInt64("storage.read_cache.max_size_mb") << 20
+		cacheStorage, err := storage.NewDiskCacheStorage(storageInst, cacheDir, maxBytes)
+		if err != nil {
+			log.Fatalf("初始化读缓存失败: %v", err)
+		}
+		storageInst = cacheStorage
+		log.Printf("已启用磁盘读缓存: %s，容量 %d MB", cacheDir, maxBytes>>20)
+	}
+
+	// 后台为新上传的文档建立全文索引
+	if viper.IsSet("fulltext") {
+		if err := viper.UnmarshalKey("fulltext", &fulltext.DefaultLimits); err != nil {
+			log.Fatalf("解析全文索引配置失败: %v", err)
+		}
+	}
+	go fulltext.StartIndexer(ctx, db, storageInst, 10*time.Second)
+	// 后台检测直传上传和历史内容的 MIME 类型
+	go file.StartSniffer(ctx, db, storageInst, 30*time.Second)
+
 	// 注入 db、redis、storage 到 gin.Context
 	r.Use(func(c *gin.Context) {
 		c.Set("db", db)
 		c.Set("redis", redisClient)
 		c.Set(handler.StorageKey, storageInst)
+		c.Set(handler.TaskManagerKey, taskManager)
 		c.Next()
 	})
 
@@ -342,12 +425,40 @@ func main() {
 	apiAuth.GET("/user/me", handler.UserMeHandler)
 	apiAuth.GET("/files", handler.FileListHandler)
 	apiAuth.POST("/files/upload", handler.FileUploadHandler)
+	apiAuth.POST("/files/batch-upload", handler.FileBatchUploadHandler)
+	apiAuth.POST("/files/batch", handler.FileBatchHandler)
 	apiAuth.GET("/files/download/:id", handler.FileDownloadHandler)
 	apiAuth.DELETE("/files/:id", handler.FileDeleteHandler)
 	apiAuth.PUT("/files/:id/rename", handler.FileRenameHandler)
 	apiAuth.POST("/folders", handler.CreateFolderHandler)
 	apiAuth.PUT("/files/:id/move", handler.FileMoveHandler)
+	apiAuth.POST("/files/:id/copy", handler.FileCopyHandler)
+	apiAuth.GET("/files/resolve", handler.FileResolveHandler)
+	apiAuth.GET("/files/:id/breadcrumbs", handler.FileBreadcrumbsHandler)
+	apiAuth.GET("/files/:id/subtree", handler.FileSubtreeHandler)
 	apiAuth.GET("/files/search", handler.FileSearchHandler)
+	apiAuth.GET("/files/search/content", handler.FileContentSearchHandler)
+	apiAuth.POST("/files/tags", handler.FileTagHandler)
+	apiAuth.DELETE("/files/tags", handler.FileUntagHandler)
+	apiAuth.GET("/tags", handler.TagListHandler)
+	apiAuth.POST("/tags", handler.TagCreateHandler)
+	apiAuth.PUT("/tags/:id", handler.TagUpdateHandler)
+	apiAuth.DELETE("/tags/:id", handler.TagDeleteHandler)
+	apiAuth.GET("/tags/:id/files", handler.TagFilesHandler)
+	apiAuth.GET("/favorites", handler.FavoriteListHandler)
+	apiAuth.POST("/favorites", handler.FavoriteAddHandler)
+	apiAuth.DELETE("/favorites", handler.FavoriteRemoveHandler)
+	apiAuth.GET("/files/categories", handler.FileCategoriesHandler)
+	apiAuth.GET("/files/categories/:category", handler.FileCategoryFilesHandler)
+	apiAuth.GET("/files/:id/metadata", handler.FileMetadataGetHandler)
+	apiAuth.PUT("/files/:id/metadata", handler.FileMetadataSetHandler)
+	apiAuth.DELETE("/files/:id/metadata", handler.FileMetadataDeleteHandler)
+	apiAuth.GET("/saved-searches", handler.SavedSearchListHandler)
+	apiAuth.POST("/saved-searches", handler.SavedSearchCreateHandler)
+	apiAuth.GET("/saved-searches/:id", handler.SavedSearchGetHandler)
+	apiAuth.PUT("/saved-searches/:id", handler.SavedSearchUpdateHandler)
+	apiAuth.DELETE("/saved-searches/:id", handler.SavedSearchDeleteHandler)
+	apiAuth.GET("/saved-searches/:id/files", handler.SavedSearchFilesHandler)
 	apiAuth.GET("/files/preview/:id", handler.FilePreviewHandler)
 	apiAuth.POST("/files/multipart/init", handler.MultipartInitHandler)
 	apiAuth.POST("/files/multipart/upload", handler.MultipartUploadPartHandler)
@@ -355,6 +466,22 @@ func main() {
 	apiAuth.POST("/files/multipart/complete", handler.MultipartCompleteHandler)
 	apiAuth.POST("/files/multipart/refresh-token", handler.MultipartRefreshTokenHandler)
 
+	// 打包下载、压缩包解压与浏览、异步任务
+	apiAuth.GET("/files/zip", handler.FileZipDownloadHandler)
+	apiAuth.POST("/files/:id/extract", handler.FileExtractHandler)
+	apiAuth.GET("/files/:id/archive/entries", handler.FileArchiveEntriesHandler)
+	apiAuth.GET("/files/:id/archive/entry", handler.FileArchiveEntryHandler)
+	apiAuth.GET("/tasks", handler.TaskListHandler)
+	apiAuth.GET("/tasks/:id", handler.TaskGetHandler)
+
+	// 文件历史版本
+	apiAuth.GET("/files/:id/versions", handler.FileVersionListHandler)
+	apiAuth.GET("/files/:id/versions/:vid/download", handler.FileVersionDownloadHandler)
+	apiAuth.POST("/files/:id/versions/:vid/restore", handler.FileVersionRestoreHandler)
+	apiAuth.DELETE("/files/:id/versions/:vid", handler.FileVersionDeleteHandler)
+	apiAuth.GET("/user/version-policy", handler.VersionPolicyGetHandler)
+	apiAuth.PUT("/user/version-policy", handler.VersionPolicyUpdateHandler)
+
 	// 添加临时URL API
 	apiAuth.GET("/files/upload-url", handler.GetUploadURLHandler)
 	apiAuth.GET("/files/download-url/:id", handler.GetDownloadURLHandler)
@@ -364,14 +491,18 @@ func main() {
 	r.GET("/api/share/public", handler.GetPublicShareHandler)
 	r.GET("/api/share/:token", handler.AccessShareHandler)
 	r.GET("/api/share/download/:token", handler.ShareDownloadHandler)
+	r.GET("/api/share/zip/:token", handler.ShareZipDownloadHandler)
 	r.POST("/api/share/private", handler.CreatePrivateShareHandler)
 	r.GET("/api/share/private", handler.GetPrivateShareHandler)
 	r.DELETE("/api/share", handler.CancelShareHandler)
+	apiAuth.POST("/share/:token/copy", handler.ShareCopyHandler)
 
 	// 注册回收站相关API
 	apiAuth.GET("/recycle", handler.RecycleBinListHandler)
 	apiAuth.POST("/recycle/restore", handler.RecycleBinRestoreHandler)
 	apiAuth.DELETE("/recycle", handler.RecycleBinDeleteHandler)
+	apiAuth.DELETE("/recycle/all", handler.RecycleBinEmptyHandler)
+	apiAuth.POST("/recycle/bulk", handler.RecycleBinBulkHandler)
 
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
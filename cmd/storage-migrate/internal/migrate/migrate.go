@@ -0,0 +1,285 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"cloudDrive/internal/file"
+	"cloudDrive/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+// 单个对象的迁移结果
+const (
+	ResultCopied  = "copied"
+	ResultSkipped = "skipped"
+	ResultFailed  = "failed"
+)
+
+// Checkpoint 迁移进度检查点，按hash升序推进，中断后先重试Failures中的对象，再从LastHash之后继续
+// Failed 为尚未成功迁移的对象数，重试成功后相应减少
+type Checkpoint struct {
+	LastHash  string            `json:"last_hash"`
+	Copied    int64             `json:"copied"`
+	Skipped   int64             `json:"skipped"`
+	Failed    int64             `json:"failed"`
+	Failures  map[string]string `json:"failures,omitempty"` // hash -> 失败原因
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// MismatchedObject 目标存储中内容不一致的对象
+type MismatchedObject struct {
+	Hash         string `json:"hash"`
+	ExpectedSize int64  `json:"expected_size"`
+	ActualSize   int64  `json:"actual_size"`
+	ActualDigest string `json:"actual_digest"`
+}
+
+// Report 对账报告
+type Report struct {
+	Checked     int64              `json:"checked"`
+	OK          int64              `json:"ok"`
+	Missing     []string           `json:"missing"`
+	Mismatched  []MismatchedObject `json:"mismatched"`
+	Errors      map[string]string  `json:"errors,omitempty"` // hash -> 查询失败原因
+	GeneratedAt time.Time          `json:"generated_at"`
+}
+
+// Migrator 将FileContent引用的所有对象从源存储复制到目标存储
+type Migrator struct {
+	DB             *gorm.DB
+	Source         storage.Storage
+	Dest           storage.Storage
+	CheckpointPath string // 为空时不持久化进度
+	BatchSize      int
+}
+
+// LoadCheckpoint 读取检查点文件，文件不存在时返回空检查点
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	cp := &Checkpoint{Failures: map[string]string{}}
+	if path == "" {
+		return cp, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取检查点失败: %v", err)
+	}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("解析检查点失败: %v", err)
+	}
+	if cp.Failures == nil {
+		cp.Failures = map[string]string{}
+	}
+	return cp, nil
+}
+
+// saveCheckpoint 原子写入检查点文件
+func (m *Migrator) saveCheckpoint(cp *Checkpoint) error {
+	if m.CheckpointPath == "" {
+		return nil
+	}
+	cp.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.CheckpointPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("写入检查点失败: %v", err)
+	}
+	return os.Rename(tmp, m.CheckpointPath)
+}
+
+func (m *Migrator) batchSize() int {
+	if m.BatchSize <= 0 {
+		return 500
+	}
+	return m.BatchSize
+}
+
+// forEachContent 按hash升序分批遍历FileContent，从after之后开始
+func (m *Migrator) forEachContent(ctx context.Context, after string, fn func(fc file.FileContent) error) error {
+	for {
+		var batch []file.FileContent
+		err := m.DB.WithContext(ctx).Where("hash > ?", after).Order("hash").Limit(m.batchSize()).Find(&batch).Error
+		if err != nil {
+			return fmt.Errorf("查询文件内容失败: %v", err)
+		}
+		for _, fc := range batch {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(fc); err != nil {
+				return err
+			}
+		}
+		if len(batch) < m.batchSize() {
+			return nil
+		}
+		after = batch[len(batch)-1].Hash
+	}
+}
+
+// Run 执行复制，已在目标存储中且摘要一致的对象会被跳过；每批结束时保存检查点
+func (m *Migrator) Run(ctx context.Context) (*Checkpoint, error) {
+	cp, err := LoadCheckpoint(m.CheckpointPath)
+	if err != nil {
+		return nil, err
+	}
+	if cp.LastHash != "" {
+		log.Printf("从检查点继续迁移: %s", cp.LastHash)
+	}
+	// 失败的hash已在LastHash之前，继续遍历不会再遇到，先重试一遍
+	if err := m.retryFailures(ctx, cp); err != nil {
+		return cp, err
+	}
+
+	processed := 0
+	err = m.forEachContent(ctx, cp.LastHash, func(fc file.FileContent) error {
+		result, err := m.CopyObject(ctx, fc.Hash)
+		switch result {
+		case ResultCopied:
+			cp.Copied++
+			delete(cp.Failures, fc.Hash)
+		case ResultSkipped:
+			cp.Skipped++
+			delete(cp.Failures, fc.Hash)
+		default:
+			cp.Failed++
+			cp.Failures[fc.Hash] = err.Error()
+			log.Printf("迁移对象 %s 失败: %v", fc.Hash, err)
+		}
+		cp.LastHash = fc.Hash
+		processed++
+		if processed%m.batchSize() == 0 {
+			if err := m.saveCheckpoint(cp); err != nil {
+				return err
+			}
+			log.Printf("迁移进度: 复制 %d, 跳过 %d, 失败 %d", cp.Copied, cp.Skipped, cp.Failed)
+		}
+		return nil
+	})
+	if saveErr := m.saveCheckpoint(cp); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	return cp, err
+}
+
+// retryFailures 重试检查点中记录的失败对象，成功的从失败列表中移除
+func (m *Migrator) retryFailures(ctx context.Context, cp *Checkpoint) error {
+	if len(cp.Failures) == 0 {
+		return nil
+	}
+	hashes := make([]string, 0, len(cp.Failures))
+	for hash := range cp.Failures {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	log.Printf("重试上次失败的 %d 个对象", len(hashes))
+	for _, hash := range hashes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		result, err := m.CopyObject(ctx, hash)
+		switch result {
+		case ResultCopied:
+			cp.Copied++
+		case ResultSkipped:
+			cp.Skipped++
+		default:
+			cp.Failures[hash] = err.Error()
+			log.Printf("重试迁移对象 %s 失败: %v", hash, err)
+			continue
+		}
+		cp.Failed--
+		delete(cp.Failures, hash)
+	}
+	return m.saveCheckpoint(cp)
+}
+
+// CopyObject 复制单个对象并校验目标存储中的SHA-256
+func (m *Migrator) CopyObject(ctx context.Context, hash string) (string, error) {
+	if info, err := storage.StatWithDigest(ctx, m.Dest, hash); err == nil && info.Digest == hash {
+		return ResultSkipped, nil
+	}
+
+	reader, err := m.Source.Download(ctx, hash)
+	if err != nil {
+		return ResultFailed, fmt.Errorf("读取源对象失败: %v", err)
+	}
+	defer reader.Close()
+
+	h := sha256.New()
+	if err := m.Dest.Upload(ctx, hash, io.TeeReader(reader, h)); err != nil {
+		return ResultFailed, fmt.Errorf("写入目标对象失败: %v", err)
+	}
+	if sourceDigest := hex.EncodeToString(h.Sum(nil)); sourceDigest != hash {
+		_ = m.Dest.Delete(ctx, hash)
+		return ResultFailed, fmt.Errorf("源对象内容已损坏，摘要为 %s", sourceDigest)
+	}
+
+	info, err := storage.StatWithDigest(ctx, m.Dest, hash)
+	if err != nil {
+		return ResultFailed, fmt.Errorf("校验目标对象失败: %v", err)
+	}
+	if info.Digest != hash {
+		return ResultFailed, fmt.Errorf("目标对象摘要不一致: %s", info.Digest)
+	}
+	return ResultCopied, nil
+}
+
+// Reconcile 对照FileContent逐一检查目标存储，生成缺失与不一致对象的报告
+func (m *Migrator) Reconcile(ctx context.Context) (*Report, error) {
+	report := &Report{
+		Missing:    []string{},
+		Mismatched: []MismatchedObject{},
+		Errors:     map[string]string{},
+	}
+	err := m.forEachContent(ctx, "", func(fc file.FileContent) error {
+		report.Checked++
+		info, err := storage.StatWithDigest(ctx, m.Dest, fc.Hash)
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			report.Missing = append(report.Missing, fc.Hash)
+			return nil
+		}
+		if err != nil {
+			report.Errors[fc.Hash] = err.Error()
+			return nil
+		}
+		if info.Digest != fc.Hash || info.Size != fc.Size {
+			report.Mismatched = append(report.Mismatched, MismatchedObject{
+				Hash:         fc.Hash,
+				ExpectedSize: fc.Size,
+				ActualSize:   info.Size,
+				ActualDigest: info.Digest,
+			})
+			return nil
+		}
+		report.OK++
+		return nil
+	})
+	report.GeneratedAt = time.Now()
+	return report, err
+}
+
+// WriteReport 将对账报告写入文件
+func WriteReport(path string, report *Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,149 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"testing"
+
+	"cloudDrive/internal/file"
+	"cloudDrive/internal/storage"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupMigrateTest(t *testing.T, contents ...string) (*gorm.DB, *storage.LocalFileStorage, *storage.LocalFileStorage) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect database: %v", err)
+	}
+	if err := db.AutoMigrate(&file.FileContent{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	src := &storage.LocalFileStorage{Dir: t.TempDir()}
+	dst := &storage.LocalFileStorage{Dir: t.TempDir()}
+	for _, content := range contents {
+		sum := sha256.Sum256([]byte(content))
+		hash := hex.EncodeToString(sum[:])
+		if err := src.Upload(context.Background(), hash, bytes.NewReader([]byte(content))); err != nil {
+			t.Fatalf("upload failed: %v", err)
+		}
+		db.Create(&file.FileContent{Hash: hash, Size: int64(len(content))})
+	}
+	return db, src, dst
+}
+
+func TestMigrator_RunAndReconcile(t *testing.T) {
+	db, src, dst := setupMigrateTest(t, "alpha", "beta", "gamma")
+	ctx := context.Background()
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint.json")
+	m := &Migrator{DB: db, Source: src, Dest: dst, CheckpointPath: checkpoint, BatchSize: 2}
+
+	cp, err := m.Run(ctx)
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if cp.Copied != 3 || cp.Failed != 0 {
+		t.Fatalf("unexpected checkpoint: %+v", cp)
+	}
+
+	// 检查点已推进到最后一个hash，再次运行不会重复复制
+	cp, err = m.Run(ctx)
+	if err != nil {
+		t.Fatalf("rerun failed: %v", err)
+	}
+	if cp.Copied != 3 || cp.Skipped != 0 {
+		t.Errorf("resume should not copy again, got: %+v", cp)
+	}
+
+	report, err := m.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if report.Checked != 3 || report.OK != 3 || len(report.Missing) != 0 || len(report.Mismatched) != 0 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+func TestMigrator_ReconcileReportsMissingAndMismatched(t *testing.T) {
+	db, src, dst := setupMigrateTest(t, "alpha", "beta")
+	ctx := context.Background()
+	m := &Migrator{DB: db, Source: src, Dest: dst}
+
+	var contents []file.FileContent
+	db.Order("hash").Find(&contents)
+	// 第一个对象写入错误内容，第二个对象缺失
+	dst.Upload(ctx, contents[0].Hash, bytes.NewReader([]byte("corrupted")))
+
+	report, err := m.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if len(report.Mismatched) != 1 || report.Mismatched[0].Hash != contents[0].Hash {
+		t.Errorf("expected mismatched %s, got %+v", contents[0].Hash, report.Mismatched)
+	}
+	if len(report.Missing) != 1 || report.Missing[0] != contents[1].Hash {
+		t.Errorf("expected missing %s, got %+v", contents[1].Hash, report.Missing)
+	}
+
+	// 重新迁移会修复不一致的对象
+	if _, err := m.Run(ctx); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	report, _ = m.Reconcile(ctx)
+	if report.OK != 2 {
+		t.Errorf("expected all objects ok after migration, got %+v", report)
+	}
+}
+
+func TestMigrator_CopyObjectRejectsCorruptSource(t *testing.T) {
+	db, src, dst := setupMigrateTest(t)
+	ctx := context.Background()
+	sum := sha256.Sum256([]byte("original"))
+	hash := hex.EncodeToString(sum[:])
+	src.Upload(ctx, hash, bytes.NewReader([]byte("tampered")))
+	m := &Migrator{DB: db, Source: src, Dest: dst}
+
+	result, err := m.CopyObject(ctx, hash)
+	if result != ResultFailed || err == nil {
+		t.Fatalf("expected failure for corrupt source, got %s %v", result, err)
+	}
+	if ok, _ := dst.Exists(ctx, hash); ok {
+		t.Errorf("corrupt object should be removed from destination")
+	}
+}
+
+func TestMigrator_ResumeRetriesFailures(t *testing.T) {
+	db, src, dst := setupMigrateTest(t, "alpha", "beta")
+	ctx := context.Background()
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint.json")
+	failing := storage.NewFaultInjectingStorage(dst, storage.FaultConfig{
+		Enabled:    true,
+		Operations: map[string]storage.FaultRule{storage.OpUpload: {ErrorRate: 1}},
+	})
+	m := &Migrator{DB: db, Source: src, Dest: failing, CheckpointPath: checkpoint}
+	cp, err := m.Run(ctx)
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if cp.Failed != 2 || len(cp.Failures) != 2 {
+		t.Fatalf("expected 2 failures, got %+v", cp)
+	}
+
+	// 目标存储恢复后继续迁移，LastHash之前失败的对象也会被重试
+	failing.SetConfig(storage.FaultConfig{})
+	cp, err = m.Run(ctx)
+	if err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	if cp.Copied != 2 || cp.Failed != 0 || len(cp.Failures) != 0 {
+		t.Errorf("failures should be retried on resume, got %+v", cp)
+	}
+	report, _ := m.Reconcile(ctx)
+	if report.OK != 2 {
+		t.Errorf("expected all objects ok after resume, got %+v", report)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"cloudDrive/cmd/storage-migrate/internal/migrate"
+	"cloudDrive/internal/storage"
+
+	"github.com/spf13/viper"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// Config 迁移工具配置
+type Config struct {
+	Database struct {
+		User      string `mapstructure:"user"`
+		Password  string `mapstructure:"password"`
+		Host      string `mapstructure:"host"`
+		Port      int    `mapstructure:"port"`
+		Name      string `mapstructure:"name"`
+		Charset   string `mapstructure:"charset"`
+		ParseTime bool   `mapstructure:"parseTime"`
+		Loc       string `mapstructure:"loc"`
+	} `mapstructure:"database"`
+
+	Source      storage.BackendConfig `mapstructure:"source"`
+	Destination storage.BackendConfig `mapstructure:"destination"`
+
+	CheckpointFile string `mapstructure:"checkpoint_file"`
+	ReportFile     string `mapstructure:"report_file"`
+	BatchSize      int    `mapstructure:"batch_size"`
+}
+
+var (
+	configPath = flag.String("config", "configs/storage-migrate.yaml", "配置文件路径")
+	mode       = flag.String("mode", "all", "运行模式: copy 仅复制, verify 仅对账, all 复制后对账")
+	reset      = flag.Bool("reset", false, "忽略已有检查点，从头开始迁移")
+)
+
+func main() {
+	flag.Parse()
+
+	viper.SetConfigFile(*configPath)
+	if err := viper.ReadInConfig(); err != nil {
+		log.Fatalf("读取配置文件失败: %v", err)
+	}
+	var cfg Config
+	if err := viper.Unmarshal(&cfg); err != nil {
+		log.Fatalf("解析配置失败: %v", err)
+	}
+
+	parseTimeStr := "False"
+	if cfg.Database.ParseTime {
+		parseTimeStr = "True"
+	}
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&parseTime=%s&loc=%s",
+		cfg.Database.User, cfg.Database.Password, cfg.Database.Host, cfg.Database.Port,
+		cfg.Database.Name, cfg.Database.Charset, parseTimeStr, cfg.Database.Loc)
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Error),
+	})
+	if err != nil {
+		log.Fatalf("数据库连接失败: %v", err)
+	}
+
+	source, err := storage.NewBackend(cfg.Source)
+	if err != nil {
+		log.Fatalf("初始化源存储失败: %v", err)
+	}
+	dest, err := storage.NewBackend(cfg.Destination)
+	if err != nil {
+		log.Fatalf("初始化目标存储失败: %v", err)
+	}
+	log.Printf("迁移: %s -> %s", cfg.Source.Type, cfg.Destination.Type)
+
+	if *reset && cfg.CheckpointFile != "" {
+		if err := os.Remove(cfg.CheckpointFile); err != nil && !os.IsNotExist(err) {
+			log.Fatalf("删除检查点失败: %v", err)
+		}
+	}
+
+	// 收到中断信号时停止迁移，已完成的进度保存在检查点中
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	migrator := &migrate.Migrator{
+		DB:             db,
+		Source:         source,
+		Dest:           dest,
+		CheckpointPath: cfg.CheckpointFile,
+		BatchSize:      cfg.BatchSize,
+	}
+
+	if *mode == "copy" || *mode == "all" {
+		cp, err := migrator.Run(ctx)
+		if err != nil {
+			log.Fatalf("迁移中断: %v", err)
+		}
+		log.Printf("复制完成: 复制 %d, 跳过 %d, 失败 %d", cp.Copied, cp.Skipped, cp.Failed)
+	}
+
+	if *mode == "verify" || *mode == "all" {
+		report, err := migrator.Reconcile(ctx)
+		if err != nil {
+			log.Fatalf("对账中断: %v", err)
+		}
+		reportFile := cfg.ReportFile
+		if reportFile == "" {
+			reportFile = "storage-migrate-report.json"
+		}
+		if err := migrate.WriteReport(reportFile, report); err != nil {
+			log.Fatalf("写入对账报告失败: %v", err)
+		}
+		log.Printf("对账完成: 检查 %d, 一致 %d, 缺失 %d, 不一致 %d, 查询失败 %d，报告已写入 %s",
+			report.Checked, report.OK, len(report.Missing), len(report.Mismatched), len(report.Errors), reportFile)
+		if len(report.Missing) > 0 || len(report.Mismatched) > 0 || len(report.Errors) > 0 {
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,455 @@
+// Package archive 实现网盘内压缩包的解压与浏览
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"cloudDrive/internal/file"
+	"cloudDrive/internal/storage"
+	"cloudDrive/internal/user"
+
+	"gorm.io/gorm"
+)
+
+// 支持的压缩包格式
+const (
+	FormatZip   = "zip"
+	FormatTar   = "tar"
+	FormatTarGz = "tar.gz"
+)
+
+var ErrUnsupportedFormat = errors.New("不支持的压缩包格式，仅支持zip、tar、tar.gz")
+var ErrUnsafePath = errors.New("压缩包包含不安全的路径")
+var ErrTooManyEntries = errors.New("压缩包条目数超过限制")
+var ErrTooLarge = errors.New("压缩包解压后大小超过限制")
+var ErrSuspiciousRatio = errors.New("压缩包压缩率异常，疑似压缩炸弹")
+var ErrSizeMismatch = errors.New("压缩包条目实际大小与声明不符")
+var ErrQuotaExceeded = errors.New("存储空间不足")
+var ErrTargetNotFolder = errors.New("目标目录不存在")
+
+// Limits 解压限制，防止压缩炸弹
+// MaxRatio 为单个条目解压后与压缩后大小之比的上限，只对超过 ratioCheckMinSize 的条目生效
+type Limits struct {
+	MaxEntries   int   `mapstructure:"max_entries"`
+	MaxTotalSize int64 `mapstructure:"max_total_size"`
+	MaxEntrySize int64 `mapstructure:"max_entry_size"`
+	MaxRatio     int64 `mapstructure:"max_ratio"`
+}
+
+// DefaultLimits 默认解压限制，可在启动时由配置覆盖
+var DefaultLimits = Limits{
+	MaxEntries:   10000,
+	MaxTotalSize: 10 << 30,
+	MaxEntrySize: 4 << 30,
+	MaxRatio:     200,
+}
+
+const ratioCheckMinSize = 1 << 20
+
+// Entry 压缩包中的一项，Path 已经过安全校验
+type Entry struct {
+	Path           string
+	IsDir          bool
+	Size           int64
+	CompressedSize int64 // 仅zip可知，0表示未知
+}
+
+// Progress 解压进度上报，单位为字节
+type Progress interface {
+	SetTotal(total int64)
+	Add(n int64)
+}
+
+// Options 解压参数
+type Options struct {
+	ArchiveID      string
+	TargetParentID string // 为空时解压到压缩包所在目录
+	OwnerID        uint
+	Limits         Limits
+}
+
+// Result 解压结果
+type Result struct {
+	TargetID string `json:"target_id"`
+	Folders  int    `json:"folders"`
+	Files    int    `json:"files"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// DetectFormat 根据文件名判断压缩包格式
+func DetectFormat(name string) (string, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return FormatZip, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return FormatTarGz, nil
+	case strings.HasSuffix(lower, ".tar"):
+		return FormatTar, nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// SanitizePath 规范化压缩包内的路径，拒绝绝对路径和跳出解压目录的路径（zip-slip）
+// 返回空串表示该条目无需处理（如 "./"）
+func SanitizePath(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.ContainsRune(name, 0) || strings.HasPrefix(name, "/") ||
+		(len(name) >= 2 && name[1] == ':') {
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	var parts []string
+	for _, p := range strings.Split(name, "/") {
+		switch p {
+		case "", ".":
+			continue
+		case "..":
+			return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+		}
+		parts = append(parts, p)
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// Validate 校验压缩包文件归属和格式，用于提交任务前快速失败
+func Validate(db *gorm.DB, archiveID string, ownerID uint) (*file.File, string, error) {
+	var f file.File
+	if err := db.First(&f, "id = ?", archiveID).Error; err != nil {
+		return nil, "", err
+	}
+	if f.OwnerID != ownerID {
+		return nil, "", file.ErrNoPermission
+	}
+	if f.Type != "file" {
+		return nil, "", file.ErrNotAFile
+	}
+	format, err := DetectFormat(f.Name)
+	if err != nil {
+		return nil, "", err
+	}
+	return &f, format, nil
+}
+
+// lazyReader 首次读取时才打开zip条目，扫描阶段无需解压
+type lazyReader struct {
+	open func() (io.ReadCloser, error)
+	rc   io.ReadCloser
+	err  error
+}
+
+func (l *lazyReader) Read(p []byte) (int, error) {
+	if l.rc == nil && l.err == nil {
+		l.rc, l.err = l.open()
+	}
+	if l.err != nil {
+		return 0, l.err
+	}
+	return l.rc.Read(p)
+}
+
+func (l *lazyReader) Close() {
+	if l.rc != nil {
+		l.rc.Close()
+	}
+}
+
+// Walk 依次遍历压缩包中的目录和普通文件，符号链接等特殊条目被忽略
+func Walk(f *os.File, size int64, format string, fn func(e Entry, r io.Reader) error) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if format == FormatZip {
+		zr, err := zip.NewReader(f, size)
+		if err != nil {
+			return fmt.Errorf("读取zip失败: %w", err)
+		}
+		for _, zf := range zr.File {
+			mode := zf.Mode()
+			if !mode.IsDir() && !mode.IsRegular() {
+				continue
+			}
+			p, err := SanitizePath(zf.Name)
+			if err != nil {
+				return err
+			}
+			if p == "" {
+				continue
+			}
+			lr := &lazyReader{open: zf.Open}
+			err = fn(Entry{
+				Path:           p,
+				IsDir:          mode.IsDir(),
+				Size:           int64(zf.UncompressedSize64),
+				CompressedSize: int64(zf.CompressedSize64),
+			}, lr)
+			lr.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var r io.Reader = f
+	if format == FormatTarGz {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("读取gzip失败: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("读取tar失败: %w", err)
+		}
+		mode := h.FileInfo().Mode()
+		if !mode.IsDir() && !mode.IsRegular() {
+			continue
+		}
+		p, err := SanitizePath(h.Name)
+		if err != nil {
+			return err
+		}
+		if p == "" {
+			continue
+		}
+		if err := fn(Entry{Path: p, IsDir: mode.IsDir(), Size: h.Size}, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// plannedFile 已写入存储、等待提交到数据库的文件
+type plannedFile struct {
+	path     string
+	hash     string
+	size     int64
+	mimeType string // 新写入存储的内容按文件头检测的类型，已有的内容为空
+}
+
+// Extract 将压缩包解压到网盘目录
+// 先扫描全部条目检查数量、大小、压缩率和配额，再逐个计算SHA-256写入存储（已存在的内容直接复用），
+// 最后在一个事务中建立目录、文件记录并扣减配额；提交失败时删除本次新写入的对象
+func Extract(ctx context.Context, db *gorm.DB, stor storage.Storage, opts Options, progress Progress) (*Result, error) {
+	arc, format, err := Validate(db, opts.ArchiveID, opts.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	targetID := opts.TargetParentID
+	if targetID == "" {
+		targetID = arc.ParentID
+	} else {
+		var target file.File
+		if err := db.First(&target, "id = ? AND owner_id = ? AND type = ?", targetID, opts.OwnerID, "folder").Error; err != nil {
+			return nil, ErrTargetNotFolder
+		}
+	}
+	limits := opts.Limits
+	if limits == (Limits{}) {
+		limits = DefaultLimits
+	}
+
+	// 下载压缩包到临时文件，zip需要随机读取，且需要扫描和解压两遍
+	tmp, err := os.CreateTemp("", "extract-archive-*")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	rc, err := stor.Download(ctx, arc.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("读取压缩包失败: %w", err)
+	}
+	archiveSize, err := io.Copy(tmp, rc)
+	rc.Close()
+	if err != nil {
+		return nil, fmt.Errorf("读取压缩包失败: %w", err)
+	}
+
+	// 第一遍：只读取条目信息，检查限制
+	var count int
+	var total int64
+	err = Walk(tmp, archiveSize, format, func(e Entry, _ io.Reader) error {
+		count++
+		if count > limits.MaxEntries {
+			return ErrTooManyEntries
+		}
+		if e.IsDir {
+			return nil
+		}
+		if e.Size < 0 || e.Size > limits.MaxEntrySize {
+			return fmt.Errorf("%w: %s", ErrTooLarge, e.Path)
+		}
+		if e.CompressedSize > 0 && e.Size > ratioCheckMinSize && e.Size/e.CompressedSize > limits.MaxRatio {
+			return fmt.Errorf("%w: %s", ErrSuspiciousRatio, e.Path)
+		}
+		total += e.Size
+		if total > limits.MaxTotalSize {
+			return ErrTooLarge
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if format == FormatTarGz && archiveSize > 0 && total > ratioCheckMinSize && total/archiveSize > limits.MaxRatio {
+		return nil, ErrSuspiciousRatio
+	}
+	if err := checkQuota(db, opts.OwnerID, total); err != nil {
+		return nil, err
+	}
+	progress.SetTotal(total)
+
+	// 第二遍：计算hash并写入存储
+	var dirs []string
+	var files []plannedFile
+	seen := map[string]bool{}
+	// 失败时只删除没有记录引用、也没有其他请求正在写入的对象，期间其他上传或解压可能写入了相同内容
+	blobs := file.NewBlobReservation(db)
+	cleanup := func() {
+		blobs.Release(stor, blobs.Hashes())
+	}
+	entryTmp, err := os.CreateTemp("", "extract-entry-*")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer os.Remove(entryTmp.Name())
+	defer entryTmp.Close()
+
+	err = Walk(tmp, archiveSize, format, func(e Entry, r io.Reader) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if e.IsDir {
+			dirs = append(dirs, e.Path)
+			return nil
+		}
+		hash, mimeType, err := storeEntry(ctx, db, stor, entryTmp, e, r, seen, blobs)
+		if err != nil {
+			return err
+		}
+		files = append(files, plannedFile{path: e.Path, hash: hash, size: e.Size, mimeType: mimeType})
+		progress.Add(e.Size)
+		return nil
+	})
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	result := &Result{TargetID: targetID, Files: len(files), Bytes: total}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := checkQuota(tx, opts.OwnerID, total); err != nil {
+			return err
+		}
+		folders := file.NewFolderTree(tx, targetID, opts.OwnerID)
+		for _, d := range dirs {
+			if _, err := folders.Ensure(d); err != nil {
+				return err
+			}
+		}
+		for _, pf := range files {
+			parentID, err := folders.Ensure(path.Dir(pf.path))
+			if err != nil {
+				return err
+			}
+			content := file.FileContent{Hash: pf.hash, Size: pf.size}
+			content.SetMimeType(pf.mimeType)
+			if err := tx.FirstOrCreate(&content, "hash = ?", pf.hash).Error; err != nil {
+				return err
+			}
+			name, err := file.AvailableName(tx, parentID, path.Base(pf.path), opts.OwnerID)
+			if err != nil {
+				return err
+			}
+			if err := tx.Create(&file.File{
+				Name:       name,
+				Hash:       pf.hash,
+				Type:       "file",
+				ParentID:   parentID,
+				OwnerID:    opts.OwnerID,
+				UploadTime: time.Now(),
+			}).Error; err != nil {
+				return err
+			}
+		}
+		result.Folders = folders.Created
+		return user.UpdateUserStorageUsed(tx, opts.OwnerID, total)
+	})
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	blobs.Release(stor, nil)
+	return result, nil
+}
+
+// storeEntry 将条目内容写入临时文件并计算SHA-256，内容不存在时登记到 blobs 后写入存储并按文件头检测 MIME 类型
+func storeEntry(ctx context.Context, db *gorm.DB, stor storage.Storage, tmp *os.File, e Entry, r io.Reader, seen map[string]bool, blobs *file.BlobReservation) (hash, mimeType string, err error) {
+	if err := tmp.Truncate(0); err != nil {
+		return "", "", err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", "", err
+	}
+	h := sha256.New()
+	// 多读1字节，用于发现实际内容超过声明大小的条目
+	n, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(r, e.Size+1))
+	if err != nil {
+		return "", "", fmt.Errorf("解压 %s 失败: %w", e.Path, err)
+	}
+	if n != e.Size {
+		return "", "", fmt.Errorf("%w: %s", ErrSizeMismatch, e.Path)
+	}
+	hash = hex.EncodeToString(h.Sum(nil))
+	if seen[hash] {
+		return hash, "", nil
+	}
+	seen[hash] = true
+	var count int64
+	if err := db.Model(&file.FileContent{}).Where("hash = ?", hash).Count(&count).Error; err != nil {
+		return "", "", err
+	}
+	if count > 0 {
+		return hash, "", nil
+	}
+	if mimeType, err = file.SniffMimeType(io.NewSectionReader(tmp, 0, n)); err != nil {
+		return "", "", err
+	}
+	if err := blobs.Reserve(hash); err != nil {
+		return "", "", err
+	}
+	if err := stor.Upload(ctx, hash, io.NewSectionReader(tmp, 0, n)); err != nil {
+		return "", "", fmt.Errorf("保存 %s 失败: %w", e.Path, err)
+	}
+	return hash, mimeType, nil
+}
+
+func checkQuota(db *gorm.DB, ownerID uint, size int64) error {
+	u, err := user.GetUserByID(db, ownerID)
+	if err != nil {
+		return err
+	}
+	if u.StorageUsed+size > u.StorageLimit {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
@@ -0,0 +1,336 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"cloudDrive/internal/file"
+	"cloudDrive/internal/storage"
+	"cloudDrive/internal/user"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type testEntry struct {
+	name    string
+	content string
+	dir     bool
+}
+
+func buildZip(t *testing.T, entries []testEntry) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		if err != nil {
+			t.Fatalf("create zip entry: %v", err)
+		}
+		w.Write([]byte(e.content))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func buildTar(t *testing.T, entries []testEntry, compress bool) []byte {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	gz := gzip.NewWriter(&buf)
+	if compress {
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		h := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.content)), Typeflag: tar.TypeReg}
+		if e.dir {
+			h = &tar.Header{Name: e.name, Mode: 0755, Typeflag: tar.TypeDir}
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatalf("write tar header: %v", err)
+		}
+		tw.Write([]byte(e.content))
+	}
+	tw.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"})
+	tw.Close()
+	if compress {
+		gz.Close()
+	}
+	return buf.Bytes()
+}
+
+func sha(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+type countingProgress struct {
+	total, done int64
+}
+
+func (p *countingProgress) SetTotal(total int64) { p.total = total }
+func (p *countingProgress) Add(n int64)          { p.done += n }
+
+// setupExtract 创建用户、根目录，并把压缩包以 name 上传到根目录
+func setupExtract(t *testing.T, name string, data []byte, limit int64) (*gorm.DB, *storage.MemoryStorage, *file.File) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect database: %v", err)
+	}
+	if err := db.AutoMigrate(&file.File{}, &file.FileAncestor{}, &file.FileNameToken{}, &file.Tag{}, &file.FileTag{}, &file.Favorite{}, &file.FileMeta{}, &file.FileContent{}, &file.UserRoot{}, &user.User{}, &file.PendingBlob{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	stor := storage.NewMemoryStorage()
+	db.Create(&user.User{ID: 1, Username: "u", StorageLimit: limit, StorageUsed: int64(len(data))})
+	db.Create(&file.File{ID: "root", Name: "root", Type: "folder", OwnerID: 1, UploadTime: time.Now()})
+	db.Create(&file.UserRoot{UserID: 1, RootID: "root", CreatedAt: time.Now()})
+	hash := sha(string(data))
+	stor.Upload(context.Background(), hash, bytes.NewReader(data))
+	db.Create(&file.FileContent{Hash: hash, Size: int64(len(data))})
+	arc := &file.File{Name: name, Hash: hash, Type: "file", ParentID: "root", OwnerID: 1, UploadTime: time.Now()}
+	db.Create(arc)
+	return db, stor, arc
+}
+
+func findPath(t *testing.T, db *gorm.DB, parentID string, names ...string) file.File {
+	t.Helper()
+	var f file.File
+	for _, name := range names {
+		f = file.File{}
+		if err := db.Where("parent_id = ? AND name = ?", parentID, name).First(&f).Error; err != nil {
+			t.Fatalf("未找到 %s: %v", name, err)
+		}
+		parentID = f.ID
+	}
+	return f
+}
+
+func usedStorage(db *gorm.DB) int64 {
+	var u user.User
+	db.First(&u, 1)
+	return u.StorageUsed
+}
+
+func TestSanitizePath(t *testing.T) {
+	cases := map[string]string{
+		"a/b.txt":       "a/b.txt",
+		"./a//b.txt":    "a/b.txt",
+		"dir\\file.txt": "dir/file.txt",
+		"./":            "",
+	}
+	for in, want := range cases {
+		got, err := SanitizePath(in)
+		if err != nil || got != want {
+			t.Errorf("SanitizePath(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"../evil", "a/../../evil", "/etc/passwd", "C:\\windows", "..\\evil", "a\x00b"} {
+		if _, err := SanitizePath(in); !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("SanitizePath(%q) should be rejected, got %v", in, err)
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	for name, want := range map[string]string{"a.ZIP": FormatZip, "a.tar": FormatTar, "a.tar.gz": FormatTarGz, "a.tgz": FormatTarGz} {
+		if got, err := DetectFormat(name); err != nil || got != want {
+			t.Errorf("DetectFormat(%q) = %q, %v", name, got, err)
+		}
+	}
+	if _, err := DetectFormat("a.rar"); err != ErrUnsupportedFormat {
+		t.Errorf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+func TestExtract_Zip(t *testing.T) {
+	data := buildZip(t, []testEntry{
+		{name: "docs/"},
+		{name: "docs/readme.txt", content: "hello"},
+		{name: "docs/sub/deep.txt", content: "deep"}, // 目录项缺失，需自动创建
+		{name: "copy.txt", content: "hello"},         // 与 readme.txt 内容相同
+		{name: "existing.txt", content: "new"},
+	})
+	db, stor, arc := setupExtract(t, "bundle.zip", data, 1<<20)
+	// 目标目录中已有同名文件和同名文件夹
+	db.Create(&file.File{Name: "existing.txt", Hash: "x", Type: "file", ParentID: "root", OwnerID: 1, UploadTime: time.Now()})
+	docs, _ := file.CreateFolder(db, "docs", "root", 1)
+	before := usedStorage(db)
+
+	progress := &countingProgress{}
+	result, err := Extract(context.Background(), db, stor, Options{ArchiveID: arc.ID, OwnerID: 1}, progress)
+	if err != nil {
+		t.Fatalf("extract failed: %v", err)
+	}
+	if result.Files != 4 || result.Folders != 1 || result.Bytes != 17 || result.TargetID != "root" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if progress.total != 17 || progress.done != 17 {
+		t.Errorf("unexpected progress: %+v", progress)
+	}
+
+	if f := findPath(t, db, "root", "docs"); f.ID != docs.ID {
+		t.Errorf("existing folder should be reused")
+	}
+	deep := findPath(t, db, "root", "docs", "sub", "deep.txt")
+	if deep.Hash != sha("deep") {
+		t.Errorf("unexpected hash for deep.txt")
+	}
+	findPath(t, db, "root", "existing (1).txt")
+
+	var contentCount int64
+	db.Model(&file.FileContent{}).Where("hash = ?", sha("hello")).Count(&contentCount)
+	if contentCount != 1 {
+		t.Errorf("duplicate content should be stored once, got %d", contentCount)
+	}
+	if ok, _ := stor.Exists(context.Background(), sha("hello")); !ok {
+		t.Errorf("content should be uploaded to storage")
+	}
+	var hello file.FileContent
+	db.First(&hello, "hash = ?", sha("hello"))
+	if hello.MimeType != "text/plain; charset=utf-8" {
+		t.Errorf("mime type should be detected from content, got %q", hello.MimeType)
+	}
+	if used := usedStorage(db); used != before+17 {
+		t.Errorf("quota should grow by 17, got %d", used-before)
+	}
+}
+
+func TestExtract_TarGz(t *testing.T) {
+	data := buildTar(t, []testEntry{
+		{name: "./photos/", dir: true},
+		{name: "./photos/a.jpg", content: "jpeg"},
+	}, true)
+	db, stor, arc := setupExtract(t, "photos.tgz", data, 1<<20)
+	db.Create(&file.File{ID: "target", Name: "target", Type: "folder", ParentID: "root", OwnerID: 1, UploadTime: time.Now()})
+
+	result, err := Extract(context.Background(), db, stor, Options{ArchiveID: arc.ID, TargetParentID: "target", OwnerID: 1}, &countingProgress{})
+	if err != nil {
+		t.Fatalf("extract failed: %v", err)
+	}
+	if result.Files != 1 {
+		t.Errorf("symlink should be skipped, got %+v", result)
+	}
+	findPath(t, db, "target", "photos", "a.jpg")
+
+	_, err = Extract(context.Background(), db, stor, Options{ArchiveID: arc.ID, TargetParentID: "missing", OwnerID: 1}, &countingProgress{})
+	if err != ErrTargetNotFolder {
+		t.Errorf("expected ErrTargetNotFolder, got %v", err)
+	}
+}
+
+func TestExtract_Rejected(t *testing.T) {
+	zeros := make([]byte, 8<<20)
+	cases := []struct {
+		name    string
+		entries []testEntry
+		limit   int64
+		limits  Limits
+		want    error
+	}{
+		{
+			name:    "zip-slip",
+			entries: []testEntry{{name: "ok.txt", content: "ok"}, {name: "../../evil.sh", content: "rm -rf"}},
+			limit:   1 << 20,
+			want:    ErrUnsafePath,
+		},
+		{
+			name:    "条目过多",
+			entries: []testEntry{{name: "a", content: "1"}, {name: "b", content: "2"}, {name: "c", content: "3"}},
+			limit:   1 << 20,
+			limits:  Limits{MaxEntries: 2, MaxTotalSize: 1 << 20, MaxEntrySize: 1 << 20, MaxRatio: 200},
+			want:    ErrTooManyEntries,
+		},
+		{
+			name:    "压缩炸弹",
+			entries: []testEntry{{name: "zeros.bin", content: string(zeros)}},
+			limit:   1 << 30,
+			want:    ErrSuspiciousRatio,
+		},
+		{
+			name:    "解压后过大",
+			entries: []testEntry{{name: "a", content: "12345"}, {name: "b", content: "67890"}},
+			limit:   1 << 20,
+			limits:  Limits{MaxEntries: 10, MaxTotalSize: 8, MaxEntrySize: 8, MaxRatio: 200},
+			want:    ErrTooLarge,
+		},
+		{
+			name:    "配额不足",
+			entries: []testEntry{{name: "a", content: "1234567890"}},
+			limit:   100,
+			want:    ErrQuotaExceeded,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, stor, arc := setupExtract(t, "a.zip", buildZip(t, tc.entries), tc.limit)
+			before := usedStorage(db)
+			_, err := Extract(context.Background(), db, stor, Options{ArchiveID: arc.ID, OwnerID: 1, Limits: tc.limits}, &countingProgress{})
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, err)
+			}
+			var count int64
+			db.Model(&file.File{}).Count(&count)
+			if count != 2 {
+				t.Errorf("nothing should be committed, got %d files", count)
+			}
+			if usedStorage(db) != before {
+				t.Errorf("quota should not change")
+			}
+			page, _ := stor.List(context.Background(), "", "", 0)
+			if len(page.Objects) != 1 {
+				t.Errorf("no objects should be left in storage, got %d", len(page.Objects))
+			}
+		})
+	}
+}
+
+func TestExtract_CommitFailureRemovesUploadedContent(t *testing.T) {
+	db, stor, arc := setupExtract(t, "a.zip", buildZip(t, []testEntry{{name: "a.txt", content: "fresh"}}), 1<<20)
+	db.Callback().Create().Before("gorm:create").Register("fail_files", func(tx *gorm.DB) {
+		if tx.Statement.Table == "files" {
+			tx.AddError(errors.New("injected"))
+		}
+	})
+	if _, err := Extract(context.Background(), db, stor, Options{ArchiveID: arc.ID, OwnerID: 1}, &countingProgress{}); err == nil {
+		t.Fatalf("expected commit failure")
+	}
+	if ok, _ := stor.Exists(context.Background(), sha("fresh")); ok {
+		t.Errorf("uploaded content should be removed after rollback")
+	}
+}
+
+// committingProgress 在解压过程中模拟其他请求提交了相同内容
+type committingProgress struct {
+	countingProgress
+	db   *gorm.DB
+	hash string
+}
+
+func (p *committingProgress) Add(n int64) {
+	p.countingProgress.Add(n)
+	p.db.Create(&file.FileContent{Hash: p.hash, Size: n})
+}
+
+func TestExtract_CommitFailureKeepsContentCommittedElsewhere(t *testing.T) {
+	db, stor, arc := setupExtract(t, "a.zip", buildZip(t, []testEntry{{name: "a.txt", content: "shared"}}), 1<<20)
+	db.Callback().Create().Before("gorm:create").Register("fail_files", func(tx *gorm.DB) {
+		if tx.Statement.Table == "files" {
+			tx.AddError(errors.New("injected"))
+		}
+	})
+	progress := &committingProgress{db: db, hash: sha("shared")}
+	if _, err := Extract(context.Background(), db, stor, Options{ArchiveID: arc.ID, OwnerID: 1}, progress); err == nil {
+		t.Fatalf("expected commit failure")
+	}
+	if ok, _ := stor.Exists(context.Background(), sha("shared")); !ok {
+		t.Errorf("content referenced by another commit must not be removed")
+	}
+}
@@ -0,0 +1,190 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"cloudDrive/internal/storage"
+)
+
+var ErrEntryNotFound = errors.New("压缩包中不存在该条目")
+
+// IndexEntry 压缩包目录中的一项
+// Ordinal 为zip中央目录中的序号，Offset 为tar条目数据在（解压后的）tar流中的偏移，用于定位条目内容
+type IndexEntry struct {
+	Path    string    `json:"path"`
+	IsDir   bool      `json:"is_dir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Ordinal int       `json:"ordinal,omitempty"`
+	Offset  int64     `json:"offset,omitempty"`
+}
+
+// Index 压缩包目录，内容只与压缩包内容和格式有关，可按内容hash缓存
+type Index struct {
+	Format  string       `json:"format"`
+	Entries []IndexEntry `json:"entries"`
+}
+
+// Find 按路径查找条目
+func (idx *Index) Find(p string) (*IndexEntry, error) {
+	p, err := SanitizePath(p)
+	if err != nil || p == "" {
+		return nil, ErrEntryNotFound
+	}
+	for i := range idx.Entries {
+		if idx.Entries[i].Path == p {
+			return &idx.Entries[i], nil
+		}
+	}
+	return nil, ErrEntryNotFound
+}
+
+// BuildIndex 读取压缩包目录，不下载整个压缩包：
+// zip 通过范围读取只读取中央目录；tar 逐个读取条目头，跳过条目数据；
+// tar.gz 无法随机访问，需要顺序解压整个压缩包
+// 路径不安全的条目和符号链接等特殊条目不出现在目录中
+func BuildIndex(ctx context.Context, stor storage.Storage, hash string, size int64, format string, maxEntries int) (*Index, error) {
+	idx := &Index{Format: format, Entries: []IndexEntry{}}
+	add := func(e IndexEntry) error {
+		if len(idx.Entries) >= maxEntries {
+			return ErrTooManyEntries
+		}
+		idx.Entries = append(idx.Entries, e)
+		return nil
+	}
+
+	if format == FormatZip {
+		zr, err := zip.NewReader(storage.NewReaderAt(ctx, stor, hash, size), size)
+		if err != nil {
+			return nil, fmt.Errorf("读取zip失败: %w", err)
+		}
+		for i, zf := range zr.File {
+			mode := zf.Mode()
+			p, err := SanitizePath(zf.Name)
+			if (!mode.IsDir() && !mode.IsRegular()) || err != nil || p == "" {
+				continue
+			}
+			if err := add(IndexEntry{
+				Path:    p,
+				IsDir:   mode.IsDir(),
+				Size:    int64(zf.UncompressedSize64),
+				ModTime: zf.Modified,
+				Ordinal: i,
+			}); err != nil {
+				return nil, err
+			}
+		}
+		return idx, nil
+	}
+
+	var r io.Reader
+	var pos func() int64
+	if format == FormatTar {
+		// SectionReader 实现了 io.Seeker，tar 跳过条目数据时不会读取其内容
+		sr := io.NewSectionReader(storage.NewReaderAt(ctx, stor, hash, size), 0, size)
+		r = sr
+		pos = func() int64 {
+			off, _ := sr.Seek(0, io.SeekCurrent)
+			return off
+		}
+	} else {
+		rc, err := stor.Download(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		gz, err := gzip.NewReader(rc)
+		if err != nil {
+			return nil, fmt.Errorf("读取gzip失败: %w", err)
+		}
+		defer gz.Close()
+		cr := &countingReader{r: gz}
+		r = cr
+		pos = func() int64 { return cr.n }
+	}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return idx, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取tar失败: %w", err)
+		}
+		mode := h.FileInfo().Mode()
+		p, err := SanitizePath(h.Name)
+		if (!mode.IsDir() && !mode.IsRegular()) || h.Typeflag == tar.TypeGNUSparse || err != nil || p == "" {
+			continue
+		}
+		if err := add(IndexEntry{
+			Path:    p,
+			IsDir:   mode.IsDir(),
+			Size:    h.Size,
+			ModTime: h.ModTime,
+			Offset:  pos(),
+		}); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// countingReader 统计已读取的字节数
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// OpenEntry 打开压缩包中的单个文件条目
+// zip 重新读取中央目录后只读取该条目的数据；tar 直接按偏移范围读取；tar.gz 需要顺序解压到该条目
+func OpenEntry(ctx context.Context, stor storage.Storage, hash string, size int64, format string, e *IndexEntry) (io.ReadCloser, error) {
+	if e.IsDir {
+		return nil, ErrEntryNotFound
+	}
+	switch format {
+	case FormatZip:
+		zr, err := zip.NewReader(storage.NewReaderAt(ctx, stor, hash, size), size)
+		if err != nil {
+			return nil, fmt.Errorf("读取zip失败: %w", err)
+		}
+		if e.Ordinal >= len(zr.File) {
+			return nil, ErrEntryNotFound
+		}
+		zf := zr.File[e.Ordinal]
+		if p, _ := SanitizePath(zf.Name); p != e.Path {
+			return nil, ErrEntryNotFound
+		}
+		return zf.Open()
+	case FormatTar:
+		return storage.DownloadRange(ctx, stor, hash, e.Offset, e.Size)
+	}
+	rc, err := stor.Download(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(rc)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("读取gzip失败: %w", err)
+	}
+	if _, err := io.CopyN(io.Discard, gz, e.Offset); err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("读取gzip失败: %w", err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(gz, e.Size), rc}, nil
+}
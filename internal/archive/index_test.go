@@ -0,0 +1,135 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"sync"
+	"testing"
+
+	"cloudDrive/internal/storage"
+)
+
+// meteredStorage 统计范围读取的字节数和完整下载次数
+type meteredStorage struct {
+	*storage.MemoryStorage
+	mu         sync.Mutex
+	rangeBytes int64
+	downloads  int
+}
+
+func (m *meteredStorage) Download(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	m.downloads++
+	m.mu.Unlock()
+	return m.MemoryStorage.Download(ctx, fileID)
+}
+
+func (m *meteredStorage) DownloadRange(ctx context.Context, fileID string, offset, length int64) (io.ReadCloser, error) {
+	rc, err := m.MemoryStorage.DownloadRange(ctx, fileID, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	data, _ := io.ReadAll(rc)
+	m.mu.Lock()
+	m.rangeBytes += int64(len(data))
+	m.mu.Unlock()
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *meteredStorage) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rangeBytes, m.downloads = 0, 0
+}
+
+func randomContent(t *testing.T, n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestBuildIndexAndOpenEntry(t *testing.T) {
+	big := randomContent(t, 2<<20)
+	entries := []testEntry{
+		{name: "big.bin", content: big},
+		{name: "docs/", dir: true},
+		{name: "docs/readme.txt", content: "hello archive"},
+		{name: "../evil.txt", content: "skipped"},
+	}
+
+	for _, tc := range []struct {
+		format string
+		data   []byte
+	}{
+		{FormatZip, buildZip(t, entries)},
+		{FormatTar, buildTar(t, entries, false)},
+		{FormatTarGz, buildTar(t, entries, true)},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			ctx := context.Background()
+			stor := &meteredStorage{MemoryStorage: storage.NewMemoryStorage()}
+			hash := sha(string(tc.data))
+			stor.Upload(ctx, hash, bytes.NewReader(tc.data))
+			size := int64(len(tc.data))
+
+			idx, err := BuildIndex(ctx, stor, hash, size, tc.format, 100)
+			if err != nil {
+				t.Fatalf("build index: %v", err)
+			}
+			var paths []string
+			for _, e := range idx.Entries {
+				paths = append(paths, e.Path)
+			}
+			if len(paths) != 3 || paths[0] != "big.bin" || paths[1] != "docs" || paths[2] != "docs/readme.txt" {
+				t.Fatalf("unexpected entries: %v", paths)
+			}
+			if !idx.Entries[1].IsDir || idx.Entries[0].Size != int64(len(big)) {
+				t.Errorf("unexpected entry info: %+v", idx.Entries)
+			}
+			if tc.format != FormatTarGz {
+				if stor.downloads != 0 || stor.rangeBytes > size/4 {
+					t.Errorf("listing should only read a small part, downloads=%d rangeBytes=%d size=%d",
+						stor.downloads, stor.rangeBytes, size)
+				}
+			}
+
+			for _, p := range []string{"docs/readme.txt", "./big.bin"} {
+				stor.reset()
+				e, err := idx.Find(p)
+				if err != nil {
+					t.Fatalf("find %s: %v", p, err)
+				}
+				rc, err := OpenEntry(ctx, stor, hash, size, tc.format, e)
+				if err != nil {
+					t.Fatalf("open %s: %v", p, err)
+				}
+				got, err := io.ReadAll(rc)
+				rc.Close()
+				if err != nil {
+					t.Fatalf("read %s: %v", p, err)
+				}
+				want := "hello archive"
+				if e.Path == "big.bin" {
+					want = big
+				}
+				if string(got) != want {
+					t.Errorf("unexpected content for %s", p)
+				}
+				if tc.format != FormatTarGz && e.Path == "docs/readme.txt" && (stor.downloads != 0 || stor.rangeBytes > size/4) {
+					t.Errorf("reading a small entry should not read the whole archive, rangeBytes=%d", stor.rangeBytes)
+				}
+			}
+
+			if _, err := idx.Find("missing.txt"); err != ErrEntryNotFound {
+				t.Errorf("expected ErrEntryNotFound, got %v", err)
+			}
+			if _, err := BuildIndex(ctx, stor, hash, size, tc.format, 2); err != ErrTooManyEntries {
+				t.Errorf("expected ErrTooManyEntries, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+// Package cache 统一管理 Redis 缓存的键、失效和回源
+//
+// 文件列表的键中嵌入用户和目录的代数计数器，变更时递增计数器，旧键不再被访问并随过期时间自然淘汰，
+// 失效操作为 O(1)，不再需要 KEYS 扫描；回源时同一进程内合并相同键的并发请求，
+// 多实例之间通过 Redis 短锁保证同一时刻只有一个实例回源，其余实例等待结果写入
+package cache
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 各类缓存的过期时间
+const (
+	FileListTTL     = 5 * time.Minute
+	FileMetaTTL     = 5 * time.Minute
+	UserInfoTTL     = time.Hour
+	ArchiveIndexTTL = 24 * time.Hour // 压缩包目录按内容hash缓存，内容不变则目录不变
+)
+
+// generationTTL 代数计数器的过期时间，每次递增时刷新；需远大于 FileListTTL，
+// 计数器过期归零时使用旧代数的列表缓存早已过期，不会被重新命中
+const generationTTL = 7 * 24 * time.Hour
+
+// 回源锁参数，测试中可调小
+var (
+	fillLockTTL  = 5 * time.Second        // 回源锁的最长持有时间，防止持锁实例异常退出后永久阻塞
+	fillWait     = 500 * time.Millisecond // 未抢到锁时等待其他实例写入结果的最长时间，超时后自行回源
+	fillInterval = 20 * time.Millisecond  // 等待期间轮询缓存的间隔
+)
+
+// Client 缓存用到的 Redis 命令，*redis.Client 满足该接口，测试中可替换为内存实现
+type Client interface {
+	Get(ctx context.Context, key string) *redis.StringCmd
+	MGet(ctx context.Context, keys ...string) *redis.SliceCmd
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	Incr(ctx context.Context, key string) *redis.IntCmd
+	Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd
+}
+
+// UserInfoKey 用户信息（含存储空间）缓存的键
+func UserInfoKey(userID uint) string {
+	return fmt.Sprintf("user:info:%d", userID)
+}
+
+// FileMetaKey 文件元数据缓存的键
+func FileMetaKey(fileID string) string {
+	return "filemeta:" + fileID
+}
+
+// ShareKey 分享信息缓存的键
+func ShareKey(token string) string {
+	return "share:" + token
+}
+
+// ArchiveIndexKey 压缩包目录缓存的键，同一内容按不同格式解析的结果不同
+func ArchiveIndexKey(format, hash string) string {
+	return fmt.Sprintf("archive:index:%s:%s", format, hash)
+}
+
+func userGenerationKey(userID uint) string {
+	return fmt.Sprintf("gen:user:%d", userID)
+}
+
+func folderGenerationKey(folderID string) string {
+	return "gen:folder:" + folderID
+}
+
+// Cache 基于 Redis 的缓存，可按请求创建，回源合并在进程内所有实例间共享
+type Cache struct {
+	rdb Client
+}
+
+func New(rdb Client) *Cache {
+	return &Cache{rdb: rdb}
+}
+
+// FileListKey 返回目录列表缓存的键，其中嵌入用户和目录当前的代数，params 为分页、排序等参数
+// Redis 不可用时代数按 0 处理，随后的读写同样会失败并直接回源
+func (c *Cache) FileListKey(ctx context.Context, userID uint, folderID string, params ...string) string {
+	gens := [2]int64{}
+	if vals, err := c.rdb.MGet(ctx, userGenerationKey(userID), folderGenerationKey(folderID)).Result(); err == nil {
+		for i, v := range vals {
+			if s, ok := v.(string); ok && i < len(gens) {
+				gens[i], _ = strconv.ParseInt(s, 10, 64)
+			}
+		}
+	}
+	return fmt.Sprintf("filelist:%d:%s:g%d.%d:%s", userID, folderID, gens[0], gens[1], strings.Join(params, ":"))
+}
+
+// bump 递增代数计数器并刷新其过期时间
+func (c *Cache) bump(ctx context.Context, key string) {
+	if err := c.rdb.Incr(ctx, key).Err(); err == nil {
+		c.rdb.Expire(ctx, key, generationTTL)
+	}
+}
+
+// InvalidateFileLists 使用户所有目录的列表缓存失效，用于批量操作、回收站等涉及多个目录的变更
+func (c *Cache) InvalidateFileLists(ctx context.Context, userID uint) {
+	c.bump(ctx, userGenerationKey(userID))
+}
+
+// InvalidateFolders 使指定目录的列表缓存失效，用于只影响少数目录的变更，如上传、重命名、移动
+func (c *Cache) InvalidateFolders(ctx context.Context, folderIDs ...string) {
+	seen := map[string]bool{}
+	for _, id := range folderIDs {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		c.bump(ctx, folderGenerationKey(id))
+	}
+}
+
+// InvalidateUserInfo 删除用户信息缓存，存储空间变化后调用
+func (c *Cache) InvalidateUserInfo(ctx context.Context, userID uint) {
+	c.rdb.Del(ctx, UserInfoKey(userID))
+}
+
+// InvalidateFileMeta 删除文件元数据缓存
+func (c *Cache) InvalidateFileMeta(ctx context.Context, fileIDs ...string) {
+	if len(fileIDs) == 0 {
+		return
+	}
+	keys := make([]string, len(fileIDs))
+	for i, id := range fileIDs {
+		keys[i] = FileMetaKey(id)
+	}
+	c.rdb.Del(ctx, keys...)
+}
+
+// InvalidateShare 删除分享信息缓存
+func (c *Cache) InvalidateShare(ctx context.Context, token string) {
+	c.rdb.Del(ctx, ShareKey(token))
+}
+
+// Get 读取缓存，未命中或 Redis 不可用时返回 false
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, bool) {
+	val, err := c.rdb.Get(ctx, key).Bytes()
+	if err != nil || len(val) == 0 {
+		return nil, false
+	}
+	return val, true
+}
+
+// Set 写入缓存，ttl <= 0 时不写入
+func (c *Cache) Set(ctx context.Context, key string, val []byte, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	c.rdb.Set(ctx, key, val, ttl)
+}
+
+// jitter 将过期时间随机延长至多 10%，避免同一时刻回源的大量键同时过期
+func jitter(ttl time.Duration) time.Duration {
+	if n := int64(ttl / 10); n > 0 {
+		return ttl + time.Duration(rand.Int63n(n))
+	}
+	return ttl
+}
+
+// Fetch 读取缓存，未命中时调用 load 回源并写入缓存，过期时间带随机抖动；load 返回错误时不写缓存，错误原样返回给所有等待者
+// 同一进程内相同键的并发请求只回源一次；多实例间由回源锁协调，未抢到锁的实例等待结果，超时后自行回源
+func (c *Cache) Fetch(ctx context.Context, key string, ttl time.Duration, load func() ([]byte, error)) ([]byte, error) {
+	if val, ok := c.Get(ctx, key); ok {
+		return val, nil
+	}
+	return fills.do(key, func() ([]byte, error) {
+		return c.fill(ctx, key, ttl, load)
+	})
+}
+
+func (c *Cache) fill(ctx context.Context, key string, ttl time.Duration, load func() ([]byte, error)) ([]byte, error) {
+	lockKey := "lock:" + key
+	locked, err := c.rdb.SetNX(ctx, lockKey, 1, fillLockTTL).Result()
+	if err == nil && !locked {
+		// 其他实例正在回源，等待其写入
+		deadline := time.Now().Add(fillWait)
+		for time.Now().Before(deadline) {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(fillInterval):
+			}
+			if val, ok := c.Get(ctx, key); ok {
+				return val, nil
+			}
+		}
+	}
+	val, err := load()
+	if err != nil {
+		if locked {
+			c.rdb.Del(ctx, lockKey)
+		}
+		return nil, err
+	}
+	c.Set(ctx, key, val, jitter(ttl))
+	if locked {
+		c.rdb.Del(ctx, lockKey)
+	}
+	return val, nil
+}
@@ -0,0 +1,261 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// memClient 内存实现的 Client，忽略过期时间；down 为 true 时模拟 Redis 不可用
+type memClient struct {
+	mu   sync.Mutex
+	data map[string]string
+	down bool
+}
+
+func newMemClient() *memClient {
+	return &memClient{data: map[string]string{}}
+}
+
+var errDown = errors.New("redis unavailable")
+
+func (m *memClient) Get(ctx context.Context, key string) *redis.StringCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cmd := redis.NewStringCmd(ctx)
+	if m.down {
+		cmd.SetErr(errDown)
+	} else if v, ok := m.data[key]; ok {
+		cmd.SetVal(v)
+	} else {
+		cmd.SetErr(redis.Nil)
+	}
+	return cmd
+}
+
+func (m *memClient) MGet(ctx context.Context, keys ...string) *redis.SliceCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cmd := redis.NewSliceCmd(ctx)
+	if m.down {
+		cmd.SetErr(errDown)
+		return cmd
+	}
+	vals := make([]interface{}, len(keys))
+	for i, k := range keys {
+		if v, ok := m.data[k]; ok {
+			vals[i] = v
+		}
+	}
+	cmd.SetVal(vals)
+	return cmd
+}
+
+func (m *memClient) Set(ctx context.Context, key string, value interface{}, _ time.Duration) *redis.StatusCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cmd := redis.NewStatusCmd(ctx)
+	if m.down {
+		cmd.SetErr(errDown)
+		return cmd
+	}
+	switch v := value.(type) {
+	case []byte:
+		m.data[key] = string(v)
+	case string:
+		m.data[key] = v
+	default:
+		m.data[key] = "1"
+	}
+	return cmd
+}
+
+func (m *memClient) SetNX(ctx context.Context, key string, value interface{}, _ time.Duration) *redis.BoolCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cmd := redis.NewBoolCmd(ctx)
+	if m.down {
+		cmd.SetErr(errDown)
+		return cmd
+	}
+	if _, ok := m.data[key]; ok {
+		cmd.SetVal(false)
+		return cmd
+	}
+	m.data[key] = "1"
+	cmd.SetVal(true)
+	return cmd
+}
+
+func (m *memClient) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cmd := redis.NewIntCmd(ctx)
+	for _, k := range keys {
+		delete(m.data, k)
+	}
+	return cmd
+}
+
+func (m *memClient) Incr(ctx context.Context, key string) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cmd := redis.NewIntCmd(ctx)
+	if m.down {
+		cmd.SetErr(errDown)
+		return cmd
+	}
+	n, _ := strconv.ParseInt(m.data[key], 10, 64)
+	n++
+	m.data[key] = strconv.FormatInt(n, 10)
+	cmd.SetVal(n)
+	return cmd
+}
+
+func (m *memClient) Expire(ctx context.Context, key string, _ time.Duration) *redis.BoolCmd {
+	return redis.NewBoolCmd(ctx)
+}
+
+func TestFileListKey_Generations(t *testing.T) {
+	ctx := context.Background()
+	c := New(newMemClient())
+	k1 := c.FileListKey(ctx, 1, "root", "10", "name", "asc")
+	other := c.FileListKey(ctx, 1, "docs", "10", "name", "asc")
+	if k1 != "filelist:1:root:g0.0:10:name:asc" {
+		t.Fatalf("unexpected key %q", k1)
+	}
+
+	c.InvalidateFolders(ctx, "root", "root", "")
+	k2 := c.FileListKey(ctx, 1, "root", "10", "name", "asc")
+	if k2 == k1 || k2 != "filelist:1:root:g0.1:10:name:asc" {
+		t.Errorf("folder bump should change key once, got %q", k2)
+	}
+	if c.FileListKey(ctx, 1, "docs", "10", "name", "asc") != other {
+		t.Errorf("other folders should keep their key")
+	}
+
+	c.InvalidateFileLists(ctx, 1)
+	if c.FileListKey(ctx, 1, "docs", "10", "name", "asc") == other {
+		t.Errorf("user bump should change keys of all folders")
+	}
+	if c.FileListKey(ctx, 2, "x") != "filelist:2:x:g0.0:" {
+		t.Errorf("other users should not be affected")
+	}
+}
+
+func TestFetch_HitMissAndError(t *testing.T) {
+	ctx := context.Background()
+	c := New(newMemClient())
+	calls := 0
+	load := func() ([]byte, error) {
+		calls++
+		return []byte("v"), nil
+	}
+	for i := 0; i < 3; i++ {
+		val, err := c.Fetch(ctx, "k", time.Minute, load)
+		if err != nil || string(val) != "v" {
+			t.Fatalf("fetch: %q %v", val, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected a single load, got %d", calls)
+	}
+
+	errLoad := errors.New("boom")
+	if _, err := c.Fetch(ctx, "bad", time.Minute, func() ([]byte, error) { return nil, errLoad }); err != errLoad {
+		t.Errorf("expected load error, got %v", err)
+	}
+	if _, ok := c.Get(ctx, "bad"); ok {
+		t.Errorf("failed loads must not be cached")
+	}
+	if _, ok := c.Get(ctx, "lock:bad"); ok {
+		t.Errorf("fill lock should be released after a failed load")
+	}
+}
+
+func TestFetch_SingleFlight(t *testing.T) {
+	ctx := context.Background()
+	rdb := newMemClient()
+	var calls int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			val, err := New(rdb).Fetch(ctx, "hot", time.Minute, func() ([]byte, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return []byte("v"), nil
+			})
+			if err != nil || string(val) != "v" {
+				t.Errorf("fetch: %q %v", val, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("concurrent fetches should load once, got %d", calls)
+	}
+}
+
+func TestFetch_WaitsForOtherInstance(t *testing.T) {
+	ctx := context.Background()
+	rdb := newMemClient()
+	c := New(rdb)
+	// 其他实例持有回源锁，稍后写入结果
+	rdb.SetNX(ctx, "lock:k", 1, time.Second)
+	go func() {
+		time.Sleep(3 * fillInterval)
+		rdb.Set(ctx, "k", "remote", time.Minute)
+	}()
+	val, err := c.Fetch(ctx, "k", time.Minute, func() ([]byte, error) {
+		t.Error("should not load while another instance fills")
+		return []byte("local"), nil
+	})
+	if err != nil || string(val) != "remote" {
+		t.Errorf("expected value from other instance, got %q %v", val, err)
+	}
+
+	// 持锁实例迟迟不写入时超时后自行回源
+	oldWait := fillWait
+	fillWait = 5 * fillInterval
+	defer func() { fillWait = oldWait }()
+	rdb.SetNX(ctx, "lock:slow", 1, time.Second)
+	val, err = c.Fetch(ctx, "slow", time.Minute, func() ([]byte, error) { return []byte("local"), nil })
+	if err != nil || string(val) != "local" {
+		t.Errorf("expected local load after timeout, got %q %v", val, err)
+	}
+}
+
+func TestFetch_RedisDown(t *testing.T) {
+	ctx := context.Background()
+	rdb := newMemClient()
+	rdb.down = true
+	c := New(rdb)
+	calls := 0
+	for i := 0; i < 2; i++ {
+		val, err := c.Fetch(ctx, "k", time.Minute, func() ([]byte, error) {
+			calls++
+			return []byte("v"), nil
+		})
+		if err != nil || string(val) != "v" {
+			t.Fatalf("fetch: %q %v", val, err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("without redis every fetch should load, got %d", calls)
+	}
+	c.InvalidateFileLists(ctx, 1)
+	if c.FileListKey(ctx, 1, "root") != "filelist:1:root:g0.0:" {
+		t.Errorf("generations should fall back to zero")
+	}
+}
@@ -0,0 +1,44 @@
+package cache
+
+import "sync"
+
+// call 一次正在进行的回源
+type call struct {
+	wg  sync.WaitGroup
+	val []byte
+	err error
+}
+
+// group 合并同一键的并发回源，等待者共享第一个调用者的结果
+type group struct {
+	mu sync.Mutex
+	m  map[string]*call
+}
+
+// fills 进程内所有 Cache 共享的回源合并
+var fills group
+
+func (g *group) do(key string, fn func() ([]byte, error)) ([]byte, error) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = map[string]*call{}
+	}
+	if cl, ok := g.m[key]; ok {
+		g.mu.Unlock()
+		cl.wg.Wait()
+		return cl.val, cl.err
+	}
+	cl := &call{}
+	cl.wg.Add(1)
+	g.m[key] = cl
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.m, key)
+		g.mu.Unlock()
+		cl.wg.Done()
+	}()
+	cl.val, cl.err = fn()
+	return cl.val, cl.err
+}
@@ -0,0 +1,160 @@
+package file
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ArchiveEntry 打包下载中的一项，Path 为压缩包内的相对路径，目录以 / 结尾
+type ArchiveEntry struct {
+	Path    string
+	Hash    string
+	Size    int64
+	IsDir   bool
+	ModTime time.Time
+}
+
+// uniqueName 在同一目录内为重名项生成不重复的名称，如 a.txt、a (1).txt
+func uniqueName(used map[string]bool, name string) string {
+	if !used[name] {
+		used[name] = true
+		return name
+	}
+	for i := 1; ; i++ {
+		candidate := numberedName(name, i)
+		if !used[candidate] {
+			used[candidate] = true
+			return candidate
+		}
+	}
+}
+
+// CollectArchiveEntries 展开所选文件/文件夹的子树，生成打包下载的条目列表
+// 所选项位于压缩包根目录，文件夹保留层级结构，同一目录内的重名项自动追加序号
+func CollectArchiveEntries(db *gorm.DB, ids []string, ownerID uint) ([]ArchiveEntry, error) {
+	var roots []File
+	if err := inChunks(ids, func(chunk []string) error {
+		var batch []File
+		if err := db.Where("id IN ?", chunk).Find(&batch).Error; err != nil {
+			return err
+		}
+		roots = append(roots, batch...)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	byID := make(map[string]File, len(roots))
+	var folderIDs []string
+	for _, f := range roots {
+		byID[f.ID] = f
+		if f.Type == "folder" {
+			folderIDs = append(folderIDs, f.ID)
+		}
+	}
+	children, err := subtreeChildren(db, folderIDs)
+	if err != nil {
+		return nil, err
+	}
+	var entries []ArchiveEntry
+	used := map[string]bool{}
+	visited := map[string]bool{}
+	for _, id := range ids {
+		f, ok := byID[id]
+		if !ok {
+			return nil, gorm.ErrRecordNotFound
+		}
+		if f.OwnerID != ownerID {
+			return nil, ErrNoPermission
+		}
+		if visited[id] {
+			continue
+		}
+		entries = collectEntries(f, "", children, used, visited, entries)
+	}
+	if err := fillEntrySizes(db, entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// subtreeChildren 通过目录树闭包表一次取出各文件夹的所有子孙，按父目录分组并按名称排序
+func subtreeChildren(db *gorm.DB, folderIDs []string) (map[string][]File, error) {
+	children := map[string][]File{}
+	seen := map[string]bool{}
+	err := inChunks(folderIDs, func(chunk []string) error {
+		var files []File
+		if err := db.Joins("JOIN file_ancestors ON file_ancestors.descendant_id = files.id").
+			Where("file_ancestors.ancestor_id IN ? AND file_ancestors.depth > 0", chunk).
+			Order("files.name").Find(&files).Error; err != nil {
+			return err
+		}
+		// 所选文件夹互相嵌套时子孙会出现多次，同一父目录的子项总在同一批中出现，去重后仍保持名称顺序
+		for _, f := range files {
+			if seen[f.ID] {
+				continue
+			}
+			seen[f.ID] = true
+			children[f.ParentID] = append(children[f.ParentID], f)
+		}
+		return nil
+	})
+	return children, err
+}
+
+// collectEntries 递归收集 f 及其子项，prefix 为所在目录在压缩包内的路径
+func collectEntries(f File, prefix string, children map[string][]File, used, visited map[string]bool, entries []ArchiveEntry) []ArchiveEntry {
+	visited[f.ID] = true
+	name := prefix + uniqueName(used, f.Name)
+	if f.Type != "folder" {
+		return append(entries, ArchiveEntry{Path: name, Hash: f.Hash, ModTime: f.UploadTime})
+	}
+	entries = append(entries, ArchiveEntry{Path: name + "/", IsDir: true, ModTime: f.UploadTime})
+	childUsed := map[string]bool{}
+	for _, child := range children[f.ID] {
+		if visited[child.ID] {
+			continue
+		}
+		entries = collectEntries(child, name+"/", children, childUsed, visited, entries)
+	}
+	return entries
+}
+
+// fillEntrySizes 分批查询文件内容大小
+func fillEntrySizes(db *gorm.DB, entries []ArchiveEntry) error {
+	var hashes []string
+	seen := map[string]bool{}
+	for _, e := range entries {
+		if !e.IsDir && !seen[e.Hash] {
+			seen[e.Hash] = true
+			hashes = append(hashes, e.Hash)
+		}
+	}
+	sizes := make(map[string]int64, len(hashes))
+	err := inChunks(hashes, func(chunk []string) error {
+		var contents []FileContent
+		if err := db.Where("hash IN ?", chunk).Find(&contents).Error; err != nil {
+			return err
+		}
+		for _, fc := range contents {
+			sizes[fc.Hash] = fc.Size
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		if !entries[i].IsDir {
+			entries[i].Size = sizes[entries[i].Hash]
+		}
+	}
+	return nil
+}
+
+// IsDescendant 判断 id 是否为 ancestorID 本身或其子孙，通过目录树闭包表一次查询
+func IsDescendant(db *gorm.DB, id, ancestorID string) (bool, error) {
+	var count int64
+	err := db.Model(&FileAncestor{}).Where("ancestor_id = ? AND descendant_id = ?", ancestorID, id).Count(&count).Error
+	return count > 0, err
+}
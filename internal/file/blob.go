@@ -0,0 +1,110 @@
+package file
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"cloudDrive/internal/storage"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PendingBlob 已开始写入存储、尚未提交 FileContent 记录的对象
+// 对象以 hash 为 key，同一内容可能被多个请求同时写入；写入前先登记，清理时仍有登记的对象视为正在使用。
+// 进程异常退出遗留的登记会使对应对象不再被即时清理，留给后台清理处理
+type PendingBlob struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Hash      string    `gorm:"type:varchar(64);index" json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BlobReservation 一次上传登记的对象
+type BlobReservation struct {
+	db     *gorm.DB
+	ids    []uint
+	hashes []string
+}
+
+// NewBlobReservation 创建对象登记，须使用事务外的连接，登记在写入存储前就要对其他请求可见
+func NewBlobReservation(db *gorm.DB) *BlobReservation {
+	return &BlobReservation{db: db}
+}
+
+// Reserve 在写入存储之前登记即将写入的对象
+func (r *BlobReservation) Reserve(hashes ...string) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+	rows := make([]PendingBlob, len(hashes))
+	for i, h := range hashes {
+		rows[i].Hash = h
+	}
+	if err := r.db.CreateInBatches(rows, deleteChunkSize).Error; err != nil {
+		return err
+	}
+	for _, row := range rows {
+		r.ids = append(r.ids, row.ID)
+	}
+	r.hashes = append(r.hashes, hashes...)
+	return nil
+}
+
+// Hashes 已登记的对象
+func (r *BlobReservation) Hashes() []string {
+	return r.hashes
+}
+
+// Release 在写库事务提交或回滚之后撤销登记，并删除 cleanup 中既没有 FileContent 记录、也没有其他登记的对象
+// 撤销登记、检查引用和删除对象在同一事务中进行，检查时锁定这些 hash 的登记，
+// 并发写入同一内容的请求要等删除完成后才能登记，不会出现记录提交后对象已被删除的情况
+func (r *BlobReservation) Release(stor storage.Storage, cleanup []string) {
+	if len(r.ids) == 0 && len(cleanup) == 0 {
+		return
+	}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		ids := make([]string, len(r.ids))
+		for i, id := range r.ids {
+			ids[i] = strconv.FormatUint(uint64(id), 10)
+		}
+		if err := inChunks(ids, func(chunk []string) error {
+			return tx.Where("id IN ?", chunk).Delete(&PendingBlob{}).Error
+		}); err != nil {
+			return err
+		}
+		inUse := map[string]bool{}
+		if err := inChunks(cleanup, func(chunk []string) error {
+			var pending, stored []string
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&PendingBlob{}).
+				Where("hash IN ?", chunk).Pluck("hash", &pending).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&FileContent{}).Where("hash IN ?", chunk).Pluck("hash", &stored).Error; err != nil {
+				return err
+			}
+			for _, h := range append(pending, stored...) {
+				inUse[h] = true
+			}
+			return nil
+		}); err != nil {
+			// 无法确认引用情况时保留对象，宁可留下孤儿对象也不误删
+			return err
+		}
+		for _, h := range cleanup {
+			if inUse[h] {
+				continue
+			}
+			inUse[h] = true
+			if err := stor.Delete(context.Background(), h); err != nil {
+				log.Printf("删除未引用对象 %s 失败: %v", h, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("撤销对象登记失败: %v", err)
+	}
+	r.ids, r.hashes = nil, nil
+}
@@ -0,0 +1,83 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"cloudDrive/internal/storage"
+)
+
+func TestBlobReservation_ReleaseDeletesUnreferenced(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	stor := storage.NewMemoryStorage()
+	res := NewBlobReservation(db)
+	if err := res.Reserve("orphan", "shared"); err != nil {
+		t.Fatalf("登记失败: %v", err)
+	}
+	stor.Upload(ctx, "orphan", bytes.NewReader([]byte("orphan")))
+	stor.Upload(ctx, "shared", bytes.NewReader([]byte("shared")))
+	// 模拟回滚期间其他请求已为同一 hash 提交了内容记录
+	db.Create(&FileContent{Hash: "shared", Size: 6})
+
+	res.Release(stor, res.Hashes())
+
+	if ok, _ := stor.Exists(ctx, "orphan"); ok {
+		t.Errorf("未被引用的对象应被删除")
+	}
+	if ok, _ := stor.Exists(ctx, "shared"); !ok {
+		t.Errorf("已有记录引用的对象不应被删除")
+	}
+	var count int64
+	db.Model(&PendingBlob{}).Count(&count)
+	if count != 0 {
+		t.Errorf("释放后应撤销全部登记，剩余 %d 条", count)
+	}
+}
+
+func TestBlobReservation_ConcurrentUploadOfSameHash(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	stor := storage.NewMemoryStorage()
+	const hash = "same"
+
+	// 两个请求都未找到内容记录，先后登记并写入同一对象
+	failed, committed := NewBlobReservation(db), NewBlobReservation(db)
+	if err := failed.Reserve(hash); err != nil {
+		t.Fatalf("登记失败: %v", err)
+	}
+	stor.Upload(ctx, hash, bytes.NewReader([]byte("content")))
+	if err := committed.Reserve(hash); err != nil {
+		t.Fatalf("登记失败: %v", err)
+	}
+	stor.Upload(ctx, hash, bytes.NewReader([]byte("content")))
+
+	// 其中一个事务回滚并清理，此时另一个请求的事务尚未提交
+	failed.Release(stor, []string{hash})
+	if ok, _ := stor.Exists(ctx, hash); !ok {
+		t.Fatalf("其他请求仍在写入的对象不应被删除")
+	}
+
+	// 另一个请求提交内容记录后对象必须存在
+	db.Create(&FileContent{Hash: hash, Size: 7})
+	committed.Release(stor, nil)
+	if ok, _ := stor.Exists(ctx, hash); !ok {
+		t.Errorf("已提交记录引用的对象不应被删除")
+	}
+
+	// 两个请求都失败时，最后一个释放的请求删除对象
+	const other = "other"
+	first, second := NewBlobReservation(db), NewBlobReservation(db)
+	first.Reserve(other)
+	second.Reserve(other)
+	stor.Upload(ctx, other, bytes.NewReader([]byte("other")))
+	first.Release(stor, []string{other})
+	if ok, _ := stor.Exists(ctx, other); !ok {
+		t.Fatalf("仍有登记的对象不应被删除")
+	}
+	second.Release(stor, []string{other})
+	if ok, _ := stor.Exists(ctx, other); ok {
+		t.Errorf("没有记录和登记的对象应被删除")
+	}
+}
@@ -0,0 +1,195 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"cloudDrive/internal/storage"
+
+	"github.com/gabriel-vasile/mimetype"
+	"gorm.io/gorm"
+)
+
+// SniffLen 检测内容类型时读取的文件头字节数
+const SniffLen = 3072
+
+// DefaultMimeType 无法识别内容类型时使用的 MIME 类型
+const DefaultMimeType = "application/octet-stream"
+
+// Categories 文件分类，other 为不属于其他任何分类的文件
+var Categories = []string{"images", "documents", "video", "audio", "archives", "other"}
+
+// documentMimes 属于文档分类的 MIME 类型，另外 OOXML 和 OpenDocument 格式按前缀匹配
+var documentMimes = map[string]bool{
+	"application/pdf":               true,
+	"application/msword":            true,
+	"application/vnd.ms-excel":      true,
+	"application/vnd.ms-powerpoint": true,
+	"application/epub+zip":          true,
+	"application/json":              true,
+}
+
+var documentMimePrefixes = []string{"application/vnd.openxmlformats-officedocument.", "application/vnd.oasis.opendocument."}
+
+// archiveMimes 属于压缩包分类的 MIME 类型
+var archiveMimes = map[string]bool{
+	"application/zip":              true,
+	"application/x-7z-compressed":  true,
+	"application/x-rar-compressed": true,
+	"application/x-tar":            true,
+	"application/gzip":             true,
+	"application/x-bzip2":          true,
+	"application/x-xz":             true,
+	"application/zstd":             true,
+}
+
+// ValidCategory 是否为支持的文件分类
+func ValidCategory(category string) bool {
+	for _, c := range Categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectMimeType 按文件头的魔数检测内容的 MIME 类型，无法识别时为 DefaultMimeType
+func DetectMimeType(header []byte) string {
+	return mimetype.Detect(header).String()
+}
+
+// SniffMimeType 读取 r 的前 SniffLen 字节检测 MIME 类型
+func SniffMimeType(r io.Reader) (string, error) {
+	header := make([]byte, SniffLen)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return DetectMimeType(header[:n]), nil
+}
+
+// MimeCategory MIME 类型对应的分类；纯文本和无法识别的类型返回空，此时按文件扩展名归类
+func MimeCategory(mimeType string) string {
+	base, _, _ := strings.Cut(mimeType, ";")
+	base = strings.ToLower(strings.TrimSpace(base))
+	switch {
+	case base == "" || base == DefaultMimeType || strings.HasPrefix(base, "text/"):
+		return ""
+	case strings.HasPrefix(base, "image/"):
+		return "images"
+	case strings.HasPrefix(base, "video/"):
+		return "video"
+	case strings.HasPrefix(base, "audio/"), base == "application/ogg":
+		return "audio"
+	case documentMimes[base]:
+		return "documents"
+	case archiveMimes[base]:
+		return "archives"
+	}
+	for _, p := range documentMimePrefixes {
+		if strings.HasPrefix(base, p) {
+			return "documents"
+		}
+	}
+	return "other"
+}
+
+// SetMimeType 记录检测到的 MIME 类型及对应的分类，为空表示尚未检测
+func (c *FileContent) SetMimeType(mimeType string) {
+	c.MimeType = mimeType
+	c.Category = MimeCategory(mimeType)
+}
+
+// SniffStored 从存储中读取内容的文件头检测 MIME 类型
+func SniffStored(ctx context.Context, stor storage.Storage, hash string) (string, error) {
+	rc, err := stor.Download(ctx, hash)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	return SniffMimeType(rc)
+}
+
+// maxRetryDelay 后台任务读取存储失败后的最长重试间隔
+const maxRetryDelay = time.Hour
+
+// RetryDelay 第 failures 次失败后到下次重试的间隔，从1分钟开始逐次翻倍，最长 maxRetryDelay
+func RetryDelay(failures int) time.Duration {
+	delay := time.Minute
+	for i := 1; i < failures && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// SniffPending 检测尚未记录 MIME 类型的内容（直传上传、上传时检测失败或功能上线前上传的），每次最多 batch 个，返回处理的数量
+// 对象不存在时记为 DefaultMimeType，不再重复尝试；存储的其他错误记录失败次数，按 RetryDelay 推迟重试并继续处理后面的内容，
+// 避免个别无法读取的对象一直排在最前面，阻塞其后所有内容的检测
+func SniffPending(ctx context.Context, db *gorm.DB, stor storage.Storage, batch int) (int, error) {
+	var contents []FileContent
+	if err := db.Where("mime_type = ? OR mime_type IS NULL", "").
+		Where("sniff_retry_at IS NULL OR sniff_retry_at <= ?", time.Now()).
+		Limit(batch).Find(&contents).Error; err != nil {
+		return 0, err
+	}
+	for i, content := range contents {
+		mimeType, err := SniffStored(ctx, stor, content.Hash)
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			mimeType, err = DefaultMimeType, nil
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return i, ctx.Err()
+			}
+			log.Printf("检测内容 %s 的文件类型失败: %v", content.Hash, err)
+			retryAt := time.Now().Add(RetryDelay(content.SniffFailures + 1))
+			if err := db.Model(&content).Updates(map[string]interface{}{
+				"sniff_failures": content.SniffFailures + 1,
+				"sniff_retry_at": retryAt,
+			}).Error; err != nil {
+				return i, err
+			}
+			continue
+		}
+		content.SetMimeType(mimeType)
+		if err := db.Model(&content).Select("mime_type", "category").Updates(&content).Error; err != nil {
+			return i, err
+		}
+	}
+	return len(contents), nil
+}
+
+// sniffBatch 每轮检测的内容数
+const sniffBatch = 100
+
+// StartSniffer 定期检测尚未记录 MIME 类型的内容，一轮处理满一批时立即继续下一轮，直到ctx取消
+func StartSniffer(ctx context.Context, db *gorm.DB, stor storage.Storage, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := SniffPending(ctx, db, stor, sniffBatch)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("检测文件类型失败: %v", err)
+				}
+				break
+			}
+			if n < sniffBatch {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package file
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"cloudDrive/internal/storage"
+)
+
+var (
+	pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x02\x00\x00\x00")
+	pdfHeader = []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n1 0 obj\n<<>>\nendobj\n")
+)
+
+func zipBytes(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, _ := w.Create("a.txt")
+	f.Write([]byte("hello"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectMimeTypeAndCategory(t *testing.T) {
+	for _, tc := range []struct {
+		data     []byte
+		mime     string
+		category string
+	}{
+		{pngHeader, "image/png", "images"},
+		{pdfHeader, "application/pdf", "documents"},
+		{zipBytes(t), "application/zip", "archives"},
+		{[]byte("纯文本内容\n"), "text/plain; charset=utf-8", ""},
+		{[]byte{0x00, 0x01, 0x02, 0x03}, DefaultMimeType, ""},
+	} {
+		mimeType, err := SniffMimeType(bytes.NewReader(tc.data))
+		if err != nil || mimeType != tc.mime {
+			t.Errorf("sniff: got %q %v, want %q", mimeType, err, tc.mime)
+		}
+		if got := MimeCategory(mimeType); got != tc.category {
+			t.Errorf("%s: category %q, want %q", mimeType, got, tc.category)
+		}
+	}
+	for mimeType, want := range map[string]string{
+		"video/mp4":                   "video",
+		"audio/mpeg":                  "audio",
+		"application/ogg":             "audio",
+		"application/x-7z-compressed": "archives",
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document": "documents",
+		"application/x-executable": "other",
+	} {
+		if got := MimeCategory(mimeType); got != want {
+			t.Errorf("%s: category %q, want %q", mimeType, got, want)
+		}
+	}
+}
+
+func TestCategoryFilter_PrefersDetectedType(t *testing.T) {
+	db := setupTestDB(t)
+	for _, f := range []File{
+		{ID: "root", Name: "root", Type: "folder", OwnerID: 1},
+		{ID: "png", Name: "截图.txt", Hash: "hpng", Type: "file", ParentID: "root", OwnerID: 1},   // 内容为图片，扩展名为 txt
+		{ID: "pdf", Name: "合同", Hash: "hpdf", Type: "file", ParentID: "root", OwnerID: 1},       // 没有扩展名
+		{ID: "old", Name: "old.jpg", Hash: "hold", Type: "file", ParentID: "root", OwnerID: 1},  // 尚未检测，按扩展名
+		{ID: "md", Name: "notes.md", Hash: "htext", Type: "file", ParentID: "root", OwnerID: 1}, // 纯文本，按扩展名
+		{ID: "py", Name: "main.py", Hash: "htext", Type: "file", ParentID: "root", OwnerID: 1},
+		{ID: "dir", Name: "图片", Type: "folder", ParentID: "root", OwnerID: 1},
+		{ID: "x", Name: "x.png", Hash: "hpng", Type: "file", ParentID: "other", OwnerID: 2},
+	} {
+		db.Create(&f)
+	}
+	db.Create(&UserRoot{UserID: 1, RootID: "root"})
+	for hash, mimeType := range map[string]string{"hpng": "image/png", "hpdf": "application/pdf", "hold": "", "htext": "text/plain; charset=utf-8"} {
+		content := FileContent{Hash: hash, Size: 10}
+		content.SetMimeType(mimeType)
+		db.Create(&content)
+	}
+
+	for category, want := range map[string]string{
+		"images":    "old,png",
+		"documents": "md,pdf",
+		"other":     "py",
+		"video":     "",
+	} {
+		got := strings.Join(sorted(searchIDs(t, db, SearchRequest{Category: category})), ",")
+		if got != want {
+			t.Errorf("search %s: got %q, want %q", category, got, want)
+		}
+		resp, err := ListFiles(db, ListFilesRequest{OwnerID: 1, Category: category, PageSize: 100})
+		if err != nil {
+			t.Fatalf("list %s: %v", category, err)
+		}
+		ids := []string{}
+		for _, f := range resp.Files {
+			ids = append(ids, f.ID)
+		}
+		if got := strings.Join(sorted(ids), ","); got != want || resp.Total != int64(len(ids)) {
+			t.Errorf("list %s: got %q (total %d), want %q", category, got, resp.Total, want)
+		}
+	}
+	if _, err := ListFiles(db, ListFilesRequest{OwnerID: 1, Category: "music"}); err != ErrInvalidCategory {
+		t.Errorf("expected ErrInvalidCategory, got %v", err)
+	}
+
+	resp, _ := ListFiles(db, ListFilesRequest{OwnerID: 1, OrderBy: "name", Order: "asc", PageSize: 100})
+	for _, f := range resp.Files {
+		if f.ID == "png" && f.MimeType != "image/png" || f.ID == "dir" && f.MimeType != "" {
+			t.Errorf("unexpected mime type for %s: %q", f.ID, f.MimeType)
+		}
+	}
+
+	summaries, err := SummarizeCategories(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != len(Categories) || summaries[0].Category != "images" || summaries[0].Count != 2 ||
+		summaries[0].Size != 20 || summaries[5].Category != "other" || summaries[5].Count != 1 {
+		t.Errorf("unexpected summaries: %+v", summaries)
+	}
+}
+
+func TestSniffPending(t *testing.T) {
+	db := setupTestDB(t)
+	stor := storage.NewMemoryStorage()
+	ctx := context.Background()
+	stor.Upload(ctx, "hpdf", bytes.NewReader(pdfHeader))
+	db.Create(&FileContent{Hash: "hpdf", Size: int64(len(pdfHeader))})
+	db.Create(&FileContent{Hash: "missing", Size: 1})
+	done := FileContent{Hash: "hpng", Size: 1}
+	done.SetMimeType("image/png")
+	db.Create(&done)
+
+	n, err := SniffPending(ctx, db, stor, 10)
+	if err != nil || n != 2 {
+		t.Fatalf("sniff pending: %d %v", n, err)
+	}
+	var content FileContent
+	db.First(&content, "hash = ?", "hpdf")
+	if content.MimeType != "application/pdf" || content.Category != "documents" {
+		t.Errorf("unexpected content: %+v", content)
+	}
+	content = FileContent{}
+	db.First(&content, "hash = ?", "missing")
+	if content.MimeType != DefaultMimeType {
+		t.Errorf("missing objects should not be retried: %+v", content)
+	}
+	if n, _ := SniffPending(ctx, db, stor, 10); n != 0 {
+		t.Errorf("nothing left to sniff, got %d", n)
+	}
+}
+
+// brokenObjectStorage 下载指定对象时返回存储错误
+type brokenObjectStorage struct {
+	storage.Storage
+	broken string
+}
+
+func (s *brokenObjectStorage) Download(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	if fileID == s.broken {
+		return nil, storage.ErrCacheDigestMismatch
+	}
+	return s.Storage.Download(ctx, fileID)
+}
+
+func TestSniffPending_StorageErrorDoesNotBlock(t *testing.T) {
+	db := setupTestDB(t)
+	mem := storage.NewMemoryStorage()
+	stor := &brokenObjectStorage{Storage: mem, broken: "broken"}
+	ctx := context.Background()
+	mem.Upload(ctx, "broken", bytes.NewReader(pdfHeader))
+	mem.Upload(ctx, "hpdf", bytes.NewReader(pdfHeader))
+	db.Create(&FileContent{Hash: "broken", Size: int64(len(pdfHeader))})
+	db.Create(&FileContent{Hash: "hpdf", Size: int64(len(pdfHeader))})
+
+	// 排在前面的对象读取失败时记录失败并推迟重试，下一轮处理后面的内容
+	for i := 0; i < 2; i++ {
+		if _, err := SniffPending(ctx, db, stor, 1); err != nil {
+			t.Fatalf("storage errors should not abort the batch: %v", err)
+		}
+	}
+	var content FileContent
+	db.First(&content, "hash = ?", "hpdf")
+	if content.MimeType != "application/pdf" {
+		t.Errorf("content behind a broken object should be sniffed: %+v", content)
+	}
+	content = FileContent{}
+	db.First(&content, "hash = ?", "broken")
+	if content.MimeType != "" || content.SniffFailures != 1 || content.SniffRetryAt == nil || !content.SniffRetryAt.After(time.Now()) {
+		t.Errorf("failure should be recorded and retried later: %+v", content)
+	}
+	if n, _ := SniffPending(ctx, db, stor, 10); n != 0 {
+		t.Errorf("broken object should wait for its retry time, got %d", n)
+	}
+
+	// 到达重试时间后再次检测
+	db.Model(&FileContent{}).Where("hash = ?", "broken").Update("sniff_retry_at", time.Now().Add(-time.Second))
+	stor.broken = ""
+	if n, _ := SniffPending(ctx, db, stor, 10); n != 1 {
+		t.Errorf("broken object should be retried, got %d", n)
+	}
+	content = FileContent{}
+	db.First(&content, "hash = ?", "broken")
+	if content.MimeType != "application/pdf" {
+		t.Errorf("retried content should be sniffed: %+v", content)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	if RetryDelay(1) != time.Minute || RetryDelay(3) != 4*time.Minute || RetryDelay(100) != time.Hour {
+		t.Errorf("unexpected delays: %v %v %v", RetryDelay(1), RetryDelay(3), RetryDelay(100))
+	}
+}
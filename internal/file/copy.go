@@ -0,0 +1,146 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrCopyToSelfOrChild = errors.New("不能复制到自身或子目录下")
+
+// CopyPlan 复制前收集的源文件/文件夹子树
+// Items 按层级顺序排列（父目录在子项之前），第一项为源本身；Size 为复制后新增占用的空间
+type CopyPlan struct {
+	Items   []File
+	Size    int64
+	Files   int
+	Folders int
+}
+
+// Root 返回被复制的源文件/文件夹
+func (p *CopyPlan) Root() File {
+	return p.Items[0]
+}
+
+// PlanCopy 按 ParentID 逐层展开源子树并统计大小，不校验归属，由调用方决定源是否可读
+func PlanCopy(db *gorm.DB, srcID string) (*CopyPlan, error) {
+	var root File
+	if err := db.First(&root, "id = ?", srcID).Error; err != nil {
+		return nil, err
+	}
+	plan := &CopyPlan{Items: []File{root}}
+	level := []string{}
+	if root.Type == "folder" {
+		level = append(level, root.ID)
+	}
+	for len(level) > 0 {
+		var children []File
+		if err := db.Where("parent_id IN ?", level).Order("name").Find(&children).Error; err != nil {
+			return nil, err
+		}
+		level = level[:0]
+		for _, child := range children {
+			plan.Items = append(plan.Items, child)
+			if child.Type == "folder" {
+				level = append(level, child.ID)
+			}
+		}
+	}
+
+	var hashes []string
+	for _, f := range plan.Items {
+		if f.Type == "folder" {
+			plan.Folders++
+		} else {
+			plan.Files++
+			hashes = append(hashes, f.Hash)
+		}
+	}
+	if len(hashes) > 0 {
+		var contents []FileContent
+		if err := db.Where("hash IN ?", hashes).Find(&contents).Error; err != nil {
+			return nil, err
+		}
+		sizes := make(map[string]int64, len(contents))
+		for _, fc := range contents {
+			sizes[fc.Hash] = fc.Size
+		}
+		for _, f := range plan.Items {
+			if f.Type != "folder" {
+				plan.Size += sizes[f.Hash]
+			}
+		}
+	}
+	return plan, nil
+}
+
+// copyBatchSize 复制时每批插入的记录数
+const copyBatchSize = 500
+
+// ExecuteCopy 将 PlanCopy 收集的子树复制到目标目录，归属于 ownerID
+// 复制只新增文件记录和元数据，内容通过hash复用，不写入存储；与 MoveFile 相同，目标目录下不能有同名文件/文件夹，
+// 文件夹不能复制到自身或子目录下
+func ExecuteCopy(db *gorm.DB, plan *CopyPlan, ownerID uint, targetParentID string) (*File, error) {
+	return ExecuteCopyContext(context.Background(), db, plan, ownerID, targetParentID)
+}
+
+// ExecuteCopyContext 同 ExecuteCopy，每批插入前检查 ctx，取消时返回 ctx 的错误，由调用方回滚事务
+func ExecuteCopyContext(ctx context.Context, db *gorm.DB, plan *CopyPlan, ownerID uint, targetParentID string) (*File, error) {
+	root := plan.Root()
+	if root.Type == "folder" {
+		inside, err := IsDescendant(db, targetParentID, root.ID)
+		if err != nil {
+			return nil, err
+		}
+		if inside {
+			return nil, ErrCopyToSelfOrChild
+		}
+	}
+	var count int64
+	if err := db.Model(&File{}).Where("parent_id = ? AND name = ?", targetParentID, root.Name).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrNameExists
+	}
+
+	now := time.Now()
+	newIDs := make(map[string]string, len(plan.Items))
+	copies := make([]File, 0, len(plan.Items))
+	for i, f := range plan.Items {
+		parentID := targetParentID
+		if i > 0 {
+			parentID = newIDs[f.ParentID]
+		}
+		newIDs[f.ID] = uuid.New().String()
+		copies = append(copies, File{
+			ID:          newIDs[f.ID],
+			Name:        f.Name,
+			Hash:        f.Hash,
+			Type:        f.Type,
+			ParentID:    parentID,
+			OwnerID:     ownerID,
+			UploadTime:  now,
+			Description: f.Description,
+		})
+	}
+	for start := 0; start < len(copies); start += copyBatchSize {
+		end := start + copyBatchSize
+		if end > len(copies) {
+			end = len(copies)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := db.Create(copies[start:end]).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := copyMetadata(db, newIDs, ownerID); err != nil {
+		return nil, err
+	}
+	return &copies[0], nil
+}
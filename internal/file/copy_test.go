@@ -0,0 +1,90 @@
+package file
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPlanAndExecuteCopy(t *testing.T) {
+	db := setupTestDB(t)
+	now := time.Now()
+	for _, f := range []File{
+		{ID: "root", Name: "root", Type: "folder", OwnerID: 1},
+		{ID: "src", Name: "src", Type: "folder", ParentID: "root", OwnerID: 1},
+		{ID: "sub", Name: "sub", Type: "folder", ParentID: "src", OwnerID: 1},
+		{ID: "f1", Name: "a.txt", Hash: "ha", Type: "file", ParentID: "src", OwnerID: 1},
+		{ID: "f2", Name: "b.txt", Hash: "hb", Type: "file", ParentID: "sub", OwnerID: 1},
+		{ID: "f3", Name: "c.txt", Hash: "ha", Type: "file", ParentID: "sub", OwnerID: 1},
+		{ID: "dst", Name: "dst", Type: "folder", ParentID: "root", OwnerID: 2},
+	} {
+		f.UploadTime = now
+		db.Create(&f)
+	}
+	db.Create(&FileContent{Hash: "ha", Size: 10})
+	db.Create(&FileContent{Hash: "hb", Size: 20})
+
+	plan, err := PlanCopy(db, "src")
+	if err != nil {
+		t.Fatalf("plan copy: %v", err)
+	}
+	if len(plan.Items) != 5 || plan.Files != 3 || plan.Folders != 2 || plan.Size != 40 {
+		t.Fatalf("unexpected plan: items=%d files=%d folders=%d size=%d", len(plan.Items), plan.Files, plan.Folders, plan.Size)
+	}
+
+	copied, err := ExecuteCopy(db, plan, 2, "dst")
+	if err != nil {
+		t.Fatalf("execute copy: %v", err)
+	}
+	if copied.ID == "src" || copied.Name != "src" || copied.ParentID != "dst" || copied.OwnerID != 2 {
+		t.Errorf("unexpected copy root: %+v", copied)
+	}
+	var sub File
+	if err := db.Where("parent_id = ? AND name = ?", copied.ID, "sub").First(&sub).Error; err != nil {
+		t.Fatalf("copied sub folder missing: %v", err)
+	}
+	var files []File
+	db.Where("parent_id = ?", sub.ID).Order("name").Find(&files)
+	if len(files) != 2 || files[0].Hash != "hb" || files[1].Hash != "ha" || files[0].OwnerID != 2 {
+		t.Errorf("unexpected copied files: %+v", files)
+	}
+	var contents int64
+	db.Model(&FileContent{}).Count(&contents)
+	if contents != 2 {
+		t.Errorf("copy should reuse contents, got %d", contents)
+	}
+
+	if _, err := ExecuteCopy(db, plan, 2, "dst"); err != ErrNameExists {
+		t.Errorf("expected ErrNameExists, got %v", err)
+	}
+	if _, err := ExecuteCopy(db, plan, 1, "sub"); err != ErrCopyToSelfOrChild {
+		t.Errorf("expected ErrCopyToSelfOrChild, got %v", err)
+	}
+	if _, err := ExecuteCopy(db, plan, 1, "src"); err != ErrCopyToSelfOrChild {
+		t.Errorf("expected ErrCopyToSelfOrChild, got %v", err)
+	}
+}
+
+func TestExecuteCopyContext_Cancel(t *testing.T) {
+	db := setupTestDB(t)
+	now := time.Now()
+	db.Create(&File{ID: "root", Name: "root", Type: "folder", OwnerID: 1, UploadTime: now})
+	db.Create(&File{ID: "src", Name: "src", Type: "folder", ParentID: "root", OwnerID: 1, UploadTime: now})
+	db.Create(&File{ID: "f1", Name: "a.txt", Hash: "h", Type: "file", ParentID: "src", OwnerID: 1, UploadTime: now})
+	db.Create(&File{ID: "dst", Name: "dst", Type: "folder", ParentID: "root", OwnerID: 1, UploadTime: now})
+	plan, err := PlanCopy(db, "src")
+	if err != nil {
+		t.Fatalf("plan copy: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ExecuteCopyContext(ctx, db, plan, 1, "dst"); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	var count int64
+	db.Model(&File{}).Where("parent_id = ?", "dst").Count(&count)
+	if count != 0 {
+		t.Errorf("cancelled copy should not insert records, got %d", count)
+	}
+}
@@ -2,21 +2,58 @@ package file
 
 import (
 	"errors"
+	"time"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 var ErrNoPermission = errors.New("无权限删除该文件")
 var ErrRestoreParentNotExist = errors.New("原路径不存在，请选择新的还原路径")
 
-// DeleteFile 删除指定ID的文件，只有所有者可以删除
-func DeleteFile(db *gorm.DB, fileID string, ownerID uint) error {
-	return db.Transaction(func(tx *gorm.DB) error {
-		// 先删除所有与该文件相关的分享链接
-		if err := tx.Where("resource_id = ?", fileID).Delete(&Share{}).Error; err != nil {
+// deleteChunkSize 按ID批量更新、删除时每条语句包含的ID数
+const deleteChunkSize = 500
+
+// inChunks 将ids分批交给fn处理，避免单条语句的参数过多
+func inChunks(ids []string, fn func(chunk []string) error) error {
+	for start := 0; start < len(ids); start += deleteChunkSize {
+		end := start + deleteChunkSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		if err := fn(ids[start:end]); err != nil {
 			return err
 		}
+	}
+	return nil
+}
 
+// subtreeIDs 按 ParentID 逐层收集 rootID 及其子孙的ID
+// batch 为空时只收集未删除的记录，否则只收集属于该删除批次的记录
+func subtreeIDs(tx *gorm.DB, rootID, batch string) ([]string, error) {
+	ids := []string{rootID}
+	level := []string{rootID}
+	for len(level) > 0 {
+		var children []string
+		query := tx.Model(&File{}).Where("parent_id IN ?", level)
+		if batch != "" {
+			query = tx.Unscoped().Model(&File{}).Where("parent_id IN ? AND delete_batch = ?", level, batch)
+		}
+		if err := query.Pluck("id", &children).Error; err != nil {
+			return nil, err
+		}
+		ids = append(ids, children...)
+		level = children
+	}
+	return ids, nil
+}
+
+// DeleteFile 删除指定ID的文件，只有所有者可以删除
+// 删除文件夹时整个子树及其分享链接以同一删除批次软删除，回收站中只显示被删除的顶层项；
+// 回收站不占用配额时返回需释放的空间大小，由调用方计入配额
+func DeleteFile(db *gorm.DB, fileID string, ownerID uint) (int64, error) {
+	var released int64
+	err := db.Transaction(func(tx *gorm.DB) error {
 		var f File
 		if err := tx.First(&f, "id = ?", fileID).Error; err != nil {
 			return err
@@ -24,16 +61,40 @@ func DeleteFile(db *gorm.DB, fileID string, ownerID uint) error {
 		if f.OwnerID != ownerID {
 			return ErrNoPermission
 		}
-		if err := tx.Delete(&f).Error; err != nil {
-			return err
+		ids := []string{f.ID}
+		if f.Type == "folder" {
+			var err error
+			if ids, err = subtreeIDs(tx, f.ID, ""); err != nil {
+				return err
+			}
 		}
-		return nil
+		now, batch := time.Now(), uuid.New().String()
+		releaseQuota := !DefaultRecyclePolicy.CountInQuota
+		if releaseQuota {
+			var err error
+			if released, err = quotaOf(tx, ids); err != nil {
+				return err
+			}
+		}
+		return inChunks(ids, func(chunk []string) error {
+			// 分享链接随文件失效，还原时一并恢复
+			if err := tx.Model(&Share{}).Where("resource_id IN ?", chunk).
+				Updates(map[string]interface{}{"deleted_at": now, "delete_batch": batch}).Error; err != nil {
+				return err
+			}
+			return tx.Model(&File{}).Where("id IN ?", chunk).
+				Updates(map[string]interface{}{"deleted_at": now, "delete_batch": batch, "quota_released": releaseQuota}).Error
+		})
 	})
+	return released, err
 }
 
 // RestoreFile 恢复回收站中的文件（软删除还原），可指定新还原路径
-func RestoreFile(db *gorm.DB, fileID string, ownerID uint, targetParentID ...string) error {
-	return db.Transaction(func(tx *gorm.DB) error {
+// 同一删除批次中该项及其子孙会一并还原，随之删除的分享链接也会恢复；
+// 返回移入回收站时已释放、还原后需重新计入配额的空间大小
+func RestoreFile(db *gorm.DB, fileID string, ownerID uint, targetParentID ...string) (int64, error) {
+	var charged int64
+	err := db.Transaction(func(tx *gorm.DB) error {
 		var f File
 		if err := tx.Unscoped().First(&f, "id = ?", fileID).Error; err != nil {
 			return err
@@ -62,19 +123,56 @@ func RestoreFile(db *gorm.DB, fileID string, ownerID uint, targetParentID ...str
 		if count > 0 {
 			return ErrNameExists
 		}
-		if f.DeletedAt.Valid {
-			res := tx.Unscoped().Model(&File{}).
-				Where("id = ? AND owner_id = ?", fileID, ownerID).
-				Updates(map[string]interface{}{"deleted_at": nil, "parent_id": parentID})
-			return res.Error
+		if !f.DeletedAt.Valid {
+			return nil // 已是正常状态
+		}
+		ids := []string{f.ID}
+		if f.DeleteBatch != "" {
+			var err error
+			if ids, err = subtreeIDs(tx, f.ID, f.DeleteBatch); err != nil {
+				return err
+			}
+		}
+		// 同一批次的记录在移入回收站时一起释放配额
+		if f.QuotaReleased {
+			var err error
+			if charged, err = quotaOf(tx, ids); err != nil {
+				return err
+			}
+		}
+		if err := tx.Unscoped().Model(&File{}).
+			Where("id = ? AND owner_id = ?", fileID, ownerID).
+			Updates(map[string]interface{}{"deleted_at": nil, "delete_batch": "", "quota_released": false, "parent_id": parentID}).Error; err != nil {
+			return err
+		}
+		if parentID != f.ParentID {
+			if err := relinkSubtree(tx, f.ID, parentID); err != nil {
+				return err
+			}
+		}
+		if f.DeleteBatch == "" {
+			return nil
 		}
-		return nil // 已是正常状态
+		restore := map[string]interface{}{"deleted_at": nil, "delete_batch": ""}
+		return inChunks(ids, func(chunk []string) error {
+			if err := tx.Unscoped().Model(&Share{}).
+				Where("resource_id IN ? AND delete_batch = ?", chunk, f.DeleteBatch).Updates(restore).Error; err != nil {
+				return err
+			}
+			return tx.Unscoped().Model(&File{}).
+				Where("id IN ? AND delete_batch = ?", chunk, f.DeleteBatch).
+				Updates(map[string]interface{}{"deleted_at": nil, "delete_batch": "", "quota_released": false}).Error
+		})
 	})
+	return charged, err
 }
 
-// PermanentlyDeleteFile 彻底删除回收站中的文件（物理删除）
-func PermanentlyDeleteFile(db *gorm.DB, fileID string, ownerID uint) error {
-	return db.Transaction(func(tx *gorm.DB) error {
+// PermanentlyDeleteFile 彻底删除回收站中的文件（物理删除），同一删除批次中的子孙一并删除
+// 文件不在回收站中时返回 gorm.ErrRecordNotFound
+// 返回需释放的空间大小（内容和历史版本），移入回收站时已释放的记录不再重复计算
+func PermanentlyDeleteFile(db *gorm.DB, fileID string, ownerID uint) (int64, error) {
+	var freed int64
+	err := db.Transaction(func(tx *gorm.DB) error {
 		var f File
 		if err := tx.Unscoped().First(&f, "id = ?", fileID).Error; err != nil {
 			return err
@@ -82,14 +180,54 @@ func PermanentlyDeleteFile(db *gorm.DB, fileID string, ownerID uint) error {
 		if f.OwnerID != ownerID {
 			return ErrNoPermission
 		}
-		// 先删除所有与该文件相关的分享链接
-		if err := tx.Where("resource_id = ?", fileID).Delete(&Share{}).Error; err != nil {
-			return err
+		// 只能彻底删除回收站中的文件，未删除的文件视为不存在
+		if !f.DeletedAt.Valid {
+			return gorm.ErrRecordNotFound
 		}
-		// 物理删除文件元数据
-		if err := tx.Unscoped().Delete(&f).Error; err != nil {
-			return err
+		ids := []string{f.ID}
+		if f.DeleteBatch != "" {
+			var err error
+			if ids, err = subtreeIDs(tx, f.ID, f.DeleteBatch); err != nil {
+				return err
+			}
 		}
-		return nil
+		if !f.QuotaReleased {
+			var err error
+			if freed, err = quotaOf(tx, ids); err != nil {
+				return err
+			}
+		}
+		return inChunks(ids, func(chunk []string) error {
+			// 先删除所有与这些文件相关的分享链接
+			if err := tx.Unscoped().Where("resource_id IN ?", chunk).Delete(&Share{}).Error; err != nil {
+				return err
+			}
+			// 删除历史版本
+			if err := tx.Where("file_id IN ?", chunk).Delete(&FileVersion{}).Error; err != nil {
+				return err
+			}
+			// 删除目录树中的祖先关系
+			if err := tx.Where("descendant_id IN ? OR ancestor_id IN ?", chunk, chunk).Delete(&FileAncestor{}).Error; err != nil {
+				return err
+			}
+			// 删除文件名索引
+			if err := tx.Where("file_id IN ?", chunk).Delete(&FileNameToken{}).Error; err != nil {
+				return err
+			}
+			// 删除标签和收藏
+			if err := tx.Where("file_id IN ?", chunk).Delete(&FileTag{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("file_id IN ?", chunk).Delete(&Favorite{}).Error; err != nil {
+				return err
+			}
+			// 删除自定义元数据
+			if err := tx.Where("file_id IN ?", chunk).Delete(&FileMeta{}).Error; err != nil {
+				return err
+			}
+			// 物理删除文件元数据
+			return tx.Unscoped().Where("id IN ?", chunk).Delete(&File{}).Error
+		})
 	})
+	return freed, err
 }
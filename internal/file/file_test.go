@@ -13,7 +13,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	if err != nil {
 		t.Fatalf("failed to connect database: %v", err)
 	}
-	if err := db.AutoMigrate(&File{}, &FileContent{}, &UserRoot{}, &Share{}); err != nil {
+	if err := db.AutoMigrate(&File{}, &FileAncestor{}, &FileNameToken{}, &Tag{}, &FileTag{}, &Favorite{}, &FileMeta{}, &SearchIndexVersion{}, &FileContent{}, &UserRoot{}, &Share{}, &FileVersion{}, &VersionPolicy{}, &SavedSearch{}, &PendingBlob{}); err != nil {
 		t.Fatalf("failed to migrate: %v", err)
 	}
 	return db
@@ -36,7 +36,7 @@ func TestDeleteFile_MoveToRecycleBin(t *testing.T) {
 	}
 	db.Create(file)
 	// 删除文件（应为软删除）
-	err := DeleteFile(db, file.ID, userID)
+	_, err := DeleteFile(db, file.ID, userID)
 	if err != nil {
 		t.Fatalf("delete file failed: %v", err)
 	}
@@ -83,7 +83,7 @@ func TestRestoreFileFromRecycleBin(t *testing.T) {
 	db.Delete(file) // 软删除
 
 	// 恢复文件
-	err := RestoreFile(db, file.ID, userID)
+	_, err := RestoreFile(db, file.ID, userID)
 	if err != nil {
 		t.Fatalf("restore file failed: %v", err)
 	}
@@ -105,7 +105,7 @@ func TestPermanentlyDeleteFileFromRecycleBin(t *testing.T) {
 	db.Delete(file) // 软删除
 
 	// 彻底删除
-	err := PermanentlyDeleteFile(db, file.ID, userID)
+	_, err := PermanentlyDeleteFile(db, file.ID, userID)
 	if err != nil {
 		t.Fatalf("permanently delete file failed: %v", err)
 	}
@@ -131,7 +131,7 @@ func TestRestoreFile_ParentNotExist(t *testing.T) {
 	db.Create(file)
 	db.Delete(file)
 	// 尝试还原
-	err := RestoreFile(db, file.ID, userID)
+	_, err := RestoreFile(db, file.ID, userID)
 	if err != ErrRestoreParentNotExist {
 		t.Errorf("should return ErrRestoreParentNotExist, got %v", err)
 	}
@@ -154,7 +154,7 @@ func TestRestoreFile_WithTargetParentID(t *testing.T) {
 	db.Create(file)
 	db.Delete(file)
 	// 1. 指定B为新还原路径，B下无同名文件，应成功
-	err := RestoreFile(db, file.ID, userID, folderB.ID)
+	_, err := RestoreFile(db, file.ID, userID, folderB.ID)
 	if err != nil {
 		t.Fatalf("restore file to B failed: %v", err)
 	}
@@ -165,7 +165,7 @@ func TestRestoreFile_WithTargetParentID(t *testing.T) {
 	}
 	// 2. 指定不存在的目录，应返回 ErrRestoreParentNotExist
 	db.Delete(file) // 再次软删除
-	err = RestoreFile(db, file.ID, userID, "not_exist")
+	_, err = RestoreFile(db, file.ID, userID, "not_exist")
 	if err != ErrRestoreParentNotExist {
 		t.Errorf("should return ErrRestoreParentNotExist, got %v", err)
 	}
@@ -173,8 +173,105 @@ func TestRestoreFile_WithTargetParentID(t *testing.T) {
 	db.Delete(file) // 再次软删除
 	file2 := &File{ID: "f7", Name: "test.txt", Type: "file", ParentID: folderA.ID, OwnerID: userID, UploadTime: time.Now()}
 	db.Create(file2)
-	err = RestoreFile(db, file.ID, userID, folderA.ID)
+	_, err = RestoreFile(db, file.ID, userID, folderA.ID)
 	if err != ErrNameExists {
 		t.Errorf("should return ErrNameExists, got %v", err)
 	}
 }
+
+func setupFolderTree(t *testing.T, db *gorm.DB, userID uint) {
+	now := time.Now()
+	for _, f := range []File{
+		{ID: "root", Name: "root", Type: "folder", OwnerID: userID},
+		{ID: "dir", Name: "dir", Type: "folder", ParentID: "root", OwnerID: userID},
+		{ID: "sub", Name: "sub", Type: "folder", ParentID: "dir", OwnerID: userID},
+		{ID: "a", Name: "a.txt", Type: "file", ParentID: "dir", OwnerID: userID},
+		{ID: "b", Name: "b.txt", Type: "file", ParentID: "sub", OwnerID: userID},
+		{ID: "keep", Name: "keep.txt", Type: "file", ParentID: "root", OwnerID: userID},
+	} {
+		f.UploadTime = now
+		db.Create(&f)
+	}
+	db.Create(&UserRoot{UserID: userID, RootID: "root", CreatedAt: now})
+	db.Create(&Share{ResourceID: "b", ShareType: "public", Token: "tok-b", ExpireAt: now.Add(time.Hour), CreatorID: userID})
+}
+
+func TestDeleteFolder_CascadesToSubtree(t *testing.T) {
+	db := setupTestDB(t)
+	setupFolderTree(t, db, 7)
+	// 子文件先单独删除，属于另一个删除批次
+	if _, err := DeleteFile(db, "a", 7); err != nil {
+		t.Fatalf("delete file failed: %v", err)
+	}
+	if _, err := DeleteFile(db, "dir", 7); err != nil {
+		t.Fatalf("delete folder failed: %v", err)
+	}
+	var live int64
+	db.Model(&File{}).Count(&live)
+	if live != 2 {
+		t.Errorf("only root and keep.txt should stay live, got %d", live)
+	}
+	var dir, b File
+	db.Unscoped().First(&dir, "id = ?", "dir")
+	db.Unscoped().First(&b, "id = ?", "b")
+	if dir.DeleteBatch == "" || b.DeleteBatch != dir.DeleteBatch {
+		t.Errorf("subtree should share one delete batch, got %q and %q", dir.DeleteBatch, b.DeleteBatch)
+	}
+	var shares int64
+	db.Model(&Share{}).Count(&shares)
+	if shares != 0 {
+		t.Errorf("shares in the subtree should be disabled")
+	}
+
+	files, err := ListRecycleBinFiles(db, 7, 1, 10)
+	if err != nil {
+		t.Fatalf("list recycle bin files failed: %v", err)
+	}
+	ids := map[string]bool{}
+	for _, f := range files {
+		ids[f.ID] = true
+	}
+	if len(files) != 2 || !ids["dir"] || !ids["a"] {
+		t.Errorf("recycle bin should only show top-level items, got: %+v", files)
+	}
+}
+
+func TestRestoreFolder_RestoresBatch(t *testing.T) {
+	db := setupTestDB(t)
+	setupFolderTree(t, db, 8)
+	DeleteFile(db, "a", 8)
+	DeleteFile(db, "dir", 8)
+
+	if _, err := RestoreFile(db, "dir", 8); err != nil {
+		t.Fatalf("restore folder failed: %v", err)
+	}
+	var live []string
+	db.Model(&File{}).Order("id").Pluck("id", &live)
+	if len(live) != 5 || live[0] != "b" {
+		t.Errorf("folder, sub folder and b.txt should be restored, got %v", live)
+	}
+	var a File
+	db.Unscoped().First(&a, "id = ?", "a")
+	if !a.DeletedAt.Valid {
+		t.Errorf("a.txt was deleted in an earlier batch and should stay in the recycle bin")
+	}
+	var share Share
+	if err := db.First(&share, "token = ?", "tok-b").Error; err != nil || share.DeleteBatch != "" {
+		t.Errorf("share should be restored with the batch: %v", err)
+	}
+}
+
+func TestPermanentlyDeleteFolder_DeletesBatch(t *testing.T) {
+	db := setupTestDB(t)
+	setupFolderTree(t, db, 9)
+	DeleteFile(db, "dir", 9)
+	if _, err := PermanentlyDeleteFile(db, "dir", 9); err != nil {
+		t.Fatalf("permanently delete folder failed: %v", err)
+	}
+	var total, shares int64
+	db.Unscoped().Model(&File{}).Count(&total)
+	db.Unscoped().Model(&Share{}).Count(&shares)
+	if total != 2 || shares != 0 {
+		t.Errorf("subtree and its shares should be removed, files=%d shares=%d", total, shares)
+	}
+}
@@ -1,78 +1,210 @@
 package file
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
 	"gorm.io/gorm"
 )
 
+var ErrInvalidCursor = errors.New("分页游标无效")
+
 type ListFilesRequest struct {
 	ParentID   string // 指定目录
 	OwnerID    uint   // 当前用户
-	Page       int    // 页码
 	PageSize   int    // 每页数量
-	OrderBy    string // 排序字段
-	Order      string // asc/desc
+	Cursor     string // 上一页返回的 NextCursor，为空表示第一页
+	OrderBy    string // 排序字段：name/upload_time/size/type，默认 upload_time
+	Order      string // asc/desc，默认 desc
 	Name       string // 文件名
 	Type       string // 文件类型
 	UploadTime string // 上传时间
+	Category   string // 分类：images/documents/video/audio/archives/other，只列出该分类的文件
+}
+
+// ListItem 列表中的一项，Size 和 MimeType 由同一查询关联 file_contents 得到，文件夹的 Size 为 nil；
+// Tags 和 Starred 在查询出当前页后批量填充
+type ListItem struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	Ext        string    `json:"ext"`
+	ParentID   string    `json:"parent_id"`
+	OwnerID    uint      `json:"owner_id"`
+	UploadTime time.Time `json:"upload_time"`
+	Size       *int64    `json:"size"`
+	MimeType   string    `json:"mime_type,omitempty"` // 上传时检测的内容类型，文件夹和尚未检测的文件为空
+	Tags       []TagRef  `gorm:"-" json:"tags"`
+	Starred    bool      `gorm:"-" json:"starred"`
 }
 
 type ListFilesResponse struct {
-	Files []File `json:"files"`
-	Total int64  `json:"total"`
+	Files      []ListItem `json:"files"`
+	Total      int64      `json:"total"`       // 仅第一页统计，翻页时为 0，需统计全部记录，代价与目录大小成正比
+	NextCursor string     `json:"next_cursor"` // 为空表示没有下一页
 }
 
-func ListFiles(db *gorm.DB, req ListFilesRequest) (*ListFilesResponse, error) {
-	if req.Page <= 0 {
-		req.Page = 1
+// listOrderColumns 列表允许的排序字段及对应的排序表达式，文件夹的大小按 0 排序
+var listOrderColumns = map[string]string{
+	"name":        "files.name",
+	"upload_time": "files.upload_time",
+	"size":        "COALESCE(file_contents.size, 0)",
+	"type":        "files.type",
+}
+
+// listCursor 游标记录上一页最后一项的排序值和ID，下一页从其后开始，期间插入的记录不会导致重复或遗漏
+type listCursor struct {
+	OrderBy string     `json:"o"`
+	Desc    bool       `json:"d"`
+	Str     string     `json:"s,omitempty"`
+	Time    *time.Time `json:"t,omitempty"`
+	Num     int64      `json:"n,omitempty"`
+	ID      string     `json:"id"`
+}
+
+func (c listCursor) value() interface{} {
+	switch c.OrderBy {
+	case "upload_time":
+		if c.Time == nil {
+			return time.Time{}
+		}
+		return *c.Time
+	case "size", "relevance":
+		return c.Num
 	}
+	return c.Str
+}
+
+func cursorAfter(item ListItem, orderBy string, desc bool) string {
+	c := listCursor{OrderBy: orderBy, Desc: desc, ID: item.ID}
+	switch orderBy {
+	case "name":
+		c.Str = item.Name
+	case "type":
+		c.Str = item.Type
+	case "upload_time":
+		t := item.UploadTime
+		c.Time = &t
+	case "size":
+		if item.Size != nil {
+			c.Num = *item.Size
+		}
+	}
+	return encodeCursor(c)
+}
+
+func encodeCursor(c listCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor 解析游标，排序方式与本次请求不一致时视为无效
+func decodeCursor(s, orderBy string, desc bool) (*listCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c listCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" || c.OrderBy != orderBy || c.Desc != desc {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// ListFiles 按目录列出或按文件名搜索文件，一次查询同时返回文件大小；
+// 按 (排序字段, id) 做游标分页，翻页时不受并发新增文件的影响
+func ListFiles(db *gorm.DB, req ListFilesRequest) (*ListFilesResponse, error) {
 	if req.PageSize <= 0 || req.PageSize > 100 {
 		req.PageSize = 10
 	}
+	orderBy := req.OrderBy
+	column, ok := listOrderColumns[orderBy]
+	if !ok {
+		orderBy = "upload_time"
+		column = listOrderColumns[orderBy]
+	}
+	desc := req.Order != "asc"
 
-	parentID := req.ParentID
-	var query *gorm.DB
-	if parentID == "" && req.Name != "" {
-		// 全局搜索
-		query = db.Model(&File{}).Where("owner_id = ?", req.OwnerID)
-	} else {
+	query := db.Model(&File{}).Where("files.owner_id = ?", req.OwnerID)
+	if req.ParentID != "" || req.Name == "" {
+		parentID := req.ParentID
 		if parentID == "" {
 			// 查询用户根目录ID
 			var userRoot UserRoot
-			err := db.First(&userRoot, "user_id = ?", req.OwnerID).Error
-			if err != nil {
+			if err := db.First(&userRoot, "user_id = ?", req.OwnerID).Error; err != nil {
 				return nil, err
 			}
 			parentID = userRoot.RootID
 		}
-		query = db.Model(&File{}).Where("parent_id = ?", parentID)
+		query = query.Where("files.parent_id = ?", parentID)
 	}
+	// 未指定目录且有文件名时为全局搜索
 	if req.Name != "" {
-		query = query.Where("name LIKE ?", "%"+req.Name+"%")
+		query = query.Where("files.name LIKE ?", "%"+req.Name+"%")
 	}
 	if req.Type != "" {
-		query = query.Where("type = ?", req.Type)
+		query = query.Where("files.type = ?", req.Type)
 	}
 	if req.UploadTime != "" {
-		query = query.Where("DATE(upload_time) = ?", req.UploadTime)
+		query = query.Where("DATE(files.upload_time) = ?", req.UploadTime)
 	}
-	if req.OrderBy != "" {
-		order := req.OrderBy
-		if req.Order == "desc" {
-			order += " desc"
+	query = query.Joins("LEFT JOIN file_contents ON file_contents.hash = files.hash AND files.type = ?", "file")
+	if req.Category != "" {
+		var err error
+		if query, err = categoryFilter(query, req.Category); err != nil {
+			return nil, err
 		}
-		query = query.Order(order)
 	}
-	var files []File
+
 	var total int64
-	query.Count(&total)
-	err := query.Offset((req.Page - 1) * req.PageSize).Limit(req.PageSize).Find(&files).Error
+	if req.Cursor == "" {
+		if err := query.Count(&total).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	cmp := ">"
+	direction := ""
+	if desc {
+		cmp = "<"
+		direction = " desc"
+	}
+	if req.Cursor != "" {
+		c, err := decodeCursor(req.Cursor, orderBy, desc)
+		if err != nil {
+			return nil, err
+		}
+		// 行值比较可直接利用 (parent_id, 排序字段, id) 联合索引定位
+		query = query.Where("("+column+", files.id) "+cmp+" (?, ?)", c.value(), c.ID)
+	}
+	items := []ListItem{}
+	err := query.Select("files.id, files.name, files.type, files.ext, files.parent_id, files.owner_id, files.upload_time, file_contents.size AS size, " +
+		"COALESCE(file_contents.mime_type, '') AS mime_type").
+		Order(column + direction).Order("files.id" + direction).
+		Limit(req.PageSize + 1).Scan(&items).Error
 	if err != nil {
 		return nil, err
 	}
-	return &ListFilesResponse{Files: files, Total: total}, nil
+	resp := &ListFilesResponse{Files: items, Total: total}
+	// 多取一条判断是否还有下一页
+	if len(items) > req.PageSize {
+		resp.Files = items[:req.PageSize]
+		resp.NextCursor = cursorAfter(resp.Files[req.PageSize-1], orderBy, desc)
+	}
+	labeled := make([]*ListItem, len(resp.Files))
+	for i := range resp.Files {
+		labeled[i] = &resp.Files[i]
+	}
+	if err := attachLabels(db, labeled); err != nil {
+		return nil, err
+	}
+	return resp, nil
 }
 
 // ListRecycleBinFiles 分页查询用户回收站（软删除）的文件
+// 同一删除批次中只返回顶层项（父目录不在该批次中），其子孙随顶层项一起还原或彻底删除
 func ListRecycleBinFiles(db *gorm.DB, ownerID uint, page, pageSize int) ([]File, error) {
 	if page <= 0 {
 		page = 1
@@ -81,7 +213,7 @@ func ListRecycleBinFiles(db *gorm.DB, ownerID uint, page, pageSize int) ([]File,
 		pageSize = 10
 	}
 	var files []File
-	err := db.Unscoped().Where("owner_id = ? AND deleted_at IS NOT NULL", ownerID).
+	err := topLevelTrash(db).Where("files.owner_id = ?", ownerID).
 		Offset((page - 1) * pageSize).Limit(pageSize).Find(&files).Error
 	if err != nil {
 		return nil, err
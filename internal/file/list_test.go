@@ -0,0 +1,208 @@
+package file
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupListTest(t *testing.T) *gorm.DB {
+	db := setupTestDB(t)
+	db.Create(&UserRoot{UserID: 1, RootID: "root", CreatedAt: time.Now()})
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, f := range []File{
+		{ID: "root", Name: "root", Type: "folder", OwnerID: 1},
+		{ID: "d1", Name: "docs", Type: "folder", ParentID: "root", OwnerID: 1, UploadTime: base},
+		{ID: "f1", Name: "a.txt", Hash: "h10", Type: "file", ParentID: "root", OwnerID: 1, UploadTime: base.Add(time.Hour)},
+		{ID: "f2", Name: "b.txt", Hash: "h30", Type: "file", ParentID: "root", OwnerID: 1, UploadTime: base.Add(time.Hour)},
+		{ID: "f3", Name: "c.txt", Hash: "h20", Type: "file", ParentID: "root", OwnerID: 1, UploadTime: base.Add(2 * time.Hour)},
+		{ID: "f4", Name: "d.txt", Hash: "h10", Type: "file", ParentID: "root", OwnerID: 1, UploadTime: base.Add(3 * time.Hour)},
+		{ID: "f5", Name: "a-nested.txt", Hash: "h10", Type: "file", ParentID: "d1", OwnerID: 1, UploadTime: base},
+		{ID: "x1", Name: "a.txt", Hash: "h10", Type: "file", ParentID: "other", OwnerID: 2, UploadTime: base},
+	} {
+		db.Create(&f)
+	}
+	db.Create(&FileContent{Hash: "h10", Size: 10})
+	db.Create(&FileContent{Hash: "h20", Size: 20})
+	db.Create(&FileContent{Hash: "h30", Size: 30})
+	return db
+}
+
+// listAll 按游标逐页读取，返回所有ID
+func listAll(t *testing.T, db *gorm.DB, req ListFilesRequest) []string {
+	var ids []string
+	for i := 0; i < 100; i++ {
+		resp, err := ListFiles(db, req)
+		if err != nil {
+			t.Fatalf("list files: %v", err)
+		}
+		for _, f := range resp.Files {
+			ids = append(ids, f.ID)
+		}
+		if resp.NextCursor == "" {
+			return ids
+		}
+		req.Cursor = resp.NextCursor
+	}
+	t.Fatalf("cursor did not terminate")
+	return nil
+}
+
+func TestListFiles_SortAndCursor(t *testing.T) {
+	db := setupListTest(t)
+	cases := []struct {
+		orderBy, order string
+		want           string
+	}{
+		{"name", "asc", "[f1 f2 f3 f4 d1]"},
+		{"name", "desc", "[d1 f4 f3 f2 f1]"},
+		{"size", "asc", "[d1 f1 f4 f3 f2]"},
+		{"size", "desc", "[f2 f3 f4 f1 d1]"},
+		{"upload_time", "asc", "[d1 f1 f2 f3 f4]"},
+		{"upload_time", "desc", "[f4 f3 f2 f1 d1]"},
+		// 非法排序字段回退到上传时间倒序
+		{"name; DROP TABLE files", "desc", "[f4 f3 f2 f1 d1]"},
+	}
+	for _, tc := range cases {
+		ids := listAll(t, db, ListFilesRequest{OwnerID: 1, PageSize: 2, OrderBy: tc.orderBy, Order: tc.order})
+		if got := fmt.Sprint(ids); got != tc.want {
+			t.Errorf("order by %s %s: got %s, want %s", tc.orderBy, tc.order, got, tc.want)
+		}
+	}
+
+	resp, err := ListFiles(db, ListFilesRequest{OwnerID: 1, PageSize: 10, OrderBy: "name", Order: "asc"})
+	if err != nil {
+		t.Fatalf("list files: %v", err)
+	}
+	if resp.Total != 5 || resp.NextCursor != "" {
+		t.Errorf("unexpected total %d or cursor %q", resp.Total, resp.NextCursor)
+	}
+	if resp.Files[0].Size == nil || *resp.Files[0].Size != 10 || resp.Files[4].Size != nil {
+		t.Errorf("file size should come from content, folder size should be nil: %+v", resp.Files)
+	}
+}
+
+func TestListFiles_CursorStableUnderInserts(t *testing.T) {
+	db := setupListTest(t)
+	req := ListFilesRequest{OwnerID: 1, PageSize: 2, OrderBy: "name", Order: "asc"}
+	first, err := ListFiles(db, req)
+	if err != nil {
+		t.Fatalf("list files: %v", err)
+	}
+	// 翻页前在已读过的位置插入新文件，后续页不应重复或遗漏
+	db.Create(&File{ID: "n1", Name: "0.txt", Hash: "h10", Type: "file", ParentID: "root", OwnerID: 1})
+	db.Create(&File{ID: "n2", Name: "bb.txt", Hash: "h10", Type: "file", ParentID: "root", OwnerID: 1})
+	req.Cursor = first.NextCursor
+	ids := listAll(t, db, req)
+	if got := fmt.Sprint(ids); got != "[n2 f3 f4 d1]" {
+		t.Errorf("unexpected pages after insert: %s", got)
+	}
+}
+
+func TestListFiles_SearchAndInvalidCursor(t *testing.T) {
+	db := setupListTest(t)
+	ids := listAll(t, db, ListFilesRequest{OwnerID: 1, Name: "a", PageSize: 1, OrderBy: "name", Order: "asc"})
+	if got := fmt.Sprint(ids); got != "[f5 f1]" {
+		t.Errorf("search should cover all folders of the owner only, got %s", got)
+	}
+
+	resp, _ := ListFiles(db, ListFilesRequest{OwnerID: 1, PageSize: 1, OrderBy: "name"})
+	for _, cursor := range []string{"not-base64!", "e30", resp.NextCursor} {
+		_, err := ListFiles(db, ListFilesRequest{OwnerID: 1, Cursor: cursor, OrderBy: "size"})
+		if err != ErrInvalidCursor {
+			t.Errorf("cursor %q: expected ErrInvalidCursor, got %v", cursor, err)
+		}
+	}
+}
+
+const benchFolderSize = 100000
+
+var (
+	benchOnce sync.Once
+	benchDB   *gorm.DB
+)
+
+// setupListBenchmark 在同一目录下创建10万个文件，各基准测试共用
+func setupListBenchmark(b *testing.B) *gorm.DB {
+	benchOnce.Do(func() {
+		db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+		if err != nil {
+			b.Fatalf("failed to connect database: %v", err)
+		}
+		sqlDB, _ := db.DB()
+		sqlDB.SetMaxOpenConns(1)
+		if err := db.AutoMigrate(&File{}, &FileAncestor{}, &FileNameToken{}, &Tag{}, &FileTag{}, &Favorite{}, &FileMeta{}, &FileContent{}, &UserRoot{}); err != nil {
+			b.Fatalf("failed to migrate: %v", err)
+		}
+		db.Create(&UserRoot{UserID: 1, RootID: "root", CreatedAt: time.Now()})
+		db.Create(&File{ID: "root", Name: "root", Type: "folder", OwnerID: 1})
+		contents := make([]FileContent, 1000)
+		for i := range contents {
+			contents[i] = FileContent{Hash: fmt.Sprintf("h%04d", i), Size: int64(i * 1024)}
+		}
+		db.CreateInBatches(contents, 500)
+		base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		files := make([]File, benchFolderSize)
+		for i := range files {
+			files[i] = File{
+				ID:         fmt.Sprintf("%08d-0000-0000-0000-000000000000", i),
+				Name:       fmt.Sprintf("file-%06d.txt", (i*7919)%benchFolderSize),
+				Hash:       fmt.Sprintf("h%04d", i%1000),
+				Type:       "file",
+				ParentID:   "root",
+				OwnerID:    1,
+				UploadTime: base.Add(time.Duration(i) * time.Second),
+			}
+		}
+		// 列表不依赖目录树，跳过创建钩子加快造数
+		if err := db.Session(&gorm.Session{SkipHooks: true}).CreateInBatches(files, 1000).Error; err != nil {
+			b.Fatalf("failed to create files: %v", err)
+		}
+		benchDB = db
+	})
+	return benchDB
+}
+
+// benchmarkListPage 先按游标翻到第 pages 页，再反复读取下一页
+func benchmarkListPage(b *testing.B, orderBy string, pages int) {
+	db := setupListBenchmark(b)
+	req := ListFilesRequest{OwnerID: 1, PageSize: 100, OrderBy: orderBy, Order: "asc"}
+	for i := 0; i < pages; i++ {
+		resp, err := ListFiles(db, req)
+		if err != nil {
+			b.Fatalf("list files: %v", err)
+		}
+		req.Cursor = resp.NextCursor
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resp, err := ListFiles(db, req)
+		if err != nil || len(resp.Files) != 100 {
+			b.Fatalf("list files: %v", err)
+		}
+	}
+}
+
+func BenchmarkListFiles_FirstPageByName(b *testing.B) { benchmarkListPage(b, "name", 0) }
+func BenchmarkListFiles_DeepPageByName(b *testing.B)  { benchmarkListPage(b, "name", 900) }
+func BenchmarkListFiles_FirstPageByTime(b *testing.B) { benchmarkListPage(b, "upload_time", 0) }
+func BenchmarkListFiles_DeepPageByTime(b *testing.B)  { benchmarkListPage(b, "upload_time", 900) }
+func BenchmarkListFiles_FirstPageBySize(b *testing.B) { benchmarkListPage(b, "size", 0) }
+func BenchmarkListFiles_DeepPageBySize(b *testing.B)  { benchmarkListPage(b, "size", 900) }
+
+// BenchmarkListFiles_DeepPageOffset 同样深度下的 OFFSET 分页，作为对照
+func BenchmarkListFiles_DeepPageOffset(b *testing.B) {
+	db := setupListBenchmark(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var files []File
+		if err := db.Where("parent_id = ?", "root").Order("name").Offset(90000).Limit(100).Find(&files).Error; err != nil {
+			b.Fatalf("list files: %v", err)
+		}
+	}
+}
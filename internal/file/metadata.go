@@ -0,0 +1,319 @@
+package file
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidMeta  = errors.New("元数据无效")
+	ErrMetaTooLarge = errors.New("元数据超出大小限制")
+)
+
+// 元数据的值类型
+const (
+	MetaString = "string"
+	MetaNumber = "number"
+	MetaDate   = "date"
+)
+
+// 每个文件/文件夹的元数据限制
+const (
+	MaxMetaKeys         = 50       // 最多的键数
+	MaxMetaKeyLen       = 64       // 键的最大长度
+	MaxMetaValueLen     = 1024     // 字符串值的最大字节数
+	MaxMetaBytes        = 16 << 10 // 所有键和值的总字节数
+	MaxDescriptionRunes = 2000     // 描述的最大字符数
+)
+
+const metaDateLayout = "2006-01-02"
+
+// metaKeyPattern 键只能由字母、数字、下划线、点和短横线组成
+var metaKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.\-]+$`)
+
+// FileMeta 文件/文件夹的自定义元数据，每个键一条记录
+// Value 为值的规范字符串形式，用于展示和等值匹配；数字和日期另存于 NumValue、TimeValue 以便按范围过滤。
+// 按文件ID关联，移动、重命名、覆盖上传和版本恢复都不影响，复制时一并复制，彻底删除文件时一并删除
+type FileMeta struct {
+	FileID    string     `gorm:"type:char(36);primaryKey" json:"-"`
+	Key       string     `gorm:"column:meta_key;size:64;primaryKey;index:idx_file_meta_owner_key,priority:2" json:"key"`
+	OwnerID   uint       `gorm:"index:idx_file_meta_owner_key,priority:1" json:"-"`
+	Type      string     `gorm:"size:8" json:"type"`
+	Value     string     `gorm:"size:1024" json:"value"`
+	NumValue  *float64   `json:"-"`
+	TimeValue *time.Time `json:"-"`
+}
+
+// MetaItem 设置元数据时的一项，Value 按 Type 解析：数字如 12.5，日期为 2006-01-02 或 RFC3339
+type MetaItem struct {
+	Key   string `json:"key"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Metadata 文件的描述和全部元数据
+type Metadata struct {
+	Description string     `json:"description"`
+	Items       []FileMeta `json:"items"`
+}
+
+// parseMetaTime 解析日期或时间，日期按 UTC 零点
+func parseMetaTime(v string) (time.Time, bool) {
+	if t, err := time.Parse(metaDateLayout, v); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.UTC(), true
+	}
+	return time.Time{}, false
+}
+
+// parseMetaItem 校验并转换为记录，值转为规范形式
+func parseMetaItem(item MetaItem) (FileMeta, error) {
+	key := strings.TrimSpace(item.Key)
+	if len(key) > MaxMetaKeyLen || !metaKeyPattern.MatchString(key) {
+		return FileMeta{}, ErrInvalidMeta
+	}
+	m := FileMeta{Key: key, Type: item.Type}
+	switch item.Type {
+	case MetaString:
+		if len(item.Value) > MaxMetaValueLen || !utf8.ValidString(item.Value) {
+			return FileMeta{}, ErrMetaTooLarge
+		}
+		m.Value = item.Value
+	case MetaNumber:
+		n, err := strconv.ParseFloat(strings.TrimSpace(item.Value), 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return FileMeta{}, ErrInvalidMeta
+		}
+		m.NumValue = &n
+		m.Value = strconv.FormatFloat(n, 'f', -1, 64)
+	case MetaDate:
+		t, ok := parseMetaTime(strings.TrimSpace(item.Value))
+		if !ok {
+			return FileMeta{}, ErrInvalidMeta
+		}
+		m.TimeValue = &t
+		if t.Equal(t.Truncate(24 * time.Hour)) {
+			m.Value = t.Format(metaDateLayout)
+		} else {
+			m.Value = t.Format(time.RFC3339)
+		}
+	default:
+		return FileMeta{}, ErrInvalidMeta
+	}
+	return m, nil
+}
+
+// metaTarget 获取用户的文件或文件夹，回收站中的视为不存在
+func metaTarget(db *gorm.DB, fileID string, ownerID uint) (*File, error) {
+	var f File
+	if err := db.First(&f, "id = ?", fileID).Error; err != nil {
+		return nil, err
+	}
+	if f.OwnerID != ownerID {
+		return nil, ErrNoPermission
+	}
+	return &f, nil
+}
+
+// GetMetadata 获取文件的描述和元数据，元数据按键排序
+func GetMetadata(db *gorm.DB, fileID string, ownerID uint) (*Metadata, error) {
+	f, err := metaTarget(db, fileID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	md := &Metadata{Description: f.Description, Items: []FileMeta{}}
+	if err := db.Where("file_id = ?", f.ID).Order("meta_key").Find(&md.Items).Error; err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+// SetMetadata 设置文件的元数据，已有的键被覆盖，其他键保留；description 不为 nil 时同时修改描述
+// 修改后键数和总大小（键与值的字节数之和）不能超过限制
+func SetMetadata(db *gorm.DB, fileID string, ownerID uint, description *string, items []MetaItem) (*Metadata, error) {
+	if description != nil && utf8.RuneCountInString(*description) > MaxDescriptionRunes {
+		return nil, ErrMetaTooLarge
+	}
+	rows := make([]FileMeta, 0, len(items))
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		m, err := parseMetaItem(item)
+		if err != nil {
+			return nil, err
+		}
+		if seen[m.Key] {
+			return nil, ErrInvalidMeta
+		}
+		seen[m.Key] = true
+		m.FileID = fileID
+		m.OwnerID = ownerID
+		rows = append(rows, m)
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		f, err := metaTarget(tx, fileID, ownerID)
+		if err != nil {
+			return err
+		}
+		if description != nil {
+			if err := tx.Model(f).Update("description", *description).Error; err != nil {
+				return err
+			}
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&rows).Error; err != nil {
+			return err
+		}
+		return checkMetaLimits(tx, fileID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetMetadata(db, fileID, ownerID)
+}
+
+// checkMetaLimits 检查文件的元数据是否超出键数和总大小的限制
+func checkMetaLimits(tx *gorm.DB, fileID string) error {
+	var stat struct {
+		KeyCount int64
+		Bytes    int64
+	}
+	if err := tx.Model(&FileMeta{}).Select("COUNT(*) AS key_count, COALESCE(SUM(LENGTH(meta_key) + LENGTH(value)), 0) AS bytes").
+		Where("file_id = ?", fileID).Scan(&stat).Error; err != nil {
+		return err
+	}
+	if stat.KeyCount > MaxMetaKeys || stat.Bytes > MaxMetaBytes {
+		return ErrMetaTooLarge
+	}
+	return nil
+}
+
+// DeleteMetadata 删除文件的指定元数据键，不存在的键忽略，返回删除的数量
+func DeleteMetadata(db *gorm.DB, fileID string, ownerID uint, keys []string) (int64, error) {
+	if _, err := metaTarget(db, fileID, ownerID); err != nil {
+		return 0, err
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	result := db.Where("file_id = ? AND meta_key IN ?", fileID, keys).Delete(&FileMeta{})
+	return result.RowsAffected, result.Error
+}
+
+// copyMetadata 复制文件的元数据到新文件，idMap 为源文件ID到新文件ID的映射
+func copyMetadata(tx *gorm.DB, idMap map[string]string, ownerID uint) error {
+	srcIDs := make([]string, 0, len(idMap))
+	for id := range idMap {
+		srcIDs = append(srcIDs, id)
+	}
+	return inChunks(srcIDs, func(chunk []string) error {
+		var rows []FileMeta
+		if err := tx.Where("file_id IN ?", chunk).Find(&rows).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		for i := range rows {
+			rows[i].FileID = idMap[rows[i].FileID]
+			rows[i].OwnerID = ownerID
+		}
+		return tx.CreateInBatches(rows, copyBatchSize).Error
+	})
+}
+
+// 元数据过滤的比较方式
+const (
+	MetaOpExists   = "exists"
+	MetaOpEq       = "eq"
+	MetaOpContains = "contains"
+	MetaOpGt       = "gt"
+	MetaOpGte      = "gte"
+	MetaOpLt       = "lt"
+	MetaOpLte      = "lte"
+)
+
+var metaRangeOps = map[string]string{MetaOpGt: ">", MetaOpGte: ">=", MetaOpLt: "<", MetaOpLte: "<="}
+
+// MetaFilter 按元数据过滤：exists 存在该键；eq 值相等；contains 字符串值包含；
+// gt/gte/lt/lte 按数字或日期比较，Value 能解析为数字时比较数字类型的值，否则比较日期类型的值
+type MetaFilter struct {
+	Key   string `json:"key"`
+	Op    string `json:"op"`
+	Value string `json:"value,omitempty"`
+}
+
+// Validate 检查键、比较方式和值
+func (m MetaFilter) Validate() error {
+	if len(m.Key) > MaxMetaKeyLen || !metaKeyPattern.MatchString(m.Key) || len(m.Value) > MaxMetaValueLen {
+		return ErrInvalidFilter
+	}
+	switch m.Op {
+	case MetaOpExists, MetaOpEq, MetaOpContains:
+		return nil
+	}
+	if _, ok := metaRangeOps[m.Op]; !ok {
+		return ErrInvalidFilter
+	}
+	if _, err := strconv.ParseFloat(m.Value, 64); err == nil {
+		return nil
+	}
+	if _, ok := parseMetaTime(m.Value); ok {
+		return nil
+	}
+	return ErrInvalidFilter
+}
+
+// ParseMetaFilter 解析查询参数中的元数据条件，格式为 key:op:value，exists 可省略值
+func ParseMetaFilter(s string) (MetaFilter, error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) < 2 {
+		return MetaFilter{}, ErrInvalidFilter
+	}
+	m := MetaFilter{Key: parts[0], Op: parts[1]}
+	if len(parts) == 3 {
+		m.Value = parts[2]
+	}
+	return m, m.Validate()
+}
+
+// metaCondition 元数据条件对应的子查询，返回满足条件的文件ID
+func metaCondition(db *gorm.DB, ownerID uint, m MetaFilter) (*gorm.DB, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	sub := db.Model(&FileMeta{}).Select("file_id").Where("owner_id = ? AND meta_key = ?", ownerID, m.Key)
+	switch m.Op {
+	case MetaOpExists:
+		return sub, nil
+	case MetaOpEq:
+		if n, err := strconv.ParseFloat(m.Value, 64); err == nil {
+			return sub.Where("(type = ? AND value = ?) OR (type = ? AND num_value = ?)",
+				MetaString, m.Value, MetaNumber, n), nil
+		}
+		if t, ok := parseMetaTime(m.Value); ok {
+			return sub.Where("(type = ? AND value = ?) OR (type = ? AND time_value = ?)",
+				MetaString, m.Value, MetaDate, t), nil
+		}
+		return sub.Where("value = ?", m.Value), nil
+	case MetaOpContains:
+		return sub.Where("type = ? AND value LIKE ?", MetaString, "%"+m.Value+"%"), nil
+	}
+	cmp := metaRangeOps[m.Op]
+	if n, err := strconv.ParseFloat(m.Value, 64); err == nil {
+		return sub.Where("type = ? AND num_value "+cmp+" ?", MetaNumber, n), nil
+	}
+	t, _ := parseMetaTime(m.Value)
+	return sub.Where("type = ? AND time_value "+cmp+" ?", MetaDate, t), nil
+}
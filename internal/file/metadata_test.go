@@ -0,0 +1,214 @@
+package file
+
+import (
+	"strings"
+	"testing"
+)
+
+func metaKeys(md *Metadata) []string {
+	keys := []string{}
+	for _, m := range md.Items {
+		keys = append(keys, m.Key+"="+m.Value)
+	}
+	return keys
+}
+
+func TestMetadata_SetGetDelete(t *testing.T) {
+	db := setupSearchTest(t)
+	desc := "2024 年度报告终稿"
+	md, err := SetMetadata(db, "r1", 1, &desc, []MetaItem{
+		{Key: "project", Type: MetaString, Value: "Apollo"},
+		{Key: "amount", Type: MetaNumber, Value: " 12.50 "},
+		{Key: "due", Type: MetaDate, Value: "2024-03-01"},
+	})
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if md.Description != desc || strings.Join(metaKeys(md), ",") != "amount=12.5,due=2024-03-01,project=Apollo" {
+		t.Errorf("unexpected metadata: %+v", md)
+	}
+
+	// 已有的键被覆盖，其他键保留，描述不变
+	md, err = SetMetadata(db, "r1", 1, nil, []MetaItem{{Key: "project", Type: MetaString, Value: "Gemini"}})
+	if err != nil || md.Description != desc || strings.Join(metaKeys(md), ",") != "amount=12.5,due=2024-03-01,project=Gemini" {
+		t.Errorf("overwrite: %+v %v", md, err)
+	}
+	// 文件夹也可以设置
+	if _, err := SetMetadata(db, "work", 1, nil, []MetaItem{{Key: "owner", Type: MetaString, Value: "张三"}}); err != nil {
+		t.Errorf("folder metadata: %v", err)
+	}
+
+	for _, bad := range []MetaItem{
+		{Key: "a b", Type: MetaString, Value: "x"},
+		{Key: "n", Type: MetaNumber, Value: "abc"},
+		{Key: "d", Type: MetaDate, Value: "03/01/2024"},
+		{Key: "t", Type: "bool", Value: "true"},
+	} {
+		if _, err := SetMetadata(db, "r1", 1, nil, []MetaItem{bad}); err != ErrInvalidMeta {
+			t.Errorf("%+v: expected ErrInvalidMeta, got %v", bad, err)
+		}
+	}
+	if _, err := SetMetadata(db, "r1", 2, nil, []MetaItem{{Key: "k", Type: MetaString}}); err != ErrNoPermission {
+		t.Errorf("expected ErrNoPermission, got %v", err)
+	}
+
+	n, err := DeleteMetadata(db, "r1", 1, []string{"amount", "missing"})
+	if err != nil || n != 1 {
+		t.Errorf("delete: %d %v", n, err)
+	}
+	md, _ = GetMetadata(db, "r1", 1)
+	if strings.Join(metaKeys(md), ",") != "due=2024-03-01,project=Gemini" {
+		t.Errorf("after delete: %+v", md)
+	}
+}
+
+func TestMetadata_Limits(t *testing.T) {
+	db := setupSearchTest(t)
+	long := strings.Repeat("长", MaxDescriptionRunes+1)
+	if _, err := SetMetadata(db, "r1", 1, &long, nil); err != ErrMetaTooLarge {
+		t.Errorf("long description: %v", err)
+	}
+	big := strings.Repeat("x", MaxMetaValueLen+1)
+	if _, err := SetMetadata(db, "r1", 1, nil, []MetaItem{{Key: "k", Type: MetaString, Value: big}}); err != ErrMetaTooLarge {
+		t.Errorf("long value: %v", err)
+	}
+
+	items := make([]MetaItem, MaxMetaKeys)
+	for i := range items {
+		items[i] = MetaItem{Key: "k" + strings.Repeat("0", i), Type: MetaNumber, Value: "1"}
+	}
+	if _, err := SetMetadata(db, "r1", 1, nil, items); err != nil {
+		t.Fatalf("max keys: %v", err)
+	}
+	// 超出键数时整体回滚
+	if _, err := SetMetadata(db, "r1", 1, nil, []MetaItem{{Key: "extra", Type: MetaNumber, Value: "1"}}); err != ErrMetaTooLarge {
+		t.Errorf("too many keys: %v", err)
+	}
+	md, _ := GetMetadata(db, "r1", 1)
+	if len(md.Items) != MaxMetaKeys {
+		t.Errorf("failed set should not change metadata, got %d keys", len(md.Items))
+	}
+
+	// 总大小超过限制
+	value := strings.Repeat("v", MaxMetaValueLen)
+	items = nil
+	for i := 0; i < MaxMetaBytes/MaxMetaValueLen+1; i++ {
+		items = append(items, MetaItem{Key: "s" + strings.Repeat("0", i), Type: MetaString, Value: value})
+	}
+	if _, err := SetMetadata(db, "r2", 1, nil, items); err != ErrMetaTooLarge {
+		t.Errorf("total size: %v", err)
+	}
+}
+
+func TestMetadata_TravelsWithFile(t *testing.T) {
+	db := setupTestDB(t)
+	for _, f := range []File{
+		{ID: "root", Name: "root", Type: "folder", OwnerID: 1},
+		{ID: "src", Name: "src", Type: "folder", ParentID: "root", OwnerID: 1},
+		{ID: "f1", Name: "a.txt", Hash: "h1", Type: "file", ParentID: "src", OwnerID: 1},
+		{ID: "dst", Name: "dst", Type: "folder", ParentID: "root", OwnerID: 1},
+	} {
+		db.Create(&f)
+	}
+	db.Create(&FileContent{Hash: "h1", Size: 10})
+	db.Create(&FileContent{Hash: "h2", Size: 20})
+	desc := "合同扫描件"
+	if _, err := SetMetadata(db, "f1", 1, &desc, []MetaItem{{Key: "client", Type: MetaString, Value: "ACME"}}); err != nil {
+		t.Fatal(err)
+	}
+	SetMetadata(db, "src", 1, nil, []MetaItem{{Key: "year", Type: MetaNumber, Value: "2024"}})
+
+	plan, err := PlanCopy(db, "src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied, err := ExecuteCopy(db, plan, 1, "dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, _ := GetMetadata(db, copied.ID, 1)
+	if strings.Join(metaKeys(md), ",") != "year=2024" {
+		t.Errorf("copied folder metadata: %+v", md)
+	}
+	var f1 File
+	db.Where("parent_id = ?", copied.ID).First(&f1)
+	md, _ = GetMetadata(db, f1.ID, 1)
+	if md.Description != desc || strings.Join(metaKeys(md), ",") != "client=ACME" {
+		t.Errorf("copied file metadata: %+v", md)
+	}
+
+	// 覆盖上传和版本恢复保留元数据
+	var src File
+	db.First(&src, "id = ?", "f1")
+	if _, err := OverwriteFile(db, &src, "h2"); err != nil {
+		t.Fatal(err)
+	}
+	versions, _ := ListVersions(db, "f1", 1)
+	if _, err := RestoreVersion(db, "f1", versions[0].ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	md, _ = GetMetadata(db, "f1", 1)
+	if md.Description != desc || len(md.Items) != 1 {
+		t.Errorf("metadata after overwrite and restore: %+v", md)
+	}
+
+	if _, err := DeleteFile(db, "f1", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PermanentlyDeleteFile(db, "f1", 1); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Model(&FileMeta{}).Where("file_id = ?", "f1").Count(&count)
+	if count != 0 {
+		t.Errorf("metadata should be removed with the file, got %d", count)
+	}
+}
+
+func TestSearchFiles_MetaFilter(t *testing.T) {
+	db := setupSearchTest(t)
+	SetMetadata(db, "r1", 1, nil, []MetaItem{
+		{Key: "amount", Type: MetaNumber, Value: "120"},
+		{Key: "due", Type: MetaDate, Value: "2024-03-01"},
+		{Key: "client", Type: MetaString, Value: "ACME Corp"},
+	})
+	SetMetadata(db, "r2", 1, nil, []MetaItem{
+		{Key: "amount", Type: MetaNumber, Value: "80"},
+		{Key: "due", Type: MetaDate, Value: "2024-05-01"},
+	})
+	SetMetadata(db, "r3", 1, nil, []MetaItem{{Key: "amount", Type: MetaString, Value: "unknown"}})
+
+	for _, tc := range []struct {
+		filter string
+		want   string
+	}{
+		{"amount:exists", "r1,r2,r3"},
+		{"amount:gt:100", "r1"},
+		{"amount:lte:120", "r1,r2"},
+		{"amount:eq:80.0", "r2"},
+		{"amount:eq:unknown", "r3"},
+		{"due:gte:2024-04-01", "r2"},
+		{"client:contains:acme", "r1"},
+	} {
+		m, err := ParseMetaFilter(tc.filter)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.filter, err)
+		}
+		got := strings.Join(sorted(searchIDs(t, db, SearchRequest{Meta: []MetaFilter{m}})), ",")
+		if got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.filter, got, tc.want)
+		}
+	}
+
+	// 多个条件同时满足
+	a, _ := ParseMetaFilter("amount:gte:50")
+	d, _ := ParseMetaFilter("due:lt:2024-04-01")
+	if got := searchIDs(t, db, SearchRequest{Meta: []MetaFilter{a, d}}); len(got) != 1 || got[0] != "r1" {
+		t.Errorf("combined filters: %v", got)
+	}
+	for _, bad := range []string{"amount", "amount:like:x", "a b:exists", "amount:gt:abc"} {
+		if _, err := ParseMetaFilter(bad); err != ErrInvalidFilter {
+			t.Errorf("%s: expected ErrInvalidFilter, got %v", bad, err)
+		}
+	}
+}
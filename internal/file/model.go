@@ -1,6 +1,9 @@
 package file
 
 import (
+	"fmt"
+	"path"
+	"strings"
 	"time"
 
 	"errors"
@@ -10,20 +13,29 @@ import (
 )
 
 type FileContent struct {
-	Hash string `gorm:"primaryKey;size:64" json:"hash"`
-	Size int64  `json:"size"`
+	Hash     string `gorm:"primaryKey;size:64" json:"hash"`
+	Size     int64  `json:"size"`
+	MimeType string `gorm:"size:128" json:"mime_type"`     // 上传时按文件头检测的 MIME 类型，为空表示尚未检测
+	Category string `gorm:"size:16;index" json:"category"` // 由 MIME 类型确定的分类，为空时按文件扩展名归类
+	// 后台检测 MIME 类型时读取存储失败的次数及下次重试的时间
+	SniffFailures int        `json:"-"`
+	SniffRetryAt  *time.Time `json:"-"`
 	// 可扩展更多内容相关字段，如存储路径等
 }
 
 type File struct {
-	ID         string         `gorm:"type:char(36);primaryKey" json:"id"`
-	Name       string         `gorm:"size:255" json:"name"`
-	Hash       string         `gorm:"size:64;index" json:"hash"` // 外键关联 FileContent
-	Type       string         `gorm:"size:20" json:"type"`
-	ParentID   string         `json:"parent_id"`
-	OwnerID    uint           `json:"owner_id"`
-	UploadTime time.Time      `json:"upload_time"`
-	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+	ID            string         `gorm:"type:char(36);primaryKey;index:idx_files_parent_name,priority:3;index:idx_files_parent_time,priority:3" json:"id"`
+	Name          string         `gorm:"size:255;index:idx_files_parent_name,priority:2" json:"name"`
+	Hash          string         `gorm:"size:64;index" json:"hash"` // 外键关联 FileContent
+	Type          string         `gorm:"size:20" json:"type"`
+	Ext           string         `gorm:"size:32;index:idx_files_owner_ext,priority:2" json:"ext"`                                                // 小写、不含点的扩展名，文件夹为空，用于按扩展名和分类搜索
+	ParentID      string         `gorm:"size:36;index:idx_files_parent_name,priority:1;index:idx_files_parent_time,priority:1" json:"parent_id"` // 与名称/上传时间、ID的联合索引用于目录列表的游标分页
+	OwnerID       uint           `gorm:"index:idx_files_owner_ext,priority:1;index:idx_files_owner_time,priority:1" json:"owner_id"`
+	UploadTime    time.Time      `gorm:"index:idx_files_parent_time,priority:2;index:idx_files_owner_time,priority:2" json:"upload_time"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+	DeleteBatch   string         `gorm:"size:36;index" json:"delete_batch,omitempty"` // 删除批次ID，删除文件夹时整个子树属于同一批次
+	QuotaReleased bool           `json:"-"`                                           // 已在移入回收站时释放配额，彻底删除时不再重复释放
+	Description   string         `gorm:"type:text" json:"description,omitempty"`      // 用户填写的描述，最多 MaxDescriptionRunes 个字符
 	// 可扩展更多字段，如分享状态、权限等
 }
 
@@ -31,6 +43,9 @@ func (f *File) BeforeCreate(tx *gorm.DB) (err error) {
 	if f.ID == "" {
 		f.ID = uuid.New().String()
 	}
+	if f.Ext == "" && f.Type == "file" {
+		f.Ext = fileExt(f.Name)
+	}
 	return
 }
 
@@ -52,7 +67,51 @@ func RenameFile(db *gorm.DB, fileID string, ownerID uint, newName string) error
 	if count > 0 {
 		return ErrNameExists
 	}
-	return db.Model(&f).Update("name", newName).Error
+	ext := ""
+	if f.Type == "file" {
+		ext = fileExt(newName)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&f).Updates(map[string]interface{}{"name": newName, "ext": ext}).Error; err != nil {
+			return err
+		}
+		return reindexName(tx, &f)
+	})
+}
+
+// numberedName 为重名项生成带序号的名称，如 a.txt -> a (1).txt
+func numberedName(name string, i int) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	return fmt.Sprintf("%s (%d)%s", base, i, ext)
+}
+
+// AvailableName 返回同目录下不重名的名称，name 已被占用时依次追加序号
+func AvailableName(db *gorm.DB, parentID, name string, ownerID uint) (string, error) {
+	candidate := name
+	for i := 1; ; i++ {
+		var count int64
+		if err := db.Model(&File{}).Where("parent_id = ? AND name = ? AND owner_id = ?", parentID, candidate, ownerID).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = numberedName(name, i)
+	}
+}
+
+// FindChildByName 查找同目录下同名的文件或文件夹，不存在时返回nil
+func FindChildByName(db *gorm.DB, parentID, name string, ownerID uint) (*File, error) {
+	var f File
+	err := db.Where("parent_id = ? AND name = ? AND owner_id = ?", parentID, name, ownerID).First(&f).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
 }
 
 type RenameFileRequest struct {
@@ -88,6 +147,49 @@ func CreateFolder(db *gorm.DB, name, parentID string, ownerID uint) (*File, erro
 	return folder, nil
 }
 
+// FolderTree 在 rootID 下按相对路径（如 a/b/c）逐级查找或创建目录，已存在的同名目录直接复用
+// 已解析的路径会被缓存，适合批量上传、解压等在同一事务中创建大量目录的场景
+type FolderTree struct {
+	db      *gorm.DB
+	ownerID uint
+	ids     map[string]string
+	Created int // 新建的目录数
+}
+
+func NewFolderTree(db *gorm.DB, rootID string, ownerID uint) *FolderTree {
+	return &FolderTree{db: db, ownerID: ownerID, ids: map[string]string{"": rootID}}
+}
+
+// Ensure 返回相对路径 dir 对应的目录ID，"" 和 "." 表示根目录
+func (t *FolderTree) Ensure(dir string) (string, error) {
+	if dir == "." {
+		dir = ""
+	}
+	if id, ok := t.ids[dir]; ok {
+		return id, nil
+	}
+	parentID, err := t.Ensure(path.Dir(dir))
+	if err != nil {
+		return "", err
+	}
+	name := path.Base(dir)
+	folder, err := CreateFolder(t.db, name, parentID, t.ownerID)
+	if err == ErrNameExists {
+		var existing File
+		if err := t.db.Where("parent_id = ? AND name = ? AND type = ?", parentID, name, "folder").First(&existing).Error; err != nil {
+			return "", err
+		}
+		t.ids[dir] = existing.ID
+		return existing.ID, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	t.Created++
+	t.ids[dir] = folder.ID
+	return folder.ID, nil
+}
+
 // 用户根目录映射表
 // 每个用户有唯一的根目录ID
 // UserID为用户ID，RootID为根目录文件夹ID
@@ -130,24 +232,21 @@ func MoveFile(db *gorm.DB, fileID string, ownerID uint, newParentID string) erro
 	}
 	// 防止移动到自身或子目录下（仅对文件夹有效）
 	if f.Type == "folder" {
-		if fileID == newParentID {
-			return ErrMoveToSelfOrChild
+		inside, err := IsDescendant(db, newParentID, fileID)
+		if err != nil {
+			return err
 		}
-		// 检查newParentID是否为fileID的子孙
-		currentID := newParentID
-		for currentID != "" {
-			if currentID == fileID {
-				return ErrMoveToSelfOrChild
-			}
-			var parent File
-			err := db.Select("parent_id").First(&parent, "id = ?", currentID).Error
-			if err != nil {
-				break
-			}
-			currentID = parent.ParentID
+		if inside {
+			return ErrMoveToSelfOrChild
 		}
 	}
-	return db.Model(&f).Update("parent_id", newParentID).Error
+	// parent_id 与目录树祖先关系必须一致，同一事务中更新
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&f).Update("parent_id", newParentID).Error; err != nil {
+			return err
+		}
+		return relinkSubtree(tx, fileID, newParentID)
+	})
 }
 
 // 分享信息表
@@ -158,14 +257,17 @@ func MoveFile(db *gorm.DB, fileID string, ownerID uint, newParentID string) erro
 // ExpireAt: 过期时间
 // CreatorID: 创建者用户ID
 // CreatedAt: 创建时间
+// DeletedAt/DeleteBatch: 分享的文件被删除时随之失效，还原时按删除批次恢复
 
 type Share struct {
-	ID         uint64    `gorm:"primaryKey" json:"id"`
-	ResourceID string    `gorm:"not null" json:"resource_id"`
-	ShareType  string    `gorm:"size:20;not null" json:"share_type"`
-	Token      string    `gorm:"size:64;unique;not null" json:"token"`
-	AccessCode string    `gorm:"size:16" json:"access_code"` // 私有分享访问码
-	ExpireAt   time.Time `gorm:"not null" json:"expire_at"`
-	CreatorID  uint      `gorm:"not null" json:"creator_id"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID          uint64         `gorm:"primaryKey" json:"id"`
+	ResourceID  string         `gorm:"not null" json:"resource_id"`
+	ShareType   string         `gorm:"size:20;not null" json:"share_type"`
+	Token       string         `gorm:"size:64;unique;not null" json:"token"`
+	AccessCode  string         `gorm:"size:16" json:"access_code"` // 私有分享访问码
+	ExpireAt    time.Time      `gorm:"not null" json:"expire_at"`
+	CreatorID   uint           `gorm:"not null" json:"creator_id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	DeleteBatch string         `gorm:"size:36;index" json:"-"`
 }
@@ -0,0 +1,216 @@
+package file
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecyclePolicy 回收站策略
+type RecyclePolicy struct {
+	RetentionDays int  `mapstructure:"retention_days"` // 回收站保留天数，超过后自动彻底删除，<=0 表示不自动清理
+	CountInQuota  bool `mapstructure:"count_in_quota"` // 回收站中的文件是否继续占用配额，否则移入回收站时即释放
+}
+
+// DefaultRecyclePolicy 默认回收站策略，可在启动时由配置覆盖
+var DefaultRecyclePolicy = RecyclePolicy{
+	RetentionDays: 30,
+	CountInQuota:  true,
+}
+
+// topLevelTrash 回收站中的顶层项：同一删除批次中父目录不在该批次里的记录，未记录批次的按单项处理
+func topLevelTrash(db *gorm.DB) *gorm.DB {
+	return db.Unscoped().Model(&File{}).Where("files.deleted_at IS NOT NULL").
+		Where("files.delete_batch IS NULL OR files.delete_batch = '' OR NOT EXISTS (?)",
+			db.Unscoped().Table("files AS p").Select("1").
+				Where("p.id = files.parent_id AND p.delete_batch = files.delete_batch"))
+}
+
+// quotaOf 统计一组文件记录占用的配额：每条记录计入其内容大小和所有历史版本，内容去重不影响统计
+func quotaOf(tx *gorm.DB, ids []string) (int64, error) {
+	var total int64
+	err := inChunks(ids, func(chunk []string) error {
+		var contentSize, versionSize int64
+		if err := tx.Unscoped().Model(&File{}).Where("files.id IN ? AND files.type = ?", chunk, "file").
+			Joins("JOIN file_contents ON file_contents.hash = files.hash").
+			Select("COALESCE(SUM(file_contents.size), 0)").Scan(&contentSize).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&FileVersion{}).Where("file_id IN ?", chunk).
+			Select("COALESCE(SUM(size), 0)").Scan(&versionSize).Error; err != nil {
+			return err
+		}
+		total += contentSize + versionSize
+		return nil
+	})
+	return total, err
+}
+
+// ListTrashBefore 返回删除时间早于 before 的回收站顶层项，ownerID 为 0 时查询所有用户
+func ListTrashBefore(db *gorm.DB, ownerID uint, before time.Time) ([]File, error) {
+	query := topLevelTrash(db).Where("files.deleted_at < ?", before)
+	if ownerID != 0 {
+		query = query.Where("files.owner_id = ?", ownerID)
+	}
+	var files []File
+	err := query.Order("files.deleted_at").Find(&files).Error
+	return files, err
+}
+
+// RecycleBinQuery 回收站列表的查询条件
+type RecycleBinQuery struct {
+	OwnerID  uint
+	Name     string // 名称关键字
+	Type     string // file/folder
+	OrderBy  string // deleted_at/size/name，默认 deleted_at
+	Order    string // asc/desc，默认 desc
+	Page     int
+	PageSize int
+}
+
+// RecycleBinItem 回收站中的一项；文件夹的 Size 为随之删除的子树中所有文件的大小
+type RecycleBinItem struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Type         string    `json:"type"`
+	IsDir        bool      `json:"is_dir"`
+	ParentID     string    `json:"parent_id"`
+	Size         int64     `json:"size"`
+	DeletedAt    time.Time `json:"deleted_at"`
+	OriginalPath string    `json:"original_path"` // 删除前所在目录的路径，如 /docs/2024
+	Restorable   bool      `json:"restorable"`    // 原目录仍存在且没有同名文件，可直接还原
+}
+
+type RecycleBinResponse struct {
+	Items     []RecycleBinItem `json:"items"`
+	Total     int64            `json:"total"`
+	TotalSize int64            `json:"total_size"`
+}
+
+// recycleOrderColumns 回收站允许的排序字段
+var recycleOrderColumns = map[string]string{
+	"deleted_at": "files.deleted_at",
+	"size":       "size",
+	"name":       "files.name",
+}
+
+// recycleSizeExpr 回收站项的大小：属于删除批次时统计整个批次的文件，否则为自身内容大小
+const recycleSizeExpr = `CASE WHEN files.delete_batch IS NULL OR files.delete_batch = '' THEN
+	(SELECT COALESCE(SUM(fc.size), 0) FROM file_contents fc WHERE fc.hash = files.hash AND files.type = 'file')
+ELSE
+	(SELECT COALESCE(SUM(fc.size), 0) FROM files f2 JOIN file_contents fc ON fc.hash = f2.hash
+	 WHERE f2.delete_batch = files.delete_batch AND f2.type = 'file')
+END`
+
+// filterRecycleBin 按名称和类型过滤回收站顶层项
+func filterRecycleBin(db *gorm.DB, ownerID uint, name, fileType string) *gorm.DB {
+	query := topLevelTrash(db).Where("files.owner_id = ?", ownerID)
+	if name != "" {
+		query = query.Where("files.name LIKE ?", "%"+name+"%")
+	}
+	if fileType != "" {
+		query = query.Where("files.type = ?", fileType)
+	}
+	return query
+}
+
+// RecycleBinIDs 返回符合名称和类型过滤条件的所有回收站顶层项ID，用于按条件批量还原或彻底删除
+func RecycleBinIDs(db *gorm.DB, ownerID uint, name, fileType string) ([]string, error) {
+	var ids []string
+	err := filterRecycleBin(db, ownerID, name, fileType).Order("files.deleted_at").Pluck("files.id", &ids).Error
+	return ids, err
+}
+
+// SearchRecycleBin 分页查询回收站顶层项，支持名称搜索、类型过滤和按删除时间/大小/名称排序，
+// 同时返回符合条件的总数、总大小以及每项的原路径和能否直接还原
+func SearchRecycleBin(db *gorm.DB, q RecycleBinQuery) (*RecycleBinResponse, error) {
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	if q.PageSize <= 0 || q.PageSize > 100 {
+		q.PageSize = 20
+	}
+	column, ok := recycleOrderColumns[q.OrderBy]
+	if !ok {
+		column = recycleOrderColumns["deleted_at"]
+	}
+	if q.Order != "asc" {
+		column += " desc"
+	}
+
+	sized := filterRecycleBin(db, q.OwnerID, q.Name, q.Type).
+		Select("files.*, (" + recycleSizeExpr + ") AS size")
+	resp := &RecycleBinResponse{Items: []RecycleBinItem{}}
+	if err := db.Table("(?) AS t", sized).
+		Select("COUNT(*) AS total, COALESCE(SUM(size), 0) AS total_size").
+		Row().Scan(&resp.Total, &resp.TotalSize); err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		File
+		Size int64
+	}
+	if err := sized.Order(column).Order("files.id").
+		Offset((q.Page - 1) * q.PageSize).Limit(q.PageSize).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	folders := map[string]folderInfo{}
+	for _, r := range rows {
+		item := RecycleBinItem{
+			ID:        r.ID,
+			Name:      r.Name,
+			Type:      r.Type,
+			IsDir:     r.Type == "folder",
+			ParentID:  r.ParentID,
+			Size:      r.Size,
+			DeletedAt: r.DeletedAt.Time,
+		}
+		folder, err := folderPath(db, r.ParentID, folders)
+		if err != nil {
+			return nil, err
+		}
+		item.OriginalPath = folder.path
+		if folder.live {
+			var count int64
+			if err := db.Model(&File{}).Where("parent_id = ? AND name = ?", r.ParentID, r.Name).Count(&count).Error; err != nil {
+				return nil, err
+			}
+			item.Restorable = count == 0
+		}
+		resp.Items = append(resp.Items, item)
+	}
+	return resp, nil
+}
+
+// folderInfo 回收站项原目录的路径及其是否仍存在且未被删除
+type folderInfo struct {
+	path string
+	live bool
+}
+
+// folderPath 通过目录树解析目录的完整路径（不含用户根目录），cache 缓存同一页中已解析的目录
+func folderPath(db *gorm.DB, folderID string, cache map[string]folderInfo) (folderInfo, error) {
+	if info, ok := cache[folderID]; ok {
+		return info, nil
+	}
+	ancestors, err := Ancestors(db, folderID)
+	if err != nil {
+		return folderInfo{}, err
+	}
+	// 目录已被彻底删除或路径上有已删除的目录时不能直接还原
+	info := folderInfo{live: len(ancestors) > 0 && ancestors[0].ParentID == ""}
+	var names []string
+	for _, f := range ancestors {
+		if f.DeletedAt.Valid {
+			info.live = false
+		}
+		if f.ParentID != "" {
+			names = append(names, f.Name)
+		}
+	}
+	info.path = "/" + strings.Join(names, "/")
+	cache[folderID] = info
+	return info, nil
+}
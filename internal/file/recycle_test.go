@@ -0,0 +1,137 @@
+package file
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// withTrashQuota 临时修改回收站配额策略，返回恢复函数
+func withTrashQuota(countInQuota bool) func() {
+	old := DefaultRecyclePolicy
+	DefaultRecyclePolicy.CountInQuota = countInQuota
+	return func() { DefaultRecyclePolicy = old }
+}
+
+func TestRecycleQuota_ReleasedOnceWhenTrashFree(t *testing.T) {
+	defer withTrashQuota(false)()
+	db := setupTestDB(t)
+	setupFolderTree(t, db, 10)
+	// a.txt 和 b.txt 内容相同，去重后仍按两条记录各自释放；a.txt 另有一个历史版本
+	db.Model(&File{}).Where("id IN ?", []string{"a", "b"}).Update("hash", "h1")
+	db.Create(&FileContent{Hash: "h1", Size: 100})
+	db.Create(&FileVersion{FileID: "a", OwnerID: 10, Version: 1, Hash: "h0", Size: 7})
+
+	released, err := DeleteFile(db, "dir", 10)
+	if err != nil || released != 207 {
+		t.Fatalf("delete should release 207 bytes, got %d, %v", released, err)
+	}
+	freed, err := PermanentlyDeleteFile(db, "dir", 10)
+	if err != nil || freed != 0 {
+		t.Errorf("quota already released, permanent delete should free 0, got %d, %v", freed, err)
+	}
+	var versions int64
+	db.Model(&FileVersion{}).Count(&versions)
+	if versions != 0 {
+		t.Errorf("versions should be removed with the file")
+	}
+}
+
+func TestRecycleQuota_RestoreChargesAgain(t *testing.T) {
+	defer withTrashQuota(false)()
+	db := setupTestDB(t)
+	setupFolderTree(t, db, 11)
+	db.Model(&File{}).Where("id = ?", "b").Update("hash", "h1")
+	db.Create(&FileContent{Hash: "h1", Size: 100})
+
+	DeleteFile(db, "dir", 11)
+	charged, err := RestoreFile(db, "dir", 11)
+	if err != nil || charged != 100 {
+		t.Fatalf("restore should charge 100 bytes, got %d, %v", charged, err)
+	}
+	// 还原后再次删除、在回收站占用配额的策略下彻底删除，应释放且仅释放一次
+	DefaultRecyclePolicy.CountInQuota = true
+	released, _ := DeleteFile(db, "dir", 11)
+	freed, err := PermanentlyDeleteFile(db, "dir", 11)
+	if released != 0 || freed != 100 || err != nil {
+		t.Errorf("trash counts in quota: released=%d freed=%d err=%v", released, freed, err)
+	}
+}
+
+func TestPermanentlyDelete_RejectsLiveFiles(t *testing.T) {
+	db := setupTestDB(t)
+	setupFolderTree(t, db, 13)
+	for _, id := range []string{"dir", "keep"} {
+		if _, err := PermanentlyDeleteFile(db, id, 13); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("%s is not in the recycle bin, got %v", id, err)
+		}
+	}
+	var count int64
+	db.Model(&File{}).Count(&count)
+	if count != 6 {
+		t.Errorf("live files must not be removed, %d left", count)
+	}
+}
+
+func TestListTrashBefore(t *testing.T) {
+	db := setupTestDB(t)
+	setupFolderTree(t, db, 12)
+	DeleteFile(db, "dir", 12)
+	DeleteFile(db, "keep", 12)
+	db.Unscoped().Model(&File{}).Where("id = ?", "keep").Update("deleted_at", time.Now().AddDate(0, 0, -40))
+
+	expired, err := ListTrashBefore(db, 0, time.Now().AddDate(0, 0, -30))
+	if err != nil || len(expired) != 1 || expired[0].ID != "keep" {
+		t.Errorf("only keep.txt is past retention, got %+v, %v", expired, err)
+	}
+	all, _ := ListTrashBefore(db, 12, time.Now().Add(time.Second))
+	if len(all) != 2 {
+		t.Errorf("expected the two top-level items, got %+v", all)
+	}
+}
+
+func TestSearchRecycleBin(t *testing.T) {
+	db := setupTestDB(t)
+	setupFolderTree(t, db, 13)
+	db.Model(&File{}).Where("id = ?", "b").Update("hash", "h1")
+	db.Model(&File{}).Where("id = ?", "keep").Update("hash", "h2")
+	db.Create(&FileContent{Hash: "h1", Size: 100})
+	db.Create(&FileContent{Hash: "h2", Size: 30})
+	DeleteFile(db, "a", 13)
+	DeleteFile(db, "dir", 13)
+	DeleteFile(db, "keep", 13)
+	// 原目录下已有同名文件，不能直接还原
+	db.Create(&File{ID: "keep2", Name: "keep.txt", Type: "file", ParentID: "root", OwnerID: 13, UploadTime: time.Now()})
+
+	resp, err := SearchRecycleBin(db, RecycleBinQuery{OwnerID: 13, OrderBy: "size"})
+	if err != nil {
+		t.Fatalf("search recycle bin: %v", err)
+	}
+	if resp.Total != 3 || resp.TotalSize != 130 || len(resp.Items) != 3 {
+		t.Fatalf("unexpected totals: total=%d size=%d items=%d", resp.Total, resp.TotalSize, len(resp.Items))
+	}
+	byID := map[string]RecycleBinItem{}
+	for _, item := range resp.Items {
+		byID[item.ID] = item
+	}
+	if resp.Items[0].ID != "dir" || byID["dir"].Size != 100 || !byID["dir"].IsDir || !byID["dir"].Restorable {
+		t.Errorf("folder should be the largest item and restorable: %+v", resp.Items)
+	}
+	if byID["a"].OriginalPath != "/dir" || byID["a"].Restorable {
+		t.Errorf("a.txt was in the deleted folder /dir and cannot be restored in place: %+v", byID["a"])
+	}
+	if byID["keep"].OriginalPath != "/" || byID["keep"].Restorable {
+		t.Errorf("keep.txt conflicts with a live file: %+v", byID["keep"])
+	}
+
+	resp, _ = SearchRecycleBin(db, RecycleBinQuery{OwnerID: 13, Name: "ke", Type: "file"})
+	if resp.Total != 1 || resp.Items[0].ID != "keep" {
+		t.Errorf("name and type filter should match keep.txt only: %+v", resp.Items)
+	}
+	ids, err := RecycleBinIDs(db, 13, "", "folder")
+	if err != nil || len(ids) != 1 || ids[0] != "dir" {
+		t.Errorf("unexpected ids for folder filter: %v, %v", ids, err)
+	}
+}
@@ -0,0 +1,257 @@
+package file
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSavedSearchNotFound  = errors.New("保存的搜索不存在")
+	ErrSavedSearchExists    = errors.New("已存在同名的保存搜索")
+	ErrTooManySavedSearches = errors.New("保存的搜索数量已达上限")
+	ErrInvalidFilter        = errors.New("搜索条件无效")
+)
+
+// MaxSavedSearches 每个用户最多保存的搜索数
+const MaxSavedSearches = 100
+
+// SearchFilter 可保存的搜索条件，与搜索接口的查询参数一一对应
+// 时间范围可以是固定的 From/To，也可以是相对当前时间的 Within，每次执行时重新计算：
+// today 今天、7d 最近7天、30d 最近30天、this_month 本月、this_year 今年
+type SearchFilter struct {
+	Name      string       `json:"name,omitempty"`
+	Exts      []string     `json:"exts,omitempty"`
+	Category  string       `json:"category,omitempty"`
+	Type      string       `json:"type,omitempty"`
+	MinSize   int64        `json:"min_size,omitempty"`
+	MaxSize   int64        `json:"max_size,omitempty"`
+	From      *time.Time   `json:"from,omitempty"`
+	To        *time.Time   `json:"to,omitempty"`
+	Within    string       `json:"within,omitempty"`
+	FolderID  string       `json:"folder_id,omitempty"`
+	Recursive *bool        `json:"recursive,omitempty"` // 为空表示包含子目录
+	TagIDs    []uint64     `json:"tag_ids,omitempty"`
+	Starred   bool         `json:"starred,omitempty"`
+	Meta      []MetaFilter `json:"meta,omitempty"`
+	OrderBy   string       `json:"order_by,omitempty"`
+	Order     string       `json:"order,omitempty"`
+}
+
+// SavedSearch 用户保存的搜索（智能文件夹），只保存条件，打开时按条件实时搜索
+type SavedSearch struct {
+	ID        uint64       `gorm:"primaryKey" json:"id"`
+	OwnerID   uint         `gorm:"uniqueIndex:idx_saved_searches_owner_name,priority:1" json:"owner_id"`
+	Name      string       `gorm:"size:255;uniqueIndex:idx_saved_searches_owner_name,priority:2" json:"name"`
+	Filter    SearchFilter `gorm:"serializer:json;type:text" json:"filter"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// withinStart 相对时间范围的起始时间
+func withinStart(within string, now time.Time) (time.Time, bool) {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch within {
+	case "today":
+		return day, true
+	case "7d":
+		return now.AddDate(0, 0, -7), true
+	case "30d":
+		return now.AddDate(0, 0, -30), true
+	case "this_month":
+		return day.AddDate(0, 0, 1-now.Day()), true
+	case "this_year":
+		return time.Date(now.Year(), 1, 1, 0, 0, 0, 0, now.Location()), true
+	}
+	return time.Time{}, false
+}
+
+// ValidWithin 是否为支持的相对时间范围
+func ValidWithin(within string) bool {
+	_, ok := withinStart(within, time.Now())
+	return ok
+}
+
+// Validate 检查条件中的枚举值和范围
+func (f SearchFilter) Validate() error {
+	if f.Category != "" && !ValidCategory(f.Category) {
+		return ErrInvalidCategory
+	}
+	if f.Type != "" && f.Type != "file" && f.Type != "folder" {
+		return ErrInvalidFilter
+	}
+	if f.MinSize < 0 || f.MaxSize < 0 || (f.MaxSize > 0 && f.MinSize > f.MaxSize) {
+		return ErrInvalidFilter
+	}
+	if f.Within != "" {
+		if !ValidWithin(f.Within) || f.From != nil || f.To != nil {
+			return ErrInvalidFilter
+		}
+	}
+	if f.OrderBy != "" && f.OrderBy != "relevance" {
+		if _, ok := listOrderColumns[f.OrderBy]; !ok {
+			return ErrInvalidFilter
+		}
+	}
+	if f.Order != "" && f.Order != "asc" && f.Order != "desc" {
+		return ErrInvalidFilter
+	}
+	for _, m := range f.Meta {
+		if err := m.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Request 生成某个用户在 now 时刻执行的搜索请求，相对时间范围按 now 计算
+func (f SearchFilter) Request(ownerID uint, now time.Time) SearchRequest {
+	req := SearchRequest{
+		OwnerID:   ownerID,
+		Name:      f.Name,
+		Exts:      f.Exts,
+		Category:  f.Category,
+		Type:      f.Type,
+		MinSize:   f.MinSize,
+		MaxSize:   f.MaxSize,
+		From:      f.From,
+		To:        f.To,
+		FolderID:  f.FolderID,
+		Recursive: f.Recursive == nil || *f.Recursive,
+		TagIDs:    f.TagIDs,
+		Starred:   f.Starred,
+		Meta:      f.Meta,
+		OrderBy:   f.OrderBy,
+		Order:     f.Order,
+	}
+	if start, ok := withinStart(f.Within, now); ok {
+		req.From = &start
+	}
+	return req
+}
+
+// checkSavedSearch 校验名称、条件和搜索范围的文件夹
+func checkSavedSearch(db *gorm.DB, ownerID uint, name string, filter SearchFilter) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 255 {
+		return "", ErrInvalidFilter
+	}
+	if err := filter.Validate(); err != nil {
+		return "", err
+	}
+	if filter.FolderID != "" {
+		var count int64
+		if err := db.Model(&File{}).Where("id = ? AND owner_id = ? AND type = ?", filter.FolderID, ownerID, "folder").
+			Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return "", ErrInvalidFilter
+		}
+	}
+	return name, nil
+}
+
+// savedSearchNameTaken 用户是否已有同名的保存搜索，exceptID 为正在修改的记录
+func savedSearchNameTaken(db *gorm.DB, ownerID uint, name string, exceptID uint64) (bool, error) {
+	var count int64
+	err := db.Model(&SavedSearch{}).Where("owner_id = ? AND name = ? AND id != ?", ownerID, name, exceptID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// CreateSavedSearch 保存搜索条件，同一用户下名称不能重复
+func CreateSavedSearch(db *gorm.DB, ownerID uint, name string, filter SearchFilter) (*SavedSearch, error) {
+	name, err := checkSavedSearch(db, ownerID, name, filter)
+	if err != nil {
+		return nil, err
+	}
+	s := &SavedSearch{OwnerID: ownerID, Name: name, Filter: filter}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&SavedSearch{}).Where("owner_id = ?", ownerID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= MaxSavedSearches {
+			return ErrTooManySavedSearches
+		}
+		if taken, err := savedSearchNameTaken(tx, ownerID, name, 0); err != nil || taken {
+			if err == nil {
+				err = ErrSavedSearchExists
+			}
+			return err
+		}
+		return tx.Create(s).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ListSavedSearches 用户保存的所有搜索，按名称排序
+func ListSavedSearches(db *gorm.DB, ownerID uint) ([]SavedSearch, error) {
+	searches := []SavedSearch{}
+	err := db.Where("owner_id = ?", ownerID).Order("name").Order("id").Find(&searches).Error
+	return searches, err
+}
+
+// GetSavedSearch 获取用户的一条保存搜索，不属于该用户时视为不存在
+func GetSavedSearch(db *gorm.DB, id uint64, ownerID uint) (*SavedSearch, error) {
+	var s SavedSearch
+	err := db.Where("id = ? AND owner_id = ?", id, ownerID).First(&s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSavedSearchNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// UpdateSavedSearch 修改保存搜索的名称和条件
+func UpdateSavedSearch(db *gorm.DB, id uint64, ownerID uint, name string, filter SearchFilter) (*SavedSearch, error) {
+	name, err := checkSavedSearch(db, ownerID, name, filter)
+	if err != nil {
+		return nil, err
+	}
+	var s *SavedSearch
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if s, err = GetSavedSearch(tx, id, ownerID); err != nil {
+			return err
+		}
+		if taken, err := savedSearchNameTaken(tx, ownerID, name, id); err != nil || taken {
+			if err == nil {
+				err = ErrSavedSearchExists
+			}
+			return err
+		}
+		s.Name = name
+		s.Filter = filter
+		return tx.Save(s).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// DeleteSavedSearch 删除保存的搜索，不影响其中的文件
+func DeleteSavedSearch(db *gorm.DB, id uint64, ownerID uint) error {
+	result := db.Where("id = ? AND owner_id = ?", id, ownerID).Delete(&SavedSearch{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSavedSearchNotFound
+	}
+	return nil
+}
+
+// CountSavedSearch 按保存的条件统计当前符合条件的文件数
+func CountSavedSearch(db *gorm.DB, s *SavedSearch, now time.Time) (int64, error) {
+	return CountFiles(db, s.Filter.Request(s.OwnerID, now))
+}
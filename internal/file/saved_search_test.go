@@ -0,0 +1,104 @@
+package file
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSearchFilter_Request(t *testing.T) {
+	now := time.Date(2024, 5, 20, 15, 30, 0, 0, time.UTC)
+	for within, want := range map[string]time.Time{
+		"today":      time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC),
+		"7d":         time.Date(2024, 5, 13, 15, 30, 0, 0, time.UTC),
+		"this_month": time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		"this_year":  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		req := SearchFilter{Within: within}.Request(1, now)
+		if req.From == nil || !req.From.Equal(want) || req.To != nil {
+			t.Errorf("%s: from = %v", within, req.From)
+		}
+	}
+	if req := (SearchFilter{}).Request(1, now); !req.Recursive || req.From != nil || req.OwnerID != 1 {
+		t.Errorf("defaults: %+v", req)
+	}
+	from := now
+	for _, f := range []SearchFilter{
+		{Within: "yesterday"},
+		{Within: "7d", From: &from},
+		{Category: "bogus"},
+		{Type: "link"},
+		{MinSize: 10, MaxSize: 5},
+		{OrderBy: "owner_id"},
+		{Order: "up"},
+	} {
+		if f.Validate() == nil {
+			t.Errorf("expected invalid: %+v", f)
+		}
+	}
+}
+
+func TestSavedSearch_CRUDAndEvaluate(t *testing.T) {
+	db := setupSearchTest(t)
+	// 只看 2024 年 1 月 1 日当天之后上传的 PDF
+	from := time.Date(2024, 1, 1, 1, 30, 0, 0, time.UTC)
+	filter := SearchFilter{Exts: []string{"pdf"}, From: &from}
+	s, err := CreateSavedSearch(db, 1, " 近期 PDF ", filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "近期 PDF" {
+		t.Errorf("name should be trimmed: %q", s.Name)
+	}
+	if _, err := CreateSavedSearch(db, 1, "近期 PDF", SearchFilter{}); err != ErrSavedSearchExists {
+		t.Errorf("expected ErrSavedSearchExists, got %v", err)
+	}
+	if _, err := CreateSavedSearch(db, 1, "other user's folder", SearchFilter{FolderID: "other"}); err != ErrInvalidFilter {
+		t.Errorf("folder must belong to the owner: %v", err)
+	}
+	// 其他用户可以使用相同名称，但看不到别人的搜索
+	if _, err := CreateSavedSearch(db, 2, "近期 PDF", SearchFilter{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetSavedSearch(db, s.ID, 2); err != ErrSavedSearchNotFound {
+		t.Errorf("expected ErrSavedSearchNotFound, got %v", err)
+	}
+
+	got, err := GetSavedSearch(db, s.ID, 1)
+	if err != nil || len(got.Filter.Exts) != 1 || got.Filter.From == nil || !got.Filter.From.Equal(from) {
+		t.Fatalf("filter should round-trip: %+v %v", got, err)
+	}
+	resp, err := SearchFiles(db, got.Filter.Request(1, time.Now()))
+	if err != nil || resp.Total != 2 {
+		t.Fatalf("evaluate: %+v %v", resp, err)
+	}
+	if n, err := CountSavedSearch(db, got, time.Now()); err != nil || n != 2 {
+		t.Errorf("count: %d %v", n, err)
+	}
+
+	// 修改后立即按新条件搜索
+	recursive := false
+	if _, err := UpdateSavedSearch(db, s.ID, 1, "工作目录", SearchFilter{FolderID: "work", Recursive: &recursive}); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = GetSavedSearch(db, s.ID, 1)
+	if n, _ := CountSavedSearch(db, got, time.Now()); got.Name != "工作目录" || n != 2 {
+		t.Errorf("updated search: %+v count %d", got, n)
+	}
+	if _, err := UpdateSavedSearch(db, 999, 1, "x", SearchFilter{}); err != ErrSavedSearchNotFound {
+		t.Errorf("expected ErrSavedSearchNotFound, got %v", err)
+	}
+
+	list, _ := ListSavedSearches(db, 1)
+	if len(list) != 1 {
+		t.Errorf("list: %+v", list)
+	}
+	if err := DeleteSavedSearch(db, s.ID, 2); err != ErrSavedSearchNotFound {
+		t.Errorf("other users cannot delete: %v", err)
+	}
+	if err := DeleteSavedSearch(db, s.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := ListSavedSearches(db, 1); len(list) != 0 {
+		t.Errorf("not deleted: %+v", list)
+	}
+}
@@ -0,0 +1,591 @@
+package file
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+
+	"cloudDrive/internal/pinyin"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidCategory = errors.New("不支持的文件分类")
+
+// FileNameToken 文件名的倒排索引，每个文件名切分出的词元一条记录
+// 搜索时按 (owner_id, token) 索引做前缀/等值匹配，不再对用户的全部文件做 LIKE '%x%' 扫描；
+// 由 File 的创建钩子和 RenameFile 维护，软删除的记录保留，还原后无需重建，彻底删除时随文件一并删除
+type FileNameToken struct {
+	FileID  string `gorm:"type:char(36);primaryKey"`
+	Token   string `gorm:"size:255;primaryKey;index:idx_name_tokens_owner_token,priority:2"`
+	OwnerID uint   `gorm:"index:idx_name_tokens_owner_token,priority:1"`
+}
+
+// maxExtLen 扩展名的最大长度，超出的视为没有扩展名
+const maxExtLen = 32
+
+// fileExt 返回小写、不含点的扩展名，如 Report.PDF -> pdf
+func fileExt(name string) string {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+	if len(ext) > maxExtLen {
+		return ""
+	}
+	return ext
+}
+
+// categoryExts 各文件分类包含的扩展名
+var categoryExts = map[string][]string{
+	"images":    {"jpg", "jpeg", "png", "gif", "bmp", "webp", "svg", "ico", "tif", "tiff", "heic"},
+	"documents": {"pdf", "doc", "docx", "xls", "xlsx", "ppt", "pptx", "txt", "md", "csv", "json", "rtf", "odt", "ods", "odp", "epub"},
+	"video":     {"mp4", "mkv", "avi", "mov", "wmv", "flv", "webm", "m4v"},
+	"audio":     {"mp3", "wav", "flac", "aac", "ogg", "m4a", "wma"},
+	"archives":  {"zip", "rar", "7z", "tar", "gz", "tgz", "bz2", "xz"},
+}
+
+// categoryFilter 按分类过滤文件，other 为不属于其他任何分类的文件；
+// 优先使用上传时按内容检测的分类，未检测或内容类型不能确定分类（如纯文本）时按扩展名归类，查询需关联 file_contents
+func categoryFilter(query *gorm.DB, category string) (*gorm.DB, error) {
+	if !ValidCategory(category) {
+		return nil, ErrInvalidCategory
+	}
+	byExt := "files.ext IN ?"
+	exts := categoryExts[category]
+	if category == "other" {
+		byExt = "files.ext NOT IN ?"
+		for _, e := range categoryExts {
+			exts = append(exts, e...)
+		}
+	}
+	return query.Where("files.type = ? AND (file_contents.category = ? OR (COALESCE(file_contents.category, '') = '' AND "+byExt+"))",
+		"file", category, exts), nil
+}
+
+// CategorySummary 某个分类下的文件数和总大小
+type CategorySummary struct {
+	Category string `json:"category"`
+	Count    int64  `json:"count"`
+	Size     int64  `json:"size"`
+}
+
+// SummarizeCategories 按分类统计用户的文件数和总大小，不含回收站中的文件，顺序与 Categories 相同
+func SummarizeCategories(db *gorm.DB, ownerID uint) ([]CategorySummary, error) {
+	summaries := make([]CategorySummary, len(Categories))
+	for i, category := range Categories {
+		query := db.Model(&File{}).Where("files.owner_id = ?", ownerID).
+			Joins("LEFT JOIN file_contents ON file_contents.hash = files.hash AND files.type = ?", "file")
+		query, err := categoryFilter(query, category)
+		if err != nil {
+			return nil, err
+		}
+		if err := query.Select("COUNT(*) AS count, COALESCE(SUM(file_contents.size), 0) AS size").
+			Scan(&summaries[i]).Error; err != nil {
+			return nil, err
+		}
+		summaries[i].Category = category
+	}
+	return summaries, nil
+}
+
+func isHan(r rune) bool {
+	return unicode.Is(unicode.Han, r)
+}
+
+// SplitText 将文本切分为英文/数字单词和连续汉字片段，均转为小写，文件名和文件内容的索引共用
+func SplitText(s string) (words []string, han [][]rune) {
+	var word []rune
+	var chars []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = nil
+		}
+		if len(chars) > 0 {
+			han = append(han, chars)
+			chars = nil
+		}
+	}
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case isHan(r):
+			if len(word) > 0 {
+				flush()
+			}
+			chars = append(chars, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if len(chars) > 0 {
+				flush()
+			}
+			word = append(word, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return words, han
+}
+
+// pinyinPrefix 拼音词元的前缀，与文件名中的单词区分
+const pinyinPrefix = "~"
+
+// 拼音索引的限制：每个汉字片段只取前 maxPinyinRunes 个字，多音字展开后每个位置最多 maxPinyinVariants 种读法
+const (
+	maxPinyinRunes    = 32
+	maxPinyinVariants = 4
+)
+
+// nameTokens 文件名的索引词元：完整小写名称、每个单词，汉字的单字和相邻两字，
+// 以及汉字片段从每个字开始到片段末尾的全拼和首字母，如 年度报告 -> ~niandubaogao、~ndbg、~dubaogao、~dbg ...
+func nameTokens(name string) []string {
+	seen := map[string]bool{}
+	var tokens []string
+	add := func(t string) {
+		if t != "" && len(t) <= 255 && !seen[t] {
+			seen[t] = true
+			tokens = append(tokens, t)
+		}
+	}
+	add(strings.ToLower(name))
+	words, han := SplitText(name)
+	for _, w := range words {
+		add(w)
+	}
+	for _, chars := range han {
+		for i := range chars {
+			add(string(chars[i]))
+			if i+1 < len(chars) {
+				add(string(chars[i : i+2]))
+			}
+		}
+		if len(chars) > maxPinyinRunes {
+			chars = chars[:maxPinyinRunes]
+		}
+		for i := range chars {
+			full, initials := pinyin.Spell(chars[i:], maxPinyinVariants)
+			for _, t := range full {
+				add(pinyinPrefix + t)
+			}
+			for _, t := range initials {
+				add(pinyinPrefix + t)
+			}
+		}
+	}
+	return tokens
+}
+
+// createNameTokens 为新建的文件写入文件名索引
+func createNameTokens(db *gorm.DB, f *File) error {
+	tokens := nameTokens(f.Name)
+	if len(tokens) == 0 {
+		return nil
+	}
+	rows := make([]FileNameToken, len(tokens))
+	for i, t := range tokens {
+		rows[i] = FileNameToken{FileID: f.ID, Token: t, OwnerID: f.OwnerID}
+	}
+	return db.Create(&rows).Error
+}
+
+// reindexName 重命名后重建文件名索引
+func reindexName(tx *gorm.DB, f *File) error {
+	if err := tx.Where("file_id = ?", f.ID).Delete(&FileNameToken{}).Error; err != nil {
+		return err
+	}
+	return createNameTokens(tx, f)
+}
+
+// nameIndexVersion 文件名索引切分规则的版本，规则变化时递增，启动时为所有文件重建索引
+// 1 单词和汉字；2 增加拼音
+const nameIndexVersion = 2
+
+// SearchIndexVersion 记录已建立的索引所用规则的版本
+type SearchIndexVersion struct {
+	Name    string `gorm:"primaryKey;size:32"`
+	Version int
+}
+
+// backfillBatch 补全索引时每批处理的文件数
+const backfillBatch = 500
+
+// BackfillSearchIndex 为没有文件名索引的文件补全索引和扩展名，用于升级后迁移已有数据，可重复执行；
+// 索引规则的版本变化时为所有文件重建索引。返回处理的文件数
+func BackfillSearchIndex(db *gorm.DB) (int, error) {
+	var state SearchIndexVersion
+	if err := db.Where("name = ?", "file_name").Limit(1).Find(&state).Error; err != nil {
+		return 0, err
+	}
+	rebuild := state.Version < nameIndexVersion
+	total := 0
+	lastID := ""
+	for {
+		query := db.Unscoped().Select("id", "name", "type", "owner_id").Where("id > ?", lastID)
+		if !rebuild {
+			query = query.Where("id NOT IN (?)", db.Model(&FileNameToken{}).Select("file_id"))
+		}
+		var batch []File
+		if err := query.Order("id").Limit(backfillBatch).Find(&batch).Error; err != nil {
+			return total, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		if err := backfillNames(db, batch); err != nil {
+			return total, err
+		}
+		total += len(batch)
+		lastID = batch[len(batch)-1].ID
+	}
+	if rebuild {
+		state = SearchIndexVersion{Name: "file_name", Version: nameIndexVersion}
+		if err := db.Save(&state).Error; err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// backfillNames 重建一批文件的文件名索引和扩展名
+func backfillNames(db *gorm.DB, files []File) error {
+	ids := make([]string, len(files))
+	var rows []FileNameToken
+	byExt := map[string][]string{}
+	for i, f := range files {
+		ids[i] = f.ID
+		for _, t := range nameTokens(f.Name) {
+			rows = append(rows, FileNameToken{FileID: f.ID, Token: t, OwnerID: f.OwnerID})
+		}
+		if f.Type == "file" {
+			if ext := fileExt(f.Name); ext != "" {
+				byExt[ext] = append(byExt[ext], f.ID)
+			}
+		}
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("file_id IN ?", ids).Delete(&FileNameToken{}).Error; err != nil {
+			return err
+		}
+		for ext, extIDs := range byExt {
+			if err := tx.Unscoped().Model(&File{}).Where("id IN ?", extIDs).Update("ext", ext).Error; err != nil {
+				return err
+			}
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(rows, deleteChunkSize).Error
+	})
+}
+
+// SearchRequest 高级搜索条件，各条件之间为与的关系，零值表示不限
+type SearchRequest struct {
+	OwnerID   uint
+	Name      string       // 关键字，空格分隔的多个词需同时出现在文件名中，只含字母的词也可匹配拼音
+	Exts      []string     // 扩展名，不含点，满足其一即可
+	Category  string       // 分类：images/documents/video/audio/archives/other
+	Type      string       // file/folder
+	MinSize   int64        // 最小文件大小（字节），指定大小范围时不返回文件夹
+	MaxSize   int64        // 最大文件大小（字节）
+	From      *time.Time   // 上传时间不早于
+	To        *time.Time   // 上传时间早于
+	FolderID  string       // 搜索范围，为空表示全部文件
+	Recursive bool         // 是否包含 FolderID 的所有子目录，否则只搜索其直接子项
+	TagIDs    []uint64     // 标签，需同时带有所有标签
+	Starred   bool         // 只返回收藏的文件
+	Meta      []MetaFilter // 自定义元数据条件，需同时满足
+	OrderBy   string       // relevance/size/upload_time/name，有关键字时默认 relevance，否则 upload_time
+	Order     string       // asc/desc，默认 desc
+	PageSize  int
+	Cursor    string
+}
+
+// SearchItem 搜索结果中的一项，Relevance 为名称匹配程度：3 完全相同、2 以关键字开头、1 包含关键字、0 拼音匹配
+type SearchItem struct {
+	ListItem
+	Relevance int64 `json:"relevance"`
+}
+
+// FacetCount 某个取值及符合条件的结果数
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// SearchFacets 按类型和扩展名统计的结果数，扩展名按数量降序取前 maxExtFacets 个
+type SearchFacets struct {
+	Types []FacetCount `json:"types"`
+	Exts  []FacetCount `json:"exts"`
+}
+
+type SearchResponse struct {
+	Files      []SearchItem  `json:"files"`
+	Total      int64         `json:"total"`            // 仅第一页统计，翻页时为 0
+	Facets     *SearchFacets `json:"facets,omitempty"` // 仅第一页统计
+	NextCursor string        `json:"next_cursor"`      // 为空表示没有下一页
+}
+
+const maxExtFacets = 20
+
+// isPinyinTerm 只含英文字母的词也可能是拼音或首字母
+func isPinyinTerm(term string) bool {
+	for _, r := range term {
+		if r > unicode.MaxASCII || !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return term != ""
+}
+
+// keywordFilter 关键字过滤：每个词切分出的词元先通过文件名索引缩小范围，再用 LIKE 校验完整的词，
+// 候选集由 (owner_id, token) 索引得到；不含字母、数字和汉字的词只能做 LIKE 匹配。
+// 词元按前缀匹配，词出现在文件名单词中间时（如 report 之于 annualreport.pdf）索引找不到，
+// 因此索引没有命中任何文件时退回只用 LIKE 的子串匹配。
+// 只含字母的词同时按拼音匹配，如 ndbg、niandu 可以搜到 年度报告
+func keywordFilter(db, query *gorm.DB, ownerID uint, name string) *gorm.DB {
+	terms := strings.Fields(name)
+	if len(terms) == 0 {
+		return query
+	}
+	probe := db.Model(&File{}).Where("files.owner_id = ?", ownerID)
+	for _, term := range terms {
+		probe = probe.Where(keywordTermCond(db, ownerID, term, true))
+	}
+	var hit []string
+	useIndex := probe.Limit(1).Pluck("files.id", &hit).Error != nil || len(hit) > 0
+	for _, term := range terms {
+		query = query.Where(keywordTermCond(db, ownerID, term, useIndex))
+	}
+	return query
+}
+
+// keywordTermCond 单个词的匹配条件，useIndex 为 false 时不使用文件名索引缩小范围
+func keywordTermCond(db *gorm.DB, ownerID uint, term string, useIndex bool) *gorm.DB {
+	cond := db.Where("files.name LIKE ?", "%"+term+"%")
+	if useIndex {
+		words, han := SplitText(term)
+		for _, w := range words {
+			cond = cond.Where("files.id IN (?)", db.Model(&FileNameToken{}).Select("file_id").
+				Where("owner_id = ? AND token LIKE ?", ownerID, w+"%"))
+		}
+		for _, chars := range han {
+			grams := []string{string(chars)}
+			if len(chars) > 1 {
+				grams = grams[:0]
+				for i := 0; i+1 < len(chars); i++ {
+					grams = append(grams, string(chars[i:i+2]))
+				}
+			}
+			for _, g := range grams {
+				cond = cond.Where("files.id IN (?)", db.Model(&FileNameToken{}).Select("file_id").
+					Where("owner_id = ? AND token = ?", ownerID, g))
+			}
+		}
+	}
+	if isPinyinTerm(term) {
+		cond = cond.Or("files.id IN (?)", db.Model(&FileNameToken{}).Select("file_id").
+			Where("owner_id = ? AND token LIKE ?", ownerID, pinyinPrefix+strings.ToLower(term)+"%"))
+	}
+	return cond
+}
+
+// relevanceExpr 名称匹配程度的表达式及其参数，无关键字时所有结果相同；
+// 文字匹配优先于拼音匹配，只通过拼音匹配的结果为 0
+func relevanceExpr(name string) (string, []interface{}) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return "1", nil
+	}
+	terms := strings.Fields(name)
+	contains := make([]string, len(terms))
+	args := []interface{}{name, name + "%"}
+	for i, t := range terms {
+		contains[i] = "LOWER(files.name) LIKE ?"
+		args = append(args, "%"+t+"%")
+	}
+	return "CASE WHEN LOWER(files.name) = ? THEN 3 WHEN LOWER(files.name) LIKE ? THEN 2 WHEN " +
+		strings.Join(contains, " AND ") + " THEN 1 ELSE 0 END", args
+}
+
+// SearchFiles 按关键字、扩展名、分类、大小、上传时间、目录范围、标签、收藏和自定义元数据搜索用户的文件，
+// 第一页同时返回总数和按类型、扩展名的分面统计；按 (排序字段, id) 做游标分页
+func SearchFiles(db *gorm.DB, req SearchRequest) (*SearchResponse, error) {
+	if req.PageSize <= 0 || req.PageSize > 100 {
+		req.PageSize = 10
+	}
+	hasName := strings.TrimSpace(req.Name) != ""
+	orderBy := req.OrderBy
+	if orderBy == "" && hasName {
+		orderBy = "relevance"
+	} else if orderBy == "relevance" && !hasName {
+		orderBy = "upload_time"
+	}
+	relExpr, relArgs := relevanceExpr(req.Name)
+	column, ok := listOrderColumns[orderBy]
+	if orderBy == "relevance" {
+		column, ok = relExpr, true
+	}
+	if !ok {
+		orderBy = "upload_time"
+		column = listOrderColumns[orderBy]
+	}
+	var columnArgs []interface{}
+	if orderBy == "relevance" {
+		columnArgs = relArgs
+	}
+	desc := req.Order != "asc"
+
+	// searchQuery 每次调用返回新的查询，统计和分页互不影响
+	query, err := searchQuery(db, req)
+	if err != nil {
+		return nil, err
+	}
+	resp := &SearchResponse{Files: []SearchItem{}}
+	if req.Cursor == "" {
+		if err := query.Count(&resp.Total).Error; err != nil {
+			return nil, err
+		}
+		if resp.Facets, err = searchFacets(db, req); err != nil {
+			return nil, err
+		}
+		query, _ = searchQuery(db, req)
+	}
+
+	cmp := ">"
+	direction := ""
+	if desc {
+		cmp = "<"
+		direction = " desc"
+	}
+	if req.Cursor != "" {
+		c, err := decodeCursor(req.Cursor, orderBy, desc)
+		if err != nil {
+			return nil, err
+		}
+		args := append(append([]interface{}{}, columnArgs...), c.value(), c.ID)
+		query = query.Where("("+column+", files.id) "+cmp+" (?, ?)", args...)
+	}
+	selectArgs := append([]interface{}{}, relArgs...)
+	items := []SearchItem{}
+	err = query.Select("files.id, files.name, files.type, files.ext, files.parent_id, files.owner_id, files.upload_time, "+
+		"file_contents.size AS size, COALESCE(file_contents.mime_type, '') AS mime_type, "+relExpr+" AS relevance", selectArgs...).
+		Order(orderAlias(orderBy, column) + direction).Order("files.id" + direction).
+		Limit(req.PageSize + 1).Scan(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	resp.Files = items
+	if len(items) > req.PageSize {
+		resp.Files = items[:req.PageSize]
+		last := resp.Files[req.PageSize-1]
+		if orderBy == "relevance" {
+			resp.NextCursor = encodeCursor(listCursor{OrderBy: orderBy, Desc: desc, Num: last.Relevance, ID: last.ID})
+		} else {
+			resp.NextCursor = cursorAfter(last.ListItem, orderBy, desc)
+		}
+	}
+	labeled := make([]*ListItem, len(resp.Files))
+	for i := range resp.Files {
+		labeled[i] = &resp.Files[i].ListItem
+	}
+	if err := attachLabels(db, labeled); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// searchQuery 按搜索条件过滤用户文件的查询，不含排序和分页
+func searchQuery(db *gorm.DB, req SearchRequest) (*gorm.DB, error) {
+	query := db.Model(&File{}).Where("files.owner_id = ?", req.OwnerID).
+		Joins("LEFT JOIN file_contents ON file_contents.hash = files.hash AND files.type = ?", "file")
+	query = keywordFilter(db, query, req.OwnerID, req.Name)
+	if len(req.Exts) > 0 {
+		exts := make([]string, len(req.Exts))
+		for i, e := range req.Exts {
+			exts[i] = strings.ToLower(strings.TrimPrefix(e, "."))
+		}
+		query = query.Where("files.ext IN ?", exts)
+	}
+	if req.Category != "" {
+		var err error
+		if query, err = categoryFilter(query, req.Category); err != nil {
+			return nil, err
+		}
+	}
+	if req.Type != "" {
+		query = query.Where("files.type = ?", req.Type)
+	}
+	if req.MinSize > 0 {
+		query = query.Where("file_contents.size >= ?", req.MinSize)
+	}
+	if req.MaxSize > 0 {
+		query = query.Where("file_contents.size <= ?", req.MaxSize)
+	}
+	if req.From != nil {
+		query = query.Where("files.upload_time >= ?", *req.From)
+	}
+	if req.To != nil {
+		query = query.Where("files.upload_time < ?", *req.To)
+	}
+	if req.FolderID != "" {
+		if req.Recursive {
+			query = query.Where("files.id IN (?)", db.Model(&FileAncestor{}).Select("descendant_id").
+				Where("ancestor_id = ? AND depth > 0", req.FolderID))
+		} else {
+			query = query.Where("files.parent_id = ?", req.FolderID)
+		}
+	}
+	for _, tagID := range req.TagIDs {
+		query = query.Where("files.id IN (?)", db.Model(&FileTag{}).Select("file_id").Where("tag_id = ?", tagID))
+	}
+	if req.Starred {
+		query = query.Where("files.id IN (?)", db.Model(&Favorite{}).Select("file_id").Where("owner_id = ?", req.OwnerID))
+	}
+	for _, m := range req.Meta {
+		sub, err := metaCondition(db, req.OwnerID, m)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("files.id IN (?)", sub)
+	}
+	return query, nil
+}
+
+// CountFiles 统计符合搜索条件的文件数
+func CountFiles(db *gorm.DB, req SearchRequest) (int64, error) {
+	query, err := searchQuery(db, req)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	err = query.Count(&total).Error
+	return total, err
+}
+
+// orderAlias 带参数的排序表达式改用其在 SELECT 中的别名
+func orderAlias(orderBy, column string) string {
+	if orderBy == "relevance" {
+		return "relevance"
+	}
+	return column
+}
+
+// searchFacets 统计符合条件的结果按类型和扩展名的数量
+func searchFacets(db *gorm.DB, req SearchRequest) (*SearchFacets, error) {
+	facets := &SearchFacets{Types: []FacetCount{}, Exts: []FacetCount{}}
+	query, err := searchQuery(db, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := query.Select("files.type AS value, COUNT(*) AS count").
+		Group("files.type").Order("count desc").Scan(&facets.Types).Error; err != nil {
+		return nil, err
+	}
+	query, _ = searchQuery(db, req)
+	if err := query.Where("files.type = ?", "file").
+		Select("files.ext AS value, COUNT(*) AS count").
+		Group("files.ext").Order("count desc").Order("files.ext").
+		Limit(maxExtFacets).Scan(&facets.Exts).Error; err != nil {
+		return nil, err
+	}
+	return facets, nil
+}
@@ -0,0 +1,267 @@
+package file
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func setupSearchTest(t *testing.T) *gorm.DB {
+	db := setupTestDB(t)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, f := range []File{
+		{ID: "root", Name: "root", Type: "folder", OwnerID: 1},
+		{ID: "work", Name: "工作", Type: "folder", ParentID: "root", OwnerID: 1, UploadTime: base},
+		{ID: "y2024", Name: "2024", Type: "folder", ParentID: "work", OwnerID: 1, UploadTime: base},
+		{ID: "r1", Name: "年度报告.docx", Hash: "h100", Type: "file", ParentID: "y2024", OwnerID: 1, UploadTime: base.Add(time.Hour)},
+		{ID: "r2", Name: "Report.PDF", Hash: "h300", Type: "file", ParentID: "work", OwnerID: 1, UploadTime: base.Add(2 * time.Hour)},
+		{ID: "r3", Name: "annual report.pdf", Hash: "h200", Type: "file", ParentID: "root", OwnerID: 1, UploadTime: base.Add(24 * time.Hour)},
+		{ID: "r4", Name: "report", Type: "folder", ParentID: "root", OwnerID: 1, UploadTime: base.Add(3 * time.Hour)},
+		{ID: "p1", Name: "photo.jpg", Hash: "h100", Type: "file", ParentID: "root", OwnerID: 1, UploadTime: base.Add(4 * time.Hour)},
+		{ID: "x1", Name: "report.pdf", Hash: "h100", Type: "file", ParentID: "other", OwnerID: 2, UploadTime: base},
+	} {
+		if err := db.Create(&f).Error; err != nil {
+			t.Fatalf("create %s: %v", f.ID, err)
+		}
+	}
+	db.Create(&FileContent{Hash: "h100", Size: 100})
+	db.Create(&FileContent{Hash: "h200", Size: 200})
+	db.Create(&FileContent{Hash: "h300", Size: 300})
+	return db
+}
+
+func searchIDs(t *testing.T, db *gorm.DB, req SearchRequest) []string {
+	t.Helper()
+	req.OwnerID = 1
+	resp, err := SearchFiles(db, req)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	ids := []string{}
+	for _, f := range resp.Files {
+		ids = append(ids, f.ID)
+	}
+	return ids
+}
+
+func sorted(ids []string) []string {
+	sort.Strings(ids)
+	return ids
+}
+
+func TestNameTokens(t *testing.T) {
+	got := nameTokens("年度报告 Q4-Final.docx")
+	want := []string{"年度报告 q4-final.docx", "q4", "final", "docx", "年", "年度", "度", "度报", "报", "报告", "告",
+		"~niandubaogao", "~ndbg", "~dubaogao", "~dbg", "~baogao", "~bg", "~gao", "~g"}
+	if len(got) != len(want) {
+		t.Fatalf("tokens = %v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("tokens[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSearchFiles_Keyword(t *testing.T) {
+	db := setupSearchTest(t)
+	// 单词前缀匹配，不区分大小写，只返回自己的文件
+	if ids := searchIDs(t, db, SearchRequest{Name: "rep"}); len(ids) != 3 {
+		t.Errorf("rep: %v", ids)
+	}
+	// 完全相同的名称排在最前，其次是以关键字开头的
+	ids := searchIDs(t, db, SearchRequest{Name: "report"})
+	if len(ids) != 3 || ids[0] != "r4" || ids[1] != "r2" || ids[2] != "r3" {
+		t.Errorf("relevance order: %v", ids)
+	}
+	if ids := searchIDs(t, db, SearchRequest{Name: "annual rep"}); len(ids) != 1 || ids[0] != "r3" {
+		t.Errorf("multiple terms: %v", ids)
+	}
+	// 汉字按两字切分，单字也能匹配
+	if ids := searchIDs(t, db, SearchRequest{Name: "报告"}); len(ids) != 1 || ids[0] != "r1" {
+		t.Errorf("han bigram: %v", ids)
+	}
+	if ids := searchIDs(t, db, SearchRequest{Name: "告"}); len(ids) != 1 || ids[0] != "r1" {
+		t.Errorf("han unigram: %v", ids)
+	}
+	// 两字都出现但不相邻时不匹配
+	if ids := searchIDs(t, db, SearchRequest{Name: "年报"}); len(ids) != 0 {
+		t.Errorf("non adjacent: %v", ids)
+	}
+	// 索引中没有以该词开头的词元时退回子串匹配
+	if ids := sorted(searchIDs(t, db, SearchRequest{Name: "port"})); len(ids) != 3 || ids[0] != "r2" {
+		t.Errorf("substring fallback: %v", ids)
+	}
+	if ids := searchIDs(t, db, SearchRequest{Name: "nnual"}); len(ids) != 1 || ids[0] != "r3" {
+		t.Errorf("substring fallback: %v", ids)
+	}
+}
+
+func TestSearchFiles_Filters(t *testing.T) {
+	db := setupSearchTest(t)
+	if ids := sorted(searchIDs(t, db, SearchRequest{Exts: []string{".PDF"}})); len(ids) != 2 || ids[0] != "r2" || ids[1] != "r3" {
+		t.Errorf("ext: %v", ids)
+	}
+	if ids := searchIDs(t, db, SearchRequest{Category: "images"}); len(ids) != 1 || ids[0] != "p1" {
+		t.Errorf("category: %v", ids)
+	}
+	if _, err := SearchFiles(db, SearchRequest{OwnerID: 1, Category: "bogus"}); err != ErrInvalidCategory {
+		t.Errorf("expected ErrInvalidCategory, got %v", err)
+	}
+	// 指定大小范围时不返回文件夹
+	if ids := sorted(searchIDs(t, db, SearchRequest{MinSize: 150, MaxSize: 300})); len(ids) != 2 || ids[0] != "r2" || ids[1] != "r3" {
+		t.Errorf("size range: %v", ids)
+	}
+	from := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 1, 4, 0, 0, 0, time.UTC)
+	if ids := sorted(searchIDs(t, db, SearchRequest{From: &from, To: &to})); len(ids) != 2 || ids[0] != "r2" || ids[1] != "r4" {
+		t.Errorf("time range: %v", ids)
+	}
+	if ids := sorted(searchIDs(t, db, SearchRequest{FolderID: "work", Type: "file", Recursive: true})); len(ids) != 2 || ids[0] != "r1" || ids[1] != "r2" {
+		t.Errorf("recursive scope: %v", ids)
+	}
+	if ids := searchIDs(t, db, SearchRequest{FolderID: "work", Type: "file"}); len(ids) != 1 || ids[0] != "r2" {
+		t.Errorf("direct scope: %v", ids)
+	}
+}
+
+func TestSearchFiles_FacetsAndCursor(t *testing.T) {
+	db := setupSearchTest(t)
+	resp, err := SearchFiles(db, SearchRequest{OwnerID: 1, OrderBy: "size", Order: "desc", PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 8 || resp.Facets == nil {
+		t.Fatalf("total=%d facets=%v", resp.Total, resp.Facets)
+	}
+	types := map[string]int64{}
+	for _, f := range resp.Facets.Types {
+		types[f.Value] = f.Count
+	}
+	if types["file"] != 4 || types["folder"] != 4 {
+		t.Errorf("type facets: %v", resp.Facets.Types)
+	}
+	if len(resp.Facets.Exts) != 3 || resp.Facets.Exts[0] != (FacetCount{Value: "pdf", Count: 2}) {
+		t.Errorf("ext facets: %v", resp.Facets.Exts)
+	}
+
+	var ids []string
+	for {
+		for _, f := range resp.Files {
+			ids = append(ids, f.ID)
+		}
+		if resp.NextCursor == "" {
+			break
+		}
+		resp, err = SearchFiles(db, SearchRequest{OwnerID: 1, OrderBy: "size", Order: "desc", PageSize: 2, Cursor: resp.NextCursor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Total != 0 || resp.Facets != nil {
+			t.Errorf("later pages should not count")
+		}
+	}
+	if len(ids) != 8 || ids[0] != "r2" || ids[1] != "r3" {
+		t.Errorf("size order: %v", ids)
+	}
+
+	// 按相关度翻页
+	first, _ := SearchFiles(db, SearchRequest{OwnerID: 1, Name: "report", PageSize: 1})
+	second, err := SearchFiles(db, SearchRequest{OwnerID: 1, Name: "report", PageSize: 1, Cursor: first.NextCursor})
+	if err != nil || len(second.Files) != 1 || second.Files[0].ID != "r2" {
+		t.Errorf("relevance cursor: %v %v", second, err)
+	}
+	if _, err := SearchFiles(db, SearchRequest{OwnerID: 1, Name: "report", OrderBy: "name", Cursor: first.NextCursor}); err != ErrInvalidCursor {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestSearchIndex_RenameDeleteAndBackfill(t *testing.T) {
+	db := setupSearchTest(t)
+	if err := RenameFile(db, "p1", 1, "holiday.PNG"); err != nil {
+		t.Fatal(err)
+	}
+	if ids := searchIDs(t, db, SearchRequest{Name: "photo"}); len(ids) != 0 {
+		t.Errorf("old name still indexed: %v", ids)
+	}
+	if ids := searchIDs(t, db, SearchRequest{Name: "holi", Exts: []string{"png"}}); len(ids) != 1 {
+		t.Errorf("new name not indexed: %v", ids)
+	}
+
+	DeleteFile(db, "p1", 1)
+	if _, err := PermanentlyDeleteFile(db, "p1", 1); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Model(&FileNameToken{}).Where("file_id = ?", "p1").Count(&count)
+	if count != 0 {
+		t.Errorf("tokens should be removed on permanent delete, got %d", count)
+	}
+
+	// 索引规则的版本变化时重建所有文件的索引
+	if n, err := BackfillSearchIndex(db); err != nil || n != 8 {
+		t.Fatalf("rebuild: %d %v", n, err)
+	}
+	// 模拟升级前的数据
+	db.Where("file_id = ?", "r3").Delete(&FileNameToken{})
+	db.Model(&File{}).Where("id = ?", "r3").Update("ext", "")
+	n, err := BackfillSearchIndex(db)
+	if err != nil || n != 1 {
+		t.Fatalf("backfill: %d %v", n, err)
+	}
+	if ids := searchIDs(t, db, SearchRequest{Name: "annual", Exts: []string{"pdf"}}); len(ids) != 1 {
+		t.Errorf("backfilled file not found: %v", ids)
+	}
+	if n, _ := BackfillSearchIndex(db); n != 0 {
+		t.Errorf("backfill should be idempotent, got %d", n)
+	}
+}
+
+func TestSearchFiles_Pinyin(t *testing.T) {
+	db := setupSearchTest(t)
+	db.Create(&File{ID: "r5", Name: "年报草稿.txt", Type: "file", ParentID: "root", OwnerID: 1})
+	db.Create(&File{ID: "r6", Name: "nian.txt", Type: "file", ParentID: "root", OwnerID: 1})
+	db.Create(&File{ID: "b1", Name: "银行流水.xlsx", Type: "file", ParentID: "root", OwnerID: 1})
+
+	for _, q := range []string{"ndbg", "NianDuBaoGao", "niandu", "dbg", "baogao"} {
+		if ids := searchIDs(t, db, SearchRequest{Name: q}); len(ids) != 1 || ids[0] != "r1" {
+			t.Errorf("%s: %v", q, ids)
+		}
+	}
+	// 多音字的其他读音
+	if ids := searchIDs(t, db, SearchRequest{Name: "yinhang"}); len(ids) != 1 || ids[0] != "b1" {
+		t.Errorf("heteronym: %v", ids)
+	}
+	// 文字匹配排在拼音匹配之前
+	resp, err := SearchFiles(db, SearchRequest{OwnerID: 1, Name: "nian"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range resp.Files {
+		got = append(got, f.ID)
+	}
+	if len(got) != 3 || got[0] != "r6" || resp.Files[0].Relevance <= resp.Files[1].Relevance {
+		t.Errorf("exact characters should rank first: %v", resp.Files)
+	}
+	// 与其他关键字同时使用
+	if ids := searchIDs(t, db, SearchRequest{Name: "nb cg"}); len(ids) != 1 || ids[0] != "r5" {
+		t.Errorf("multiple pinyin terms: %v", ids)
+	}
+	if ids := searchIDs(t, db, SearchRequest{Name: "ndbg", Exts: []string{"pdf"}}); len(ids) != 0 {
+		t.Errorf("filters should still apply: %v", ids)
+	}
+	// 回收站中的文件不返回，还原后仍可按拼音搜索
+	DeleteFile(db, "r1", 1)
+	if ids := searchIDs(t, db, SearchRequest{Name: "ndbg"}); len(ids) != 0 {
+		t.Errorf("deleted file found: %v", ids)
+	}
+	if _, err := RestoreFile(db, "r1", 1); err != nil {
+		t.Fatal(err)
+	}
+	if ids := searchIDs(t, db, SearchRequest{Name: "ndbg"}); len(ids) != 1 {
+		t.Errorf("restored file not found: %v", ids)
+	}
+}
@@ -0,0 +1,356 @@
+package file
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTagNotFound = errors.New("标签不存在")
+	ErrTagExists   = errors.New("已存在同名标签")
+	ErrInvalidTag  = errors.New("标签名称或颜色无效")
+	ErrTooManyTags = errors.New("标签数量已达上限")
+)
+
+// MaxTags 每个用户最多创建的标签数
+const MaxTags = 200
+
+// maxTagNameRunes 标签名称的最大长度（字符数）
+const maxTagNameRunes = 32
+
+// TagColors 标签可选的颜色，为空表示不设颜色
+var TagColors = []string{"red", "orange", "yellow", "green", "blue", "purple", "gray"}
+
+// Tag 用户自定义的标签，可带颜色，用于跨目录组织文件和文件夹
+type Tag struct {
+	ID        uint64    `gorm:"primaryKey" json:"id"`
+	OwnerID   uint      `gorm:"uniqueIndex:idx_tags_owner_name,priority:1" json:"owner_id"`
+	Name      string    `gorm:"size:128;uniqueIndex:idx_tags_owner_name,priority:2" json:"name"`
+	Color     string    `gorm:"size:16" json:"color"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FileTag 文件与标签的多对多关系
+// 按文件ID关联，移动、重命名、删除到回收站和还原都不影响，彻底删除文件或删除标签时一并删除
+type FileTag struct {
+	FileID    string `gorm:"type:char(36);primaryKey"`
+	TagID     uint64 `gorm:"primaryKey;index"`
+	CreatedAt time.Time
+}
+
+// Favorite 用户收藏（星标）的文件或文件夹，生命周期与 FileTag 相同
+type Favorite struct {
+	FileID    string `gorm:"type:char(36);primaryKey"`
+	OwnerID   uint   `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// TagRef 列表和搜索结果中文件带有的标签
+type TagRef struct {
+	ID    uint64 `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// TagSummary 标签及带有该标签的文件数（不含回收站中的文件）
+type TagSummary struct {
+	Tag
+	FileCount int64 `json:"file_count"`
+}
+
+// checkTag 校验并规范化标签名称和颜色
+func checkTag(name, color string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxTagNameRunes {
+		return "", ErrInvalidTag
+	}
+	if color == "" {
+		return name, nil
+	}
+	for _, c := range TagColors {
+		if c == color {
+			return name, nil
+		}
+	}
+	return "", ErrInvalidTag
+}
+
+// tagNameTaken 用户是否已有同名标签，exceptID 为正在修改的标签
+func tagNameTaken(db *gorm.DB, ownerID uint, name string, exceptID uint64) (bool, error) {
+	var count int64
+	err := db.Model(&Tag{}).Where("owner_id = ? AND name = ? AND id != ?", ownerID, name, exceptID).Count(&count).Error
+	return count > 0, err
+}
+
+// CreateTag 创建标签，同一用户下名称不能重复
+func CreateTag(db *gorm.DB, ownerID uint, name, color string) (*Tag, error) {
+	name, err := checkTag(name, color)
+	if err != nil {
+		return nil, err
+	}
+	tag := &Tag{OwnerID: ownerID, Name: name, Color: color}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&Tag{}).Where("owner_id = ?", ownerID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= MaxTags {
+			return ErrTooManyTags
+		}
+		if taken, err := tagNameTaken(tx, ownerID, name, 0); err != nil || taken {
+			if err == nil {
+				err = ErrTagExists
+			}
+			return err
+		}
+		return tx.Create(tag).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// GetTag 获取用户的标签，不属于该用户时视为不存在
+func GetTag(db *gorm.DB, id uint64, ownerID uint) (*Tag, error) {
+	var tag Tag
+	err := db.Where("id = ? AND owner_id = ?", id, ownerID).First(&tag).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTagNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// ListTags 用户的所有标签及各自的文件数，按名称排序
+func ListTags(db *gorm.DB, ownerID uint) ([]TagSummary, error) {
+	counts := db.Model(&FileTag{}).Select("file_tags.tag_id, COUNT(*) AS file_count").
+		Joins("JOIN files ON files.id = file_tags.file_id AND files.deleted_at IS NULL").
+		Group("file_tags.tag_id")
+	tags := []TagSummary{}
+	err := db.Model(&Tag{}).Select("tags.*, COALESCE(counts.file_count, 0) AS file_count").
+		Joins("LEFT JOIN (?) AS counts ON counts.tag_id = tags.id", counts).
+		Where("tags.owner_id = ?", ownerID).Order("tags.name").Order("tags.id").
+		Scan(&tags).Error
+	return tags, err
+}
+
+// UpdateTag 修改标签的名称和颜色
+func UpdateTag(db *gorm.DB, id uint64, ownerID uint, name, color string) (*Tag, error) {
+	name, err := checkTag(name, color)
+	if err != nil {
+		return nil, err
+	}
+	var tag *Tag
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if tag, err = GetTag(tx, id, ownerID); err != nil {
+			return err
+		}
+		if taken, err := tagNameTaken(tx, ownerID, name, id); err != nil || taken {
+			if err == nil {
+				err = ErrTagExists
+			}
+			return err
+		}
+		tag.Name = name
+		tag.Color = color
+		return tx.Save(tag).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// DeleteTag 删除标签并移除所有文件上的该标签，不影响文件本身
+func DeleteTag(db *gorm.DB, id uint64, ownerID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if _, err := GetTag(tx, id, ownerID); err != nil {
+			return err
+		}
+		if err := tx.Where("tag_id = ?", id).Delete(&FileTag{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Tag{}, id).Error
+	})
+}
+
+// ownedFileIDs 校验文件均属于该用户且不在回收站中，有任一不满足时返回 gorm.ErrRecordNotFound
+func ownedFileIDs(db *gorm.DB, ownerID uint, fileIDs []string) ([]string, error) {
+	ids := dedupeIDs(fileIDs)
+	var count int64
+	if err := db.Model(&File{}).Where("id IN ? AND owner_id = ?", ids, ownerID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count != int64(len(ids)) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return ids, nil
+}
+
+// ownedTagIDs 校验标签均属于该用户，有任一不满足时返回 ErrTagNotFound
+func ownedTagIDs(db *gorm.DB, ownerID uint, tagIDs []uint64) ([]uint64, error) {
+	seen := make(map[uint64]bool, len(tagIDs))
+	ids := make([]uint64, 0, len(tagIDs))
+	for _, id := range tagIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	var count int64
+	if err := db.Model(&Tag{}).Where("id IN ? AND owner_id = ?", ids, ownerID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count != int64(len(ids)) {
+		return nil, ErrTagNotFound
+	}
+	return ids, nil
+}
+
+func dedupeIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// TagFiles 为一批文件添加一批标签，已有的标签忽略，返回新增的关联数
+func TagFiles(db *gorm.DB, ownerID uint, fileIDs []string, tagIDs []uint64) (int64, error) {
+	if len(fileIDs) == 0 || len(tagIDs) == 0 {
+		return 0, nil
+	}
+	var added int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		files, err := ownedFileIDs(tx, ownerID, fileIDs)
+		if err != nil {
+			return err
+		}
+		tags, err := ownedTagIDs(tx, ownerID, tagIDs)
+		if err != nil {
+			return err
+		}
+		rows := make([]FileTag, 0, len(files)*len(tags))
+		for _, f := range files {
+			for _, t := range tags {
+				rows = append(rows, FileTag{FileID: f, TagID: t})
+			}
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(rows, deleteChunkSize)
+		added = result.RowsAffected
+		return result.Error
+	})
+	return added, err
+}
+
+// UntagFiles 移除一批文件上的一批标签，返回移除的关联数
+func UntagFiles(db *gorm.DB, ownerID uint, fileIDs []string, tagIDs []uint64) (int64, error) {
+	if len(fileIDs) == 0 || len(tagIDs) == 0 {
+		return 0, nil
+	}
+	var removed int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		files, err := ownedFileIDs(tx, ownerID, fileIDs)
+		if err != nil {
+			return err
+		}
+		tags, err := ownedTagIDs(tx, ownerID, tagIDs)
+		if err != nil {
+			return err
+		}
+		result := tx.Where("file_id IN ? AND tag_id IN ?", files, tags).Delete(&FileTag{})
+		removed = result.RowsAffected
+		return result.Error
+	})
+	return removed, err
+}
+
+// SetFavorites 收藏或取消收藏一批文件，返回状态发生变化的文件数
+func SetFavorites(db *gorm.DB, ownerID uint, fileIDs []string, starred bool) (int64, error) {
+	if len(fileIDs) == 0 {
+		return 0, nil
+	}
+	var changed int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		files, err := ownedFileIDs(tx, ownerID, fileIDs)
+		if err != nil {
+			return err
+		}
+		var result *gorm.DB
+		if starred {
+			rows := make([]Favorite, len(files))
+			for i, f := range files {
+				rows[i] = Favorite{FileID: f, OwnerID: ownerID}
+			}
+			result = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows)
+		} else {
+			result = tx.Where("file_id IN ?", files).Delete(&Favorite{})
+		}
+		changed = result.RowsAffected
+		return result.Error
+	})
+	return changed, err
+}
+
+// loadLabels 批量查询文件的标签和收藏状态，标签按名称排序
+func loadLabels(db *gorm.DB, ids []string) (map[string][]TagRef, map[string]bool, error) {
+	tags := map[string][]TagRef{}
+	starred := map[string]bool{}
+	if len(ids) == 0 {
+		return tags, starred, nil
+	}
+	var rows []struct {
+		FileID string
+		TagRef
+	}
+	if err := db.Model(&FileTag{}).Select("file_tags.file_id, tags.id, tags.name, tags.color").
+		Joins("JOIN tags ON tags.id = file_tags.tag_id").
+		Where("file_tags.file_id IN ?", ids).Order("tags.name").Order("tags.id").
+		Scan(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, r := range rows {
+		tags[r.FileID] = append(tags[r.FileID], r.TagRef)
+	}
+	var favorites []string
+	if err := db.Model(&Favorite{}).Where("file_id IN ?", ids).Pluck("file_id", &favorites).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, id := range favorites {
+		starred[id] = true
+	}
+	return tags, starred, nil
+}
+
+// attachLabels 为列表项填充标签和收藏状态
+func attachLabels(db *gorm.DB, items []*ListItem) error {
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	tags, starred, err := loadLabels(db, ids)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		item.Tags = tags[item.ID]
+		if item.Tags == nil {
+			item.Tags = []TagRef{}
+		}
+		item.Starred = starred[item.ID]
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package file
+
+import (
+	"testing"
+)
+
+func TestTags_CRUD(t *testing.T) {
+	db := setupSearchTest(t)
+	work, err := CreateTag(db, 1, " 工作 ", "blue")
+	if err != nil || work.Name != "工作" {
+		t.Fatalf("create: %+v %v", work, err)
+	}
+	if _, err := CreateTag(db, 1, "工作", ""); err != ErrTagExists {
+		t.Errorf("expected ErrTagExists, got %v", err)
+	}
+	if _, err := CreateTag(db, 1, "x", "pink"); err != ErrInvalidTag {
+		t.Errorf("expected ErrInvalidTag, got %v", err)
+	}
+	if _, err := CreateTag(db, 2, "工作", ""); err != nil {
+		t.Errorf("names are per user: %v", err)
+	}
+	if _, err := UpdateTag(db, work.ID, 2, "y", ""); err != ErrTagNotFound {
+		t.Errorf("other users cannot update: %v", err)
+	}
+	urgent, _ := CreateTag(db, 1, "紧急", "red")
+	if _, err := UpdateTag(db, urgent.ID, 1, "工作", "red"); err != ErrTagExists {
+		t.Errorf("rename to existing name: %v", err)
+	}
+	if tag, err := UpdateTag(db, urgent.ID, 1, "加急", "orange"); err != nil || tag.Color != "orange" {
+		t.Errorf("update: %+v %v", tag, err)
+	}
+
+	// 文件和标签必须属于当前用户
+	if _, err := TagFiles(db, 1, []string{"r1", "x1"}, []uint64{work.ID}); err == nil {
+		t.Errorf("tagging other users' files should fail")
+	}
+	if n, err := TagFiles(db, 1, []string{"r1", "r2", "r1"}, []uint64{work.ID, urgent.ID}); err != nil || n != 4 {
+		t.Fatalf("tag: %d %v", n, err)
+	}
+	if n, _ := TagFiles(db, 1, []string{"r1"}, []uint64{work.ID}); n != 0 {
+		t.Errorf("existing tags should be ignored, added %d", n)
+	}
+	if n, err := UntagFiles(db, 1, []string{"r2"}, []uint64{urgent.ID}); err != nil || n != 1 {
+		t.Errorf("untag: %d %v", n, err)
+	}
+	tags, err := ListTags(db, 1)
+	if err != nil || len(tags) != 2 || tags[0].Name != "加急" || tags[0].FileCount != 1 || tags[1].FileCount != 2 {
+		t.Errorf("list: %+v %v", tags, err)
+	}
+
+	if err := DeleteTag(db, work.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Model(&FileTag{}).Where("tag_id = ?", work.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("file tags should be removed with the tag, got %d", count)
+	}
+}
+
+func TestTags_Lifecycle(t *testing.T) {
+	db := setupSearchTest(t)
+	tag, _ := CreateTag(db, 1, "项目", "green")
+	if _, err := TagFiles(db, 1, []string{"r1", "r4"}, []uint64{tag.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := SetFavorites(db, 1, []string{"r1", "p1"}, true); err != nil || n != 2 {
+		t.Fatalf("favorite: %d %v", n, err)
+	}
+
+	// 列表和搜索结果带有标签和收藏状态
+	list, err := ListFiles(db, ListFilesRequest{ParentID: "y2024", OwnerID: 1})
+	if err != nil || len(list.Files) != 1 {
+		t.Fatalf("list: %+v %v", list, err)
+	}
+	if item := list.Files[0]; len(item.Tags) != 1 || item.Tags[0].Name != "项目" || !item.Starred {
+		t.Errorf("list labels: %+v", item)
+	}
+	if ids := searchIDs(t, db, SearchRequest{TagIDs: []uint64{tag.ID}}); len(ids) != 2 {
+		t.Errorf("by tag: %v", ids)
+	}
+	if ids := searchIDs(t, db, SearchRequest{TagIDs: []uint64{tag.ID}, Starred: true}); len(ids) != 1 || ids[0] != "r1" {
+		t.Errorf("by tag and starred: %v", ids)
+	}
+
+	// 移动、重命名、删除到回收站再还原后仍保留
+	if err := MoveFile(db, "r1", 1, "root"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RenameFile(db, "r1", 1, "总结.docx"); err != nil {
+		t.Fatal(err)
+	}
+	DeleteFile(db, "r1", 1)
+	if ids := searchIDs(t, db, SearchRequest{Starred: true}); len(ids) != 1 || ids[0] != "p1" {
+		t.Errorf("trashed files should be hidden: %v", ids)
+	}
+	if tags, _ := ListTags(db, 1); tags[0].FileCount != 1 {
+		t.Errorf("trashed files should not be counted: %+v", tags)
+	}
+	if _, err := RestoreFile(db, "r1", 1); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := SearchFiles(db, SearchRequest{OwnerID: 1, Name: "总结", TagIDs: []uint64{tag.ID}, Starred: true})
+	if err != nil || len(resp.Files) != 1 || len(resp.Files[0].Tags) != 1 || !resp.Files[0].Starred {
+		t.Fatalf("labels should survive move, rename and restore: %+v %v", resp, err)
+	}
+
+	// 彻底删除时一并删除
+	DeleteFile(db, "r1", 1)
+	if _, err := PermanentlyDeleteFile(db, "r1", 1); err != nil {
+		t.Fatal(err)
+	}
+	var tagged, starred int64
+	db.Model(&FileTag{}).Where("file_id = ?", "r1").Count(&tagged)
+	db.Model(&Favorite{}).Where("file_id = ?", "r1").Count(&starred)
+	if tagged != 0 || starred != 0 {
+		t.Errorf("labels should be removed on permanent delete: %d %d", tagged, starred)
+	}
+
+	if n, err := SetFavorites(db, 1, []string{"p1"}, false); err != nil || n != 1 {
+		t.Errorf("unfavorite: %d %v", n, err)
+	}
+	if _, err := SetFavorites(db, 1, []string{"x1"}, true); err == nil {
+		t.Errorf("cannot favorite other users' files")
+	}
+}
@@ -0,0 +1,204 @@
+package file
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var ErrPathNotFound = errors.New("路径不存在")
+
+// FileAncestor 目录树的闭包表：每个文件/文件夹与其自身及所有祖先各有一条记录，Depth 为两者之间的层数（自身为0）
+// 由 File 的创建钩子、MoveFile 和还原到新目录时维护，彻底删除时随文件一并删除；软删除的记录保留，以便还原
+type FileAncestor struct {
+	AncestorID   string `gorm:"type:char(36);primaryKey"`
+	DescendantID string `gorm:"type:char(36);primaryKey;index"`
+	Depth        int
+}
+
+// AfterCreate 新建文件/文件夹时写入文件名索引和闭包表：闭包表中自身一条，再继承父目录的所有祖先
+// 批量创建时按切片顺序执行，调用方需保证父目录在子项之前
+func (f *File) AfterCreate(tx *gorm.DB) error {
+	db := tx.Session(&gorm.Session{NewDB: true})
+	if err := createNameTokens(db, f); err != nil {
+		return err
+	}
+	if err := db.Create(&FileAncestor{AncestorID: f.ID, DescendantID: f.ID}).Error; err != nil {
+		return err
+	}
+	if f.ParentID == "" {
+		return nil
+	}
+	return db.Exec("INSERT INTO file_ancestors (ancestor_id, descendant_id, depth) "+
+		"SELECT ancestor_id, ?, depth + 1 FROM file_ancestors WHERE descendant_id = ?", f.ID, f.ParentID).Error
+}
+
+// relinkSubtree 将 id 及其子树挂到新的父目录下：删除子树与原祖先之间的记录，再与新父目录的祖先逐一关联
+// 子树内部的记录不变；调用方负责更新 id 的 ParentID 并保证新父目录不在子树中
+func relinkSubtree(tx *gorm.DB, id, newParentID string) error {
+	var subtree []FileAncestor
+	if err := tx.Where("ancestor_id = ?", id).Find(&subtree).Error; err != nil {
+		return err
+	}
+	byDepth := map[int][]string{}
+	for _, s := range subtree {
+		byDepth[s.Depth] = append(byDepth[s.Depth], s.DescendantID)
+	}
+	// 距 id 为 k 层的节点，深度大于 k 的记录都指向子树之外的原祖先
+	for depth, ids := range byDepth {
+		err := inChunks(ids, func(chunk []string) error {
+			return tx.Where("descendant_id IN ? AND depth > ?", chunk, depth).Delete(&FileAncestor{}).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if newParentID == "" {
+		return nil
+	}
+	var ancestors []FileAncestor
+	if err := tx.Where("descendant_id = ?", newParentID).Find(&ancestors).Error; err != nil {
+		return err
+	}
+	links := make([]FileAncestor, 0, len(ancestors)*len(subtree))
+	for _, a := range ancestors {
+		for _, s := range subtree {
+			links = append(links, FileAncestor{AncestorID: a.AncestorID, DescendantID: s.DescendantID, Depth: a.Depth + 1 + s.Depth})
+		}
+	}
+	if len(links) == 0 {
+		return nil
+	}
+	return tx.CreateInBatches(links, deleteChunkSize).Error
+}
+
+// BackfillAncestors 为闭包表中缺少记录的文件补全祖先关系，用于升级后迁移已有数据，可重复执行
+func BackfillAncestors(db *gorm.DB) (int, error) {
+	var missing []string
+	if err := db.Unscoped().Model(&File{}).
+		Where("id NOT IN (?)", db.Model(&FileAncestor{}).Select("descendant_id").Where("depth = 0")).
+		Pluck("id", &missing).Error; err != nil {
+		return 0, err
+	}
+	if len(missing) == 0 {
+		return 0, nil
+	}
+	var all []File
+	if err := db.Unscoped().Select("id", "parent_id").Find(&all).Error; err != nil {
+		return 0, err
+	}
+	parents := make(map[string]string, len(all))
+	for _, f := range all {
+		parents[f.ID] = f.ParentID
+	}
+	var links []FileAncestor
+	for _, id := range missing {
+		seen := map[string]bool{}
+		for cur, depth := id, 0; cur != "" && !seen[cur]; depth++ {
+			if _, ok := parents[cur]; !ok {
+				break // 父目录已不存在
+			}
+			seen[cur] = true
+			links = append(links, FileAncestor{AncestorID: cur, DescendantID: id, Depth: depth})
+			cur = parents[cur]
+		}
+	}
+	return len(missing), db.Transaction(func(tx *gorm.DB) error {
+		// 清除缺失文件可能残留的部分记录后重建
+		if err := inChunks(missing, func(chunk []string) error {
+			return tx.Where("descendant_id IN ?", chunk).Delete(&FileAncestor{}).Error
+		}); err != nil {
+			return err
+		}
+		return tx.CreateInBatches(links, deleteChunkSize).Error
+	})
+}
+
+// Ancestors 返回文件/文件夹从最顶层目录到自身的完整路径（含已软删除的记录），用于面包屑导航
+func Ancestors(db *gorm.DB, id string) ([]File, error) {
+	var files []File
+	err := db.Unscoped().Model(&File{}).
+		Joins("JOIN file_ancestors ON file_ancestors.ancestor_id = files.id").
+		Where("file_ancestors.descendant_id = ?", id).
+		Order("file_ancestors.depth desc").Find(&files).Error
+	return files, err
+}
+
+// SubtreeQuery 子树查询条件，MaxDepth 为 0 表示不限层数
+type SubtreeQuery struct {
+	RootID   string
+	MaxDepth int
+	Type     string
+	Page     int
+	PageSize int
+}
+
+// SubtreeFile 子树中的文件及其相对根目录的层数
+type SubtreeFile struct {
+	File
+	Depth int `json:"depth"`
+}
+
+// ListSubtree 分页返回目录下所有层级未删除的文件/文件夹，按层数、名称排序
+func ListSubtree(db *gorm.DB, q SubtreeQuery) ([]SubtreeFile, int64, error) {
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	if q.PageSize <= 0 || q.PageSize > 1000 {
+		q.PageSize = 100
+	}
+	query := db.Model(&File{}).
+		Joins("JOIN file_ancestors ON file_ancestors.descendant_id = files.id").
+		Where("file_ancestors.ancestor_id = ? AND file_ancestors.depth > 0", q.RootID)
+	if q.MaxDepth > 0 {
+		query = query.Where("file_ancestors.depth <= ?", q.MaxDepth)
+	}
+	if q.Type != "" {
+		query = query.Where("files.type = ?", q.Type)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var files []SubtreeFile
+	err := query.Select("files.*, file_ancestors.depth AS depth").
+		Order("file_ancestors.depth").Order("files.name").
+		Offset((q.Page - 1) * q.PageSize).Limit(q.PageSize).Find(&files).Error
+	return files, total, err
+}
+
+// ResolvePath 按 /a/b/c 形式的路径从用户根目录逐级查找文件/文件夹，中间各级必须是文件夹；"/" 表示根目录
+func ResolvePath(db *gorm.DB, ownerID uint, p string) (*File, error) {
+	var userRoot UserRoot
+	if err := db.First(&userRoot, "user_id = ?", ownerID).Error; err != nil {
+		return nil, err
+	}
+	var cur File
+	if err := db.First(&cur, "id = ?", userRoot.RootID).Error; err != nil {
+		return nil, err
+	}
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	for i, name := range segments {
+		if name == "" {
+			if len(segments) == 1 {
+				break
+			}
+			return nil, ErrPathNotFound
+		}
+		query := db.Where("parent_id = ? AND name = ? AND owner_id = ?", cur.ID, name, ownerID)
+		if i < len(segments)-1 {
+			query = query.Where("type = ?", "folder")
+		}
+		var next File
+		// 同名的文件夹和文件并存时优先匹配文件夹
+		if err := query.Order("type = 'folder' desc").First(&next).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrPathNotFound
+			}
+			return nil, err
+		}
+		cur = next
+	}
+	return &cur, nil
+}
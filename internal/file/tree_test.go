@@ -0,0 +1,131 @@
+package file
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ancestorIDs 返回文件从最顶层到自身的ID路径
+func ancestorIDs(t *testing.T, db *gorm.DB, id string) []string {
+	t.Helper()
+	files, err := Ancestors(db, id)
+	if err != nil {
+		t.Fatalf("ancestors of %s: %v", id, err)
+	}
+	ids := []string{}
+	for _, f := range files {
+		ids = append(ids, f.ID)
+	}
+	return ids
+}
+
+func TestMoveFile_RelinkFailureRollsBackParent(t *testing.T) {
+	db := setupTestDB(t)
+	setupFolderTree(t, db, 21)
+	db.Callback().Create().Before("gorm:create").Register("test:fail_ancestors", func(tx *gorm.DB) {
+		if tx.Statement.Table == "file_ancestors" {
+			tx.AddError(errors.New("injected"))
+		}
+	})
+	if err := MoveFile(db, "sub", 21, "root"); err == nil {
+		t.Fatalf("expected relink failure")
+	}
+	var sub File
+	db.First(&sub, "id = ?", "sub")
+	if sub.ParentID != "dir" {
+		t.Errorf("parent_id should roll back with the closure table, got %s", sub.ParentID)
+	}
+	if got := ancestorIDs(t, db, "b"); !reflect.DeepEqual(got, []string{"root", "dir", "sub", "b"}) {
+		t.Errorf("ancestors should be unchanged: %v", got)
+	}
+}
+
+func TestAncestors_MaintainedOnCreateAndMove(t *testing.T) {
+	db := setupTestDB(t)
+	setupFolderTree(t, db, 20)
+	if got := ancestorIDs(t, db, "b"); !reflect.DeepEqual(got, []string{"root", "dir", "sub", "b"}) {
+		t.Fatalf("unexpected ancestors after create: %v", got)
+	}
+
+	// 把 sub 移到根目录下，子树中 b.txt 的祖先随之更新
+	if err := MoveFile(db, "sub", 20, "root"); err != nil {
+		t.Fatalf("move folder: %v", err)
+	}
+	if got := ancestorIDs(t, db, "b"); !reflect.DeepEqual(got, []string{"root", "sub", "b"}) {
+		t.Errorf("unexpected ancestors after move: %v", got)
+	}
+	if inside, _ := IsDescendant(db, "b", "dir"); inside {
+		t.Errorf("b.txt should no longer be under dir")
+	}
+	if err := MoveFile(db, "dir", 20, "dir"); err != ErrMoveToSelfOrChild {
+		t.Errorf("expected ErrMoveToSelfOrChild, got %v", err)
+	}
+	MoveFile(db, "dir", 20, "sub")
+	if err := MoveFile(db, "sub", 20, "dir"); err != ErrMoveToSelfOrChild {
+		t.Errorf("moving a folder under its own child should fail, got %v", err)
+	}
+
+	// 还原到新目录时重新关联，彻底删除时移除记录
+	DeleteFile(db, "dir", 20)
+	if _, err := RestoreFile(db, "dir", 20, "root"); err != nil {
+		t.Fatalf("restore to root: %v", err)
+	}
+	if got := ancestorIDs(t, db, "a"); !reflect.DeepEqual(got, []string{"root", "dir", "a"}) {
+		t.Errorf("unexpected ancestors after restore: %v", got)
+	}
+	DeleteFile(db, "dir", 20)
+	PermanentlyDeleteFile(db, "dir", 20)
+	var links int64
+	db.Model(&FileAncestor{}).Where("descendant_id IN ? OR ancestor_id IN ?", []string{"dir", "a"}, []string{"dir", "a"}).Count(&links)
+	if links != 0 {
+		t.Errorf("links of purged files should be removed, got %d", links)
+	}
+}
+
+func TestBackfillAncestors(t *testing.T) {
+	db := setupTestDB(t)
+	setupFolderTree(t, db, 21)
+	// 模拟升级前的数据：闭包表为空
+	db.Where("1 = 1").Delete(&FileAncestor{})
+	n, err := BackfillAncestors(db)
+	if err != nil || n != 6 {
+		t.Fatalf("backfill should cover 6 files, got %d, %v", n, err)
+	}
+	if got := ancestorIDs(t, db, "b"); !reflect.DeepEqual(got, []string{"root", "dir", "sub", "b"}) {
+		t.Errorf("unexpected ancestors after backfill: %v", got)
+	}
+	if n, _ := BackfillAncestors(db); n != 0 {
+		t.Errorf("backfill should be idempotent, got %d", n)
+	}
+}
+
+func TestResolvePathAndSubtree(t *testing.T) {
+	db := setupTestDB(t)
+	setupFolderTree(t, db, 22)
+	db.Create(&File{ID: "sub-file", Name: "sub", Type: "file", ParentID: "dir", OwnerID: 22, UploadTime: time.Now()})
+
+	for p, want := range map[string]string{"/": "root", "/dir/sub/b.txt": "b", "dir/a.txt": "a", "/dir/sub": "sub"} {
+		f, err := ResolvePath(db, 22, p)
+		if err != nil || f.ID != want {
+			t.Errorf("resolve %s: got %+v, %v", p, f, err)
+		}
+	}
+	for _, p := range []string{"/dir/missing", "/dir/a.txt/x", "/dir//sub"} {
+		if _, err := ResolvePath(db, 22, p); err != ErrPathNotFound {
+			t.Errorf("resolve %s: expected ErrPathNotFound, got %v", p, err)
+		}
+	}
+
+	files, total, err := ListSubtree(db, SubtreeQuery{RootID: "dir"})
+	if err != nil || total != 4 || files[0].Depth != 1 || files[3].ID != "b" || files[3].Depth != 2 {
+		t.Fatalf("unexpected subtree: %+v, %d, %v", files, total, err)
+	}
+	_, total, _ = ListSubtree(db, SubtreeQuery{RootID: "dir", MaxDepth: 1, Type: "file"})
+	if total != 2 {
+		t.Errorf("depth and type filter should leave a.txt and the sub file, got %d", total)
+	}
+}
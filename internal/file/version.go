@@ -0,0 +1,255 @@
+package file
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 默认版本保留策略：最多保留10个历史版本，保留30天
+const (
+	DefaultKeepVersions = 10
+	DefaultKeepDays     = 30
+)
+
+var ErrVersionNotFound = errors.New("版本不存在")
+var ErrNotAFile = errors.New("只有文件支持历史版本")
+
+// 文件历史版本表
+// 覆盖上传时，文件原来的内容hash保存为一个历史版本
+// Version 在同一文件内递增，Size 冗余记录内容大小便于统计配额
+type FileVersion struct {
+	ID        uint64    `gorm:"primaryKey" json:"id"`
+	FileID    string    `gorm:"type:char(36);index" json:"file_id"`
+	Version   int       `json:"version"`
+	Hash      string    `gorm:"size:64;index" json:"hash"`
+	Size      int64     `json:"size"`
+	OwnerID   uint      `gorm:"index" json:"owner_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 用户版本保留策略
+// KeepVersions 每个文件最多保留的历史版本数，0表示不限制
+// KeepDays 历史版本最长保留天数，0表示不限制
+type VersionPolicy struct {
+	UserID       uint      `gorm:"primaryKey" json:"user_id"`
+	KeepVersions int       `json:"keep_versions"`
+	KeepDays     int       `json:"keep_days"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// GetVersionPolicy 获取用户的版本保留策略，未设置时返回默认策略
+func GetVersionPolicy(db *gorm.DB, userID uint) (VersionPolicy, error) {
+	var policy VersionPolicy
+	err := db.First(&policy, "user_id = ?", userID).Error
+	if err == gorm.ErrRecordNotFound {
+		return VersionPolicy{UserID: userID, KeepVersions: DefaultKeepVersions, KeepDays: DefaultKeepDays}, nil
+	}
+	return policy, err
+}
+
+// SetVersionPolicy 设置用户的版本保留策略
+func SetVersionPolicy(db *gorm.DB, userID uint, keepVersions, keepDays int) (*VersionPolicy, error) {
+	policy := &VersionPolicy{UserID: userID, KeepVersions: keepVersions, KeepDays: keepDays}
+	if err := db.Save(policy).Error; err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// FindFileByName 查找同目录下同名的文件（不含文件夹），不存在时返回nil
+func FindFileByName(db *gorm.DB, parentID, name string, ownerID uint) (*File, error) {
+	var f File
+	err := db.Where("parent_id = ? AND name = ? AND owner_id = ? AND type = ?", parentID, name, ownerID, "file").First(&f).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// archiveVersion 将文件当前内容保存为新的历史版本
+func archiveVersion(tx *gorm.DB, f *File) (*FileVersion, error) {
+	var content FileContent
+	if err := tx.First(&content, "hash = ?", f.Hash).Error; err != nil {
+		return nil, err
+	}
+	var maxVersion int
+	if err := tx.Model(&FileVersion{}).Where("file_id = ?", f.ID).Select("COALESCE(MAX(version), 0)").Scan(&maxVersion).Error; err != nil {
+		return nil, err
+	}
+	v := &FileVersion{
+		FileID:  f.ID,
+		Version: maxVersion + 1,
+		Hash:    f.Hash,
+		Size:    content.Size,
+		OwnerID: f.OwnerID,
+	}
+	if err := tx.Create(v).Error; err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// OverwriteFile 用新内容覆盖文件，原内容保存为历史版本
+// 新内容与当前内容相同时不产生版本，返回nil
+func OverwriteFile(tx *gorm.DB, f *File, newHash string) (*FileVersion, error) {
+	if f.Type != "file" {
+		return nil, ErrNotAFile
+	}
+	if f.Hash == newHash {
+		return nil, nil
+	}
+	v, err := archiveVersion(tx, f)
+	if err != nil {
+		return nil, err
+	}
+	f.Hash = newHash
+	f.UploadTime = time.Now()
+	if err := tx.Model(f).Updates(map[string]interface{}{"hash": f.Hash, "upload_time": f.UploadTime}).Error; err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// getOwnedFile 获取文件并校验所有者
+func getOwnedFile(db *gorm.DB, fileID string, ownerID uint) (*File, error) {
+	var f File
+	if err := db.First(&f, "id = ?", fileID).Error; err != nil {
+		return nil, err
+	}
+	if f.OwnerID != ownerID {
+		return nil, ErrNoPermission
+	}
+	if f.Type != "file" {
+		return nil, ErrNotAFile
+	}
+	return &f, nil
+}
+
+// ListVersions 列出文件的历史版本，按版本号倒序
+func ListVersions(db *gorm.DB, fileID string, ownerID uint) ([]FileVersion, error) {
+	if _, err := getOwnedFile(db, fileID, ownerID); err != nil {
+		return nil, err
+	}
+	versions := []FileVersion{}
+	err := db.Where("file_id = ?", fileID).Order("version desc").Find(&versions).Error
+	return versions, err
+}
+
+// GetVersion 获取文件的指定历史版本
+func GetVersion(db *gorm.DB, fileID string, versionID uint64, ownerID uint) (*File, *FileVersion, error) {
+	f, err := getOwnedFile(db, fileID, ownerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var v FileVersion
+	if err := db.First(&v, "id = ? AND file_id = ?", versionID, fileID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil, ErrVersionNotFound
+		}
+		return nil, nil, err
+	}
+	return f, &v, nil
+}
+
+// RestoreVersion 将文件还原到指定历史版本
+// 当前内容保存为新的历史版本，被还原的版本记录随之移除，因此占用空间总量不变
+func RestoreVersion(tx *gorm.DB, fileID string, versionID uint64, ownerID uint) (*File, error) {
+	f, v, err := GetVersion(tx, fileID, versionID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := archiveVersion(tx, f); err != nil {
+		return nil, err
+	}
+	if err := tx.Delete(v).Error; err != nil {
+		return nil, err
+	}
+	f.Hash = v.Hash
+	f.UploadTime = time.Now()
+	if err := tx.Model(f).Updates(map[string]interface{}{"hash": f.Hash, "upload_time": f.UploadTime}).Error; err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// DeleteVersion 删除指定历史版本，返回释放的空间大小
+func DeleteVersion(tx *gorm.DB, fileID string, versionID uint64, ownerID uint) (int64, error) {
+	_, v, err := GetVersion(tx, fileID, versionID, ownerID)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Delete(v).Error; err != nil {
+		return 0, err
+	}
+	return v.Size, nil
+}
+
+// ApplyVersionRetention 按保留策略清理文件的历史版本，返回释放的空间大小
+func ApplyVersionRetention(tx *gorm.DB, fileID string, policy VersionPolicy, now time.Time) (int64, error) {
+	var versions []FileVersion
+	if err := tx.Where("file_id = ?", fileID).Order("version desc").Find(&versions).Error; err != nil {
+		return 0, err
+	}
+	return deleteExpiredVersions(tx, versions, policy, now)
+}
+
+// deleteExpiredVersions 删除超出保留数量或保留期限的版本，versions 需按版本号倒序
+func deleteExpiredVersions(tx *gorm.DB, versions []FileVersion, policy VersionPolicy, now time.Time) (int64, error) {
+	var expired []uint64
+	var freed int64
+	for i, v := range versions {
+		tooMany := policy.KeepVersions > 0 && i >= policy.KeepVersions
+		tooOld := policy.KeepDays > 0 && v.CreatedAt.Before(now.AddDate(0, 0, -policy.KeepDays))
+		if tooMany || tooOld {
+			expired = append(expired, v.ID)
+			freed += v.Size
+		}
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+	if err := tx.Where("id IN ?", expired).Delete(&FileVersion{}).Error; err != nil {
+		return 0, err
+	}
+	return freed, nil
+}
+
+// PurgeExpiredVersions 对指定用户的所有文件执行版本保留策略，返回释放的空间大小
+func PurgeExpiredVersions(tx *gorm.DB, ownerID uint, now time.Time) (int64, error) {
+	policy, err := GetVersionPolicy(tx, ownerID)
+	if err != nil {
+		return 0, err
+	}
+	var versions []FileVersion
+	// 回收站中文件的历史版本随文件一起彻底删除时释放，这里跳过以免重复释放配额
+	live := tx.Model(&File{}).Select("id").Where("owner_id = ?", ownerID)
+	if err := tx.Where("owner_id = ? AND file_id IN (?)", ownerID, live).Order("file_id, version desc").Find(&versions).Error; err != nil {
+		return 0, err
+	}
+	var freed int64
+	for start := 0; start < len(versions); {
+		end := start
+		for end < len(versions) && versions[end].FileID == versions[start].FileID {
+			end++
+		}
+		n, err := deleteExpiredVersions(tx, versions[start:end], policy, now)
+		if err != nil {
+			return 0, err
+		}
+		freed += n
+		start = end
+	}
+	return freed, nil
+}
+
+// ListVersionOwners 列出拥有历史版本的用户ID，用于定期清理
+func ListVersionOwners(db *gorm.DB) ([]uint, error) {
+	var owners []uint
+	err := db.Model(&FileVersion{}).Distinct("owner_id").Pluck("owner_id", &owners).Error
+	return owners, err
+}
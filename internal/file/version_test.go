@@ -0,0 +1,143 @@
+package file
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// setupVersionedFile 创建一个内容为 h1 的文件，并准备 h1~h4 四份内容
+func setupVersionedFile(t *testing.T, db *gorm.DB) *File {
+	for i, h := range []string{"h1", "h2", "h3", "h4"} {
+		db.Create(&FileContent{Hash: h, Size: int64(100 * (i + 1))})
+	}
+	f := &File{ID: "vf", Name: "doc.txt", Hash: "h1", Type: "file", ParentID: "root", OwnerID: 1, UploadTime: time.Now()}
+	db.Create(f)
+	return f
+}
+
+func TestOverwriteFile_KeepsPreviousVersion(t *testing.T) {
+	db := setupTestDB(t)
+	f := setupVersionedFile(t, db)
+
+	for _, h := range []string{"h2", "h3"} {
+		if _, err := OverwriteFile(db, f, h); err != nil {
+			t.Fatalf("overwrite failed: %v", err)
+		}
+	}
+	versions, err := ListVersions(db, f.ID, 1)
+	if err != nil {
+		t.Fatalf("list versions failed: %v", err)
+	}
+	if len(versions) != 2 || versions[0].Version != 2 || versions[0].Hash != "h2" || versions[1].Hash != "h1" {
+		t.Fatalf("unexpected versions: %+v", versions)
+	}
+	if versions[1].Size != 100 {
+		t.Errorf("version size should come from FileContent, got %d", versions[1].Size)
+	}
+	var current File
+	db.First(&current, "id = ?", f.ID)
+	if current.Hash != "h3" {
+		t.Errorf("current hash should be h3, got %s", current.Hash)
+	}
+
+	// 相同内容覆盖不产生新版本
+	v, err := OverwriteFile(db, &current, "h3")
+	if err != nil || v != nil {
+		t.Errorf("same content should not create version, v=%v err=%v", v, err)
+	}
+
+	if _, err := ListVersions(db, f.ID, 2); err != ErrNoPermission {
+		t.Errorf("other user should get ErrNoPermission, got %v", err)
+	}
+}
+
+func TestRestoreVersion_SwapsContent(t *testing.T) {
+	db := setupTestDB(t)
+	f := setupVersionedFile(t, db)
+	OverwriteFile(db, f, "h2")
+	versions, _ := ListVersions(db, f.ID, 1)
+
+	restored, err := RestoreVersion(db, f.ID, versions[0].ID, 1)
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if restored.Hash != "h1" {
+		t.Errorf("restored hash should be h1, got %s", restored.Hash)
+	}
+	versions, _ = ListVersions(db, f.ID, 1)
+	if len(versions) != 1 || versions[0].Hash != "h2" || versions[0].Version != 2 {
+		t.Errorf("current content should be archived as version 2, got %+v", versions)
+	}
+
+	if _, err := RestoreVersion(db, f.ID, 9999, 1); err != ErrVersionNotFound {
+		t.Errorf("expected ErrVersionNotFound, got %v", err)
+	}
+}
+
+func TestDeleteVersion_ReturnsFreedSize(t *testing.T) {
+	db := setupTestDB(t)
+	f := setupVersionedFile(t, db)
+	OverwriteFile(db, f, "h2")
+	versions, _ := ListVersions(db, f.ID, 1)
+
+	if _, err := DeleteVersion(db, f.ID, versions[0].ID, 2); err != ErrNoPermission {
+		t.Errorf("other user should get ErrNoPermission, got %v", err)
+	}
+	freed, err := DeleteVersion(db, f.ID, versions[0].ID, 1)
+	if err != nil || freed != 100 {
+		t.Errorf("expected 100 bytes freed, got %d err=%v", freed, err)
+	}
+	versions, _ = ListVersions(db, f.ID, 1)
+	if len(versions) != 0 {
+		t.Errorf("version should be deleted, got %+v", versions)
+	}
+}
+
+func TestVersionRetention(t *testing.T) {
+	db := setupTestDB(t)
+	f := setupVersionedFile(t, db)
+	for _, h := range []string{"h2", "h3", "h4"} {
+		OverwriteFile(db, f, h)
+	}
+	// 版本1~3 分别为 h1(100)、h2(200)、h3(300)，将版本1设为40天前
+	db.Model(&FileVersion{}).Where("version = ?", 1).Update("created_at", time.Now().AddDate(0, 0, -40))
+
+	policy, err := GetVersionPolicy(db, 1)
+	if err != nil || policy.KeepVersions != DefaultKeepVersions || policy.KeepDays != DefaultKeepDays {
+		t.Fatalf("expected default policy, got %+v err=%v", policy, err)
+	}
+	freed, err := ApplyVersionRetention(db, f.ID, policy, time.Now())
+	if err != nil || freed != 100 {
+		t.Fatalf("expected expired version 1 to be purged, freed=%d err=%v", freed, err)
+	}
+
+	if _, err := SetVersionPolicy(db, 1, 1, 0); err != nil {
+		t.Fatalf("set policy failed: %v", err)
+	}
+	freed, err = PurgeExpiredVersions(db, 1, time.Now())
+	if err != nil || freed != 200 {
+		t.Fatalf("expected version 2 to be purged by count, freed=%d err=%v", freed, err)
+	}
+	versions, _ := ListVersions(db, f.ID, 1)
+	if len(versions) != 1 || versions[0].Hash != "h3" {
+		t.Errorf("only newest version should remain, got %+v", versions)
+	}
+}
+
+func TestPermanentlyDeleteFile_RemovesVersions(t *testing.T) {
+	db := setupTestDB(t)
+	f := setupVersionedFile(t, db)
+	OverwriteFile(db, f, "h2")
+	db.Delete(f)
+
+	if _, err := PermanentlyDeleteFile(db, f.ID, 1); err != nil {
+		t.Fatalf("permanently delete failed: %v", err)
+	}
+	var count int64
+	db.Model(&FileVersion{}).Where("file_id = ?", f.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("versions should be deleted with file, got %d", count)
+	}
+}
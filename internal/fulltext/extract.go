@@ -0,0 +1,143 @@
+package fulltext
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cloudDrive/internal/strutil"
+)
+
+var ErrUnsupported = errors.New("不支持提取该类型文件的文本")
+
+// 可提取文本的扩展名：纯文本直接读取，Office 文档为 ZIP 包中的 XML
+var (
+	plainExts = map[string]bool{"txt": true, "md": true, "markdown": true, "csv": true, "json": true}
+	ooxmlExts = map[string]bool{"docx": true, "xlsx": true, "pptx": true}
+)
+
+// Supported 判断扩展名（小写、不含点）是否可提取文本
+func Supported(ext string) bool {
+	return plainExts[ext] || ooxmlExts[ext]
+}
+
+// Extract 按扩展名从文件内容中提取文本，最多返回 maxBytes 字节，截断时保证 UTF-8 完整
+func Extract(data []byte, ext string, maxBytes int) (string, error) {
+	var text string
+	switch {
+	case plainExts[ext]:
+		text = strings.ToValidUTF8(string(data), "")
+	case ooxmlExts[ext]:
+		var err error
+		if text, err = extractOOXML(data, ext, maxBytes); err != nil {
+			return "", err
+		}
+	default:
+		return "", ErrUnsupported
+	}
+	return strutil.Truncate(text, maxBytes), nil
+}
+
+// ooxmlParts 返回文档中包含正文的 XML 部件，幻灯片和工作表按序号排序
+func ooxmlParts(files []*zip.File, ext string) []*zip.File {
+	var parts []*zip.File
+	for _, f := range files {
+		name := f.Name
+		switch ext {
+		case "docx":
+			if name == "word/document.xml" {
+				parts = append(parts, f)
+			}
+		case "xlsx":
+			if name == "xl/sharedStrings.xml" || strings.HasPrefix(name, "xl/worksheets/sheet") {
+				parts = append(parts, f)
+			}
+		case "pptx":
+			if strings.HasPrefix(name, "ppt/slides/slide") && strings.HasSuffix(name, ".xml") {
+				parts = append(parts, f)
+			}
+		}
+	}
+	sort.SliceStable(parts, func(i, j int) bool { return partOrder(parts[i].Name) < partOrder(parts[j].Name) })
+	return parts
+}
+
+// partOrder 取 slide12.xml、sheet3.xml 等文件名中的序号，sharedStrings.xml 等排在最前
+func partOrder(name string) int {
+	base := strings.TrimSuffix(path.Base(name), ".xml")
+	i := len(base)
+	for i > 0 && base[i-1] >= '0' && base[i-1] <= '9' {
+		i--
+	}
+	n, _ := strconv.Atoi(base[i:])
+	return n
+}
+
+// extractOOXML 提取 docx/xlsx/pptx 中 <t> 元素的文本，每个段落、字符串单元格一行
+// 解压后的 XML 总量不超过 maxBytes 的 maxXMLRatio 倍，防止压缩炸弹
+func extractOOXML(data []byte, ext string, maxBytes int) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	budget := int64(maxBytes) * maxXMLRatio
+	for _, f := range ooxmlParts(zr.File, ext) {
+		if budget <= 0 || sb.Len() >= maxBytes {
+			break
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", err
+		}
+		lr := &io.LimitedReader{R: rc, N: budget}
+		err = xmlText(lr, &sb, maxBytes)
+		budget = lr.N
+		rc.Close()
+		// 超出解压上限时保留已提取的文本
+		if err != nil && budget > 0 {
+			return "", err
+		}
+	}
+	return sb.String(), nil
+}
+
+// maxXMLRatio XML 标记远多于文本，允许解压的 XML 为文本上限的倍数
+const maxXMLRatio = 20
+
+// lineElements 结束时换行的元素：段落、共享字符串和内联字符串
+var lineElements = map[string]bool{"p": true, "si": true, "is": true}
+
+func xmlText(r io.Reader, sb *strings.Builder, maxBytes int) error {
+	dec := xml.NewDecoder(r)
+	inText := false
+	for sb.Len() < maxBytes {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			inText = t.Name.Local == "t"
+		case xml.EndElement:
+			inText = false
+			if lineElements[t.Name.Local] {
+				sb.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				sb.Write(t)
+			}
+		}
+	}
+	return nil
+}
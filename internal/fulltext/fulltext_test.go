@@ -0,0 +1,230 @@
+package fulltext
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"cloudDrive/internal/file"
+	"cloudDrive/internal/storage"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect database: %v", err)
+	}
+	if err := db.AutoMigrate(&file.File{}, &file.FileAncestor{}, &file.FileNameToken{}, &file.Tag{}, &file.FileTag{}, &file.Favorite{}, &file.FileMeta{}, &file.FileContent{}, &ContentIndex{}, &ContentTerm{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return db
+}
+
+// zipOf 按 name -> content 生成 zip 包
+func zipOf(t *testing.T, parts map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtract(t *testing.T) {
+	docx := zipOf(t, map[string]string{
+		"word/document.xml": `<w:document xmlns:w="w"><w:body><w:p><w:r><w:t>年度</w:t></w:r><w:r><w:t>报告</w:t></w:r></w:p><w:p><w:r><w:t>Revenue grew</w:t></w:r></w:p></w:body></w:document>`,
+		"word/styles.xml":   `<w:styles xmlns:w="w"><w:t>ignored</w:t></w:styles>`,
+	})
+	text, err := Extract(docx, "docx", 1<<20)
+	if err != nil || text != "年度报告\nRevenue grew\n" {
+		t.Errorf("docx: %q %v", text, err)
+	}
+
+	pptx := zipOf(t, map[string]string{
+		"ppt/slides/slide10.xml": `<p:sld xmlns:a="a" xmlns:p="p"><a:p><a:t>ten</a:t></a:p></p:sld>`,
+		"ppt/slides/slide2.xml":  `<p:sld xmlns:a="a" xmlns:p="p"><a:p><a:t>two</a:t></a:p></p:sld>`,
+	})
+	if text, err := Extract(pptx, "pptx", 1<<20); err != nil || text != "two\nten\n" {
+		t.Errorf("pptx slides should be in order: %q %v", text, err)
+	}
+
+	xlsx := zipOf(t, map[string]string{
+		"xl/sharedStrings.xml":     `<sst><si><t>客户名单</t></si><si><t>Alice</t></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData><row><c t="s"><v>0</v></c><c t="inlineStr"><is><t>inline</t></is></c></row></sheetData></worksheet>`,
+	})
+	if text, err := Extract(xlsx, "xlsx", 1<<20); err != nil || text != "客户名单\nAlice\ninline\n" {
+		t.Errorf("xlsx: %q %v", text, err)
+	}
+
+	if text, _ := Extract([]byte("héllo wörld"), "md", 9); text != "héllo w" {
+		t.Errorf("truncate should keep utf-8 valid: %q", text)
+	}
+	if _, err := Extract([]byte("x"), "exe", 10); err != ErrUnsupported {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+	if _, err := Extract([]byte("not a zip"), "docx", 10); err == nil {
+		t.Errorf("expected error for broken docx")
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	text := strings.Repeat("填充", 50) + "本年度<报告>显示\nRevenue 增长" + strings.Repeat("尾", 200)
+	got := Snippet(text, "年度 revenue", 40)
+	if !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "…") {
+		t.Errorf("snippet should be cut on both sides: %q", got)
+	}
+	if !strings.Contains(got, "本<em>年度</em>&lt;报告&gt;显示 <em>Revenue</em> 增长") {
+		t.Errorf("unexpected highlight: %q", got)
+	}
+	if got := Snippet("short text", "missing", 40); got != "short text" {
+		t.Errorf("no match should return start of text: %q", got)
+	}
+}
+
+func TestIndexAndSearch(t *testing.T) {
+	db := setupTestDB(t)
+	stor := storage.NewMemoryStorage()
+	ctx := context.Background()
+	put := func(hash, content string) {
+		stor.Upload(ctx, hash, strings.NewReader(content))
+		db.Create(&file.FileContent{Hash: hash, Size: int64(len(content))})
+	}
+	put("h-report", "2024 年度报告：营收增长显著。Revenue report for 2024, revenue grew.")
+	put("h-notes", "会议记录：讨论年度计划")
+	put("h-bin", "年度报告 in a binary")
+	put("h-missing", "")
+	stor.Delete(ctx, "h-missing")
+	now := time.Now()
+	for _, f := range []file.File{
+		{ID: "a", Name: "report.md", Hash: "h-report", Type: "file", OwnerID: 1, UploadTime: now},
+		{ID: "b", Name: "copy.txt", Hash: "h-report", Type: "file", OwnerID: 2, UploadTime: now},
+		{ID: "c", Name: "notes.txt", Hash: "h-notes", Type: "file", OwnerID: 1, UploadTime: now},
+		{ID: "d", Name: "data.bin", Hash: "h-bin", Type: "file", OwnerID: 1, UploadTime: now},
+		{ID: "e", Name: "gone.txt", Hash: "h-missing", Type: "file", OwnerID: 1, UploadTime: now},
+	} {
+		db.Create(&f)
+	}
+
+	n, err := IndexPending(ctx, db, stor, 10, DefaultLimits)
+	if err != nil || n != 4 {
+		t.Fatalf("index pending: %d %v", n, err)
+	}
+	statuses := map[string]string{}
+	var indexes []ContentIndex
+	db.Find(&indexes)
+	for _, idx := range indexes {
+		statuses[idx.Hash] = idx.Status
+	}
+	if statuses["h-report"] != StatusIndexed || statuses["h-bin"] != StatusSkipped || statuses["h-missing"] != StatusFailed {
+		t.Errorf("statuses: %v", statuses)
+	}
+	// 相同内容只索引一次，已处理的内容不再重复索引
+	if n, _ := IndexPending(ctx, db, stor, 10, DefaultLimits); n != 0 {
+		t.Errorf("expected nothing pending, got %d", n)
+	}
+
+	resp, err := Search(db, SearchQuery{OwnerID: 1, Query: "年度"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 2 || len(resp.Hits) != 2 {
+		t.Fatalf("hits: %+v", resp)
+	}
+	resp, _ = Search(db, SearchQuery{OwnerID: 1, Query: "年度报告 revenue"})
+	if resp.Total != 1 || resp.Hits[0].ID != "a" {
+		t.Fatalf("all terms should match: %+v", resp)
+	}
+	if !strings.Contains(resp.Hits[0].Snippet, "<em>年度报告</em>") || resp.Hits[0].Score == 0 {
+		t.Errorf("snippet: %q score: %d", resp.Hits[0].Snippet, resp.Hits[0].Score)
+	}
+
+	// 只返回当前用户未删除的文件
+	resp, _ = Search(db, SearchQuery{OwnerID: 2, Query: "revenue"})
+	if resp.Total != 1 || resp.Hits[0].ID != "b" {
+		t.Errorf("owner filter: %+v", resp)
+	}
+	db.Delete(&file.File{}, "id = ?", "b")
+	if resp, _ = Search(db, SearchQuery{OwnerID: 2, Query: "revenue"}); resp.Total != 0 {
+		t.Errorf("deleted files should not match: %+v", resp)
+	}
+	if resp, _ = Search(db, SearchQuery{OwnerID: 1, Query: "binary"}); resp.Total != 0 {
+		t.Errorf("unsupported files should not be indexed: %+v", resp)
+	}
+}
+
+// brokenObjectStorage 下载指定对象时返回存储错误
+type brokenObjectStorage struct {
+	storage.Storage
+	broken string
+}
+
+func (s *brokenObjectStorage) Download(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	if fileID == s.broken {
+		return nil, storage.ErrCacheDigestMismatch
+	}
+	return s.Storage.Download(ctx, fileID)
+}
+
+func TestIndexPending_StorageErrorDoesNotBlock(t *testing.T) {
+	db := setupTestDB(t)
+	mem := storage.NewMemoryStorage()
+	stor := &brokenObjectStorage{Storage: mem, broken: "h-broken"}
+	ctx := context.Background()
+	now := time.Now()
+	for _, h := range []string{"h-broken", "h-ok"} {
+		mem.Upload(ctx, h, strings.NewReader("年度报告"))
+		db.Create(&file.FileContent{Hash: h, Size: int64(len("年度报告"))})
+		db.Create(&file.File{ID: h, Name: h + ".txt", Hash: h, Type: "file", OwnerID: 1, UploadTime: now})
+	}
+
+	// 排在前面的对象读取失败时记录失败并推迟重试，下一轮处理后面的内容
+	for i := 0; i < 2; i++ {
+		if _, err := IndexPending(ctx, db, stor, 1, DefaultLimits); err != nil {
+			t.Fatalf("storage errors should not abort the batch: %v", err)
+		}
+	}
+	var broken, ok ContentIndex
+	db.First(&ok, "hash = ?", "h-ok")
+	if ok.Status != StatusIndexed {
+		t.Errorf("content behind a broken object should be indexed: %+v", ok)
+	}
+	db.First(&broken, "hash = ?", "h-broken")
+	if broken.Status != StatusFailed || broken.Attempts != 1 || broken.RetryAt == nil || !broken.RetryAt.After(time.Now()) {
+		t.Errorf("failure should be recorded and retried later: %+v", broken)
+	}
+	if n, _ := IndexPending(ctx, db, stor, 10, DefaultLimits); n != 0 {
+		t.Errorf("broken object should wait for its retry time, got %d", n)
+	}
+
+	// 到达重试时间后再次索引，仍失败时增加失败次数
+	db.Model(&ContentIndex{}).Where("hash = ?", "h-broken").Update("retry_at", time.Now().Add(-time.Second))
+	if n, _ := IndexPending(ctx, db, stor, 10, DefaultLimits); n != 1 {
+		t.Errorf("broken object should be retried, got %d", n)
+	}
+	db.First(&broken, "hash = ?", "h-broken")
+	if broken.Attempts != 2 {
+		t.Errorf("attempts should grow: %+v", broken)
+	}
+	db.Model(&ContentIndex{}).Where("hash = ?", "h-broken").Update("retry_at", time.Now().Add(-time.Second))
+	stor.broken = ""
+	IndexPending(ctx, db, stor, 10, DefaultLimits)
+	broken = ContentIndex{}
+	db.First(&broken, "hash = ?", "h-broken")
+	if broken.Status != StatusIndexed || broken.RetryAt != nil {
+		t.Errorf("retried content should be indexed: %+v", broken)
+	}
+}
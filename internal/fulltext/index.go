@@ -0,0 +1,252 @@
+// Package fulltext 文件内容的全文索引：从文本和 Office 文档中提取文本，按内容hash建立倒排索引，
+// 相同内容的文件只索引一次；汉字按单字和相邻两字切分，英文按单词切分
+package fulltext
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"cloudDrive/internal/file"
+	"cloudDrive/internal/storage"
+	"cloudDrive/internal/strutil"
+
+	"gorm.io/gorm"
+)
+
+// 内容的索引状态
+const (
+	StatusIndexed = "indexed"
+	StatusSkipped = "skipped" // 类型不支持或文件过大
+	StatusFailed  = "failed"
+)
+
+// ContentIndex 每个内容hash的索引状态及提取出的文本，文本用于生成搜索结果的摘要
+type ContentIndex struct {
+	Hash      string    `gorm:"primaryKey;size:64" json:"hash"`
+	Status    string    `gorm:"size:16" json:"status"`
+	Message   string    `gorm:"size:255" json:"message,omitempty"`
+	Text      string    `gorm:"type:mediumtext" json:"-"`
+	IndexedAt time.Time `json:"indexed_at"`
+	// 读取存储失败的次数及下次重试的时间，RetryAt 为空表示已处理完毕、不再重试
+	Attempts int        `json:"-"`
+	RetryAt  *time.Time `json:"-"`
+}
+
+// ContentTerm 倒排索引：词元在某个内容中出现的次数，按 (term, hash) 查找包含词元的内容
+type ContentTerm struct {
+	Term string `gorm:"size:64;primaryKey"`
+	Hash string `gorm:"size:64;primaryKey;index"`
+	Freq int
+}
+
+// Limits 索引限制
+type Limits struct {
+	MaxFileSize  int64 `mapstructure:"max_file_size"`  // 超过该大小的文件不索引
+	MaxTextBytes int   `mapstructure:"max_text_bytes"` // 每个文件最多索引的文本字节数
+	MaxTerms     int   `mapstructure:"max_terms"`      // 每个文件最多索引的不同词元数
+}
+
+// DefaultLimits 默认索引限制，可在启动时由配置覆盖
+var DefaultLimits = Limits{
+	MaxFileSize:  20 << 20,
+	MaxTextBytes: 1 << 20,
+	MaxTerms:     50000,
+}
+
+// maxTermLen 超过该长度的单词不索引，多为编码数据
+const maxTermLen = 64
+
+// termFreqs 统计文本中各词元的出现次数：英文/数字单词，汉字的单字和相邻两字
+func termFreqs(text string, maxTerms int) map[string]int {
+	freqs := map[string]int{}
+	add := func(t string) {
+		if len(t) > maxTermLen {
+			return
+		}
+		if _, ok := freqs[t]; ok || len(freqs) < maxTerms {
+			freqs[t]++
+		}
+	}
+	words, han := file.SplitText(text)
+	for _, w := range words {
+		add(w)
+	}
+	for _, chars := range han {
+		for i := range chars {
+			add(string(chars[i]))
+			if i+1 < len(chars) {
+				add(string(chars[i : i+2]))
+			}
+		}
+	}
+	return freqs
+}
+
+// queryTerms 查询词切分出的词元，均需出现在内容中：汉字片段为一个字时按单字，否则按相邻两字
+func queryTerms(q string) []string {
+	seen := map[string]bool{}
+	var terms []string
+	add := func(t string) {
+		if !seen[t] && len(t) <= maxTermLen {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	words, han := file.SplitText(q)
+	for _, w := range words {
+		add(w)
+	}
+	for _, chars := range han {
+		if len(chars) == 1 {
+			add(string(chars))
+			continue
+		}
+		for i := 0; i+1 < len(chars); i++ {
+			add(string(chars[i : i+2]))
+		}
+	}
+	return terms
+}
+
+// saveIndex 保存内容的索引状态，已索引时同时写入倒排索引，可重复执行
+func saveIndex(db *gorm.DB, idx ContentIndex, freqs map[string]int) error {
+	idx.IndexedAt = time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("hash = ?", idx.Hash).Delete(&ContentTerm{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("hash = ?", idx.Hash).Delete(&ContentIndex{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&idx).Error; err != nil {
+			return err
+		}
+		if len(freqs) == 0 {
+			return nil
+		}
+		terms := make([]ContentTerm, 0, len(freqs))
+		for t, n := range freqs {
+			terms = append(terms, ContentTerm{Term: t, Hash: idx.Hash, Freq: n})
+		}
+		return tx.CreateInBatches(terms, 500).Error
+	})
+}
+
+// IndexContent 下载内容并提取文本建立索引，ext 为引用该内容的文件的扩展名
+// 类型不支持、文件过大、对象不存在或提取失败时同样记录状态，不再重复尝试；存储的其他错误原样返回，由 IndexPending 记录后稍后重试
+func IndexContent(ctx context.Context, db *gorm.DB, stor storage.Storage, content file.FileContent, ext string, limits Limits) error {
+	idx := ContentIndex{Hash: content.Hash, Status: StatusSkipped}
+	if !Supported(ext) || content.Size > limits.MaxFileSize {
+		return saveIndex(db, idx, nil)
+	}
+	rc, err := stor.Download(ctx, content.Hash)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		idx.Status = StatusFailed
+		idx.Message = err.Error()
+		return saveIndex(db, idx, nil)
+	}
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(io.LimitReader(rc, limits.MaxFileSize+1))
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	text, err := Extract(data, ext, limits.MaxTextBytes)
+	if err != nil {
+		idx.Status = StatusFailed
+		idx.Message = strutil.Truncate(err.Error(), 255)
+		return saveIndex(db, idx, nil)
+	}
+	idx.Status = StatusIndexed
+	idx.Text = text
+	return saveIndex(db, idx, termFreqs(text, limits.MaxTerms))
+}
+
+// IndexPending 索引尚未处理过（或读取失败、已到重试时间）且仍被文件引用的内容，每次最多 batch 个，返回处理的数量
+// 同一内容被多个文件引用时取任一可提取文本的扩展名；读取存储失败时记为 StatusFailed 并按 file.RetryDelay 推迟重试，
+// 继续处理后面的内容，避免个别无法读取的对象一直排在最前面，阻塞其后所有内容的索引
+func IndexPending(ctx context.Context, db *gorm.DB, stor storage.Storage, batch int, limits Limits) (int, error) {
+	var contents []file.FileContent
+	done := db.Model(&ContentIndex{}).Select("hash").Where("retry_at IS NULL OR retry_at > ?", time.Now())
+	if err := db.Where("hash NOT IN (?)", done).
+		Where("hash IN (?)", db.Model(&file.File{}).Select("hash").Where("type = ?", "file")).
+		Limit(batch).Find(&contents).Error; err != nil {
+		return 0, err
+	}
+	for i, content := range contents {
+		if ctx.Err() != nil {
+			return i, ctx.Err()
+		}
+		var exts []string
+		if err := db.Model(&file.File{}).Where("hash = ? AND type = ?", content.Hash, "file").
+			Distinct().Pluck("ext", &exts).Error; err != nil {
+			return i, err
+		}
+		ext := ""
+		for _, e := range exts {
+			if Supported(e) {
+				ext = e
+				break
+			}
+		}
+		if err := IndexContent(ctx, db, stor, content, ext, limits); err != nil {
+			if ctx.Err() != nil {
+				return i, ctx.Err()
+			}
+			if err := recordFailure(db, content.Hash, err); err != nil {
+				return i, err
+			}
+		}
+	}
+	return len(contents), nil
+}
+
+// recordFailure 记录内容索引失败，按失败次数推迟下次重试
+func recordFailure(db *gorm.DB, hash string, cause error) error {
+	log.Printf("索引内容 %s 失败: %v", hash, cause)
+	var prev ContentIndex
+	if err := db.Select("attempts").Where("hash = ?", hash).Limit(1).Find(&prev).Error; err != nil {
+		return err
+	}
+	retryAt := time.Now().Add(file.RetryDelay(prev.Attempts + 1))
+	return saveIndex(db, ContentIndex{
+		Hash:     hash,
+		Status:   StatusFailed,
+		Message:  strutil.Truncate(cause.Error(), 255),
+		Attempts: prev.Attempts + 1,
+		RetryAt:  &retryAt,
+	}, nil)
+}
+
+// indexBatch 每轮索引的内容数
+const indexBatch = 50
+
+// StartIndexer 定期索引新上传的内容，一轮处理满一批时立即继续下一轮，直到ctx取消
+func StartIndexer(ctx context.Context, db *gorm.DB, stor storage.Storage, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := IndexPending(ctx, db, stor, indexBatch, DefaultLimits)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("建立全文索引失败: %v", err)
+				}
+				break
+			}
+			if n < indexBatch {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package fulltext
+
+import (
+	"html"
+	"strings"
+	"time"
+	"unicode"
+
+	"cloudDrive/internal/file"
+
+	"gorm.io/gorm"
+)
+
+// SearchQuery 全文搜索条件
+type SearchQuery struct {
+	OwnerID  uint
+	Query    string
+	Page     int
+	PageSize int
+}
+
+// Hit 一条搜索结果，Snippet 为包含关键字的上下文，已做 HTML 转义，关键字以 <em> 标出
+type Hit struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	ParentID   string    `json:"parent_id"`
+	UploadTime time.Time `json:"upload_time"`
+	Size       int64     `json:"size"`
+	Score      int64     `json:"score"`
+	Snippet    string    `json:"snippet"`
+}
+
+type SearchResponse struct {
+	Hits  []Hit `json:"hits"`
+	Total int64 `json:"total"`
+}
+
+// Search 在当前用户未删除的文件中搜索内容包含所有关键字的文件，按关键字出现次数之和排序
+// 先限定为用户文件引用的内容hash，再按 (term, hash) 主键查找倒排索引，不会读取其他用户的内容
+func Search(db *gorm.DB, q SearchQuery) (*SearchResponse, error) {
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	if q.PageSize <= 0 || q.PageSize > 50 {
+		q.PageSize = 20
+	}
+	resp := &SearchResponse{Hits: []Hit{}}
+	terms := queryTerms(q.Query)
+	if len(terms) == 0 {
+		return resp, nil
+	}
+	owned := db.Model(&file.File{}).Select("hash").Where("owner_id = ? AND type = ?", q.OwnerID, "file")
+	matched := db.Model(&ContentTerm{}).Select("hash, SUM(freq) AS score").
+		Where("term IN ? AND hash IN (?)", terms, owned).
+		Group("hash").Having("COUNT(*) = ?", len(terms))
+	query := db.Model(&file.File{}).
+		Joins("JOIN (?) AS matched ON matched.hash = files.hash", matched).
+		Joins("JOIN file_contents ON file_contents.hash = files.hash").
+		Where("files.owner_id = ? AND files.type = ?", q.OwnerID, "file")
+	if err := query.Count(&resp.Total).Error; err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Hit
+		Hash string
+	}
+	if err := query.Select("files.id, files.name, files.parent_id, files.upload_time, files.hash, file_contents.size, matched.score").
+		Order("matched.score desc").Order("files.upload_time desc").Order("files.id").
+		Offset((q.Page - 1) * q.PageSize).Limit(q.PageSize).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return resp, nil
+	}
+	hashes := make([]string, len(rows))
+	for i, r := range rows {
+		hashes[i] = r.Hash
+	}
+	var texts []ContentIndex
+	if err := db.Select("hash", "text").Where("hash IN ?", hashes).Find(&texts).Error; err != nil {
+		return nil, err
+	}
+	snippets := make(map[string]string, len(texts))
+	for _, t := range texts {
+		snippets[t.Hash] = Snippet(t.Text, q.Query, snippetRunes)
+	}
+	for _, r := range rows {
+		r.Hit.Snippet = snippets[r.Hash]
+		resp.Hits = append(resp.Hits, r.Hit)
+	}
+	return resp, nil
+}
+
+// snippetRunes 摘要的长度（字符数）
+const snippetRunes = 120
+
+// highlightTerms 摘要中需要标出的片段：查询中的每个单词和连续汉字
+func highlightTerms(q string) [][]rune {
+	words, han := file.SplitText(q)
+	terms := make([][]rune, 0, len(words)+len(han))
+	for _, w := range words {
+		terms = append(terms, []rune(w))
+	}
+	return append(terms, han...)
+}
+
+// Snippet 截取文本中第一个关键字附近 width 个字符作为摘要，转义 HTML 后用 <em> 标出所有关键字，
+// 关键字不区分大小写；没有出现关键字时取文本开头
+func Snippet(text, q string, width int) string {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		// 摘要中的换行、制表符显示为空格
+		if unicode.IsSpace(r) {
+			runes[i] = ' '
+		}
+		lower[i] = unicode.ToLower(runes[i])
+	}
+	terms := highlightTerms(q)
+	marks := make([]bool, len(runes))
+	first := -1
+	for _, t := range terms {
+		for i := 0; i+len(t) <= len(lower); i++ {
+			if runesEqual(lower[i:i+len(t)], t) {
+				if first < 0 || i < first {
+					first = i
+				}
+				for j := i; j < i+len(t); j++ {
+					marks[j] = true
+				}
+			}
+		}
+	}
+	start := 0
+	if first > width/3 {
+		start = first - width/3
+	}
+	end := start + width
+	if end > len(runes) {
+		end = len(runes)
+	}
+	var sb strings.Builder
+	if start > 0 {
+		sb.WriteString("…")
+	}
+	for i := start; i < end; {
+		j := i
+		for j < end && marks[j] == marks[i] {
+			j++
+		}
+		seg := string(runes[i:j])
+		if marks[i] {
+			sb.WriteString("<em>" + html.EscapeString(seg) + "</em>")
+		} else {
+			sb.WriteString(html.EscapeString(seg))
+		}
+		i = j
+	}
+	if end < len(runes) {
+		sb.WriteString("…")
+	}
+	return sb.String()
+}
+
+func runesEqual(a, b []rune) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"archive/zip"
+	"cloudDrive/internal/file"
+	"cloudDrive/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// archiveName 生成压缩包文件名：单选时使用所选项名称，多选时使用请求中的名称或默认名称
+func archiveName(db *gorm.DB, ids []string, name string) string {
+	if name == "" && len(ids) == 1 {
+		var f file.File
+		if err := db.Select("name").First(&f, "id = ?", ids[0]).Error; err == nil {
+			name = f.Name
+		}
+	}
+	if name == "" {
+		name = "download"
+	}
+	if !strings.HasSuffix(strings.ToLower(name), ".zip") {
+		name += ".zip"
+	}
+	return name
+}
+
+// streamZip 将条目逐个从存储读取并写入ZIP响应，不落地临时文件
+// 条目数超过65535或单个文件/总大小超过4GB时由 archive/zip 自动写入ZIP64结构；
+// 客户端断开时请求ctx被取消，停止读取存储并放弃写入中央目录
+func streamZip(c *gin.Context, stor storage.Storage, name string, entries []file.ArchiveEntry) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", "attachment; filename*=UTF-8''"+url.QueryEscape(name))
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	for _, e := range entries {
+		if err := writeZipEntry(ctx, zw, stor, e); err != nil {
+			if ctx.Err() != nil {
+				log.Printf("客户端已断开，停止打包下载 %s: %v", name, ctx.Err())
+			} else {
+				log.Printf("打包下载 %s 失败于 %s: %v", name, e.Path, err)
+			}
+			if !c.Writer.Written() {
+				// 尚未向客户端输出任何内容时仍可返回正常的错误响应
+				c.Writer.Header().Del("Content-Type")
+				c.Writer.Header().Del("Content-Disposition")
+				if errors.Is(err, storage.ErrObjectNotFound) {
+					c.JSON(http.StatusNotFound, gin.H{"error": "文件内容不存在", "detail": e.Path})
+				} else {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "打包下载失败", "detail": err.Error()})
+				}
+				return
+			}
+			abortStream(c)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("写入压缩包目录失败 %s: %v", name, err)
+	}
+}
+
+// abortStream 响应头已发送后出错时直接关闭连接，
+// 避免分块传输正常结束导致客户端把不完整的压缩包当作下载成功
+func abortStream(c *gin.Context) {
+	c.Abort()
+	// gin 的 Hijack 在底层不支持时会panic，因此直接判断底层的 ResponseWriter
+	w, ok := c.Writer.(interface{ Unwrap() http.ResponseWriter })
+	if !ok {
+		return
+	}
+	if hj, ok := w.Unwrap().(http.Hijacker); ok {
+		if conn, _, err := hj.Hijack(); err == nil {
+			conn.Close()
+		}
+	}
+}
+
+func writeZipEntry(ctx context.Context, zw *zip.Writer, stor storage.Storage, e file.ArchiveEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	hdr := &zip.FileHeader{Name: e.Path, Method: zip.Store, Modified: e.ModTime}
+	if e.IsDir {
+		_, err := zw.CreateHeader(hdr)
+		return err
+	}
+	// 网盘中的文件多为已压缩格式，仅在大小较小时压缩以节省CPU
+	if e.Size < 64<<20 {
+		hdr.Method = zip.Deflate
+	}
+	w, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	rc, err := stor.Download(ctx, e.Hash)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	_, err = io.Copy(w, rc)
+	return err
+}
+
+// @Summary 打包下载
+// @Description 将文件夹子树或多个文件/文件夹流式打包为ZIP下载，保留目录结构，重名项自动追加序号，需登录（Session）
+// @Tags 文件模块
+// @Produce application/zip
+// @Param id query []string true "文件/文件夹ID，可重复传入"
+// @Param name query string false "压缩包名称，多选时默认为download.zip"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /files/zip [get]
+func FileZipDownloadHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	stor := c.MustGet(StorageKey).(storage.Storage)
+	ids := c.QueryArray("id")
+	if len(ids) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	entries, err := file.CollectArchiveEntries(db, ids, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+		case errors.Is(err, file.ErrNoPermission):
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权限下载该文件"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询文件失败", "detail": err.Error()})
+		}
+		return
+	}
+	streamZip(c, stor, archiveName(db, ids, c.Query("name")), entries)
+}
+
+// @Summary 分享打包下载
+// @Description 通过分享链接将分享的文件夹（或其中的部分文件）流式打包为ZIP下载，私有需access_code
+// @Tags 分享
+// @Produce application/zip
+// @Param token path string true "分享Token"
+// @Param access_code query string false "访问码(私有分享)"
+// @Param id query []string false "分享文件夹内的文件/文件夹ID，不传时下载整个分享"
+// @Success 200 {file} file
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 410 {object} map[string]interface{}
+// @Router /share/zip/{token} [get]
+func ShareZipDownloadHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	stor := c.MustGet(StorageKey).(storage.Storage)
+	share, ok := validShare(c, db, c.Param("token"), c.Query("access_code"))
+	if !ok {
+		return
+	}
+	ids := c.QueryArray("id")
+	if len(ids) == 0 {
+		ids = []string{share.ResourceID}
+	}
+	// 只允许下载分享资源本身或其子孙
+	for _, id := range ids {
+		ok, err := file.IsDescendant(db, id, share.ResourceID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询文件失败", "detail": err.Error()})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("文件 %s 不在分享范围内", id)})
+			return
+		}
+	}
+	entries, err := file.CollectArchiveEntries(db, ids, share.CreatorID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, file.ErrNoPermission) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "资源不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询文件失败", "detail": err.Error()})
+		return
+	}
+	streamZip(c, stor, archiveName(db, ids, c.Query("name")), entries)
+}
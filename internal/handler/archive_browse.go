@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"cloudDrive/internal/archive"
+	"cloudDrive/internal/cache"
+	"cloudDrive/internal/file"
+	"cloudDrive/internal/storage"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// loadArchive 校验压缩包并读取其目录，优先使用缓存；出错时已写入响应
+func loadArchive(c *gin.Context) (*file.File, int64, *archive.Index, bool) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	stor := c.MustGet(StorageKey).(storage.Storage)
+	f, format, err := archive.Validate(db, c.Param("id"), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+		case errors.Is(err, file.ErrNoPermission):
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权限访问该文件"})
+		case errors.Is(err, file.ErrNotAFile), errors.Is(err, archive.ErrUnsupportedFormat):
+			c.JSON(http.StatusBadRequest, gin.H{"error": archive.ErrUnsupportedFormat.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询文件失败", "detail": err.Error()})
+		}
+		return nil, 0, nil, false
+	}
+	var content file.FileContent
+	if err := db.First(&content, "hash = ?", f.Hash).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件内容不存在"})
+		return nil, 0, nil, false
+	}
+
+	// 同一压缩包的并发请求只解析一次
+	data, err := cacheFrom(c).Fetch(c.Request.Context(), cache.ArchiveIndexKey(format, f.Hash), cache.ArchiveIndexTTL, func() ([]byte, error) {
+		idx, err := archive.BuildIndex(c.Request.Context(), stor, f.Hash, content.Size, format, archive.DefaultLimits.MaxEntries)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(idx)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrObjectNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "文件内容不存在"})
+		case errors.Is(err, archive.ErrTooManyEntries):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "读取压缩包失败", "detail": err.Error()})
+		}
+		return nil, 0, nil, false
+	}
+	var idx archive.Index
+	if err := json.Unmarshal(data, &idx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取压缩包目录失败", "detail": err.Error()})
+		return nil, 0, nil, false
+	}
+	return f, content.Size, &idx, true
+}
+
+// archiveEntryView 压缩包条目的对外展示信息
+type archiveEntryView struct {
+	Path    string    `json:"path"`
+	Name    string    `json:"name"`
+	IsDir   bool      `json:"is_dir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+// @Summary 查看压缩包内容
+// @Description 列出网盘中zip、tar、tar.gz压缩包内的条目，无需下载整个压缩包（zip只读取中央目录），目录按内容缓存，需登录（Session）
+// @Tags 文件模块
+// @Produce json
+// @Param id path string true "压缩包文件ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 422 {object} map[string]interface{}
+// @Router /files/{id}/archive/entries [get]
+func FileArchiveEntriesHandler(c *gin.Context) {
+	f, _, idx, ok := loadArchive(c)
+	if !ok {
+		return
+	}
+	entries := make([]archiveEntryView, 0, len(idx.Entries))
+	for _, e := range idx.Entries {
+		entries = append(entries, archiveEntryView{
+			Path:    e.Path,
+			Name:    path.Base(e.Path),
+			IsDir:   e.IsDir,
+			Size:    e.Size,
+			ModTime: e.ModTime,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      f.ID,
+		"name":    f.Name,
+		"format":  idx.Format,
+		"entries": entries,
+		"total":   len(entries),
+	})
+}
+
+// @Summary 下载或预览压缩包中的单个文件
+// @Description 从压缩包中流式读取单个文件，无需下载整个压缩包；preview=1 时按文件类型内联返回用于预览，HTML、SVG 等可执行脚本的类型以纯文本返回，需登录（Session）
+// @Tags 文件模块
+// @Produce application/octet-stream
+// @Param id path string true "压缩包文件ID"
+// @Param path query string true "条目在压缩包内的路径"
+// @Param preview query bool false "是否预览"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /files/{id}/archive/entry [get]
+func FileArchiveEntryHandler(c *gin.Context) {
+	stor := c.MustGet(StorageKey).(storage.Storage)
+	if c.Query("path") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少条目路径"})
+		return
+	}
+	f, size, idx, ok := loadArchive(c)
+	if !ok {
+		return
+	}
+	e, err := idx.Find(c.Query("path"))
+	if err != nil || e.IsDir {
+		c.JSON(http.StatusNotFound, gin.H{"error": archive.ErrEntryNotFound.Error()})
+		return
+	}
+	rc, err := archive.OpenEntry(c.Request.Context(), stor, f.Hash, size, idx.Format, e)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取压缩包条目失败", "detail": err.Error()})
+		return
+	}
+	defer rc.Close()
+
+	name := path.Base(e.Path)
+	contentType := "application/octet-stream"
+	disposition := "attachment"
+	if c.Query("preview") == "1" || c.Query("preview") == "true" {
+		disposition = "inline"
+		// 条目内容来自用户上传，可执行脚本的类型与文件预览一样降级为纯文本
+		if t := mime.TypeByExtension(path.Ext(name)); t != "" {
+			contentType = previewContentType(t)
+		}
+	}
+	c.DataFromReader(http.StatusOK, e.Size, contentType, rc, map[string]string{
+		"Content-Disposition":    disposition + "; filename*=UTF-8''" + url.QueryEscape(name),
+		"X-Content-Type-Options": "nosniff",
+	})
+}
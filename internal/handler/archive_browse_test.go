@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"cloudDrive/internal/file"
+	"cloudDrive/internal/storage"
+	"cloudDrive/internal/user"
+)
+
+func setupArchiveBrowseTest(t *testing.T) (*gin.Engine, *gorm.DB) {
+	db := setupTestDB(t)
+	db.Create(&user.User{ID: 1, Username: "testuser", StorageLimit: 1024 * 1024})
+	db.Create(&file.UserRoot{UserID: 1, RootID: "root-id", CreatedAt: time.Now()})
+
+	stor := storage.NewMemoryStorage()
+	rdb := setupTestRedis()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("db", db)
+		c.Set("redis", rdb)
+		c.Set("user_id", uint(1))
+		c.Set(StorageKey, stor)
+		c.Next()
+	})
+	router.POST("/files/upload", FileUploadHandler)
+	router.GET("/files/:id/archive/entries", FileArchiveEntriesHandler)
+	router.GET("/files/:id/archive/entry", FileArchiveEntryHandler)
+	return router, db
+}
+
+func TestFileArchiveBrowse(t *testing.T) {
+	router, db := setupArchiveBrowseTest(t)
+	doUpload(router, "docs.zip", zipOf(map[string]string{
+		"readme.md":       "# 说明",
+		"src/main.go":     "package main",
+		"src/lib/util.go": "package lib",
+	}))
+	var arc file.File
+	db.Where("name = ?", "docs.zip").First(&arc)
+
+	w := doJSON(router, "GET", "/files/"+arc.ID+"/archive/entries", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Format  string             `json:"format"`
+		Total   int                `json:"total"`
+		Entries []archiveEntryView `json:"entries"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "zip", resp.Format)
+	assert.Equal(t, 3, resp.Total)
+	sizes := map[string]int64{}
+	for _, e := range resp.Entries {
+		sizes[e.Path] = e.Size
+	}
+	assert.Equal(t, int64(len("package lib")), sizes["src/lib/util.go"])
+	assert.NotContains(t, w.Body.String(), "ordinal")
+
+	w = doJSON(router, "GET", "/files/"+arc.ID+"/archive/entry?path=src/main.go", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "package main", w.Body.String())
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+
+	w = doJSON(router, "GET", "/files/"+arc.ID+"/archive/entry?path=readme.md&preview=1", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "# 说明", w.Body.String())
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "inline")
+
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "GET", "/files/"+arc.ID+"/archive/entry?path=src", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "GET", "/files/"+arc.ID+"/archive/entry?path=../x", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/files/"+arc.ID+"/archive/entry", nil).Code)
+}
+
+func TestFileArchiveBrowse_Validation(t *testing.T) {
+	router, db := setupArchiveBrowseTest(t)
+	doUpload(router, "notes.txt", []byte("plain"))
+	doUpload(router, "broken.zip", []byte("not a zip file"))
+	var txt, broken file.File
+	db.Where("name = ?", "notes.txt").First(&txt)
+	db.Where("name = ?", "broken.zip").First(&broken)
+	db.Create(&file.File{ID: "other", Name: "x.zip", Type: "file", OwnerID: 2, UploadTime: time.Now()})
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/files/"+txt.ID+"/archive/entries", nil).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, doJSON(router, "GET", "/files/"+broken.ID+"/archive/entries", nil).Code)
+	assert.Equal(t, http.StatusForbidden, doJSON(router, "GET", "/files/other/archive/entries", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "GET", "/files/missing/archive/entries", nil).Code)
+}
+
+func TestFileArchiveBrowse_PreviewScriptableEntry(t *testing.T) {
+	router, db := setupArchiveBrowseTest(t)
+	doUpload(router, "site.zip", zipOf(map[string]string{
+		"index.html": "<script>alert(1)</script>",
+		"logo.svg":   "<svg onload=\"alert(1)\"/>",
+	}))
+	var arc file.File
+	db.Where("name = ?", "site.zip").First(&arc)
+
+	for _, p := range []string{"index.html", "logo.svg"} {
+		w := doJSON(router, "GET", "/files/"+arc.ID+"/archive/entry?path="+p+"&preview=1", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"), p)
+		assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+		assert.Contains(t, w.Header().Get("Content-Disposition"), "inline")
+	}
+}
@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"cloudDrive/internal/file"
+	"cloudDrive/internal/storage"
+)
+
+// setupArchiveTest 构造目录树：
+//
+//	root-id/
+//	  docs/ a.txt, b.txt, sub/ a.txt, empty/
+//	  a.txt
+//	  a.txt（重名）
+func setupArchiveTest(t *testing.T, stor storage.Storage) (*gin.Engine, *gorm.DB) {
+	db := setupTestDB(t)
+	db.AutoMigrate(&file.Share{})
+	now := time.Now()
+	put := func(id, name, typ, parent, content string) {
+		f := &file.File{ID: id, Name: name, Type: typ, ParentID: parent, OwnerID: 1, UploadTime: now}
+		if typ == "file" {
+			f.Hash = contentHash([]byte(content))
+			db.Save(&file.FileContent{Hash: f.Hash, Size: int64(len(content))})
+			stor.Upload(context.Background(), f.Hash, bytes.NewReader([]byte(content)))
+		}
+		db.Create(f)
+	}
+	put("docs", "docs", "folder", "root-id", "")
+	put("docs-a", "a.txt", "file", "docs", "docs a")
+	put("docs-b", "b.txt", "file", "docs", "docs b")
+	put("sub", "sub", "folder", "docs", "")
+	put("sub-a", "a.txt", "file", "sub", "sub a")
+	put("empty", "empty", "folder", "docs", "")
+	put("root-a1", "a.txt", "file", "root-id", "root a 1")
+	put("root-a2", "a.txt", "file", "root-id", "root a 2")
+	put("other", "other.txt", "file", "root-id", "other")
+	db.Model(&file.File{}).Where("id = ?", "other").Update("owner_id", 2)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("db", db)
+		c.Set("user_id", uint(1))
+		c.Set(StorageKey, stor)
+		c.Next()
+	})
+	router.GET("/files/zip", FileZipDownloadHandler)
+	router.GET("/share/zip/:token", ShareZipDownloadHandler)
+	return router, db
+}
+
+// readZip 解析响应中的压缩包，返回 路径->内容
+func readZip(t *testing.T, body []byte) map[string]string {
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("解析压缩包失败: %v", err)
+	}
+	out := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("打开 %s 失败: %v", f.Name, err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		out[f.Name] = string(data)
+	}
+	return out
+}
+
+func zipPaths(entries map[string]string) []string {
+	paths := make([]string, 0, len(entries))
+	for p := range entries {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestFileZipDownload(t *testing.T) {
+	router, db := setupArchiveTest(t, storage.NewMemoryStorage())
+
+	t.Run("文件夹保留目录结构", func(t *testing.T) {
+		w := doJSON(router, "GET", "/files/zip?id=docs", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Header().Get("Content-Disposition"), "docs.zip")
+		entries := readZip(t, w.Body.Bytes())
+		assert.Equal(t, []string{"docs/", "docs/a.txt", "docs/b.txt", "docs/empty/", "docs/sub/", "docs/sub/a.txt"}, zipPaths(entries))
+		assert.Equal(t, "sub a", entries["docs/sub/a.txt"])
+	})
+
+	t.Run("多选重名自动追加序号", func(t *testing.T) {
+		w := doJSON(router, "GET", "/files/zip?id=root-a1&id=root-a2&id=docs-a&name=selection", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Disposition"), "selection.zip")
+		entries := readZip(t, w.Body.Bytes())
+		assert.Equal(t, map[string]string{
+			"a.txt":     "root a 1",
+			"a (1).txt": "root a 2",
+			"a (2).txt": "docs a",
+		}, entries)
+	})
+
+	t.Run("已删除的子项不打包", func(t *testing.T) {
+		db.Delete(&file.File{ID: "docs-b"})
+		defer db.Unscoped().Model(&file.File{}).Where("id = ?", "docs-b").Update("deleted_at", nil)
+		w := doJSON(router, "GET", "/files/zip?id=docs", nil)
+		assert.NotContains(t, readZip(t, w.Body.Bytes()), "docs/b.txt")
+	})
+
+	t.Run("参数和权限校验", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/files/zip", nil).Code)
+		assert.Equal(t, http.StatusNotFound, doJSON(router, "GET", "/files/zip?id=missing", nil).Code)
+		assert.Equal(t, http.StatusForbidden, doJSON(router, "GET", "/files/zip?id=docs&id=other", nil).Code)
+	})
+}
+
+func TestShareZipDownload(t *testing.T) {
+	router, db := setupArchiveTest(t, storage.NewMemoryStorage())
+	db.Create(&file.Share{ResourceID: "docs", ShareType: "public", Token: "pub", ExpireAt: time.Now().Add(time.Hour), CreatorID: 1})
+	db.Create(&file.Share{ResourceID: "docs", ShareType: "private", Token: "priv", AccessCode: "abcd", ExpireAt: time.Now().Add(time.Hour), CreatorID: 1})
+	db.Create(&file.Share{ResourceID: "docs", ShareType: "public", Token: "expired", ExpireAt: time.Now().Add(-time.Hour), CreatorID: 1})
+
+	t.Run("下载整个分享文件夹", func(t *testing.T) {
+		w := doJSON(router, "GET", "/share/zip/pub", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, readZip(t, w.Body.Bytes()), 6)
+	})
+
+	t.Run("下载分享内的部分文件", func(t *testing.T) {
+		w := doJSON(router, "GET", "/share/zip/pub?id=sub", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"sub/", "sub/a.txt"}, zipPaths(readZip(t, w.Body.Bytes())))
+	})
+
+	t.Run("不允许下载分享范围外的文件", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, doJSON(router, "GET", "/share/zip/pub?id=root-a1", nil).Code)
+	})
+
+	t.Run("私有分享需要访问码", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, doJSON(router, "GET", "/share/zip/priv", nil).Code)
+		assert.Equal(t, http.StatusForbidden, doJSON(router, "GET", "/share/zip/priv?access_code=x", nil).Code)
+		assert.Equal(t, http.StatusOK, doJSON(router, "GET", "/share/zip/priv?access_code=abcd", nil).Code)
+	})
+
+	t.Run("过期和不存在的分享", func(t *testing.T) {
+		assert.Equal(t, http.StatusGone, doJSON(router, "GET", "/share/zip/expired", nil).Code)
+		assert.Equal(t, http.StatusNotFound, doJSON(router, "GET", "/share/zip/none", nil).Code)
+	})
+}
+
+// cancelOnDownloadStorage 第一次下载时取消请求，模拟客户端中途断开
+type cancelOnDownloadStorage struct {
+	storage.Storage
+	cancel    context.CancelFunc
+	downloads int
+}
+
+func (s *cancelOnDownloadStorage) Download(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	s.downloads++
+	s.cancel()
+	return s.Storage.Download(ctx, fileID)
+}
+
+func TestFileZipDownload_ClientDisconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stor := &cancelOnDownloadStorage{Storage: storage.NewMemoryStorage(), cancel: cancel}
+	router, _ := setupArchiveTest(t, stor)
+	stor.downloads = 0
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/files/zip?id=docs", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 1, stor.downloads, "断开后不应继续读取后续文件")
+	_, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	assert.Error(t, err, "中断的压缩包不应包含中央目录")
+}
+
+func TestFileZipDownload_StorageError(t *testing.T) {
+	stor := storage.NewMemoryStorage()
+	router, db := setupArchiveTest(t, stor)
+
+	t.Run("尚未输出内容时返回错误响应", func(t *testing.T) {
+		stor.Delete(context.Background(), contentHash([]byte("docs a")))
+		defer stor.Upload(context.Background(), contentHash([]byte("docs a")), bytes.NewReader([]byte("docs a")))
+		w := doJSON(router, "GET", "/files/zip?id=docs", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+		assert.Empty(t, w.Header().Get("Content-Disposition"))
+	})
+
+	t.Run("已输出部分内容时中断连接", func(t *testing.T) {
+		// docs/big.bin 先写出足够多的数据，随后 docs/sub/a.txt 的内容丢失
+		big := make([]byte, 256<<10)
+		rand.Read(big)
+		stor.Upload(context.Background(), contentHash(big), bytes.NewReader(big))
+		db.Create(&file.FileContent{Hash: contentHash(big), Size: int64(len(big))})
+		db.Create(&file.File{ID: "big", Name: "big.bin", Type: "file", Hash: contentHash(big), ParentID: "docs", OwnerID: 1, UploadTime: time.Now()})
+		stor.Delete(context.Background(), contentHash([]byte("sub a")))
+
+		srv := httptest.NewServer(router)
+		defer srv.Close()
+		resp, err := http.Get(srv.URL + "/files/zip?id=docs")
+		if err != nil {
+			t.Fatalf("请求失败: %v", err)
+		}
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		_, err = io.ReadAll(resp.Body)
+		assert.Error(t, err, "出错时应中断连接而不是正常结束响应")
+	})
+}
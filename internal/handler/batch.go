@@ -0,0 +1,367 @@
+package handler
+
+import (
+	"cloudDrive/internal/file"
+	"cloudDrive/internal/user"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 批量操作类型
+const (
+	BatchOpMove    = "move"
+	BatchOpCopy    = "copy"
+	BatchOpDelete  = "delete"
+	BatchOpRestore = "restore"
+)
+
+// 批量操作执行模式：atomic 任一项失败则全部回滚，partial 每项独立提交
+const (
+	BatchModeAtomic  = "atomic"
+	BatchModePartial = "partial"
+)
+
+// 批量操作单项的执行结果
+const (
+	BatchOpOK         = "ok"
+	BatchOpFailed     = "failed"
+	BatchOpRolledBack = "rolled_back" // 已执行，但因其他项失败被回滚
+	BatchOpSkipped    = "skipped"     // 因其他项失败未执行
+)
+
+// maxBatchOperations 单次批量操作的最大项数
+const maxBatchOperations = 1000
+
+var errBatchAborted = errors.New("批量操作失败，已全部回滚")
+
+// batchOperation 批量操作中的一项，TargetParentID 用于移动、复制的目标目录（为空表示根目录）和还原的新路径
+type batchOperation struct {
+	Op             string `json:"op"`
+	ID             string `json:"id"`
+	TargetParentID string `json:"target_parent_id"`
+}
+
+type batchOpResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	NewID  string `json:"new_id,omitempty"` // 复制生成的新文件ID
+	Error  string `json:"error,omitempty"`
+}
+
+// batchOpMessage 将批量操作单项的错误转换为提示信息
+func batchOpMessage(err error) string {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return "文件不存在"
+	case errors.Is(err, file.ErrNoPermission):
+		return "无权限操作该文件"
+	case errors.Is(err, file.ErrNameExists):
+		return "目标目录下已存在同名文件/文件夹"
+	case errors.Is(err, file.ErrMoveToSelfOrChild), errors.Is(err, file.ErrCopyToSelfOrChild):
+		return err.Error()
+	case errors.Is(err, errBatchQuotaExceeded):
+		return "存储空间不足"
+	}
+	return err.Error()
+}
+
+// validateBatchOperations 执行前统一校验操作类型、文件归属、目标目录和同名冲突，返回每项的校验错误（nil表示通过）
+// 以及复制所需的总空间
+func validateBatchOperations(db *gorm.DB, userID uint, ops []batchOperation) ([]error, int64, error) {
+	var rootID string
+	var userRoot file.UserRoot
+	if err := db.First(&userRoot, "user_id = ?", userID).Error; err == nil {
+		rootID = userRoot.RootID
+	}
+	ids := make([]string, 0, len(ops)*2)
+	for i := range ops {
+		if (ops[i].Op == BatchOpMove || ops[i].Op == BatchOpCopy) && ops[i].TargetParentID == "" {
+			ops[i].TargetParentID = rootID
+		}
+		ids = append(ids, ops[i].ID)
+		if ops[i].TargetParentID != "" {
+			ids = append(ids, ops[i].TargetParentID)
+		}
+	}
+	var rows []file.File
+	if err := db.Unscoped().Where("id IN ?", ids).Find(&rows).Error; err != nil {
+		return nil, 0, err
+	}
+	byID := make(map[string]file.File, len(rows))
+	for _, f := range rows {
+		byID[f.ID] = f
+	}
+	errs := make([]error, len(ops))
+	var copySize int64
+	for i, op := range ops {
+		f, ok := byID[op.ID]
+		switch {
+		case op.Op != BatchOpMove && op.Op != BatchOpCopy && op.Op != BatchOpDelete && op.Op != BatchOpRestore:
+			errs[i] = errors.New("不支持的操作类型")
+			continue
+		case !ok || (op.Op != BatchOpRestore && f.DeletedAt.Valid):
+			errs[i] = gorm.ErrRecordNotFound
+			continue
+		case f.OwnerID != userID:
+			errs[i] = file.ErrNoPermission
+			continue
+		}
+		if op.TargetParentID != "" {
+			target, ok := byID[op.TargetParentID]
+			if !ok || target.DeletedAt.Valid || target.Type != "folder" || target.OwnerID != userID {
+				if op.Op == BatchOpRestore {
+					errs[i] = file.ErrRestoreParentNotExist
+				} else {
+					errs[i] = errors.New("目标目录不存在")
+				}
+				continue
+			}
+		}
+		if op.Op == BatchOpCopy {
+			plan, err := file.PlanCopy(db, f.ID)
+			if err != nil {
+				return nil, 0, err
+			}
+			copySize += plan.Size
+		}
+	}
+	if err := checkBatchNameConflicts(db, ops, byID, errs); err != nil {
+		return nil, 0, err
+	}
+	return errs, copySize, nil
+}
+
+// checkBatchNameConflicts 按执行顺序模拟各项对目录中名称的占用，将目标目录下的同名冲突（包括与批量中前面各项的冲突）
+// 记为 file.ErrNameExists；只查询涉及的目录中与被操作文件同名的记录，不加载整个目录
+func checkBatchNameConflicts(db *gorm.DB, ops []batchOperation, byID map[string]file.File, errs []error) error {
+	var folders, names []string
+	for i, op := range ops {
+		if errs[i] != nil {
+			continue
+		}
+		f := byID[op.ID]
+		folders = append(folders, f.ParentID)
+		if op.TargetParentID != "" {
+			folders = append(folders, op.TargetParentID)
+		}
+		names = append(names, f.Name)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	var rows []file.File
+	if err := db.Select("id", "parent_id", "name").Where("parent_id IN ? AND name IN ?", folders, names).Find(&rows).Error; err != nil {
+		return err
+	}
+	type slot struct{ parentID, name string }
+	// occupant 目录中某名称当前的占用者，复制生成的文件尚无ID，以源文件ID加前缀表示
+	occupant := make(map[slot]string, len(rows))
+	for _, r := range rows {
+		occupant[slot{r.ParentID, r.Name}] = r.ID
+	}
+	for i, op := range ops {
+		if errs[i] != nil {
+			continue
+		}
+		f := byID[op.ID]
+		from, to := slot{f.ParentID, f.Name}, slot{op.TargetParentID, f.Name}
+		switch op.Op {
+		case BatchOpDelete:
+			if occupant[from] == f.ID {
+				delete(occupant, from)
+			}
+			continue
+		case BatchOpMove:
+			if f.ParentID == op.TargetParentID {
+				continue // 已在目标目录，无需移动
+			}
+		case BatchOpRestore:
+			if op.TargetParentID == "" {
+				to.parentID = f.ParentID
+			}
+		}
+		// 复制时目标目录中的任何同名项都冲突，移动和还原时排除文件自身
+		if id, ok := occupant[to]; ok && (op.Op == BatchOpCopy || id != f.ID) {
+			errs[i] = file.ErrNameExists
+			continue
+		}
+		switch op.Op {
+		case BatchOpMove:
+			if occupant[from] == f.ID {
+				delete(occupant, from)
+			}
+			occupant[to] = f.ID
+		case BatchOpCopy:
+			occupant[to] = "copy:" + f.ID
+		case BatchOpRestore:
+			if f.DeletedAt.Valid { // 未删除的文件还原时不会移动
+				occupant[to] = f.ID
+			}
+		}
+	}
+	return nil
+}
+
+// runBatchOperation 在事务中执行一项操作，返回复制生成的新文件ID
+func runBatchOperation(tx *gorm.DB, userID uint, op batchOperation) (string, error) {
+	switch op.Op {
+	case BatchOpMove:
+		return "", file.MoveFile(tx, op.ID, userID, op.TargetParentID)
+	case BatchOpDelete:
+		return "", deleteToRecycle(tx, op.ID, userID)
+	case BatchOpRestore:
+		return "", restoreFromRecycle(tx, op.ID, userID, op.TargetParentID)
+	}
+	plan, err := file.PlanCopy(tx, op.ID)
+	if err != nil {
+		return "", err
+	}
+	u, err := user.GetUserByID(tx, userID)
+	if err != nil {
+		return "", err
+	}
+	if u.StorageUsed+plan.Size > u.StorageLimit {
+		return "", errBatchQuotaExceeded
+	}
+	copied, err := file.ExecuteCopy(tx, plan, userID, op.TargetParentID)
+	if err != nil {
+		return "", err
+	}
+	return copied.ID, user.UpdateUserStorageUsed(tx, userID, plan.Size)
+}
+
+// @Summary 批量操作
+// @Description 批量移动（move）、复制（copy）、删除（delete）、还原（restore）文件/文件夹，所有操作在同一事务中执行，执行前统一校验权限、目标目录和同名冲突（包括批量中各项之间的冲突）；
+// @Description mode 为 atomic（默认）时任一项失败则全部回滚，为 partial 时每项独立生效并返回各自结果；缓存只在结束后清理一次，需登录（Session）
+// @Tags 文件模块
+// @Accept json
+// @Produce json
+// @Param mode body string false "执行模式：atomic、partial"
+// @Param operations body []batchOperation true "操作列表"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Router /files/batch [post]
+func FileBatchHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	var req struct {
+		Mode       string           `json:"mode"`
+		Operations []batchOperation `json:"operations"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Operations) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = BatchModeAtomic
+	}
+	if req.Mode != BatchModeAtomic && req.Mode != BatchModePartial {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的执行模式"})
+		return
+	}
+	if len(req.Operations) > maxBatchOperations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "单次批量操作的项数过多"})
+		return
+	}
+	ops := req.Operations
+	results := make([]batchOpResult, len(ops))
+	for i, op := range ops {
+		results[i] = batchOpResult{Index: i, Op: op.Op, ID: op.ID, Status: BatchOpSkipped}
+	}
+
+	errs, copySize, err := validateBatchOperations(db, userID, ops)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询文件失败", "detail": err.Error()})
+		return
+	}
+	invalid := false
+	for i, e := range errs {
+		if e != nil {
+			results[i].Status, results[i].Error = BatchOpFailed, batchOpMessage(e)
+			invalid = true
+		}
+	}
+	if req.Mode == BatchModeAtomic {
+		if invalid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errBatchAborted.Error(), "results": results})
+			return
+		}
+		u, err := user.GetUserByID(db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "用户不存在"})
+			return
+		}
+		if u.StorageUsed+copySize > u.StorageLimit {
+			c.JSON(http.StatusForbidden, gin.H{"error": "存储空间不足"})
+			return
+		}
+	}
+
+	committed := false
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for i, op := range ops {
+			if errs[i] != nil {
+				continue
+			}
+			var newID string
+			var err error
+			if req.Mode == BatchModeAtomic {
+				newID, err = runBatchOperation(tx, userID, op)
+			} else {
+				// 每项在独立的保存点中执行，失败时只回滚该项
+				err = tx.Transaction(func(sp *gorm.DB) error {
+					newID, err = runBatchOperation(sp, userID, op)
+					return err
+				})
+			}
+			if err != nil {
+				results[i].Status, results[i].Error = BatchOpFailed, batchOpMessage(err)
+				if req.Mode == BatchModeAtomic {
+					for j := 0; j < i; j++ {
+						results[j].Status = BatchOpRolledBack
+						results[j].NewID = ""
+					}
+					return errBatchAborted
+				}
+				continue
+			}
+			results[i].Status, results[i].NewID = BatchOpOK, newID
+		}
+		return nil
+	})
+	if err == nil {
+		committed = true
+	} else if err != errBatchAborted {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "批量操作失败", "detail": err.Error()})
+		return
+	}
+
+	summary := map[string]int{}
+	for _, r := range results {
+		summary[r.Status]++
+	}
+	if committed && summary[BatchOpOK] > 0 {
+		// 所有操作完成后统一清理一次缓存
+		cc := cacheFrom(c)
+		ids := make([]string, 0, len(ops))
+		for _, r := range results {
+			if r.Status == BatchOpOK {
+				ids = append(ids, r.ID)
+			}
+		}
+		cc.InvalidateFileMeta(context.Background(), ids...)
+		clearUserFileCaches(cc, userID)
+	}
+	if !committed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errBatchAborted.Error(), "results": results, "summary": summary})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results, "summary": summary})
+}
@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"cloudDrive/internal/file"
+	"cloudDrive/internal/user"
+)
+
+func setupBatchTest(t *testing.T, limit int64) (*gin.Engine, *gorm.DB) {
+	db := setupTestDB(t)
+	db.AutoMigrate(&file.Share{})
+	db.Create(&user.User{ID: 1, Username: "testuser", StorageLimit: limit})
+	db.Create(&file.UserRoot{UserID: 1, RootID: "root", CreatedAt: time.Now()})
+	now := time.Now()
+	for _, f := range []file.File{
+		{ID: "root", Name: "root", Type: "folder", OwnerID: 1},
+		{ID: "docs", Name: "docs", Type: "folder", ParentID: "root", OwnerID: 1},
+		{ID: "pics", Name: "pics", Type: "folder", ParentID: "root", OwnerID: 1},
+		{ID: "a", Name: "a.txt", Hash: "ha", Type: "file", ParentID: "root", OwnerID: 1},
+		{ID: "b", Name: "b.txt", Hash: "hb", Type: "file", ParentID: "root", OwnerID: 1},
+		{ID: "docs-a", Name: "a.txt", Hash: "ha", Type: "file", ParentID: "docs", OwnerID: 1},
+		{ID: "other", Name: "other.txt", Hash: "ha", Type: "file", ParentID: "x", OwnerID: 2},
+	} {
+		f.UploadTime = now
+		db.Create(&f)
+	}
+	db.Create(&file.FileContent{Hash: "ha", Size: 10})
+	db.Create(&file.FileContent{Hash: "hb", Size: 20})
+
+	rdb := setupTestRedis()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("db", db)
+		c.Set("redis", rdb)
+		c.Set("user_id", uint(1))
+		c.Next()
+	})
+	router.POST("/files/batch", FileBatchHandler)
+	return router, db
+}
+
+type batchOpResponse struct {
+	Error   string          `json:"error"`
+	Results []batchOpResult `json:"results"`
+	Summary map[string]int  `json:"summary"`
+}
+
+func doBatch(router *gin.Engine, mode string, ops ...batchOperation) (int, batchOpResponse) {
+	w := doJSON(router, "POST", "/files/batch", gin.H{"mode": mode, "operations": ops})
+	var resp batchOpResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func statusesOf(resp batchOpResponse) []string {
+	var s []string
+	for _, r := range resp.Results {
+		s = append(s, r.Status)
+	}
+	return s
+}
+
+func parentOf(db *gorm.DB, id string) string {
+	var f file.File
+	db.Unscoped().First(&f, "id = ?", id)
+	return f.ParentID
+}
+
+func TestFileBatch_AtomicSuccess(t *testing.T) {
+	router, db := setupBatchTest(t, 1000)
+	code, resp := doBatch(router, "",
+		batchOperation{Op: BatchOpMove, ID: "b", TargetParentID: "docs"},
+		batchOperation{Op: BatchOpCopy, ID: "b", TargetParentID: ""},
+		batchOperation{Op: BatchOpDelete, ID: "docs-a"},
+		batchOperation{Op: BatchOpRestore, ID: "docs-a"},
+	)
+	assert.Equal(t, http.StatusOK, code, resp.Error)
+	assert.Equal(t, []string{BatchOpOK, BatchOpOK, BatchOpOK, BatchOpOK}, statusesOf(resp))
+	assert.Equal(t, "docs", parentOf(db, "b"))
+
+	copyID := resp.Results[1].NewID
+	assert.NotEmpty(t, copyID)
+	var copied file.File
+	db.First(&copied, "id = ?", copyID)
+	assert.Equal(t, "root", copied.ParentID)
+	assert.Equal(t, "hb", copied.Hash)
+	assert.Equal(t, int64(20), storageUsed(db))
+
+	var restored file.File
+	assert.NoError(t, db.First(&restored, "id = ?", "docs-a").Error)
+}
+
+func TestFileBatch_AtomicRollsBackOnConflict(t *testing.T) {
+	router, db := setupBatchTest(t, 1000)
+	db.Create(&file.File{ID: "sub", Name: "sub", Type: "folder", ParentID: "docs", OwnerID: 1, UploadTime: time.Now()})
+	// 移动到自身的子目录，执行时才失败
+	code, resp := doBatch(router, BatchModeAtomic,
+		batchOperation{Op: BatchOpMove, ID: "b", TargetParentID: "docs"},
+		batchOperation{Op: BatchOpDelete, ID: "docs-a"},
+		batchOperation{Op: BatchOpMove, ID: "docs", TargetParentID: "sub"},
+	)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, []string{BatchOpRolledBack, BatchOpRolledBack, BatchOpFailed}, statusesOf(resp))
+	assert.Equal(t, "root", parentOf(db, "b"), "第一项应被回滚")
+	var count int64
+	db.Model(&file.File{}).Where("id = ?", "docs-a").Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestFileBatch_NameConflictsCheckedUpFront(t *testing.T) {
+	router, db := setupBatchTest(t, 1000)
+	db.Create(&file.File{ID: "docs-b", Name: "b.txt", Type: "file", ParentID: "docs", OwnerID: 1, UploadTime: time.Now()})
+	code, resp := doBatch(router, BatchModeAtomic,
+		batchOperation{Op: BatchOpMove, ID: "a", TargetParentID: "pics"},
+		batchOperation{Op: BatchOpCopy, ID: "docs-a", TargetParentID: "pics"}, // 与第一项移入的 a.txt 冲突
+		batchOperation{Op: BatchOpMove, ID: "b", TargetParentID: "docs"},      // docs 中已有 b.txt
+		batchOperation{Op: BatchOpDelete, ID: "docs-b"},
+		batchOperation{Op: BatchOpMove, ID: "b", TargetParentID: "docs"}, // 前一项删除后不再冲突
+	)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, []string{BatchOpSkipped, BatchOpFailed, BatchOpFailed, BatchOpSkipped, BatchOpSkipped}, statusesOf(resp))
+	assert.Equal(t, "目标目录下已存在同名文件/文件夹", resp.Results[1].Error)
+	assert.Equal(t, "root", parentOf(db, "a"), "校验失败时不应执行任何操作")
+	assert.Equal(t, "root", parentOf(db, "b"))
+
+	code, resp = doBatch(router, BatchModeAtomic,
+		batchOperation{Op: BatchOpDelete, ID: "docs-b"},
+		batchOperation{Op: BatchOpMove, ID: "b", TargetParentID: "docs"},
+		batchOperation{Op: BatchOpMove, ID: "docs-a", TargetParentID: "root"}, // 根目录的 a.txt 已移走
+		batchOperation{Op: BatchOpMove, ID: "a", TargetParentID: "pics"},
+	)
+	assert.Equal(t, http.StatusBadRequest, code, "移走的名称只在其后的项中释放")
+	assert.Equal(t, []string{BatchOpSkipped, BatchOpSkipped, BatchOpFailed, BatchOpSkipped}, statusesOf(resp))
+}
+
+func TestFileBatch_ValidatesUpFront(t *testing.T) {
+	router, db := setupBatchTest(t, 1000)
+	code, resp := doBatch(router, BatchModeAtomic,
+		batchOperation{Op: BatchOpMove, ID: "b", TargetParentID: "docs"},
+		batchOperation{Op: BatchOpDelete, ID: "other"},
+		batchOperation{Op: BatchOpMove, ID: "a", TargetParentID: "b"},
+		batchOperation{Op: BatchOpCopy, ID: "docs", TargetParentID: "a"},
+		batchOperation{Op: BatchOpRestore, ID: "a", TargetParentID: "missing"},
+		batchOperation{Op: "rename", ID: "a"},
+		batchOperation{Op: BatchOpDelete, ID: "missing"},
+	)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, []string{BatchOpSkipped, BatchOpFailed, BatchOpFailed, BatchOpFailed, BatchOpFailed, BatchOpFailed, BatchOpFailed}, statusesOf(resp))
+	assert.Equal(t, "无权限操作该文件", resp.Results[1].Error)
+	assert.Equal(t, "目标目录不存在", resp.Results[2].Error)
+	assert.Equal(t, "root", parentOf(db, "b"), "校验失败时不应执行任何操作")
+}
+
+func TestFileBatch_PartialMode(t *testing.T) {
+	router, db := setupBatchTest(t, 25)
+	code, resp := doBatch(router, BatchModePartial,
+		batchOperation{Op: BatchOpMove, ID: "b", TargetParentID: "docs"},
+		batchOperation{Op: BatchOpMove, ID: "a", TargetParentID: "docs"},
+		batchOperation{Op: BatchOpCopy, ID: "b", TargetParentID: "root"},
+		batchOperation{Op: BatchOpCopy, ID: "a", TargetParentID: "root"}, // 根目录已有 a.txt
+		batchOperation{Op: BatchOpCopy, ID: "docs-a", TargetParentID: "pics"},
+		batchOperation{Op: BatchOpDelete, ID: "other"},
+	)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{BatchOpOK, BatchOpFailed, BatchOpOK, BatchOpFailed, BatchOpFailed, BatchOpFailed}, statusesOf(resp))
+	assert.Equal(t, "存储空间不足", resp.Results[4].Error)
+	assert.Equal(t, 2, resp.Summary[BatchOpOK])
+	assert.Equal(t, "docs", parentOf(db, "b"))
+	assert.Equal(t, int64(20), storageUsed(db))
+}
+
+func TestFileBatch_QuotaCheckedUpFront(t *testing.T) {
+	router, db := setupBatchTest(t, 15)
+	code, _ := doBatch(router, BatchModeAtomic,
+		batchOperation{Op: BatchOpCopy, ID: "a", TargetParentID: "pics"},
+		batchOperation{Op: BatchOpCopy, ID: "b", TargetParentID: "pics"},
+	)
+	assert.Equal(t, http.StatusForbidden, code)
+	var count int64
+	db.Model(&file.File{}).Where("parent_id = ?", "pics").Count(&count)
+	assert.Equal(t, int64(0), count)
+}
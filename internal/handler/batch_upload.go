@@ -0,0 +1,385 @@
+package handler
+
+import (
+	"cloudDrive/internal/archive"
+	"cloudDrive/internal/file"
+	"cloudDrive/internal/storage"
+	"cloudDrive/internal/user"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 批量上传遇到同名文件时的处理策略
+const (
+	ConflictSkip      = "skip"
+	ConflictRename    = "rename"
+	ConflictOverwrite = "overwrite"
+)
+
+// 批量上传单个条目的处理结果
+const (
+	BatchCreated     = "created"
+	BatchRenamed     = "renamed"
+	BatchOverwritten = "overwritten"
+	BatchSkipped     = "skipped"
+	BatchMissing     = "missing" // 秒传的内容不存在，需要携带文件内容重新上传
+	BatchFailed      = "failed"
+)
+
+// maxBatchUploadEntries 单次批量上传的最大条目数
+const maxBatchUploadEntries = 5000
+
+var errBatchQuotaExceeded = errors.New("存储空间不足")
+
+// batchUploadEntry 批量上传清单中的一项
+// Path 为相对于目标目录的路径（如浏览器的 webkitRelativePath），中间目录不存在时自动创建；
+// Field 为携带文件内容的表单字段名，为空时按 Hash 秒传
+type batchUploadEntry struct {
+	Path  string `json:"path"`
+	Hash  string `json:"hash"`
+	Field string `json:"field"`
+}
+
+type batchUploadResult struct {
+	Path    string `json:"path"`
+	Status  string `json:"status"`
+	ID      string `json:"id,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+	Instant bool   `json:"instant,omitempty"` // 内容已存在，未写入存储
+	Error   string `json:"error,omitempty"`
+}
+
+// batchUploadItem 已通过校验、等待写入的条目
+type batchUploadItem struct {
+	result *batchUploadResult
+	path   string
+	hash   string
+	size   int64
+	header *multipart.FileHeader
+}
+
+// hashFormFile 计算上传文件的SHA-256
+func hashFormFile(fh *multipart.FileHeader) (string, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// prepareBatchUpload 校验清单中的每一项并计算文件内容的hash，无效条目直接记录失败结果
+func prepareBatchUpload(db *gorm.DB, form *multipart.Form, entries []batchUploadEntry, results []batchUploadResult) []batchUploadItem {
+	var items []batchUploadItem
+	for i, e := range entries {
+		r := &results[i]
+		r.Path = e.Path
+		p, err := archive.SanitizePath(e.Path)
+		if err != nil || p == "" {
+			r.Status, r.Error = BatchFailed, "路径无效"
+			continue
+		}
+		item := batchUploadItem{result: r, path: p, hash: e.Hash}
+		if e.Field != "" {
+			headers := form.File[e.Field]
+			if len(headers) == 0 {
+				r.Status, r.Error = BatchFailed, "缺少文件内容"
+				continue
+			}
+			item.header = headers[0]
+			hash, err := hashFormFile(item.header)
+			if err != nil {
+				r.Status, r.Error = BatchFailed, "文件读取失败"
+				continue
+			}
+			if e.Hash != "" && e.Hash != hash {
+				r.Status, r.Error = BatchFailed, "文件内容校验失败，请重试"
+				continue
+			}
+			item.hash, item.size = hash, item.header.Size
+		} else {
+			if e.Hash == "" {
+				r.Status, r.Error = BatchFailed, "缺少文件内容"
+				continue
+			}
+			var content file.FileContent
+			if err := db.First(&content, "hash = ?", e.Hash).Error; err != nil {
+				r.Status = BatchMissing
+				continue
+			}
+			item.size = content.Size
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// @Summary 批量上传（文件夹上传）
+// @Description 按相对路径一次上传多个文件，自动创建缺少的中间目录；清单 manifest 为JSON数组，每项包含 path、可选的 hash 和携带内容的表单字段名 field（为空时按hash秒传）；
+// @Description 同名文件按 conflict 处理：skip 跳过、rename 自动改名（默认）、overwrite 覆盖并保留历史版本，与同名文件夹冲突时 overwrite 记为失败；文件内容先写入存储，目录和文件记录在同一事务中写入，需登录（Session）
+// @Tags 文件模块
+// @Accept multipart/form-data
+// @Produce json
+// @Param parent_id formData string false "目标目录ID，默认为根目录"
+// @Param conflict formData string false "同名文件处理策略：skip、rename、overwrite"
+// @Param manifest formData string true "上传清单JSON"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /files/batch-upload [post]
+func FileBatchUploadHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	cc := cacheFrom(c)
+	userID := c.MustGet("user_id").(uint)
+	stor := c.MustGet(StorageKey).(storage.Storage)
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误", "detail": err.Error()})
+		return
+	}
+	conflict := c.DefaultPostForm("conflict", ConflictRename)
+	if conflict != ConflictSkip && conflict != ConflictRename && conflict != ConflictOverwrite {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的同名文件处理策略"})
+		return
+	}
+	var entries []batchUploadEntry
+	if err := json.Unmarshal([]byte(c.PostForm("manifest")), &entries); err != nil || len(entries) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "上传清单无效"})
+		return
+	}
+	if len(entries) > maxBatchUploadEntries {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "单次上传的文件数过多"})
+		return
+	}
+	parentID := c.PostForm("parent_id")
+	if parentID == "" {
+		var userRoot file.UserRoot
+		if err := db.First(&userRoot, "user_id = ?", userID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查找根目录失败", "detail": err.Error()})
+			return
+		}
+		parentID = userRoot.RootID
+	} else {
+		var parent file.File
+		if err := db.First(&parent, "id = ? AND owner_id = ? AND type = ?", parentID, userID, "folder").Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "目标目录不存在"})
+			return
+		}
+	}
+
+	results := make([]batchUploadResult, len(entries))
+	items := prepareBatchUpload(db, form, entries, results)
+
+	// 先把尚不存在的内容登记并写入存储，事务中只做数据库写入，避免大请求长时间持有写锁
+	blobs := file.NewBlobReservation(db)
+	mimeTypes, err := uploadBatchContents(db, stor, blobs, items)
+	if err != nil {
+		blobs.Release(stor, blobs.Hashes())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "文件保存失败", "detail": err.Error()})
+		return
+	}
+
+	// 目录、文件内容、文件记录和配额在同一事务中写入，任一步失败都整体回滚；
+	// 回滚时清理本次写入的全部对象，提交时只清理被跳过或失败的条目写入的对象，
+	// 没有记录引用、也没有其他请求正在写入的对象才会被删除
+	var overwritten []string
+	stored := map[string]bool{}
+	folders := 0
+	err = db.Transaction(func(tx *gorm.DB) error {
+		tree := file.NewFolderTree(tx, parentID, userID)
+		for _, item := range items {
+			r := item.result
+			dirID, err := tree.Ensure(path.Dir(item.path))
+			if err != nil {
+				return err
+			}
+			name := path.Base(item.path)
+			// 同目录下文件和文件夹不能重名，同名文件夹也视为冲突
+			existing, err := file.FindChildByName(tx, dirID, name, userID)
+			if err != nil {
+				return err
+			}
+			r.Status = BatchCreated
+			if existing != nil {
+				switch conflict {
+				case ConflictSkip:
+					r.Status, r.ID, r.Name = BatchSkipped, existing.ID, existing.Name
+					continue
+				case ConflictRename:
+					if name, err = file.AvailableName(tx, dirID, name, userID); err != nil {
+						return err
+					}
+					r.Status = BatchRenamed
+				case ConflictOverwrite:
+					if existing.Type != "file" {
+						r.Status, r.Error = BatchFailed, "同名文件夹已存在"
+						continue
+					}
+					r.Status = BatchOverwritten
+				}
+			}
+
+			u, err := user.GetUserByID(tx, userID)
+			if err != nil {
+				return err
+			}
+			if u.StorageUsed+item.size > u.StorageLimit {
+				return errBatchQuotaExceeded
+			}
+			var content file.FileContent
+			err = tx.First(&content, "hash = ?", item.hash).Error
+			if err == gorm.ErrRecordNotFound {
+				mimeType, ok := mimeTypes[item.hash]
+				if !ok {
+					return errors.New("缺少文件内容")
+				}
+				content = file.FileContent{Hash: item.hash, Size: item.size}
+				content.SetMimeType(mimeType)
+				if err := tx.Create(&content).Error; err != nil {
+					return err
+				}
+			} else if err != nil {
+				return err
+			} else {
+				r.Instant = true
+			}
+			stored[item.hash] = true
+
+			if r.Status == BatchOverwritten {
+				f := *existing
+				if err := overwriteWithVersion(tx, &f, item.hash, content.Size); err != nil {
+					return err
+				}
+				overwritten = append(overwritten, f.ID)
+				r.ID, r.Name, r.Size = f.ID, f.Name, content.Size
+				continue
+			}
+			f := file.File{
+				Name:       name,
+				Hash:       item.hash,
+				Type:       "file",
+				ParentID:   dirID,
+				OwnerID:    userID,
+				UploadTime: time.Now(),
+			}
+			if err := tx.Create(&f).Error; err != nil {
+				return err
+			}
+			if err := user.UpdateUserStorageUsed(tx, userID, content.Size); err != nil {
+				return err
+			}
+			r.ID, r.Name, r.Size = f.ID, f.Name, content.Size
+		}
+		folders = tree.Created
+		return nil
+	})
+	if err != nil {
+		blobs.Release(stor, blobs.Hashes())
+		if err == errBatchQuotaExceeded {
+			c.JSON(http.StatusForbidden, gin.H{"error": "存储空间不足"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "批量上传失败", "detail": err.Error()})
+		return
+	}
+
+	var unused []string
+	for _, h := range blobs.Hashes() {
+		if !stored[h] {
+			unused = append(unused, h)
+		}
+	}
+	blobs.Release(stor, unused)
+
+	cc.InvalidateFileMeta(context.Background(), overwritten...)
+	clearUserFileCaches(cc, userID)
+	summary := map[string]int{}
+	for _, r := range results {
+		summary[r.Status]++
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results, "summary": summary, "folders": folders})
+}
+
+// batchContentChunkSize 查询已有内容时每条 IN 语句的hash数
+const batchContentChunkSize = 500
+
+// uploadBatchContents 将尚无 FileContent 记录的条目内容登记到 blobs 后写入存储
+// 返回按文件头检测的 MIME 类型；出错时已登记的对象由调用方通过 blobs 清理
+func uploadBatchContents(db *gorm.DB, stor storage.Storage, blobs *file.BlobReservation, items []batchUploadItem) (map[string]string, error) {
+	var hashes []string
+	pending := map[string]*multipart.FileHeader{}
+	for _, item := range items {
+		if item.header == nil || pending[item.hash] != nil {
+			continue
+		}
+		pending[item.hash] = item.header
+		hashes = append(hashes, item.hash)
+	}
+	for start := 0; start < len(hashes); start += batchContentChunkSize {
+		end := start + batchContentChunkSize
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+		var existing []string
+		if err := db.Model(&file.FileContent{}).Where("hash IN ?", hashes[start:end]).Pluck("hash", &existing).Error; err != nil {
+			return nil, err
+		}
+		for _, h := range existing {
+			delete(pending, h)
+		}
+	}
+
+	var missing []string
+	for _, h := range hashes {
+		if _, ok := pending[h]; ok {
+			missing = append(missing, h)
+		}
+	}
+	if err := blobs.Reserve(missing...); err != nil {
+		return nil, err
+	}
+	mimeTypes := map[string]string{}
+	for _, h := range missing {
+		mimeType, err := uploadFormFile(stor, pending[h], h)
+		if err != nil {
+			return nil, err
+		}
+		mimeTypes[h] = mimeType
+	}
+	return mimeTypes, nil
+}
+
+// uploadFormFile 将上传的文件写入存储，返回按文件头检测的 MIME 类型
+func uploadFormFile(stor storage.Storage, fh *multipart.FileHeader, hash string) (string, error) {
+	if fh == nil {
+		return "", errors.New("缺少文件内容")
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	mimeType := sniffFile(f)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return mimeType, stor.Upload(context.Background(), hash, f)
+}
@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"cloudDrive/internal/file"
+	"cloudDrive/internal/storage"
+	"cloudDrive/internal/user"
+)
+
+func setupBatchUploadTest(t *testing.T, limit int64) (*gin.Engine, *gorm.DB, *storage.MemoryStorage) {
+	db := setupTestDB(t)
+	db.Create(&user.User{ID: 1, Username: "testuser", StorageLimit: limit})
+	db.Create(&file.UserRoot{UserID: 1, RootID: "root-id", CreatedAt: time.Now()})
+	db.Create(&file.File{ID: "root-id", Name: "root", Type: "folder", OwnerID: 1, UploadTime: time.Now()})
+
+	stor := storage.NewMemoryStorage()
+	rdb := setupTestRedis()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("db", db)
+		c.Set("redis", rdb)
+		c.Set("user_id", uint(1))
+		c.Set(StorageKey, stor)
+		c.Next()
+	})
+	router.POST("/files/upload", FileUploadHandler)
+	router.POST("/files/batch-upload", FileBatchUploadHandler)
+	router.GET("/files/:id/versions", FileVersionListHandler)
+	return router, db, stor
+}
+
+type batchFile struct {
+	path    string
+	content string // 为空时只提交hash秒传
+	hash    string
+}
+
+type batchResponse struct {
+	Results []batchUploadResult `json:"results"`
+	Summary map[string]int      `json:"summary"`
+	Folders int                 `json:"folders"`
+}
+
+func doBatchUpload(router *gin.Engine, conflict string, files []batchFile) (*httptest.ResponseRecorder, batchResponse) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	var manifest []batchUploadEntry
+	for i, f := range files {
+		e := batchUploadEntry{Path: f.path, Hash: f.hash}
+		if f.content != "" {
+			e.Field = fmt.Sprintf("file%d", i)
+			part, _ := writer.CreateFormFile(e.Field, "blob")
+			part.Write([]byte(f.content))
+		}
+		manifest = append(manifest, e)
+	}
+	data, _ := json.Marshal(manifest)
+	writer.WriteField("manifest", string(data))
+	if conflict != "" {
+		writer.WriteField("conflict", conflict)
+	}
+	writer.Close()
+	req, _ := http.NewRequest("POST", "/files/batch-upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var resp batchResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+func childByName(t *testing.T, db *gorm.DB, parentID, name string) file.File {
+	t.Helper()
+	var f file.File
+	if err := db.Where("parent_id = ? AND name = ?", parentID, name).First(&f).Error; err != nil {
+		t.Fatalf("未找到 %s: %v", name, err)
+	}
+	return f
+}
+
+func TestFileBatchUpload_CreatesFoldersAndFiles(t *testing.T) {
+	router, db, stor := setupBatchUploadTest(t, 1024*1024)
+	doUpload(router, "existing.bin", []byte("already stored"))
+	before := storageUsed(db)
+
+	w, resp := doBatchUpload(router, "", []batchFile{
+		{path: "photos/2024/a.jpg", content: "jpeg-a"},
+		{path: "photos/b.jpg", content: "jpeg-bb"},
+		{path: "photos/2024/copy.bin", hash: contentHash([]byte("already stored"))},
+		{path: "photos/2024/unknown.bin", hash: contentHash([]byte("never uploaded"))},
+		{path: "../escape.txt", content: "x"},
+		{path: "photos/c.jpg", content: "jpeg-c", hash: contentHash([]byte("other"))},
+	})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	statuses := []string{}
+	for _, r := range resp.Results {
+		statuses = append(statuses, r.Status)
+	}
+	assert.Equal(t, []string{BatchCreated, BatchCreated, BatchCreated, BatchMissing, BatchFailed, BatchFailed}, statuses)
+	assert.True(t, resp.Results[2].Instant)
+	assert.False(t, resp.Results[0].Instant)
+	assert.Equal(t, 2, resp.Folders)
+	assert.Equal(t, 3, resp.Summary[BatchCreated])
+
+	photos := childByName(t, db, "root-id", "photos")
+	y2024 := childByName(t, db, photos.ID, "2024")
+	a := childByName(t, db, y2024.ID, "a.jpg")
+	assert.Equal(t, resp.Results[0].ID, a.ID)
+	childByName(t, db, y2024.ID, "copy.bin")
+	ok, _ := stor.Exists(context.Background(), contentHash([]byte("jpeg-a")))
+	assert.True(t, ok)
+	assert.Equal(t, before+int64(len("jpeg-a")+len("jpeg-bb")+len("already stored")), storageUsed(db))
+
+	// 再次上传同一目录时复用已有文件夹
+	_, resp = doBatchUpload(router, "", []batchFile{{path: "photos/2024/d.jpg", content: "jpeg-d"}})
+	assert.Equal(t, 0, resp.Folders)
+	var count int64
+	db.Model(&file.File{}).Where("name = ? AND type = ?", "photos", "folder").Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestFileBatchUpload_ConflictPolicies(t *testing.T) {
+	router, db, _ := setupBatchUploadTest(t, 1024*1024)
+	_, resp := doBatchUpload(router, "", []batchFile{{path: "docs/readme.txt", content: "v1"}})
+	original := resp.Results[0].ID
+	docs := childByName(t, db, "root-id", "docs")
+
+	_, resp = doBatchUpload(router, ConflictSkip, []batchFile{{path: "docs/readme.txt", content: "v2"}})
+	assert.Equal(t, BatchSkipped, resp.Results[0].Status)
+	assert.Equal(t, original, resp.Results[0].ID)
+
+	_, resp = doBatchUpload(router, ConflictRename, []batchFile{{path: "docs/readme.txt", content: "v2"}})
+	assert.Equal(t, BatchRenamed, resp.Results[0].Status)
+	assert.Equal(t, "readme (1).txt", resp.Results[0].Name)
+	childByName(t, db, docs.ID, "readme (1).txt")
+
+	used := storageUsed(db)
+	_, resp = doBatchUpload(router, ConflictOverwrite, []batchFile{{path: "docs/readme.txt", content: "v3!"}})
+	assert.Equal(t, BatchOverwritten, resp.Results[0].Status)
+	assert.Equal(t, original, resp.Results[0].ID)
+	f := childByName(t, db, docs.ID, "readme.txt")
+	assert.Equal(t, contentHash([]byte("v3!")), f.Hash)
+	assert.Len(t, listVersions(t, router, original), 1)
+	assert.Equal(t, used+3, storageUsed(db))
+
+	w, _ := doBatchUpload(router, "replace", []batchFile{{path: "a.txt", content: "a"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestFileBatchUpload_QuotaRollsBackEverything(t *testing.T) {
+	router, db, stor := setupBatchUploadTest(t, 10)
+	w, _ := doBatchUpload(router, "", []batchFile{
+		{path: "dir/a.txt", content: "12345"},
+		{path: "dir/b.txt", content: "67890!"},
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	var count int64
+	db.Model(&file.File{}).Count(&count)
+	assert.Equal(t, int64(1), count, "不应创建任何目录或文件")
+	assert.Equal(t, int64(0), storageUsed(db))
+	page, _ := stor.List(context.Background(), "", "", 0)
+	assert.Empty(t, page.Objects, "不应残留已写入的对象")
+}
+
+func TestFileBatchUpload_FolderNameConflicts(t *testing.T) {
+	router, db, stor := setupBatchUploadTest(t, 1024*1024)
+	file.CreateFolder(db, "notes", "root-id", 1)
+
+	_, resp := doBatchUpload(router, ConflictOverwrite, []batchFile{{path: "notes", content: "overwrite folder"}})
+	assert.Equal(t, BatchFailed, resp.Results[0].Status)
+
+	_, resp = doBatchUpload(router, ConflictRename, []batchFile{{path: "notes", content: "renamed"}})
+	assert.Equal(t, BatchRenamed, resp.Results[0].Status)
+	assert.Equal(t, "notes (1)", resp.Results[0].Name)
+
+	_, resp = doBatchUpload(router, ConflictSkip, []batchFile{{path: "notes", content: "skipped"}})
+	assert.Equal(t, BatchSkipped, resp.Results[0].Status)
+
+	var count int64
+	db.Model(&file.File{}).Where("parent_id = ? AND name = ?", "root-id", "notes").Count(&count)
+	assert.Equal(t, int64(1), count, "不应创建与文件夹同名的文件")
+	for _, content := range []string{"overwrite folder", "skipped"} {
+		ok, _ := stor.Exists(context.Background(), contentHash([]byte(content)))
+		assert.False(t, ok, "未被使用的内容不应残留在存储中")
+	}
+}
+
+// deleteRecordingStorage 记录被删除的对象
+type deleteRecordingStorage struct {
+	storage.Storage
+	deleted []string
+}
+
+func (s *deleteRecordingStorage) Delete(ctx context.Context, fileID string) error {
+	s.deleted = append(s.deleted, fileID)
+	return s.Storage.Delete(ctx, fileID)
+}
+
+func TestFileBatchUpload_CleansUpOnlyUnusedContents(t *testing.T) {
+	_, db, mem := setupBatchUploadTest(t, 1024*1024)
+	stor := &deleteRecordingStorage{Storage: mem}
+	rdb := setupTestRedis()
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("db", db)
+		c.Set("redis", rdb)
+		c.Set("user_id", uint(1))
+		c.Set(StorageKey, storage.Storage(stor))
+		c.Next()
+	})
+	router.POST("/files/batch-upload", FileBatchUploadHandler)
+	file.CreateFolder(db, "notes", "root-id", 1)
+
+	_, resp := doBatchUpload(router, ConflictSkip, []batchFile{
+		{path: "a.txt", content: "created"},
+		{path: "notes", content: "skipped"},
+	})
+	assert.Equal(t, BatchCreated, resp.Results[0].Status)
+	assert.Equal(t, BatchSkipped, resp.Results[1].Status)
+	// 提交成功后只清理被跳过的条目写入的对象，已提交条目的对象不参与清理
+	assert.Equal(t, []string{contentHash([]byte("skipped"))}, stor.deleted)
+	ok, _ := mem.Exists(context.Background(), contentHash([]byte("created")))
+	assert.True(t, ok)
+}
@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"cloudDrive/internal/cache"
+	"cloudDrive/internal/file"
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cacheFrom 返回基于请求上下文中 Redis 客户端的缓存
+func cacheFrom(c *gin.Context) *cache.Cache {
+	return cache.New(c.MustGet("redis").(cache.Client))
+}
+
+// clearFileCaches 清理单个文件新增或内容变化后受影响的缓存：文件元数据、用户信息和所在目录的列表
+func clearFileCaches(c *gin.Context, userID uint, f *file.File) {
+	cc := cacheFrom(c)
+	ctx := context.Background()
+	cc.InvalidateFileMeta(ctx, f.ID)
+	cc.InvalidateUserInfo(ctx, userID)
+	cc.InvalidateFolders(ctx, f.ParentID)
+}
+
+// clearUserFileCaches 清理用户信息和该用户所有目录的列表缓存，可在请求之外（如异步任务）调用
+func clearUserFileCaches(cc *cache.Cache, userID uint) {
+	ctx := context.Background()
+	cc.InvalidateUserInfo(ctx, userID)
+	cc.InvalidateFileLists(ctx, userID)
+}
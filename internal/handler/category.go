@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"cloudDrive/internal/file"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary 按分类统计文件
+// @Description 按分类（images、documents、video、audio、archives、other）统计当前用户的文件数和总大小，不含回收站中的文件；
+// @Description 分类由上传时按内容检测的类型确定，纯文本等无法确定时按扩展名，需登录（Session）
+// @Tags 文件模块
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /files/categories [get]
+func FileCategoriesHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	categories, err := file.SummarizeCategories(db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "统计失败", "detail": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"categories": categories})
+}
+
+// @Summary 按分类列出文件
+// @Description 列出所有目录中属于该分类的文件，可叠加搜索接口的其他条件，结果格式和分页方式与搜索接口相同，需登录（Session）
+// @Tags 文件模块
+// @Produce json
+// @Param category path string true "分类：images、documents、video、audio、archives、other"
+// @Param cursor query string false "分页游标，取上一页返回的next_cursor，为空表示第一页"
+// @Param page_size query int false "每页数量，默认10，最大100"
+// @Success 200 {object} file.SearchResponse
+// @Failure 400 {object} map[string]interface{}
+// @Router /files/categories/{category} [get]
+func FileCategoryFilesHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	category := c.Param("category")
+	if !file.ValidCategory(category) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": file.ErrInvalidCategory.Error()})
+		return
+	}
+	filter, ok := searchFilterFrom(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	filter.Category = category
+	searchResponse(c, db, filter.Request(userID, time.Now()))
+}
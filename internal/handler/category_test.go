@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"cloudDrive/internal/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x02\x00\x00\x00")
+	testPDF = []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n1 0 obj\n<<>>\nendobj\n")
+)
+
+func TestFileCategories_DetectedAtUpload(t *testing.T) {
+	router, db, _ := setupBatchUploadTest(t, 1<<20)
+	router.GET("/files", FileListHandler)
+	router.GET("/files/categories", FileCategoriesHandler)
+	router.GET("/files/categories/:category", FileCategoryFilesHandler)
+	router.GET("/files/:id/metadata", FileMetadataGetHandler)
+
+	// 图片内容使用了 txt 扩展名，按内容归入图片
+	assert.Equal(t, http.StatusOK, doUpload(router, "scan.txt", testPNG).Code)
+	assert.Equal(t, http.StatusOK, doUpload(router, "notes.md", []byte("# 笔记\n")).Code)
+	w, _ := doBatchUpload(router, "", []batchFile{{path: "docs/合同", content: string(testPDF)}})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var png, pdf file.FileContent
+	db.First(&png, "hash = ?", contentHash(testPNG))
+	db.First(&pdf, "hash = ?", contentHash(testPDF))
+	assert.Equal(t, "image/png", png.MimeType)
+	assert.Equal(t, "images", png.Category)
+	assert.Equal(t, "application/pdf", pdf.MimeType)
+	assert.Equal(t, "documents", pdf.Category)
+
+	var list file.ListFilesResponse
+	w = doJSON(router, "GET", "/files?category=images", nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if assert.Len(t, list.Files, 1) {
+		assert.Equal(t, "scan.txt", list.Files[0].Name)
+		assert.Equal(t, "image/png", list.Files[0].MimeType)
+	}
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/files?category=music", nil).Code)
+
+	var summary struct {
+		Categories []file.CategorySummary `json:"categories"`
+	}
+	json.Unmarshal(doJSON(router, "GET", "/files/categories", nil).Body.Bytes(), &summary)
+	counts := map[string]int64{}
+	for _, s := range summary.Categories {
+		counts[s.Category] = s.Count
+	}
+	assert.Equal(t, map[string]int64{"images": 1, "documents": 2, "video": 0, "audio": 0, "archives": 0, "other": 0}, counts)
+
+	var resp file.SearchResponse
+	w = doJSON(router, "GET", "/files/categories/documents?order_by=name&order=asc", nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if assert.Len(t, resp.Files, 2) {
+		assert.Equal(t, "notes.md", resp.Files[0].Name)
+		assert.Equal(t, "合同", resp.Files[1].Name)
+	}
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/files/categories/music", nil).Code)
+
+	// 预览和下载使用检测到的类型，未检测时按扩展名
+	scan := childByName(t, db, "root-id", "scan.txt")
+	assert.Equal(t, "image/png", contentTypeOf(db, &scan))
+	legacy := file.File{Name: "old.pdf", Hash: "unknown"}
+	assert.Equal(t, "application/pdf", contentTypeOf(db, &legacy))
+	legacy.Name = "old"
+	assert.Equal(t, file.DefaultMimeType, contentTypeOf(db, &legacy))
+}
+
+func TestPreviewContentType_DowngradesScriptableTypes(t *testing.T) {
+	for _, ct := range []string{"text/html; charset=utf-8", "image/svg+xml", "application/xhtml+xml", "TEXT/HTML", "text/javascript"} {
+		assert.Equal(t, "text/plain; charset=utf-8", previewContentType(ct), ct)
+	}
+	for _, ct := range []string{"image/png", "application/pdf", "text/plain; charset=utf-8"} {
+		assert.Equal(t, ct, previewContentType(ct))
+	}
+}
@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"cloudDrive/internal/file"
+	"cloudDrive/internal/task"
+	"cloudDrive/internal/user"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// copyAsyncThreshold 子树中的文件/文件夹数超过该值时以异步任务复制
+const copyAsyncThreshold = 200
+
+var errCopyTargetNotExist = errors.New("目标目录不存在")
+
+type copyResult struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Files   int    `json:"files"`
+	Folders int    `json:"folders"`
+	Size    int64  `json:"size"`
+}
+
+// resolveCopyTarget 返回复制的目标目录ID，为空时为用户根目录，否则必须是用户自己的文件夹
+func resolveCopyTarget(db *gorm.DB, userID uint, targetParentID string) (string, error) {
+	if targetParentID == "" {
+		var userRoot file.UserRoot
+		if err := db.First(&userRoot, "user_id = ?", userID).Error; err != nil {
+			return "", err
+		}
+		return userRoot.RootID, nil
+	}
+	var target file.File
+	if err := db.First(&target, "id = ? AND owner_id = ? AND type = ?", targetParentID, userID, "folder").Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", errCopyTargetNotExist
+		}
+		return "", err
+	}
+	return target.ID, nil
+}
+
+// runCopy 在事务中重新展开源子树、校验配额并写入副本，配额只在提交后生效
+// ctx 取消时整体回滚；副本在同一事务中写入，提交前没有可见的中间进度
+func runCopy(ctx context.Context, db *gorm.DB, srcID string, userID uint, targetParentID string) (*copyResult, error) {
+	var result *copyResult
+	err := db.Transaction(func(tx *gorm.DB) error {
+		plan, err := file.PlanCopy(tx, srcID)
+		if err != nil {
+			return err
+		}
+		u, err := user.GetUserByID(tx, userID)
+		if err != nil {
+			return err
+		}
+		if u.StorageUsed+plan.Size > u.StorageLimit {
+			return errBatchQuotaExceeded
+		}
+		copied, err := file.ExecuteCopyContext(ctx, tx, plan, userID, targetParentID)
+		if err != nil {
+			return err
+		}
+		if err := user.UpdateUserStorageUsed(tx, userID, plan.Size); err != nil {
+			return err
+		}
+		result = &copyResult{ID: copied.ID, Name: copied.Name, Files: plan.Files, Folders: plan.Folders, Size: plan.Size}
+		return nil
+	})
+	return result, err
+}
+
+// copyErrorResponse 将复制过程中的错误转换为响应
+func copyErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+	case errors.Is(err, errCopyTargetNotExist):
+		c.JSON(http.StatusNotFound, gin.H{"error": errCopyTargetNotExist.Error()})
+	case errors.Is(err, errBatchQuotaExceeded):
+		c.JSON(http.StatusForbidden, gin.H{"error": "存储空间不足"})
+	case errors.Is(err, file.ErrNameExists):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "目标目录下已存在同名文件/文件夹"})
+	case errors.Is(err, file.ErrCopyToSelfOrChild):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "复制失败", "detail": err.Error()})
+	}
+}
+
+// startCopy 预先校验配额和同名冲突，小的子树直接复制，大的子树提交异步任务
+func startCopy(c *gin.Context, srcID string, userID uint, targetParentID string) {
+	db := c.MustGet("db").(*gorm.DB)
+	cc := cacheFrom(c)
+	target, err := resolveCopyTarget(db, userID, targetParentID)
+	if err != nil {
+		copyErrorResponse(c, err)
+		return
+	}
+	plan, err := file.PlanCopy(db, srcID)
+	if err != nil {
+		copyErrorResponse(c, err)
+		return
+	}
+	u, err := user.GetUserByID(db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "用户不存在"})
+		return
+	}
+	if u.StorageUsed+plan.Size > u.StorageLimit {
+		copyErrorResponse(c, errBatchQuotaExceeded)
+		return
+	}
+	root := plan.Root()
+	if root.Type == "folder" {
+		inside, err := file.IsDescendant(db, target, root.ID)
+		if err != nil {
+			copyErrorResponse(c, err)
+			return
+		}
+		if inside {
+			copyErrorResponse(c, file.ErrCopyToSelfOrChild)
+			return
+		}
+	}
+	var count int64
+	if err := db.Model(&file.File{}).Where("parent_id = ? AND name = ?", target, root.Name).Count(&count).Error; err != nil {
+		copyErrorResponse(c, err)
+		return
+	}
+	if count > 0 {
+		copyErrorResponse(c, file.ErrNameExists)
+		return
+	}
+
+	if len(plan.Items) <= copyAsyncThreshold {
+		result, err := runCopy(c.Request.Context(), db, srcID, userID, target)
+		if err != nil {
+			copyErrorResponse(c, err)
+			return
+		}
+		clearUserFileCaches(cc, userID)
+		c.JSON(http.StatusOK, result)
+		return
+	}
+	tasks := c.MustGet(TaskManagerKey).(*task.Manager)
+	t, err := tasks.Submit(userID, "copy", func(ctx context.Context, _ *task.Progress) (interface{}, error) {
+		result, err := runCopy(ctx, db, srcID, userID, target)
+		if err != nil {
+			return nil, err
+		}
+		clearUserFileCaches(cc, userID)
+		return result, nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建任务失败", "detail": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"task_id": t.ID})
+}
+
+// @Summary 复制文件/文件夹
+// @Description 将文件或整个文件夹复制到目标目录，内容通过hash复用，不占用额外的存储写入但计入配额；目标目录下不能有同名文件/文件夹，文件夹不能复制到自身或子目录下；
+// @Description 子树较小时直接返回新文件信息，较大时以异步任务执行并返回任务ID，通过 /tasks/{id} 查询状态和结果（复制在单个事务中完成，不报告中间进度），需登录（Session）
+// @Tags 文件模块
+// @Accept json
+// @Produce json
+// @Param id path string true "文件/文件夹ID"
+// @Param target_parent_id body string false "目标目录ID，默认为根目录"
+// @Success 200 {object} map[string]interface{}
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /files/{id}/copy [post]
+func FileCopyHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	var req struct {
+		TargetParentID string `json:"target_parent_id"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+			return
+		}
+	}
+	var src file.File
+	if err := db.First(&src, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+		return
+	}
+	if src.OwnerID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权限操作该文件"})
+		return
+	}
+	startCopy(c, src.ID, userID, req.TargetParentID)
+}
+
+// @Summary 转存分享内容
+// @Description 将分享的文件/文件夹（或分享文件夹中的某一项）复制到自己的网盘，规则与复制相同，需登录（Session）
+// @Tags 分享模块
+// @Accept json
+// @Produce json
+// @Param token path string true "分享Token"
+// @Param access_code body string false "私有分享访问码"
+// @Param id body string false "分享文件夹中的文件/文件夹ID，默认为分享的资源本身"
+// @Param target_parent_id body string false "目标目录ID，默认为根目录"
+// @Success 200 {object} map[string]interface{}
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 410 {object} map[string]interface{}
+// @Router /share/{token}/copy [post]
+func ShareCopyHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	var req struct {
+		AccessCode     string `json:"access_code"`
+		ID             string `json:"id"`
+		TargetParentID string `json:"target_parent_id"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+			return
+		}
+	}
+	share, ok := validShare(c, db, c.Param("token"), req.AccessCode)
+	if !ok {
+		return
+	}
+	srcID := share.ResourceID
+	if req.ID != "" && req.ID != share.ResourceID {
+		inside, err := file.IsDescendant(db, req.ID, share.ResourceID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询文件失败", "detail": err.Error()})
+			return
+		}
+		if !inside {
+			c.JSON(http.StatusForbidden, gin.H{"error": "该文件不在分享范围内"})
+			return
+		}
+		srcID = req.ID
+	}
+	var src file.File
+	if err := db.First(&src, "id = ? AND owner_id = ?", srcID, share.CreatorID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "分享的文件不存在"})
+		return
+	}
+	startCopy(c, src.ID, userID, req.TargetParentID)
+}
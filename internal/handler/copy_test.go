@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"cloudDrive/internal/file"
+	"cloudDrive/internal/task"
+	"cloudDrive/internal/user"
+)
+
+func setupCopyTest(t *testing.T, limit int64) (*gin.Engine, *gorm.DB, *task.Manager) {
+	db := setupTestDB(t)
+	// 大的子树以异步任务复制，内存数据库需共用同一连接
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&file.Share{}, &task.Task{})
+	db.Create(&user.User{ID: 1, Username: "testuser", StorageLimit: limit})
+	db.Create(&user.User{ID: 2, Username: "sharer", StorageLimit: limit})
+	db.Create(&file.UserRoot{UserID: 1, RootID: "root", CreatedAt: time.Now()})
+	now := time.Now()
+	for _, f := range []file.File{
+		{ID: "root", Name: "root", Type: "folder", OwnerID: 1},
+		{ID: "docs", Name: "docs", Type: "folder", ParentID: "root", OwnerID: 1},
+		{ID: "sub", Name: "sub", Type: "folder", ParentID: "docs", OwnerID: 1},
+		{ID: "a", Name: "a.txt", Hash: "ha", Type: "file", ParentID: "docs", OwnerID: 1},
+		{ID: "b", Name: "b.txt", Hash: "hb", Type: "file", ParentID: "sub", OwnerID: 1},
+		{ID: "backup", Name: "backup", Type: "folder", ParentID: "root", OwnerID: 1},
+		{ID: "shared", Name: "shared", Type: "folder", ParentID: "x", OwnerID: 2},
+		{ID: "shared-a", Name: "s.txt", Hash: "ha", Type: "file", ParentID: "shared", OwnerID: 2},
+		{ID: "outside", Name: "o.txt", Hash: "ha", Type: "file", ParentID: "x", OwnerID: 2},
+	} {
+		f.UploadTime = now
+		db.Create(&f)
+	}
+	db.Create(&file.FileContent{Hash: "ha", Size: 10})
+	db.Create(&file.FileContent{Hash: "hb", Size: 20})
+	db.Create(&file.Share{ResourceID: "shared", ShareType: "private", Token: "tok", AccessCode: "1234",
+		ExpireAt: now.Add(time.Hour), CreatorID: 2})
+
+	tasks := task.NewManager(db, 1)
+	t.Cleanup(tasks.Shutdown)
+	rdb := setupTestRedis()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("db", db)
+		c.Set("redis", rdb)
+		c.Set("user_id", uint(1))
+		c.Set(TaskManagerKey, tasks)
+		c.Next()
+	})
+	router.POST("/files/:id/copy", FileCopyHandler)
+	router.POST("/share/:token/copy", ShareCopyHandler)
+	router.GET("/tasks/:id", TaskGetHandler)
+	return router, db, tasks
+}
+
+func TestFileCopyHandler_Folder(t *testing.T) {
+	router, db, _ := setupCopyTest(t, 1000)
+	w := doJSON(router, "POST", "/files/docs/copy", gin.H{"target_parent_id": "backup"})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp copyResult
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, 2, resp.Files)
+	assert.Equal(t, 2, resp.Folders)
+	assert.Equal(t, int64(30), resp.Size)
+	assert.Equal(t, int64(30), storageUsed(db))
+
+	sub := childByName(t, db, resp.ID, "sub")
+	childByName(t, db, sub.ID, "b.txt")
+	assert.Equal(t, "backup", parentOf(db, resp.ID))
+
+	// 同名冲突、复制到自身子目录
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", "/files/docs/copy", gin.H{"target_parent_id": "backup"}).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", "/files/docs/copy", gin.H{"target_parent_id": "sub"}).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "POST", "/files/docs/copy", gin.H{"target_parent_id": "a"}).Code)
+	assert.Equal(t, http.StatusForbidden, doJSON(router, "POST", "/files/shared/copy", nil).Code)
+	assert.Equal(t, int64(30), storageUsed(db))
+}
+
+func TestFileCopyHandler_QuotaCheckedUpFront(t *testing.T) {
+	router, db, _ := setupCopyTest(t, 25)
+	w := doJSON(router, "POST", "/files/docs/copy", gin.H{"target_parent_id": "backup"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	var count int64
+	db.Model(&file.File{}).Where("parent_id = ?", "backup").Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	// 单个文件在配额内可以复制到根目录
+	w = doJSON(router, "POST", "/files/b/copy", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(20), storageUsed(db))
+}
+
+func TestFileCopyHandler_LargeTreeRunsAsTask(t *testing.T) {
+	router, db, tasks := setupCopyTest(t, 1<<20)
+	for i := 0; i < copyAsyncThreshold; i++ {
+		db.Create(&file.File{Name: fmt.Sprintf("f%03d.txt", i), Hash: "ha", Type: "file", ParentID: "sub", OwnerID: 1, UploadTime: time.Now()})
+	}
+	w := doJSON(router, "POST", "/files/docs/copy", gin.H{"target_parent_id": "backup"})
+	assert.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var resp struct {
+		TaskID string `json:"task_id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	tasks.Wait()
+
+	tk := getTask(t, router, resp.TaskID)
+	assert.Equal(t, task.StatusSucceeded, tk.Status, tk.Message)
+	assert.Equal(t, "copy", tk.Type)
+	assert.Equal(t, tk.Total, tk.Done)
+	assert.Equal(t, int64(copyAsyncThreshold*10+30), storageUsed(db))
+
+	copied := childByName(t, db, "backup", "docs")
+	sub := childByName(t, db, copied.ID, "sub")
+	var count int64
+	db.Model(&file.File{}).Where("parent_id = ?", sub.ID).Count(&count)
+	assert.Equal(t, int64(copyAsyncThreshold+1), count)
+}
+
+func TestShareCopyHandler(t *testing.T) {
+	router, db, _ := setupCopyTest(t, 1000)
+	assert.Equal(t, http.StatusUnauthorized, doJSON(router, "POST", "/share/tok/copy", nil).Code)
+	assert.Equal(t, http.StatusForbidden, doJSON(router, "POST", "/share/tok/copy", gin.H{"access_code": "0000"}).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "POST", "/share/missing/copy", nil).Code)
+	assert.Equal(t, http.StatusForbidden, doJSON(router, "POST", "/share/tok/copy",
+		gin.H{"access_code": "1234", "id": "outside"}).Code)
+
+	w := doJSON(router, "POST", "/share/tok/copy", gin.H{"access_code": "1234"})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	copied := childByName(t, db, "root", "shared")
+	assert.Equal(t, uint(1), copied.OwnerID)
+	s := childByName(t, db, copied.ID, "s.txt")
+	assert.Equal(t, uint(1), s.OwnerID)
+
+	w = doJSON(router, "POST", "/share/tok/copy", gin.H{"access_code": "1234", "id": "shared-a", "target_parent_id": "backup"})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	childByName(t, db, "backup", "s.txt")
+	assert.Equal(t, int64(20), storageUsed(db))
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"cloudDrive/internal/archive"
+	"cloudDrive/internal/file"
+	"cloudDrive/internal/storage"
+	"cloudDrive/internal/task"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary 解压压缩包
+// @Description 将网盘中的zip、tar、tar.gz压缩包解压到所在目录或指定目录，以异步任务执行，通过 /tasks/{id} 查询进度，需登录（Session）
+// @Tags 文件模块
+// @Accept json
+// @Produce json
+// @Param id path string true "压缩包文件ID"
+// @Param target_parent_id body string false "解压目标目录ID，默认为压缩包所在目录"
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /files/{id}/extract [post]
+func FileExtractHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	cc := cacheFrom(c)
+	userID := c.MustGet("user_id").(uint)
+	stor := c.MustGet(StorageKey).(storage.Storage)
+	tasks := c.MustGet(TaskManagerKey).(*task.Manager)
+	var req struct {
+		TargetParentID string `json:"target_parent_id"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+			return
+		}
+	}
+	archiveID := c.Param("id")
+	if _, _, err := archive.Validate(db, archiveID, userID); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+		case errors.Is(err, file.ErrNoPermission):
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权限访问该文件"})
+		case errors.Is(err, file.ErrNotAFile), errors.Is(err, archive.ErrUnsupportedFormat):
+			c.JSON(http.StatusBadRequest, gin.H{"error": archive.ErrUnsupportedFormat.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询文件失败", "detail": err.Error()})
+		}
+		return
+	}
+	opts := archive.Options{
+		ArchiveID:      archiveID,
+		TargetParentID: req.TargetParentID,
+		OwnerID:        userID,
+		Limits:         archive.DefaultLimits,
+	}
+	t, err := tasks.Submit(userID, "extract", func(ctx context.Context, p *task.Progress) (interface{}, error) {
+		result, err := archive.Extract(ctx, db, stor, opts, p)
+		if err != nil {
+			return nil, err
+		}
+		clearUserFileCaches(cc, userID)
+		return result, nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建任务失败", "detail": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"task_id": t.ID})
+}
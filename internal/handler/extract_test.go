@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"cloudDrive/internal/file"
+	"cloudDrive/internal/storage"
+	"cloudDrive/internal/task"
+	"cloudDrive/internal/user"
+)
+
+func setupExtractTest(t *testing.T) (*gin.Engine, *gorm.DB, *task.Manager) {
+	db := setupTestDB(t)
+	// 任务在后台goroutine中执行，内存数据库需共用同一连接
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&task.Task{})
+	db.Create(&user.User{ID: 1, Username: "testuser", StorageLimit: 1024 * 1024})
+	db.Create(&file.UserRoot{UserID: 1, RootID: "root-id", CreatedAt: time.Now()})
+	db.Create(&file.File{ID: "root-id", Name: "root", Type: "folder", OwnerID: 1, UploadTime: time.Now()})
+
+	tasks := task.NewManager(db, 1)
+	t.Cleanup(tasks.Shutdown)
+	stor := storage.NewMemoryStorage()
+	rdb := setupTestRedis()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("db", db)
+		c.Set("redis", rdb)
+		c.Set("user_id", uint(1))
+		c.Set(StorageKey, stor)
+		c.Set(TaskManagerKey, tasks)
+		c.Next()
+	})
+	router.POST("/files/upload", FileUploadHandler)
+	router.POST("/files/:id/extract", FileExtractHandler)
+	router.GET("/tasks", TaskListHandler)
+	router.GET("/tasks/:id", TaskGetHandler)
+	return router, db, tasks
+}
+
+func zipOf(files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func getTask(t *testing.T, router *gin.Engine, id string) task.Task {
+	w := doJSON(router, "GET", "/tasks/"+id, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var tk task.Task
+	json.Unmarshal(w.Body.Bytes(), &tk)
+	return tk
+}
+
+func TestFileExtractHandler_Success(t *testing.T) {
+	router, db, tasks := setupExtractTest(t)
+	assert.Equal(t, http.StatusOK, doUpload(router, "bundle.zip", zipOf(map[string]string{
+		"a.txt":     "alpha",
+		"dir/b.txt": "bravo!",
+	})).Code)
+	var arc file.File
+	db.Where("name = ?", "bundle.zip").First(&arc)
+	before := storageUsed(db)
+
+	w := doJSON(router, "POST", "/files/"+arc.ID+"/extract", nil)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	var resp struct {
+		TaskID string `json:"task_id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	tasks.Wait()
+
+	tk := getTask(t, router, resp.TaskID)
+	assert.Equal(t, task.StatusSucceeded, tk.Status, tk.Message)
+	assert.Equal(t, "extract", tk.Type)
+	assert.Equal(t, int64(11), tk.Total)
+	assert.Equal(t, int64(11), tk.Done)
+	assert.Contains(t, tk.Result, `"files":2`)
+	assert.Equal(t, before+11, storageUsed(db))
+
+	var dir file.File
+	assert.NoError(t, db.Where("parent_id = ? AND name = ?", "root-id", "dir").First(&dir).Error)
+	var count int64
+	db.Model(&file.File{}).Where("parent_id = ? AND name = ?", dir.ID, "b.txt").Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	w = doJSON(router, "GET", "/tasks", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), resp.TaskID)
+}
+
+func TestFileExtractHandler_ZipSlipFailsTask(t *testing.T) {
+	router, db, tasks := setupExtractTest(t)
+	doUpload(router, "evil.zip", zipOf(map[string]string{"../../etc/cron.d/x": "boom"}))
+	var arc file.File
+	db.Where("name = ?", "evil.zip").First(&arc)
+
+	w := doJSON(router, "POST", "/files/"+arc.ID+"/extract", nil)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	var resp struct {
+		TaskID string `json:"task_id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	tasks.Wait()
+
+	tk := getTask(t, router, resp.TaskID)
+	assert.Equal(t, task.StatusFailed, tk.Status)
+	assert.NotEmpty(t, tk.Message)
+	var count int64
+	db.Model(&file.File{}).Count(&count)
+	assert.Equal(t, int64(2), count, "不应创建任何文件")
+}
+
+func TestFileExtractHandler_Validation(t *testing.T) {
+	router, db, _ := setupExtractTest(t)
+	doUpload(router, "notes.txt", []byte("plain"))
+	var txt file.File
+	db.Where("name = ?", "notes.txt").First(&txt)
+	db.Create(&file.File{ID: "other", Name: "x.zip", Type: "file", OwnerID: 2, UploadTime: time.Now()})
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", "/files/"+txt.ID+"/extract", nil).Code)
+	assert.Equal(t, http.StatusForbidden, doJSON(router, "POST", "/files/other/extract", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "POST", "/files/missing/extract", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "GET", "/tasks/missing", nil).Code)
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"bytes"
+	"cloudDrive/internal/cache"
 	"cloudDrive/internal/file"
 	"cloudDrive/internal/storage"
 	"cloudDrive/internal/user"
@@ -9,12 +10,15 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime"
 	"net/http"
 	"os"
+	"path"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -28,73 +32,76 @@ import (
 const StorageKey = "storage"
 
 // @Summary 获取文件/文件夹列表
-// @Description 获取指定目录下的文件和文件夹，支持分页和排序，需登录（Session）
+// @Description 获取指定目录下的文件和文件夹（含文件大小），按游标分页，需登录（Session）
 // @Tags 文件模块
 // @Accept json
 // @Produce json
 // @Param parent_id query string false "父目录ID，根目录为0"
-// @Param page query int false "页码，默认1"
-// @Param page_size query int false "每页数量，默认10"
-// @Param order_by query string false "排序字段，默认upload_time"
+// @Param cursor query string false "分页游标，取上一页返回的next_cursor，为空表示第一页"
+// @Param page_size query int false "每页数量，默认10，最大100"
+// @Param order_by query string false "排序字段：name、upload_time、size、type，默认upload_time"
 // @Param order query string false "排序方式，asc/desc，默认desc"
+// @Param category query string false "只列出该分类的文件：images、documents、video、audio、archives、other"
 // @Success 200 {object} file.ListFilesResponse
+// @Failure 400 {object} map[string]interface{}
 // @Failure 401 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
 // @Router /files [get]
 func FileListHandler(c *gin.Context) {
 	db := c.MustGet("db").(*gorm.DB)
-	rdb := c.MustGet("redis").(*redis.Client)
 	userID := c.MustGet("user_id").(uint)
 	parentID := c.DefaultQuery("parent_id", "")
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	cursor := c.Query("cursor")
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
 	orderBy := c.DefaultQuery("order_by", "upload_time")
 	order := c.DefaultQuery("order", "desc")
-
-	// 构造缓存key
-	cacheKey := fmt.Sprintf("filelist:%d:%s:%d:%d:%s:%s", userID, parentID, page, pageSize, orderBy, order)
-	ctx := context.Background()
-	if val, err := rdb.Get(ctx, cacheKey).Result(); err == nil && val != "" {
-		c.Data(http.StatusOK, "application/json", []byte(val))
+	category := c.Query("category")
+	if category != "" && !file.ValidCategory(category) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": file.ErrInvalidCategory.Error()})
 		return
 	}
+	if parentID == "" {
+		// 缓存按目录失效，根目录需使用其实际ID
+		var userRoot file.UserRoot
+		if err := db.First(&userRoot, "user_id = ?", userID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查找根目录失败", "detail": err.Error()})
+			return
+		}
+		parentID = userRoot.RootID
+	}
 
-	resp, err := file.ListFiles(db, file.ListFilesRequest{
-		ParentID: parentID,
-		OwnerID:  userID,
-		Page:     page,
-		PageSize: pageSize,
-		OrderBy:  orderBy,
-		Order:    order,
+	cc := cacheFrom(c)
+	ctx := context.Background()
+	cacheKey := cc.FileListKey(ctx, userID, parentID, strconv.Itoa(pageSize), orderBy, order, category, cursor)
+	data, err := cc.Fetch(ctx, cacheKey, cache.FileListTTL, func() ([]byte, error) {
+		resp, err := file.ListFiles(db, file.ListFilesRequest{
+			ParentID: parentID,
+			OwnerID:  userID,
+			PageSize: pageSize,
+			Cursor:   cursor,
+			OrderBy:  orderBy,
+			Order:    order,
+			Category: category,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(resp)
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		listErrorResponse(c, err)
 		return
 	}
-	filesWithSize := make([]gin.H, 0, len(resp.Files))
-	for _, f := range resp.Files {
-		fileMap := gin.H{
-			"id":          f.ID,
-			"name":        f.Name,
-			"type":        f.Type,
-			"parent_id":   f.ParentID,
-			"owner_id":    f.OwnerID,
-			"upload_time": f.UploadTime,
-		}
-		if f.Type == "file" {
-			var fc file.FileContent
-			db.First(&fc, "hash = ?", f.Hash)
-			fileMap["size"] = fc.Size
-		} else {
-			fileMap["size"] = nil
-		}
-		filesWithSize = append(filesWithSize, fileMap)
+	c.Data(http.StatusOK, "application/json", data)
+}
+
+// listErrorResponse 列表和搜索的错误响应，游标无效时返回 400
+func listErrorResponse(c *gin.Context, err error) {
+	if errors.Is(err, file.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	result := gin.H{"files": filesWithSize, "total": resp.Total}
-	jsonBytes, _ := json.Marshal(result)
-	// 写入缓存
-	rdb.Set(ctx, cacheKey, jsonBytes, 5*time.Minute)
-	c.Data(http.StatusOK, "application/json", jsonBytes)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 }
 
 // Storage实例获取函数（可根据实际情况注入或配置）
@@ -106,7 +113,7 @@ func getStorage() storage.Storage {
 }
 
 // @Summary 上传文件
-// @Description 上传文件到指定目录，需登录（Session）
+// @Description 上传文件到指定目录，同目录下已有同名文件时覆盖并保留历史版本，需登录（Session）
 // @Tags 文件模块
 // @Accept multipart/form-data
 // @Produce json
@@ -165,27 +172,14 @@ func FileUploadHandler(c *gin.Context) {
 		return
 	}
 	hashStr := serverHash
-	// 检查 hash 是否已存在
-	var fileContent file.FileContent
-	err = db.First(&fileContent, "hash = ?", hashStr).Error
-	if err == gorm.ErrRecordNotFound {
-		tmpFile.Seek(0, 0)
-		err = stor.Upload(context.Background(), hashStr, tmpFile)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "文件保存失败", "detail": err.Error()})
-			return
-		}
-		fileContent = file.FileContent{
-			Hash: hashStr,
-			Size: fileHeader.Size,
-		}
-		err = db.Create(&fileContent).Error
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库写入失败", "detail": err.Error()})
-			return
-		}
-	} else if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库查询失败", "detail": err.Error()})
+	// 先检查配额，避免写入存储后再回滚
+	u, err := user.GetUserByID(db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "用户不存在"})
+		return
+	}
+	if u.StorageUsed+fileHeader.Size > u.StorageLimit {
+		c.JSON(http.StatusForbidden, gin.H{"error": "存储空间不足"})
 		return
 	}
 	f := file.File{
@@ -196,43 +190,85 @@ func FileUploadHandler(c *gin.Context) {
 		OwnerID:    userID,
 		UploadTime: time.Now(),
 	}
-	if err := db.Create(&f).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库写入失败", "detail": err.Error()})
-		return
-	}
-
-	u, err := user.GetUserByID(db, userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "用户不存在"})
-		return
-	}
-	if u.StorageUsed+fileContent.Size > u.StorageLimit {
-		if err := db.Delete(&f).Error; err == nil {
-			_ = stor.Delete(context.Background(), hashStr)
+	// 内容尚不存在时先登记再写入存储，不在事务中进行慢速的存储写入；
+	// 文件内容、文件记录和配额在同一事务中写入，任一步失败都整体回滚，
+	// 回滚后本次写入的对象若没有记录引用、也没有其他请求正在写入则一并删除
+	var fileContent file.FileContent
+	uploaded := false
+	mimeType := ""
+	blobs := file.NewBlobReservation(db)
+	if err := db.Select("hash").First(&fileContent, "hash = ?", hashStr).Error; err == gorm.ErrRecordNotFound {
+		if err := blobs.Reserve(hashStr); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库写入失败", "detail": err.Error()})
+			return
 		}
-		c.JSON(http.StatusForbidden, gin.H{"error": "存储空间不足"})
+		mimeType = sniffFile(tmpFile)
+		tmpFile.Seek(0, 0)
+		uploaded = true
+		if err := stor.Upload(context.Background(), hashStr, tmpFile); err != nil {
+			blobs.Release(stor, blobs.Hashes())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "文件保存失败", "detail": err.Error()})
+			return
+		}
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库查询失败", "detail": err.Error()})
 		return
 	}
-	if err := user.UpdateUserStorageUsed(db, userID, fileContent.Size); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新存储空间失败", "detail": err.Error()})
+	overwritten := false
+	failMsg := "数据库写入失败"
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.First(&fileContent, "hash = ?", hashStr).Error
+		if err == gorm.ErrRecordNotFound {
+			if !uploaded {
+				// 预检查后该内容的记录被删除，需要重新上传
+				failMsg = "文件内容已失效，请重试"
+				return err
+			}
+			fileContent = file.FileContent{
+				Hash: hashStr,
+				Size: fileHeader.Size,
+			}
+			fileContent.SetMimeType(mimeType)
+			if err := tx.Create(&fileContent).Error; err != nil {
+				return err
+			}
+		} else if err != nil {
+			failMsg = "数据库查询失败"
+			return err
+		}
+		existing, err := file.FindFileByName(tx, parentID, f.Name, userID)
+		if err != nil {
+			failMsg = "数据库查询失败"
+			return err
+		}
+		if existing != nil {
+			// 同名文件覆盖上传，原内容保存为历史版本
+			f = *existing
+			overwritten = true
+			return overwriteWithVersion(tx, &f, hashStr, fileContent.Size)
+		}
+		if err := tx.Create(&f).Error; err != nil {
+			return err
+		}
+		if err := user.UpdateUserStorageUsed(tx, userID, fileContent.Size); err != nil {
+			failMsg = "更新存储空间失败"
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		blobs.Release(stor, blobs.Hashes())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failMsg, "detail": err.Error()})
 		return
 	}
-	// 清理用户缓存
-	rdb := c.MustGet("redis").(*redis.Client)
-	ctx := context.Background()
-	cacheKey := fmt.Sprintf("user:info:%d", userID)
-	rdb.Del(ctx, cacheKey)
-	// 清理文件列表缓存（父目录）
-	fileListPrefix := fmt.Sprintf("filelist:%d:", userID)
-	keys, _ := rdb.Keys(ctx, fileListPrefix+"*").Result()
-	if len(keys) > 0 {
-		rdb.Del(ctx, keys...)
-	}
-	c.JSON(http.StatusOK, gin.H{"id": f.ID, "name": f.Name, "size": fileContent.Size})
+	blobs.Release(stor, nil)
+	// 清理用户、文件列表及被覆盖文件的缓存
+	clearFileCaches(c, userID, &f)
+	c.JSON(http.StatusOK, gin.H{"id": f.ID, "name": f.Name, "size": fileContent.Size, "overwritten": overwritten})
 }
 
 // @Summary 下载文件
-// @Description 下载指定文件，需登录（Session）
+// @Description 下载指定文件，Content-Type 为上传时按内容检测的类型，需登录（Session）
 // @Tags 文件模块
 // @Accept json
 // @Produce application/octet-stream
@@ -244,29 +280,8 @@ func FileUploadHandler(c *gin.Context) {
 // @Failure 500 {object} map[string]interface{}
 // @Router /files/download/{id} [get]
 func FileDownloadHandler(c *gin.Context) {
-	db := c.MustGet("db").(*gorm.DB)
-	rdb := c.MustGet("redis").(*redis.Client)
 	userID := c.MustGet("user_id").(uint)
-	idStr := c.Param("id")
-	ctx := context.Background()
-	cacheKey := fmt.Sprintf("filemeta:%s", idStr)
-	var f file.File
-	if val, err := rdb.Get(ctx, cacheKey).Result(); err == nil && val != "" {
-		if err := json.Unmarshal([]byte(val), &f); err == nil {
-			if f.OwnerID != userID {
-				c.JSON(http.StatusForbidden, gin.H{"error": "无权限下载该文件"})
-				return
-			}
-			if f.Type != "file" {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "只能下载文件类型"})
-				return
-			}
-			filePath := "uploads/" + f.Hash
-			c.FileAttachment(filePath, f.Name)
-			return
-		}
-	}
-	err := db.First(&f, "id = ?", idStr).Error
+	f, err := cachedFileMeta(c, c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
 		return
@@ -279,12 +294,92 @@ func FileDownloadHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "只能下载文件类型"})
 		return
 	}
-	jsonBytes, _ := json.Marshal(f)
-	rdb.Set(ctx, cacheKey, jsonBytes, 5*time.Minute)
 	filePath := "uploads/" + f.Hash
+	c.Header("Content-Type", contentTypeOf(c.MustGet("db").(*gorm.DB), f))
 	c.FileAttachment(filePath, f.Name)
 }
 
+// contentTypeOf 文件的内容类型，优先使用上传时按内容检测的 MIME 类型，未检测或无法识别时按扩展名推断
+func contentTypeOf(db *gorm.DB, f *file.File) string {
+	var content file.FileContent
+	if err := db.Select("mime_type").First(&content, "hash = ?", f.Hash).Error; err == nil &&
+		content.MimeType != "" && content.MimeType != file.DefaultMimeType {
+		return content.MimeType
+	}
+	if t := mime.TypeByExtension(path.Ext(f.Name)); t != "" {
+		return t
+	}
+	return file.DefaultMimeType
+}
+
+// scriptableMimeTypes 浏览器会执行其中脚本的内容类型
+var scriptableMimeTypes = map[string]bool{
+	"text/html":                true,
+	"application/xhtml+xml":    true,
+	"image/svg+xml":            true,
+	"text/xml":                 true,
+	"application/xml":          true,
+	"text/javascript":          true,
+	"application/javascript":   true,
+	"application/x-javascript": true,
+	"application/ecmascript":   true,
+	"text/ecmascript":          true,
+}
+
+// previewContentType 预览在应用同源下内联返回，可执行脚本的类型降级为纯文本，
+// 避免上传的 HTML、SVG 等内容以当前用户身份执行
+func previewContentType(contentType string) string {
+	base, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		base = strings.ToLower(contentType)
+	}
+	if scriptableMimeTypes[base] {
+		return "text/plain; charset=utf-8"
+	}
+	return contentType
+}
+
+// sniffFile 从头读取临时文件检测 MIME 类型，读取失败时返回空，由后台任务稍后检测
+func sniffFile(f io.ReadSeeker) string {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return ""
+	}
+	mimeType, err := file.SniffMimeType(f)
+	if err != nil {
+		return ""
+	}
+	return mimeType
+}
+
+// sniffStored 读取已写入存储的内容检测 MIME 类型，读取失败时返回空，由后台任务稍后检测
+func sniffStored(stor storage.Storage, hash string) string {
+	mimeType, err := file.SniffStored(context.Background(), stor, hash)
+	if err != nil {
+		return ""
+	}
+	return mimeType
+}
+
+// cachedFileMeta 读取文件元数据，优先使用缓存
+func cachedFileMeta(c *gin.Context, id string) (*file.File, error) {
+	db := c.MustGet("db").(*gorm.DB)
+	data, err := cacheFrom(c).Fetch(context.Background(), cache.FileMetaKey(id), cache.FileMetaTTL, func() ([]byte, error) {
+		var f file.File
+		if err := db.First(&f, "id = ?", id).Error; err != nil {
+			return nil, err
+		}
+		return json.Marshal(f)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var f file.File
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
 // @Summary 删除文件
 // @Description 删除指定文件，需登录（Session）
 // @Tags 文件模块
@@ -301,7 +396,7 @@ func FileDeleteHandler(c *gin.Context) {
 	db := c.MustGet("db").(*gorm.DB)
 	userID := c.MustGet("user_id").(uint)
 	idStr := c.Param("id")
-	err := file.DeleteFile(db, idStr, userID)
+	err := deleteToRecycle(db, idStr, userID)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
@@ -315,20 +410,10 @@ func FileDeleteHandler(c *gin.Context) {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
-	// 清理用户缓存
-	rdb := c.MustGet("redis").(*redis.Client)
-	ctx := context.Background()
-	cacheKey := fmt.Sprintf("user:info:%d", userID)
-	rdb.Del(ctx, cacheKey)
-	// 清理文件列表缓存（所有目录）
-	fileListPrefix := fmt.Sprintf("filelist:%d:", userID)
-	keys, _ := rdb.Keys(ctx, fileListPrefix+"*").Result()
-	if len(keys) > 0 {
-		rdb.Del(ctx, keys...)
-	}
-	// 清理文件元数据缓存
-	fileMetaKey := fmt.Sprintf("filemeta:%s", idStr)
-	rdb.Del(ctx, fileMetaKey)
+	// 删除文件夹时整个子树都受影响，清理用户所有目录的列表缓存
+	cc := cacheFrom(c)
+	clearUserFileCaches(cc, userID)
+	cc.InvalidateFileMeta(context.Background(), idStr)
 }
 
 // @Summary 重命名文件
@@ -372,17 +457,10 @@ func FileRenameHandler(c *gin.Context) {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "重命名成功"})
-	// 清理文件列表缓存（所有目录）
-	rdb := c.MustGet("redis").(*redis.Client)
-	ctx := context.Background()
-	fileListPrefix := fmt.Sprintf("filelist:%d:", userID)
-	keys, _ := rdb.Keys(ctx, fileListPrefix+"*").Result()
-	if len(keys) > 0 {
-		rdb.Del(ctx, keys...)
-	}
-	// 清理文件元数据缓存
-	fileMetaKey := fmt.Sprintf("filemeta:%s", idStr)
-	rdb.Del(ctx, fileMetaKey)
+	// 清理文件列表缓存（所有目录）及文件元数据缓存
+	cc := cacheFrom(c)
+	cc.InvalidateFileLists(context.Background(), userID)
+	cc.InvalidateFileMeta(context.Background(), idStr)
 }
 
 // @Summary 移动文件/文件夹
@@ -430,69 +508,148 @@ func FileMoveHandler(c *gin.Context) {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "移动成功"})
-	// 清理文件列表缓存（所有目录）
-	rdb := c.MustGet("redis").(*redis.Client)
-	ctx := context.Background()
-	fileListPrefix := fmt.Sprintf("filelist:%d:", userID)
-	keys, _ := rdb.Keys(ctx, fileListPrefix+"*").Result()
-	if len(keys) > 0 {
-		rdb.Del(ctx, keys...)
-	}
-	// 清理文件元数据缓存
-	fileMetaKey := fmt.Sprintf("filemeta:%s", idStr)
-	rdb.Del(ctx, fileMetaKey)
+	// 清理文件列表缓存（所有目录）及文件元数据缓存
+	cc := cacheFrom(c)
+	cc.InvalidateFileLists(context.Background(), userID)
+	cc.InvalidateFileMeta(context.Background(), idStr)
 }
 
 // @Summary 搜索文件
-// @Description 按文件名模糊搜索文件，需登录（Session）
+// @Description 按关键字、扩展名、分类、大小、上传时间、目录范围、标签、收藏和自定义元数据搜索文件（含文件大小、标签和收藏状态），第一页返回总数和按类型、扩展名的分面统计，按游标分页，需登录（Session）
 // @Tags 文件模块
 // @Accept json
 // @Produce json
-// @Param name query string true "文件名"
-// @Param page query int false "页码，默认1"
-// @Param page_size query int false "每页数量，默认10"
-// @Success 200 {object} file.ListFilesResponse
+// @Param name query string false "关键字，空格分隔的多个词需同时出现在文件名中，优先按单词前缀匹配，没有结果时按子串匹配；只含字母的词也按拼音全拼或首字母匹配"
+// @Param ext query string false "扩展名，多个用逗号分隔，如 pdf,docx"
+// @Param category query string false "分类：images、documents、video、audio、archives、other，按上传时检测的内容类型归类，纯文本等无法确定时按扩展名"
+// @Param type query string false "类型：file、folder"
+// @Param min_size query int false "最小文件大小（字节）"
+// @Param max_size query int false "最大文件大小（字节）"
+// @Param from query string false "上传时间起，格式 2006-01-02 或 RFC3339"
+// @Param to query string false "上传时间止，格式同上，只有日期时包含当天"
+// @Param within query string false "相对当前时间的上传时间范围：today、7d、30d、this_month、this_year，不能与from/to同时使用"
+// @Param folder_id query string false "搜索范围的文件夹ID，为空表示全部文件"
+// @Param recursive query bool false "是否包含子目录，默认true"
+// @Param tags query string false "标签ID，多个用逗号分隔，需同时带有所有标签"
+// @Param starred query bool false "是否只返回收藏的文件，默认false"
+// @Param meta query []string false "自定义元数据条件，格式 key:op:value，op 为 exists、eq、contains、gt、gte、lt、lte，可重复指定" collectionFormat(multi)
+// @Param cursor query string false "分页游标，取上一页返回的next_cursor，为空表示第一页"
+// @Param page_size query int false "每页数量，默认10，最大100"
+// @Param order_by query string false "排序字段：relevance、name、upload_time、size，有关键字时默认relevance，否则upload_time"
+// @Param order query string false "排序方式，asc/desc，默认desc"
+// @Success 200 {object} file.SearchResponse
+// @Failure 400 {object} map[string]interface{}
 // @Router /files/search [get]
 func FileSearchHandler(c *gin.Context) {
 	db := c.MustGet("db").(*gorm.DB)
 	userID := c.MustGet("user_id").(uint)
-	name := c.Query("name")
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
-	resp, err := file.ListFiles(db, file.ListFilesRequest{
-		OwnerID:  userID,
-		Name:     name,
-		Page:     page,
-		PageSize: pageSize,
-	})
+	filter, ok := searchFilterFrom(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	searchResponse(c, db, filter.Request(userID, time.Now()))
+}
+
+// searchResponse 按查询参数中的游标和每页数量执行搜索并返回结果，搜索接口和保存的搜索共用
+func searchResponse(c *gin.Context, db *gorm.DB, req file.SearchRequest) {
+	req.PageSize, _ = strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	req.Cursor = c.Query("cursor")
+	resp, err := file.SearchFiles(db, req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if errors.Is(err, file.ErrInvalidCategory) || errors.Is(err, file.ErrInvalidFilter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		listErrorResponse(c, err)
 		return
 	}
-	filesWithSize := make([]gin.H, 0, len(resp.Files))
-	for _, f := range resp.Files {
-		fileMap := gin.H{
-			"id":          f.ID,
-			"name":        f.Name,
-			"type":        f.Type,
-			"parent_id":   f.ParentID,
-			"owner_id":    f.OwnerID,
-			"upload_time": f.UploadTime,
+	c.JSON(http.StatusOK, resp)
+}
+
+// searchFilterFrom 从查询参数解析搜索条件，大小、时间格式错误或相对时间范围无效时返回 false
+func searchFilterFrom(c *gin.Context) (file.SearchFilter, bool) {
+	filter := file.SearchFilter{
+		Name:     c.Query("name"),
+		Category: c.Query("category"),
+		Type:     c.Query("type"),
+		Within:   c.Query("within"),
+		FolderID: c.Query("folder_id"),
+		OrderBy:  c.Query("order_by"),
+		Order:    c.DefaultQuery("order", "desc"),
+	}
+	if c.Query("recursive") == "false" {
+		recursive := false
+		filter.Recursive = &recursive
+	}
+	for _, ext := range strings.Split(c.Query("ext"), ",") {
+		if ext = strings.TrimSpace(ext); ext != "" {
+			filter.Exts = append(filter.Exts, ext)
 		}
-		if f.Type == "file" {
-			var fc file.FileContent
-			db.First(&fc, "hash = ?", f.Hash)
-			fileMap["size"] = fc.Size
-		} else {
-			fileMap["size"] = nil
+	}
+	for _, v := range strings.Split(c.Query("tags"), ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		tagID, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return filter, false
+		}
+		filter.TagIDs = append(filter.TagIDs, tagID)
+	}
+	filter.Starred = c.Query("starred") == "true"
+	for _, v := range c.QueryArray("meta") {
+		m, err := file.ParseMetaFilter(v)
+		if err != nil {
+			return filter, false
+		}
+		filter.Meta = append(filter.Meta, m)
+	}
+	var err error
+	if v := c.Query("min_size"); v != "" {
+		if filter.MinSize, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return filter, false
 		}
-		filesWithSize = append(filesWithSize, fileMap)
 	}
-	c.JSON(http.StatusOK, gin.H{"files": filesWithSize, "total": resp.Total})
+	if v := c.Query("max_size"); v != "" {
+		if filter.MaxSize, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return filter, false
+		}
+	}
+	if v := c.Query("from"); v != "" {
+		t, _, err := parseSearchTime(v)
+		if err != nil {
+			return filter, false
+		}
+		filter.From = &t
+	}
+	if v := c.Query("to"); v != "" {
+		t, dateOnly, err := parseSearchTime(v)
+		if err != nil {
+			return filter, false
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		filter.To = &t
+	}
+	if filter.Within != "" && (filter.From != nil || filter.To != nil || !file.ValidWithin(filter.Within)) {
+		return filter, false
+	}
+	return filter, true
+}
+
+// parseSearchTime 解析 2006-01-02 或 RFC3339 格式的时间，dateOnly 表示只有日期
+func parseSearchTime(v string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", v, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	return t, false, err
 }
 
 // @Summary 文件在线预览
-// @Description 在线预览指定文件，仅支持已登录用户
+// @Description 在线预览指定文件，Content-Type 为上传时按内容检测的类型，未检测或无法识别时按扩展名推断；HTML、SVG、XML、脚本等可执行脚本的类型按纯文本返回，仅支持已登录用户
 // @Tags 文件模块
 // @Accept json
 // @Produce octet-stream
@@ -504,46 +661,8 @@ func FileSearchHandler(c *gin.Context) {
 // @Failure 500 {object} map[string]interface{}
 // @Router /files/preview/{id} [get]
 func FilePreviewHandler(c *gin.Context) {
-	db := c.MustGet("db").(*gorm.DB)
-	rdb := c.MustGet("redis").(*redis.Client)
 	userID := c.MustGet("user_id").(uint)
-	idStr := c.Param("id")
-	ctx := context.Background()
-	cacheKey := fmt.Sprintf("filemeta:%s", idStr)
-	var f file.File
-	if val, err := rdb.Get(ctx, cacheKey).Result(); err == nil && val != "" {
-		if err := json.Unmarshal([]byte(val), &f); err == nil {
-			if f.OwnerID != userID {
-				c.JSON(http.StatusForbidden, gin.H{"error": "无权限预览该文件"})
-				return
-			}
-			if f.Type != "file" {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "只能预览文件类型"})
-				return
-			}
-			filePath := "uploads/" + f.Hash
-			ext := ""
-			if len(f.Name) > 0 {
-				dot := len(f.Name) - 1
-				for ; dot >= 0 && f.Name[dot] != '.'; dot-- {
-				}
-				if dot >= 0 {
-					ext = f.Name[dot:]
-				}
-			}
-			contentType := "application/octet-stream"
-			if ext != "" {
-				contentType = mime.TypeByExtension(ext)
-				if contentType == "" {
-					contentType = "application/octet-stream"
-				}
-			}
-			c.Header("Content-Type", contentType)
-			c.File(filePath)
-			return
-		}
-	}
-	err := db.First(&f, "id = ?", idStr).Error
+	f, err := cachedFileMeta(c, c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
 		return
@@ -556,26 +675,9 @@ func FilePreviewHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "只能预览文件类型"})
 		return
 	}
-	jsonBytes, _ := json.Marshal(f)
-	rdb.Set(ctx, cacheKey, jsonBytes, 5*time.Minute)
 	filePath := "uploads/" + f.Hash
-	ext := ""
-	if len(f.Name) > 0 {
-		dot := len(f.Name) - 1
-		for ; dot >= 0 && f.Name[dot] != '.'; dot-- {
-		}
-		if dot >= 0 {
-			ext = f.Name[dot:]
-		}
-	}
-	contentType := "application/octet-stream"
-	if ext != "" {
-		contentType = mime.TypeByExtension(ext)
-		if contentType == "" {
-			contentType = "application/octet-stream"
-		}
-	}
-	c.Header("Content-Type", contentType)
+	c.Header("Content-Type", previewContentType(contentTypeOf(c.MustGet("db").(*gorm.DB), f)))
+	c.Header("X-Content-Type-Options", "nosniff")
 	c.File(filePath)
 }
 
@@ -610,7 +712,9 @@ func checkUploadIdBelongsToUser(c *gin.Context, uploadId string) (map[string]int
 // @Param size body int64 true "文件大小"
 // @Param hash body string true "文件hash"
 // @Param total_parts body int true "总分片数"
+// @Param overwrite body bool false "同目录下已有同名文件时覆盖并保留历史版本，默认返回409"
 // @Success 200 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
 // @Router /files/multipart/init [post]
 func MultipartInitHandler(c *gin.Context) {
 	var req struct {
@@ -619,6 +723,7 @@ func MultipartInitHandler(c *gin.Context) {
 		Hash       string `json:"hash"`
 		TotalParts int    `json:"total_parts"`
 		ParentID   string `json:"parent_id"`
+		Overwrite  bool   `json:"overwrite"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" || req.Hash == "" || req.TotalParts <= 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
@@ -626,23 +731,35 @@ func MultipartInitHandler(c *gin.Context) {
 	}
 	db := c.MustGet("db").(*gorm.DB)
 	userID := c.MustGet("user_id").(uint)
+	// 1. 确定父目录ID
+	parentID := req.ParentID
+	if parentID == "" {
+		var userRoot file.UserRoot
+		if err := db.First(&userRoot, "user_id = ?", userID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查找根目录失败", "detail": err.Error()})
+			return
+		}
+		parentID = userRoot.RootID
+	}
+	// 2. 检查同目录下是否已有同名文件，只有指定覆盖且同名的是文件时才允许继续
+	var existing *file.File
+	var count int64
+	db.Model(&file.File{}).Where("parent_id = ? AND name = ? AND owner_id = ?", parentID, req.Name, userID).Count(&count)
+	if count > 0 {
+		if req.Overwrite {
+			existing, _ = file.FindFileByName(db, parentID, req.Name, userID)
+		}
+		if existing == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "同目录下已存在同名文件"})
+			return
+		}
+	}
 	// 秒传判断
 	var fileContent file.FileContent
 	err := db.First(&fileContent, "hash = ?", req.Hash).Error
 	if err == nil {
 		// 已存在，执行秒传逻辑
-		// 1. 确定父目录ID
-		parentID := req.ParentID
-		if parentID == "" {
-			var userRoot file.UserRoot
-			if err := db.First(&userRoot, "user_id = ?", userID).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "查找根目录失败", "detail": err.Error()})
-				return
-			}
-			parentID = userRoot.RootID
-		}
-
-		// 2. 检查用户存储空间
+		// 3. 检查用户存储空间
 		u, err := user.GetUserByID(db, userID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "用户不存在"})
@@ -653,15 +770,7 @@ func MultipartInitHandler(c *gin.Context) {
 			return
 		}
 
-		// 3. 检查同目录下是否已有同名文件
-		var count int64
-		db.Model(&file.File{}).Where("parent_id = ? AND name = ? AND owner_id = ?", parentID, req.Name, userID).Count(&count)
-		if count > 0 {
-			c.JSON(http.StatusConflict, gin.H{"error": "同目录下已存在同名文件"})
-			return
-		}
-
-		// 4. 创建文件记录
+		// 4. 创建文件记录，或覆盖同名文件并保存历史版本
 		f := file.File{
 			Name:       req.Name,
 			Hash:       req.Hash,
@@ -670,29 +779,31 @@ func MultipartInitHandler(c *gin.Context) {
 			OwnerID:    userID,
 			UploadTime: time.Now(),
 		}
-		if err := db.Create(&f).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库写入失败", "detail": err.Error()})
-			return
-		}
+		if existing != nil {
+			f = *existing
+			if err := db.Transaction(func(tx *gorm.DB) error {
+				return overwriteWithVersion(tx, &f, req.Hash, fileContent.Size)
+			}); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "覆盖文件失败", "detail": err.Error()})
+				return
+			}
+		} else {
+			if err := db.Create(&f).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库写入失败", "detail": err.Error()})
+				return
+			}
 
-		// 5. 更新用户存储空间
-		if err := user.UpdateUserStorageUsed(db, userID, fileContent.Size); err != nil {
-			// 如果更新存储空间失败，回滚文件记录
-			db.Delete(&f)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新存储空间失败", "detail": err.Error()})
-			return
+			// 5. 更新用户存储空间
+			if err := user.UpdateUserStorageUsed(db, userID, fileContent.Size); err != nil {
+				// 如果更新存储空间失败，回滚文件记录
+				db.Delete(&f)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "更新存储空间失败", "detail": err.Error()})
+				return
+			}
 		}
 
 		// 6. 清理缓存
-		rdb := c.MustGet("redis").(*redis.Client)
-		ctx := context.Background()
-		cacheKey := fmt.Sprintf("user:info:%d", userID)
-		rdb.Del(ctx, cacheKey)
-		fileListPrefix := fmt.Sprintf("filelist:%d:", userID)
-		keys, _ := rdb.Keys(ctx, fileListPrefix+"*").Result()
-		if len(keys) > 0 {
-			rdb.Del(ctx, keys...)
-		}
+		clearFileCaches(c, userID, &f)
 
 		// 7. 返回秒传成功响应
 		c.JSON(http.StatusOK, gin.H{
@@ -722,7 +833,8 @@ func MultipartInitHandler(c *gin.Context) {
 		"total_parts": req.TotalParts,
 		"size":        req.Size,
 		"name":        req.Name,
-		"parent_id":   req.ParentID,
+		"parent_id":   parentID,
+		"overwrite":   req.Overwrite,
 	}
 	infoJson, _ := json.Marshal(info)
 	rdb.Set(ctx, "upload:"+uploadId, infoJson, 24*time.Hour)
@@ -757,7 +869,7 @@ func MultipartUploadPartHandler(c *gin.Context) {
 
 	// 生成用于分片上传的token
 	var token string
-	chunkStorage, ok := stor.(*storage.ChunkServerStorage)
+	chunkStorage, ok := storage.AsChunkServer(stor)
 	if ok {
 		// 准备上传信息
 		uploadInfo := map[string]interface{}{
@@ -881,8 +993,16 @@ func MultipartCompleteHandler(c *gin.Context) {
 			ETag:       "", // 这里可能需要实际的ETag值，但我们暂时不需要
 		}
 	}
+	// 合并会写入以 hash 为 key 的对象，先登记，避免并发回滚的请求删除该对象
+	hash := info["hash"].(string)
+	blobs := file.NewBlobReservation(db)
+	if err := blobs.Reserve(hash); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "合并失败", "detail": err.Error()})
+		return
+	}
 	_, err = stor.CompleteMultipartUpload(context.Background(), req.UploadId, parts)
 	if err != nil {
+		blobs.Release(stor, nil)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "合并失败", "detail": err.Error()})
 		return
 	}
@@ -890,35 +1010,18 @@ func MultipartCompleteHandler(c *gin.Context) {
 	// 注意：ChunkServer已经处理了文件合并和验证，这里不需要再次进行本地文件哈希校验
 	// 因为文件存储在ChunkServer的存储系统中（MinIO或本地存储），而不是API Server的本地文件系统
 
-	// 合并成功后更新用户已用空间
-	if err := user.UpdateUserStorageUsed(db, userID, fileSize); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新存储空间失败", "detail": err.Error()})
-		return
-	}
-	// 合并成功后插入 file_content 和 file 表
-	hash := info["hash"].(string)
+	// 合并成功后在同一事务中插入 file_content、file 表并更新用户已用空间
 	name := info["name"].(string)
 	parentID := c.DefaultQuery("parent_id", "")
+	if parentID == "" {
+		parentID, _ = info["parent_id"].(string)
+	}
 	if parentID == "" {
 		var userRoot file.UserRoot
 		if err := db.First(&userRoot, "user_id = ?", userID).Error; err == nil {
 			parentID = userRoot.RootID
 		}
 	}
-	var fileContent file.FileContent
-	err = db.First(&fileContent, "hash = ?", hash).Error
-	if err == gorm.ErrRecordNotFound {
-		// 记录不存在，创建新记录
-		fileContent = file.FileContent{Hash: hash, Size: fileSize}
-		if err := db.Create(&fileContent).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建文件内容记录失败", "detail": err.Error()})
-			return
-		}
-	} else if err != nil {
-		// 其他错误
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询文件内容失败", "detail": err.Error()})
-		return
-	}
 	f := file.File{
 		Name:       name,
 		Hash:       hash,
@@ -927,21 +1030,69 @@ func MultipartCompleteHandler(c *gin.Context) {
 		OwnerID:    userID,
 		UploadTime: time.Now(),
 	}
-	db.Create(&f)
+	overwrite, _ := info["overwrite"].(bool)
+	newContent := false
+	failMsg := "创建文件记录失败"
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var fileContent file.FileContent
+		err := tx.First(&fileContent, "hash = ?", hash).Error
+		if err == gorm.ErrRecordNotFound {
+			// 记录不存在，创建新记录
+			newContent = true
+			fileContent = file.FileContent{Hash: hash, Size: fileSize}
+			fileContent.SetMimeType(sniffStored(stor, hash))
+			if err := tx.Create(&fileContent).Error; err != nil {
+				failMsg = "创建文件内容记录失败"
+				return err
+			}
+		} else if err != nil {
+			failMsg = "查询文件内容失败"
+			return err
+		}
+		// 初始化时已校验同名冲突，但之后可能出现了同名文件，只有客户端选择了覆盖才覆盖
+		existing, err := file.FindFileByName(tx, parentID, name, userID)
+		if err != nil {
+			failMsg = "查询文件失败"
+			return err
+		}
+		if existing != nil {
+			if !overwrite {
+				return file.ErrNameExists
+			}
+			f = *existing
+			return overwriteWithVersion(tx, &f, hash, fileContent.Size)
+		}
+		if err := tx.Create(&f).Error; err != nil {
+			return err
+		}
+		if err := user.UpdateUserStorageUsed(tx, userID, fileSize); err != nil {
+			failMsg = "更新存储空间失败"
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		// 合并出的对象在回滚后没有记录引用、也没有其他请求正在写入时一并删除
+		if newContent {
+			blobs.Release(stor, []string{hash})
+		} else {
+			blobs.Release(stor, nil)
+		}
+		if errors.Is(err, file.ErrNameExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": "同目录下已存在同名文件"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failMsg, "detail": err.Error()})
+		return
+	}
+	blobs.Release(stor, nil)
 	// 合并成功后清理 Redis 记录
 	rdb := c.MustGet("redis").(*redis.Client)
 	ctx := context.Background()
 	rdb.Del(ctx, "upload:"+req.UploadId)
-	// 清理用户缓存
-	cacheKey := fmt.Sprintf("user:info:%d", userID)
-	rdb.Del(ctx, cacheKey)
-	// 清理文件列表缓存（所有目录）
-	fileListPrefix := fmt.Sprintf("filelist:%d:", userID)
-	keys, _ := rdb.Keys(ctx, fileListPrefix+"*").Result()
-	if len(keys) > 0 {
-		rdb.Del(ctx, keys...)
-	}
-	c.JSON(http.StatusOK, gin.H{"message": "合并成功"})
+	// 清理用户、文件列表及被覆盖文件的缓存
+	clearFileCaches(c, userID, &f)
+	c.JSON(http.StatusOK, gin.H{"message": "合并成功", "file_id": f.ID})
 }
 
 // @Summary 刷新分片上传令牌
@@ -973,7 +1124,7 @@ func MultipartRefreshTokenHandler(c *gin.Context) {
 
 	// 生成新的令牌
 	stor := c.MustGet(StorageKey).(storage.Storage)
-	chunkStorage, ok := stor.(*storage.ChunkServerStorage)
+	chunkStorage, ok := storage.AsChunkServer(stor)
 	if !ok {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "当前存储模式不支持分片上传"})
 		return
@@ -1054,7 +1205,7 @@ func GetUploadURLHandler(c *gin.Context) {
 	}
 
 	// 如果存储服务是ChunkServerStorage类型，生成临时上传URL
-	chunkStorage, ok := stor.(*storage.ChunkServerStorage)
+	chunkStorage, ok := storage.AsChunkServer(stor)
 	if !ok {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "当前存储模式不支持直接上传"})
 		return
@@ -1121,7 +1272,7 @@ func GetDownloadURLHandler(c *gin.Context) {
 	}
 
 	// 如果存储服务是ChunkServerStorage类型，生成临时下载URL
-	chunkStorage, ok := stor.(*storage.ChunkServerStorage)
+	chunkStorage, ok := storage.AsChunkServer(stor)
 	if !ok {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "当前存储模式不支持直接下载"})
 		return
@@ -1231,13 +1382,7 @@ func UploadCompleteHandler(c *gin.Context) {
 
 	// 清理Redis缓存
 	rdb.Del(ctx, "pending_upload:"+req.FileID)
-	cacheKey := fmt.Sprintf("user:info:%d", userID)
-	rdb.Del(ctx, cacheKey)
-	fileListPrefix := fmt.Sprintf("filelist:%d:", userID)
-	keys, _ := rdb.Keys(ctx, fileListPrefix+"*").Result()
-	if len(keys) > 0 {
-		rdb.Del(ctx, keys...)
-	}
+	clearFileCaches(c, userID, &f)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "上传完成",
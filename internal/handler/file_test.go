@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -16,6 +15,7 @@ import (
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
+	"cloudDrive/internal/cache"
 	"cloudDrive/internal/file"
 	"cloudDrive/internal/user"
 )
@@ -25,7 +25,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	if err != nil {
 		t.Fatalf("failed to connect database: %v", err)
 	}
-	if err := db.AutoMigrate(&file.File{}, &file.FileContent{}, &file.UserRoot{}, &user.User{}); err != nil {
+	if err := db.AutoMigrate(&file.File{}, &file.FileAncestor{}, &file.FileNameToken{}, &file.Tag{}, &file.FileTag{}, &file.Favorite{}, &file.FileMeta{}, &file.FileContent{}, &file.UserRoot{}, &user.User{}, &file.FileVersion{}, &file.VersionPolicy{}, &file.PendingBlob{}); err != nil {
 		t.Fatalf("failed to migrate: %v", err)
 	}
 	return db
@@ -360,8 +360,9 @@ func TestInstantUpload_CacheCleaning(t *testing.T) {
 	db.Create(fileContent)
 
 	// 预先在缓存中设置一些数据
-	userCacheKey := fmt.Sprintf("user:info:%d", testUser.ID)
-	fileListCacheKey := fmt.Sprintf("filelist:%d:root-id-123", testUser.ID)
+	cc := cache.New(rdb)
+	userCacheKey := cache.UserInfoKey(testUser.ID)
+	fileListCacheKey := cc.FileListKey(ctx, testUser.ID, "root-id-123", "10", "upload_time", "desc", "")
 
 	// 设置缓存数据
 	rdb.Set(ctx, userCacheKey, `{"id":1,"username":"testuser","storage_used":0}`, time.Hour)
@@ -419,10 +420,8 @@ func TestInstantUpload_CacheCleaning(t *testing.T) {
 	_, err = rdb.Get(ctx, userCacheKey).Result()
 	assert.Equal(t, redis.Nil, err) // 缓存应该被删除
 
-	// 验证文件列表缓存也被清理
-	keys, err := rdb.Keys(ctx, fmt.Sprintf("filelist:%d:*", testUser.ID)).Result()
-	assert.NoError(t, err)
-	assert.Empty(t, keys) // 所有文件列表缓存都应该被删除
+	// 验证文件列表缓存也已失效：根目录的代数递增，旧键不再被读取
+	assert.NotEqual(t, fileListCacheKey, cc.FileListKey(ctx, testUser.ID, "root-id-123", "10", "upload_time", "desc", ""))
 
 	// 验证数据库中确实创建了文件记录
 	var createdFile file.File
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"cloudDrive/internal/file"
+	"cloudDrive/internal/storage"
+	"cloudDrive/internal/user"
+)
+
+// setupUploadFaultTest 准备用户、根目录和包装了故障注入的本地存储
+func setupUploadFaultTest(t *testing.T, faults storage.FaultConfig) (*gin.Engine, *gorm.DB, *storage.LocalFileStorage) {
+	db := setupTestDB(t)
+	db.Create(&user.User{ID: 1, Username: "testuser", StorageLimit: 1024 * 1024})
+	db.Create(&file.UserRoot{UserID: 1, RootID: "root-id", CreatedAt: time.Now()})
+
+	dir, err := os.MkdirTemp("", "upload-fault-test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	inner := &storage.LocalFileStorage{Dir: dir}
+	stor := storage.NewFaultInjectingStorage(inner, faults)
+
+	rdb := setupTestRedis()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("db", db)
+		c.Set("redis", rdb)
+		c.Set("user_id", uint(1))
+		c.Set(StorageKey, stor)
+		c.Next()
+	})
+	router.POST("/files/upload", FileUploadHandler)
+	return router, db, inner
+}
+
+func doUpload(router *gin.Engine, name string, content []byte) *httptest.ResponseRecorder {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", name)
+	part.Write(content)
+	writer.Close()
+	req, _ := http.NewRequest("POST", "/files/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// assertNothingCommitted 验证上传失败后数据库、配额和存储均无残留
+func assertNothingCommitted(t *testing.T, db *gorm.DB, inner storage.Storage, hash string) {
+	var fileCount, contentCount int64
+	db.Model(&file.File{}).Where("hash = ?", hash).Count(&fileCount)
+	db.Model(&file.FileContent{}).Where("hash = ?", hash).Count(&contentCount)
+	assert.Equal(t, int64(0), fileCount, "不应残留File记录")
+	assert.Equal(t, int64(0), contentCount, "不应残留FileContent记录")
+
+	var u user.User
+	db.First(&u, 1)
+	assert.Equal(t, int64(0), u.StorageUsed, "配额不应变化")
+
+	exists, err := inner.Exists(context.Background(), hash)
+	assert.NoError(t, err)
+	assert.False(t, exists, "不应残留存储对象")
+}
+
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestFileUpload_StorageFaults_ShouldRollback(t *testing.T) {
+	content := []byte("upload rollback content")
+	hash := contentHash(content)
+
+	t.Run("存储写入失败", func(t *testing.T) {
+		router, db, inner := setupUploadFaultTest(t, storage.FaultConfig{
+			Enabled:    true,
+			Operations: map[string]storage.FaultRule{storage.OpUpload: {ErrorRate: 1}},
+		})
+		w := doUpload(router, "a.txt", content)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assertNothingCommitted(t, db, inner, hash)
+	})
+
+	t.Run("写入中途截断", func(t *testing.T) {
+		router, db, inner := setupUploadFaultTest(t, storage.FaultConfig{
+			Enabled:    true,
+			Operations: map[string]storage.FaultRule{storage.OpUpload: {TruncateWriteRate: 1}},
+		})
+		w := doUpload(router, "a.txt", content)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assertNothingCommitted(t, db, inner, hash)
+	})
+
+	t.Run("存储成功后数据库写入失败", func(t *testing.T) {
+		router, db, inner := setupUploadFaultTest(t, storage.FaultConfig{})
+		db.Callback().Create().Before("gorm:create").Register("test:fail_file_create", func(tx *gorm.DB) {
+			if tx.Statement.Table == "files" {
+				tx.AddError(errors.New("模拟数据库故障"))
+			}
+		})
+		w := doUpload(router, "a.txt", content)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assertNothingCommitted(t, db, inner, hash)
+	})
+
+	t.Run("已有内容时失败不删除共享对象", func(t *testing.T) {
+		router, db, inner := setupUploadFaultTest(t, storage.FaultConfig{})
+		inner.Upload(context.Background(), hash, bytes.NewReader(content))
+		db.Create(&file.FileContent{Hash: hash, Size: int64(len(content))})
+		db.Callback().Create().Before("gorm:create").Register("test:fail_file_create", func(tx *gorm.DB) {
+			if tx.Statement.Table == "files" {
+				tx.AddError(errors.New("模拟数据库故障"))
+			}
+		})
+		w := doUpload(router, "a.txt", content)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+		exists, err := inner.Exists(context.Background(), hash)
+		assert.NoError(t, err)
+		assert.True(t, exists, "其他文件引用的对象不应被删除")
+		var u user.User
+		db.First(&u, 1)
+		assert.Equal(t, int64(0), u.StorageUsed)
+	})
+
+	t.Run("配额不足时不写入存储", func(t *testing.T) {
+		router, db, inner := setupUploadFaultTest(t, storage.FaultConfig{})
+		db.Model(&user.User{}).Where("id = ?", 1).Update("storage_limit", 1)
+		w := doUpload(router, "a.txt", content)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assertNothingCommitted(t, db, inner, hash)
+	})
+
+	t.Run("注入延迟时正常提交", func(t *testing.T) {
+		router, db, inner := setupUploadFaultTest(t, storage.FaultConfig{
+			Enabled:    true,
+			Operations: map[string]storage.FaultRule{storage.OpAll: {Latency: 10 * time.Millisecond}},
+		})
+		w := doUpload(router, "a.txt", content)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var f file.File
+		assert.NoError(t, db.First(&f, "hash = ?", hash).Error)
+		assert.Equal(t, "root-id", f.ParentID)
+		var u user.User
+		db.First(&u, 1)
+		assert.Equal(t, int64(len(content)), u.StorageUsed)
+		exists, _ := inner.Exists(context.Background(), hash)
+		assert.True(t, exists)
+	})
+}
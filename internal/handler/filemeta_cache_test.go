@@ -2,11 +2,12 @@ package handler
 
 import (
 	"context"
-	"fmt"
 	"testing"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/assert"
+
+	"cloudDrive/internal/cache"
 )
 
 func TestFileMetaCache(t *testing.T) {
@@ -41,5 +42,5 @@ func TestFileMetaCache(t *testing.T) {
 
 // getFileMetaCacheKey 生成文件元数据缓存key
 func getFileMetaCacheKey(fileID string) string {
-	return fmt.Sprintf("filemeta:%s", fileID)
+	return cache.FileMetaKey(fileID)
 }
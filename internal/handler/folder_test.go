@@ -2,6 +2,7 @@ package handler
 
 import (
 	"bytes"
+	"cloudDrive/internal/cache"
 	"cloudDrive/internal/file"
 	"cloudDrive/internal/user"
 	"context"
@@ -9,6 +10,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
@@ -74,6 +76,50 @@ func (m *MockRedisClient) Del(ctx context.Context, keys ...string) *redis.IntCmd
 	return cmd
 }
 
+func (m *MockRedisClient) MGet(ctx context.Context, keys ...string) *redis.SliceCmd {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	vals := make([]interface{}, len(keys))
+	for i, key := range keys {
+		if val, ok := m.data[key]; ok {
+			vals[i] = val
+		}
+	}
+	cmd := redis.NewSliceCmd(ctx)
+	cmd.SetVal(vals)
+	return cmd
+}
+
+func (m *MockRedisClient) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cmd := redis.NewBoolCmd(ctx)
+	if _, ok := m.data[key]; ok {
+		cmd.SetVal(false)
+		return cmd
+	}
+	m.data[key] = fmt.Sprintf("%v", value)
+	cmd.SetVal(true)
+	return cmd
+}
+
+func (m *MockRedisClient) Incr(ctx context.Context, key string) *redis.IntCmd {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, _ := strconv.ParseInt(m.data[key], 10, 64)
+	n++
+	m.data[key] = strconv.FormatInt(n, 10)
+	cmd := redis.NewIntCmd(ctx)
+	cmd.SetVal(n)
+	return cmd
+}
+
+func (m *MockRedisClient) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
+	cmd := redis.NewBoolCmd(ctx)
+	cmd.SetVal(true)
+	return cmd
+}
+
 func (m *MockRedisClient) Keys(ctx context.Context, pattern string) *redis.StringSliceCmd {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -118,7 +164,7 @@ func setupTestDBForFolder(t *testing.T) *gorm.DB {
 	}
 
 	// 自动迁移
-	db.AutoMigrate(&user.User{}, &file.File{}, &file.FileContent{}, &file.UserRoot{})
+	db.AutoMigrate(&user.User{}, &file.File{}, &file.FileAncestor{}, &file.FileNameToken{}, &file.Tag{}, &file.FileTag{}, &file.Favorite{}, &file.FileMeta{}, &file.FileContent{}, &file.UserRoot{})
 	return db
 }
 
@@ -158,9 +204,10 @@ func TestCreateFolder_CacheCleaning(t *testing.T) {
 	}
 	db.Create(rootFolder)
 
-	// 预先在缓存中设置一些数据
-	fileListCacheKey1 := fmt.Sprintf("filelist:%d:%s:1:10:upload_time:desc", testUser.ID, userRoot.RootID)
-	fileListCacheKey2 := fmt.Sprintf("filelist:%d::1:10:upload_time:desc", testUser.ID)
+	// 预先在缓存中设置一些数据：根目录和另一个目录的列表
+	cc := cache.New(rdb)
+	fileListCacheKey1 := cc.FileListKey(ctx, testUser.ID, userRoot.RootID, "10", "upload_time", "desc", "")
+	fileListCacheKey2 := cc.FileListKey(ctx, testUser.ID, "other-folder-id", "10", "upload_time", "desc", "")
 
 	// 设置缓存数据
 	rdb.Set(ctx, fileListCacheKey1, `{"files":[{"id":"1","name":"old_file.txt"}],"total":1}`, time.Hour)
@@ -182,7 +229,7 @@ func TestCreateFolder_CacheCleaning(t *testing.T) {
 	// 设置中间件
 	router.Use(func(c *gin.Context) {
 		c.Set("db", db)
-		c.Set("redis", RedisInterface(rdb)) // 转换为接口类型
+		c.Set("redis", cache.Client(rdb)) // 转换为接口类型
 		c.Set("user_id", testUser.ID)
 		c.Next()
 	})
@@ -211,10 +258,13 @@ func TestCreateFolder_CacheCleaning(t *testing.T) {
 	assert.NotEmpty(t, response["id"])
 	assert.Equal(t, "新建文件夹", response["name"])
 
-	// 验证缓存已被清理
-	keys, err := rdb.Keys(ctx, fmt.Sprintf("filelist:%d:*", testUser.ID)).Result()
-	assert.NoError(t, err)
-	assert.Empty(t, keys, "创建文件夹后应该清理所有文件列表缓存")
+	// 验证所在目录的列表缓存已失效：代数递增后键发生变化，旧数据不再被读取
+	newKey := cc.FileListKey(ctx, testUser.ID, userRoot.RootID, "10", "upload_time", "desc", "")
+	assert.NotEqual(t, fileListCacheKey1, newKey, "创建文件夹后所在目录的列表缓存应失效")
+	_, err = rdb.Get(ctx, newKey).Result()
+	assert.Equal(t, redis.Nil, err)
+	// 其他目录的列表缓存不受影响
+	assert.Equal(t, fileListCacheKey2, cc.FileListKey(ctx, testUser.ID, "other-folder-id", "10", "upload_time", "desc", ""))
 
 	// 验证数据库中确实创建了文件夹记录
 	var createdFolder file.File
@@ -274,7 +324,8 @@ func TestCreateFolder_NoCacheCleaningWhenError(t *testing.T) {
 	db.Create(existingFolder)
 
 	// 预先在缓存中设置一些数据
-	fileListCacheKey := fmt.Sprintf("filelist:%d:%s:1:10:upload_time:desc", testUser.ID, userRoot.RootID)
+	cc := cache.New(rdb)
+	fileListCacheKey := cc.FileListKey(ctx, testUser.ID, userRoot.RootID, "10", "upload_time", "desc", "")
 	rdb.Set(ctx, fileListCacheKey, `{"files":[{"id":"1","name":"old_file.txt"}],"total":1}`, time.Hour)
 
 	// 验证缓存数据已存在
@@ -289,7 +340,7 @@ func TestCreateFolder_NoCacheCleaningWhenError(t *testing.T) {
 	// 设置中间件
 	router.Use(func(c *gin.Context) {
 		c.Set("db", db)
-		c.Set("redis", RedisInterface(rdb)) // 转换为接口类型
+		c.Set("redis", cache.Client(rdb)) // 转换为接口类型
 		c.Set("user_id", testUser.ID)
 		c.Next()
 	})
@@ -318,6 +369,7 @@ func TestCreateFolder_NoCacheCleaningWhenError(t *testing.T) {
 	assert.Equal(t, "同目录下已存在同名文件夹", response["error"])
 
 	// 验证缓存没有被清理（因为操作失败了）
+	assert.Equal(t, fileListCacheKey, cc.FileListKey(ctx, testUser.ID, userRoot.RootID, "10", "upload_time", "desc", ""))
 	val, err = rdb.Get(ctx, fileListCacheKey).Result()
 	assert.NoError(t, err)
 	assert.NotEmpty(t, val, "创建文件夹失败时不应该清理缓存")
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"cloudDrive/internal/fulltext"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary 全文搜索
+// @Description 搜索内容包含所有关键字的文本、Markdown、CSV、JSON 及 docx/xlsx/pptx 文件，只返回当前用户的文件，摘要中的关键字以 <em> 标出，需登录（Session）
+// @Tags 文件模块
+// @Produce json
+// @Param q query string true "关键字，中文按相邻两字匹配"
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量，默认20，最大50"
+// @Success 200 {object} fulltext.SearchResponse
+// @Failure 400 {object} map[string]interface{}
+// @Router /files/search/content [get]
+func FileContentSearchHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	resp, err := fulltext.Search(db, fulltext.SearchQuery{OwnerID: userID, Query: q, Page: page, PageSize: pageSize})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "搜索失败", "detail": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
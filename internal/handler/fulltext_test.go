@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"cloudDrive/internal/file"
+	"cloudDrive/internal/fulltext"
+	"cloudDrive/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileContentSearchHandler(t *testing.T) {
+	db := setupTestDB(t)
+	db.AutoMigrate(&fulltext.ContentIndex{}, &fulltext.ContentTerm{})
+	stor := storage.NewMemoryStorage()
+	content := "项目周报：本周完成了<全文搜索>功能"
+	stor.Upload(context.Background(), "h1", strings.NewReader(content))
+	db.Create(&file.FileContent{Hash: "h1", Size: int64(len(content))})
+	db.Create(&file.File{ID: "f1", Name: "周报.md", Hash: "h1", Type: "file", OwnerID: 1})
+	db.Create(&file.File{ID: "f2", Name: "他人.md", Hash: "h1", Type: "file", OwnerID: 2})
+	if _, err := fulltext.IndexPending(context.Background(), db, stor, 10, fulltext.DefaultLimits); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("db", db)
+		c.Set("user_id", uint(1))
+		c.Next()
+	})
+	router.GET("/files/search/content", FileContentSearchHandler)
+
+	w := doJSON(router, "GET", "/files/search/content?q=全文", nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp fulltext.SearchResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if assert.Len(t, resp.Hits, 1) {
+		assert.Equal(t, "f1", resp.Hits[0].ID)
+		assert.Contains(t, resp.Hits[0].Snippet, "&lt;<em>全文</em>搜索&gt;")
+	}
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/files/search/content?q=%20", nil).Code)
+}
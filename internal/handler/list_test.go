@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"cloudDrive/internal/file"
+)
+
+func TestFileListHandler_CursorPagination(t *testing.T) {
+	db := setupTestDB(t)
+	db.Create(&file.UserRoot{UserID: 1, RootID: "root", CreatedAt: time.Now()})
+	now := time.Now()
+	for _, f := range []file.File{
+		{ID: "root", Name: "root", Type: "folder", OwnerID: 1},
+		{ID: "docs", Name: "docs", Type: "folder", ParentID: "root", OwnerID: 1},
+		{ID: "a", Name: "a.txt", Hash: "ha", Type: "file", ParentID: "root", OwnerID: 1},
+		{ID: "b", Name: "b.txt", Hash: "hb", Type: "file", ParentID: "root", OwnerID: 1},
+		{ID: "docs-a", Name: "a.md", Hash: "ha", Type: "file", ParentID: "docs", OwnerID: 1},
+	} {
+		f.UploadTime = now
+		db.Create(&f)
+	}
+	db.Create(&file.FileContent{Hash: "ha", Size: 10})
+	db.Create(&file.FileContent{Hash: "hb", Size: 20})
+
+	rdb := setupTestRedis()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("db", db)
+		c.Set("redis", rdb)
+		c.Set("user_id", uint(1))
+		c.Next()
+	})
+	router.GET("/files", FileListHandler)
+	router.GET("/files/search", FileSearchHandler)
+
+	var resp file.ListFilesResponse
+	w := doJSON(router, "GET", "/files?order_by=size&order=desc&page_size=2", nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, int64(3), resp.Total)
+	if assert.Len(t, resp.Files, 2) {
+		assert.Equal(t, "b", resp.Files[0].ID)
+		assert.Equal(t, int64(20), *resp.Files[0].Size)
+	}
+	assert.NotEmpty(t, resp.NextCursor)
+
+	w = doJSON(router, "GET", "/files?order_by=size&order=desc&page_size=2&cursor="+url.QueryEscape(resp.NextCursor), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	resp = file.ListFilesResponse{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if assert.Len(t, resp.Files, 1) {
+		assert.Equal(t, "docs", resp.Files[0].ID)
+		assert.Nil(t, resp.Files[0].Size)
+	}
+	assert.Empty(t, resp.NextCursor)
+
+	// 游标与排序方式不一致或被篡改
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/files?order_by=name&cursor=abc", nil).Code)
+
+	w = doJSON(router, "GET", "/files/search?name=a.&order_by=name&order=asc", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	resp = file.ListFilesResponse{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if assert.Len(t, resp.Files, 2) {
+		assert.Equal(t, "docs-a", resp.Files[0].ID)
+		assert.Equal(t, "a", resp.Files[1].ID)
+	}
+}
+
+func TestFileSearchHandler_Filters(t *testing.T) {
+	db := setupTestDB(t)
+	day := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	for _, f := range []file.File{
+		{ID: "root", Name: "root", Type: "folder", OwnerID: 1},
+		{ID: "docs", Name: "docs", Type: "folder", ParentID: "root", OwnerID: 1, UploadTime: day},
+		{ID: "big", Name: "plan.pdf", Hash: "h2", Type: "file", ParentID: "docs", OwnerID: 1, UploadTime: day},
+		{ID: "small", Name: "plan.txt", Hash: "h1", Type: "file", ParentID: "root", OwnerID: 1, UploadTime: day.AddDate(0, 0, 1)},
+	} {
+		db.Create(&f)
+	}
+	db.Create(&file.FileContent{Hash: "h1", Size: 10})
+	db.Create(&file.FileContent{Hash: "h2", Size: 2000})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("db", db)
+		c.Set("user_id", uint(1))
+		c.Next()
+	})
+	router.GET("/files/search", FileSearchHandler)
+
+	var resp file.SearchResponse
+	w := doJSON(router, "GET", "/files/search?name=plan&min_size=100&folder_id=root", nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if assert.Len(t, resp.Files, 1) {
+		assert.Equal(t, "big", resp.Files[0].ID)
+		assert.Equal(t, "pdf", resp.Files[0].Ext)
+	}
+	if assert.NotNil(t, resp.Facets) {
+		assert.Equal(t, []file.FacetCount{{Value: "pdf", Count: 1}}, resp.Facets.Exts)
+	}
+
+	// 只有日期的截止时间包含当天
+	resp = file.SearchResponse{}
+	w = doJSON(router, "GET", "/files/search?ext=txt,pdf&from=2024-05-01&to=2024-05-01", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if assert.Len(t, resp.Files, 1) {
+		assert.Equal(t, "big", resp.Files[0].ID)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/files/search?min_size=abc", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/files/search?from=yesterday", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/files/search?category=bogus", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/files/search?within=someday", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/files/search?within=7d&from=2024-05-01", nil).Code)
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"cloudDrive/internal/file"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SetMetadataRequest 设置文件的描述和元数据，Description 为空表示不修改描述
+type SetMetadataRequest struct {
+	Description *string         `json:"description"`
+	Items       []file.MetaItem `json:"items"`
+}
+
+// DeleteMetadataRequest 删除文件的元数据键
+type DeleteMetadataRequest struct {
+	Keys []string `json:"keys" binding:"required"`
+}
+
+// metadataError 将元数据操作的错误转换为HTTP响应
+func metadataError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+	case errors.Is(err, file.ErrNoPermission):
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权限访问该文件"})
+	case errors.Is(err, file.ErrInvalidMeta), errors.Is(err, file.ErrMetaTooLarge):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败", "detail": err.Error()})
+	}
+}
+
+// @Summary 获取文件元数据
+// @Description 获取文件或文件夹的描述和自定义元数据，元数据按键排序，需登录（Session）
+// @Tags 文件模块
+// @Produce json
+// @Param id path string true "文件ID"
+// @Success 200 {object} file.Metadata
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /files/{id}/metadata [get]
+func FileMetadataGetHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	md, err := file.GetMetadata(db, c.Param("id"), userID)
+	if err != nil {
+		metadataError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, md)
+}
+
+// @Summary 设置文件元数据
+// @Description 设置文件或文件夹的描述和自定义元数据，已有的键被覆盖，未提交的键保留。类型为 string、number、date（2006-01-02 或 RFC3339）；
+// @Description 键由字母、数字、下划线、点和短横线组成，最长64字节；每项最多50个键，字符串值最长1024字节，键和值合计不超过16KB，描述最多2000个字符，需登录（Session）
+// @Tags 文件模块
+// @Accept json
+// @Produce json
+// @Param id path string true "文件ID"
+// @Param data body SetMetadataRequest true "描述和元数据"
+// @Success 200 {object} file.Metadata
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /files/{id}/metadata [put]
+func FileMetadataSetHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	var req SetMetadataRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误", "detail": err.Error()})
+		return
+	}
+	md, err := file.SetMetadata(db, c.Param("id"), userID, req.Description, req.Items)
+	if err != nil {
+		metadataError(c, err)
+		return
+	}
+	if req.Description != nil {
+		cacheFrom(c).InvalidateFileMeta(context.Background(), c.Param("id"))
+	}
+	c.JSON(http.StatusOK, md)
+}
+
+// @Summary 删除文件元数据
+// @Description 删除文件或文件夹的指定元数据键，不存在的键忽略，需登录（Session）
+// @Tags 文件模块
+// @Accept json
+// @Produce json
+// @Param id path string true "文件ID"
+// @Param data body DeleteMetadataRequest true "要删除的键"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /files/{id}/metadata [delete]
+func FileMetadataDeleteHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	var req DeleteMetadataRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误", "detail": err.Error()})
+		return
+	}
+	deleted, err := file.DeleteMetadata(db, c.Param("id"), userID, req.Keys)
+	if err != nil {
+		metadataError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功", "deleted": deleted})
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"cloudDrive/internal/file"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileMetadataHandlers(t *testing.T) {
+	db := setupTestDB(t)
+	for _, f := range []file.File{
+		{ID: "root", Name: "root", Type: "folder", OwnerID: 1},
+		{ID: "a", Name: "a.pdf", Hash: "h", Type: "file", ParentID: "root", OwnerID: 1},
+		{ID: "b", Name: "b.pdf", Hash: "h", Type: "file", ParentID: "root", OwnerID: 1},
+		{ID: "other", Name: "c.txt", Hash: "h", Type: "file", ParentID: "x", OwnerID: 2},
+	} {
+		db.Create(&f)
+	}
+	db.Create(&file.FileContent{Hash: "h", Size: 10})
+
+	rdb := setupTestRedis()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("db", db)
+		c.Set("redis", rdb)
+		c.Set("user_id", uint(1))
+		c.Next()
+	})
+	router.GET("/files/search", FileSearchHandler)
+	router.GET("/files/:id/metadata", FileMetadataGetHandler)
+	router.PUT("/files/:id/metadata", FileMetadataSetHandler)
+	router.DELETE("/files/:id/metadata", FileMetadataDeleteHandler)
+
+	w := doJSON(router, "PUT", "/files/a/metadata", gin.H{
+		"description": "三月发票",
+		"items": []gin.H{
+			{"key": "amount", "type": "number", "value": "120"},
+			{"key": "vendor", "type": "string", "value": "ACME"},
+		},
+	})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var md file.Metadata
+	json.Unmarshal(w.Body.Bytes(), &md)
+	assert.Equal(t, "三月发票", md.Description)
+	assert.Len(t, md.Items, 2)
+	doJSON(router, "PUT", "/files/b/metadata", gin.H{"items": []gin.H{{"key": "amount", "type": "number", "value": "80"}}})
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "PUT", "/files/a/metadata",
+		gin.H{"items": []gin.H{{"key": "due", "type": "date", "value": "tomorrow"}}}).Code)
+	assert.Equal(t, http.StatusForbidden, doJSON(router, "PUT", "/files/other/metadata", gin.H{}).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "GET", "/files/missing/metadata", nil).Code)
+
+	var resp file.SearchResponse
+	w = doJSON(router, "GET", "/files/search?meta=amount:gt:100", nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if assert.Len(t, resp.Files, 1) {
+		assert.Equal(t, "a", resp.Files[0].ID)
+	}
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/files/search?meta=amount:between:1", nil).Code)
+
+	w = doJSON(router, "DELETE", "/files/a/metadata", gin.H{"keys": []string{"vendor"}})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	md = file.Metadata{}
+	json.Unmarshal(doJSON(router, "GET", "/files/a/metadata", nil).Body.Bytes(), &md)
+	if assert.Len(t, md.Items, 1) {
+		assert.Equal(t, "amount", md.Items[0].Key)
+	}
+	assert.Equal(t, "三月发票", md.Description)
+}
@@ -1,17 +1,66 @@
 package handler
 
 import (
+	"cloudDrive/internal/cache"
 	"cloudDrive/internal/file"
+	"cloudDrive/internal/user"
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
 )
 
+// deleteToRecycle 将文件移入回收站，回收站不占用配额时同时释放配额
+func deleteToRecycle(db *gorm.DB, fileID string, userID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		released, err := file.DeleteFile(tx, fileID, userID)
+		if err != nil || released == 0 {
+			return err
+		}
+		return user.UpdateUserStorageUsed(tx, userID, -released)
+	})
+}
+
+// restoreFromRecycle 还原回收站中的文件，移入回收站时已释放的配额重新计入，超出配额时拒绝还原
+func restoreFromRecycle(db *gorm.DB, fileID string, userID uint, targetParentID string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		charged, err := file.RestoreFile(tx, fileID, userID, targetParentID)
+		if err != nil || charged == 0 {
+			return err
+		}
+		u, err := user.GetUserByID(tx, userID)
+		if err != nil {
+			return err
+		}
+		if u.StorageUsed+charged > u.StorageLimit {
+			return errBatchQuotaExceeded
+		}
+		return user.UpdateUserStorageUsed(tx, userID, charged)
+	})
+}
+
+// purgeFromRecycle 彻底删除回收站中的文件并释放配额，返回释放的空间大小
+func purgeFromRecycle(db *gorm.DB, fileID string, userID uint) (int64, error) {
+	var freed int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		freed, err = file.PermanentlyDeleteFile(tx, fileID, userID)
+		if err != nil || freed == 0 {
+			return err
+		}
+		return user.UpdateUserStorageUsed(tx, userID, -freed)
+	})
+	return freed, err
+}
+
 // GET /api/recycle
+// 支持 name 名称搜索、type 类型过滤（file/folder）、order_by 排序（deleted_at/size/name）和 order（asc/desc），
+// 返回回收站顶层项及其原路径、能否直接还原，以及符合条件的总数和总大小
 func RecycleBinListHandler(c *gin.Context) {
 	db := c.MustGet("db").(*gorm.DB)
 	userID := c.MustGet("user_id").(uint)
@@ -23,12 +72,20 @@ func RecycleBinListHandler(c *gin.Context) {
 	if ps := c.Query("page_size"); ps != "" {
 		fmt.Sscanf(ps, "%d", &pageSize)
 	}
-	files, err := file.ListRecycleBinFiles(db, userID, page, pageSize)
+	resp, err := file.SearchRecycleBin(db, file.RecycleBinQuery{
+		OwnerID:  userID,
+		Name:     c.Query("name"),
+		Type:     c.Query("type"),
+		OrderBy:  c.Query("order_by"),
+		Order:    c.Query("order"),
+		Page:     page,
+		PageSize: pageSize,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, files)
+	c.JSON(http.StatusOK, resp)
 }
 
 // POST /api/recycle/restore
@@ -43,24 +100,16 @@ func RecycleBinRestoreHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
 		return
 	}
-	var err error
-	if req.TargetPath != "" {
-		err = file.RestoreFile(db, req.FileID, userID, req.TargetPath)
-	} else {
-		err = file.RestoreFile(db, req.FileID, userID)
-	}
-	if err != nil {
+	if err := restoreFromRecycle(db, req.FileID, userID, req.TargetPath); err != nil {
+		if errors.Is(err, errBatchQuotaExceeded) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "存储空间不足"})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	// 清理文件列表缓存（所有目录）
-	rdb := c.MustGet("redis").(*redis.Client)
-	ctx := context.Background()
-	fileListPrefix := fmt.Sprintf("filelist:%d:", userID)
-	keys, _ := rdb.Keys(ctx, fileListPrefix+"*").Result()
-	if len(keys) > 0 {
-		rdb.Del(ctx, keys...)
-	}
+	// 清理文件列表缓存（所有目录），还原可能重新占用配额
+	clearUserFileCaches(cacheFrom(c), userID)
 	c.JSON(http.StatusOK, gin.H{"message": "还原成功"})
 }
 
@@ -75,10 +124,160 @@ func RecycleBinDeleteHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
 		return
 	}
-	err := file.PermanentlyDeleteFile(db, req.FileID, userID)
+	freed, err := purgeFromRecycle(db, req.FileID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "回收站中不存在该文件"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "彻底删除成功"})
+	if freed > 0 {
+		cacheFrom(c).InvalidateUserInfo(context.Background(), userID)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "彻底删除成功", "freed": freed})
+}
+
+// DELETE /api/recycle/all
+// 清空回收站：彻底删除回收站中的所有文件并释放占用的配额
+func RecycleBinEmptyHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	cc := cacheFrom(c)
+	userID := c.MustGet("user_id").(uint)
+	items, err := file.ListTrashBefore(db, userID, time.Now().Add(time.Second)) // 包含刚删除的文件
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询回收站失败", "detail": err.Error()})
+		return
+	}
+	var freed int64
+	deleted := 0
+	for _, f := range items {
+		n, err := purgeFromRecycle(db, f.ID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "清空回收站失败", "detail": err.Error(), "deleted": deleted, "freed": freed})
+			clearUserFileCaches(cc, userID)
+			return
+		}
+		freed += n
+		deleted++
+	}
+	clearUserFileCaches(cc, userID)
+	c.JSON(http.StatusOK, gin.H{"message": "回收站已清空", "deleted": deleted, "freed": freed})
+}
+
+// 回收站批量操作类型
+const (
+	RecycleActionRestore = "restore"
+	RecycleActionPurge   = "purge"
+)
+
+// POST /api/recycle/bulk
+// 批量还原或彻底删除回收站中的项：ids 指定所选项，为空时按 filter 的名称和类型条件选取回收站中的所有匹配项，
+// 两种方式的项数都不能超过单次批量操作上限；
+// 每项独立执行，返回各自的结果，还原时 target_path 为空则还原到原路径
+func RecycleBinBulkHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	cc := cacheFrom(c)
+	userID := c.MustGet("user_id").(uint)
+	var req struct {
+		Action     string   `json:"action" binding:"required"`
+		IDs        []string `json:"ids"`
+		TargetPath string   `json:"target_path"`
+		Filter     *struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		} `json:"filter"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
+		return
+	}
+	if req.Action != RecycleActionRestore && req.Action != RecycleActionPurge {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的操作类型"})
+		return
+	}
+	ids := req.IDs
+	switch {
+	case len(ids) > maxBatchOperations:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "单次批量操作的项数过多"})
+		return
+	case len(ids) == 0 && req.Filter == nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择文件或指定筛选条件"})
+		return
+	case len(ids) == 0:
+		var err error
+		if ids, err = file.RecycleBinIDs(db, userID, req.Filter.Name, req.Filter.Type); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询回收站失败", "detail": err.Error()})
+			return
+		}
+		// 按条件选取时同样受单次批量操作项数限制，清空整个回收站请使用 DELETE /api/recycle/all
+		if len(ids) > maxBatchOperations {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "符合条件的项数过多，请缩小筛选范围", "total": len(ids)})
+			return
+		}
+	}
+
+	results := make([]batchOpResult, len(ids))
+	summary := map[string]int{}
+	var freed int64
+	for i, id := range ids {
+		results[i] = batchOpResult{Index: i, Op: req.Action, ID: id, Status: BatchOpOK}
+		var err error
+		if req.Action == RecycleActionRestore {
+			err = restoreFromRecycle(db, id, userID, req.TargetPath)
+		} else {
+			var n int64
+			n, err = purgeFromRecycle(db, id, userID)
+			freed += n
+		}
+		if err != nil {
+			results[i].Status, results[i].Error = BatchOpFailed, batchOpMessage(err)
+		}
+		summary[results[i].Status]++
+	}
+	if summary[BatchOpOK] > 0 {
+		clearUserFileCaches(cc, userID)
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results, "summary": summary, "freed": freed})
+}
+
+// PurgeExpiredTrash 彻底删除超过保留期限的回收站文件并释放配额，清理涉及用户的用户信息和文件列表缓存
+func PurgeExpiredTrash(db *gorm.DB, cc *cache.Cache, now time.Time) error {
+	days := file.DefaultRecyclePolicy.RetentionDays
+	if days <= 0 {
+		return nil
+	}
+	items, err := file.ListTrashBefore(db, 0, now.AddDate(0, 0, -days))
+	if err != nil {
+		return err
+	}
+	purged := map[uint]bool{}
+	for _, f := range items {
+		if _, err := purgeFromRecycle(db, f.ID, f.OwnerID); err != nil {
+			log.Printf("清理回收站文件 %s 失败: %v", f.ID, err)
+			continue
+		}
+		purged[f.OwnerID] = true
+	}
+	for ownerID := range purged {
+		clearUserFileCaches(cc, ownerID)
+	}
+	return nil
+}
+
+// StartRecyclePurge 启动时立即清理一次超过保留期限的回收站文件，之后定期清理，直到ctx取消
+func StartRecyclePurge(ctx context.Context, db *gorm.DB, cc *cache.Cache, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := PurgeExpiredTrash(db, cc, time.Now()); err != nil {
+			log.Printf("清理回收站失败: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
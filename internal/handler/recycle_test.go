@@ -2,14 +2,20 @@ package handler
 
 import (
 	"bytes"
+	"cloudDrive/internal/cache"
 	"cloudDrive/internal/file"
+	"cloudDrive/internal/user"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -27,7 +33,7 @@ func setupRecycleTestRouter(db *gorm.DB, userID uint) *gin.Engine {
 
 func TestRecycleBinRestoreHandler_Success(t *testing.T) {
 	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	db.AutoMigrate(&file.File{}, &file.UserRoot{})
+	db.AutoMigrate(&file.File{}, &file.FileAncestor{}, &file.FileNameToken{}, &file.Tag{}, &file.FileTag{}, &file.Favorite{}, &file.FileMeta{}, &file.UserRoot{})
 	userID := uint(1)
 	root := &file.UserRoot{UserID: userID, RootID: "root", CreatedAt: time.Now()}
 	db.Create(root)
@@ -60,7 +66,7 @@ func TestRecycleBinRestoreHandler_Success(t *testing.T) {
 
 func TestRecycleBinRestoreHandler_NoPermission(t *testing.T) {
 	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	db.AutoMigrate(&file.File{}, &file.UserRoot{})
+	db.AutoMigrate(&file.File{}, &file.FileAncestor{}, &file.FileNameToken{}, &file.Tag{}, &file.FileTag{}, &file.Favorite{}, &file.FileMeta{}, &file.UserRoot{})
 	userID := uint(1)
 	root := &file.UserRoot{UserID: userID, RootID: "root", CreatedAt: time.Now()}
 	db.Create(root)
@@ -88,7 +94,7 @@ func TestRecycleBinRestoreHandler_NoPermission(t *testing.T) {
 
 func TestRecycleBinRestoreHandler_BadRequest(t *testing.T) {
 	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	db.AutoMigrate(&file.File{}, &file.UserRoot{})
+	db.AutoMigrate(&file.File{}, &file.FileAncestor{}, &file.FileNameToken{}, &file.Tag{}, &file.FileTag{}, &file.Favorite{}, &file.FileMeta{}, &file.UserRoot{})
 	r := setupRecycleTestRouter(db, 1)
 	// 缺少 file_id
 	body := map[string]interface{}{"target_path": ""}
@@ -107,3 +113,158 @@ func TestRecycleBinRestoreHandler_BadRequest(t *testing.T) {
 		t.Errorf("expected error message, got %v", resp["error"])
 	}
 }
+
+func setupRecyclePurgeTest(t *testing.T) (*gin.Engine, *gorm.DB) {
+	db := setupTestDB(t)
+	db.AutoMigrate(&file.Share{})
+	db.Create(&user.User{ID: 1, Username: "testuser", StorageLimit: 1000, StorageUsed: 300})
+	db.Create(&file.UserRoot{UserID: 1, RootID: "root", CreatedAt: time.Now()})
+	now := time.Now()
+	for _, f := range []file.File{
+		{ID: "root", Name: "root", Type: "folder", OwnerID: 1},
+		{ID: "dir", Name: "dir", Type: "folder", ParentID: "root", OwnerID: 1},
+		{ID: "a", Name: "a.txt", Hash: "h1", Type: "file", ParentID: "dir", OwnerID: 1},
+		{ID: "b", Name: "b.txt", Hash: "h1", Type: "file", ParentID: "root", OwnerID: 1},
+		{ID: "c", Name: "c.txt", Hash: "h2", Type: "file", ParentID: "root", OwnerID: 1},
+	} {
+		f.UploadTime = now
+		db.Create(&f)
+	}
+	db.Create(&file.FileContent{Hash: "h1", Size: 100})
+	db.Create(&file.FileContent{Hash: "h2", Size: 100})
+
+	rdb := setupTestRedis()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("db", db)
+		c.Set("redis", rdb)
+		c.Set("user_id", uint(1))
+		c.Next()
+	})
+	router.DELETE("/files/:id", FileDeleteHandler)
+	router.POST("/recycle/restore", RecycleBinRestoreHandler)
+	router.DELETE("/recycle/all", RecycleBinEmptyHandler)
+	return router, db
+}
+
+func TestRecycleBinEmptyHandler_ReleasesQuota(t *testing.T) {
+	router, db := setupRecyclePurgeTest(t)
+	assert.Equal(t, http.StatusOK, doJSON(router, "DELETE", "/files/dir", nil).Code)
+	assert.Equal(t, http.StatusOK, doJSON(router, "DELETE", "/files/b", nil).Code)
+	assert.Equal(t, int64(300), storageUsed(db), "回收站默认继续占用配额")
+
+	w := doJSON(router, "DELETE", "/recycle/all", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"deleted":2`)
+	assert.Equal(t, int64(100), storageUsed(db), "内容去重的两条记录各自释放一次")
+
+	w = doJSON(router, "DELETE", "/recycle/all", nil)
+	assert.Contains(t, w.Body.String(), `"freed":0`)
+	assert.Equal(t, int64(100), storageUsed(db))
+}
+
+func TestRecycleBin_TrashNotCountedInQuota(t *testing.T) {
+	old := file.DefaultRecyclePolicy
+	defer func() { file.DefaultRecyclePolicy = old }()
+	file.DefaultRecyclePolicy.CountInQuota = false
+
+	router, db := setupRecyclePurgeTest(t)
+	assert.Equal(t, http.StatusOK, doJSON(router, "DELETE", "/files/dir", nil).Code)
+	assert.Equal(t, int64(200), storageUsed(db), "移入回收站时即释放配额")
+
+	// 还原时重新计入配额，超出配额时拒绝
+	db.Model(&user.User{}).Where("id = ?", 1).Update("storage_limit", 250)
+	assert.Equal(t, http.StatusForbidden, doJSON(router, "POST", "/recycle/restore", gin.H{"file_id": "dir"}).Code)
+	db.Model(&user.User{}).Where("id = ?", 1).Update("storage_limit", 1000)
+	assert.Equal(t, http.StatusOK, doJSON(router, "POST", "/recycle/restore", gin.H{"file_id": "dir"}).Code)
+	assert.Equal(t, int64(300), storageUsed(db))
+
+	assert.Equal(t, http.StatusOK, doJSON(router, "DELETE", "/files/dir", nil).Code)
+	assert.Equal(t, http.StatusOK, doJSON(router, "DELETE", "/recycle/all", nil).Code)
+	assert.Equal(t, int64(200), storageUsed(db), "彻底删除时不重复释放")
+}
+
+func TestPurgeExpiredTrash(t *testing.T) {
+	router, db := setupRecyclePurgeTest(t)
+	doJSON(router, "DELETE", "/files/dir", nil)
+	doJSON(router, "DELETE", "/files/c", nil)
+	db.Unscoped().Model(&file.File{}).Where("id IN ?", []string{"dir", "a"}).
+		Update("deleted_at", time.Now().AddDate(0, 0, -file.DefaultRecyclePolicy.RetentionDays-1))
+
+	rdb := &delRecordingRedis{Client: setupTestRedis()}
+	assert.NoError(t, PurgeExpiredTrash(db, cache.New(rdb), time.Now()))
+	var remaining []string
+	db.Unscoped().Model(&file.File{}).Where("deleted_at IS NOT NULL").Pluck("id", &remaining)
+	assert.Equal(t, []string{"c"}, remaining)
+	assert.Equal(t, int64(200), storageUsed(db))
+	assert.Contains(t, rdb.deleted, cache.UserInfoKey(1), "释放配额后应清理用户信息缓存")
+}
+
+func TestRecycleBinBulkHandler(t *testing.T) {
+	router, db := setupRecyclePurgeTest(t)
+	router.GET("/recycle", RecycleBinListHandler)
+	router.POST("/recycle/bulk", RecycleBinBulkHandler)
+	for _, id := range []string{"dir", "b", "c"} {
+		assert.Equal(t, http.StatusOK, doJSON(router, "DELETE", "/files/"+id, nil).Code)
+	}
+
+	w := doJSON(router, "GET", "/recycle?type=file&order_by=name&order=asc", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var list file.RecycleBinResponse
+	json.Unmarshal(w.Body.Bytes(), &list)
+	assert.Equal(t, int64(2), list.Total)
+	assert.Equal(t, int64(200), list.TotalSize)
+	assert.Equal(t, "b.txt", list.Items[0].Name)
+	assert.Equal(t, "/", list.Items[0].OriginalPath)
+	assert.True(t, list.Items[0].Restorable)
+
+	// 按选择还原，不存在的项单独失败
+	w = doJSON(router, "POST", "/recycle/bulk", gin.H{"action": "restore", "ids": []string{"dir", "missing"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp batchOpResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, []string{BatchOpOK, BatchOpFailed}, statusesOf(resp))
+	assert.Equal(t, "dir", parentOf(db, "a"))
+	var a file.File
+	assert.NoError(t, db.First(&a, "id = ?", "a").Error)
+
+	// 按条件彻底删除
+	w = doJSON(router, "POST", "/recycle/bulk", gin.H{"action": "purge", "filter": gin.H{"name": ".txt"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"freed":200`)
+	assert.Equal(t, int64(100), storageUsed(db))
+	var trashed int64
+	db.Unscoped().Model(&file.File{}).Where("deleted_at IS NOT NULL").Count(&trashed)
+	assert.Equal(t, int64(0), trashed)
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", "/recycle/bulk", gin.H{"action": "restore"}).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", "/recycle/bulk", gin.H{"action": "move", "ids": []string{"a"}}).Code)
+}
+
+func TestRecycleBinBulkHandler_FilterRespectsLimit(t *testing.T) {
+	router, db := setupRecyclePurgeTest(t)
+	router.POST("/recycle/bulk", RecycleBinBulkHandler)
+	deletedAt := gorm.DeletedAt{Time: time.Now(), Valid: true}
+	for i := 0; i <= maxBatchOperations; i++ {
+		id := fmt.Sprintf("t%d", i)
+		db.Create(&file.File{ID: id, Name: id + ".log", Type: "file", ParentID: "root", OwnerID: 1, UploadTime: time.Now(), DeletedAt: deletedAt, DeleteBatch: id})
+	}
+
+	w := doJSON(router, "POST", "/recycle/bulk", gin.H{"action": "purge", "filter": gin.H{"name": ".log"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var trashed int64
+	db.Unscoped().Model(&file.File{}).Where("deleted_at IS NOT NULL").Count(&trashed)
+	assert.Equal(t, int64(maxBatchOperations+1), trashed, "超过上限时不应执行任何操作")
+}
+
+// delRecordingRedis 记录被删除的缓存键
+type delRecordingRedis struct {
+	cache.Client
+	deleted []string
+}
+
+func (r *delRecordingRedis) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	r.deleted = append(r.deleted, keys...)
+	return r.Client.Del(ctx, keys...)
+}
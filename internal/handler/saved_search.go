@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"cloudDrive/internal/file"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SavedSearchRequest 创建或修改保存的搜索
+type SavedSearchRequest struct {
+	Name   string            `json:"name" binding:"required"`
+	Filter file.SearchFilter `json:"filter"`
+}
+
+// SavedSearchItem 保存的搜索及当前符合条件的文件数，Count 仅在请求统计时返回
+type SavedSearchItem struct {
+	file.SavedSearch
+	Count *int64 `json:"count,omitempty"`
+}
+
+// savedSearchError 将保存搜索操作的错误转换为HTTP响应
+func savedSearchError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, file.ErrSavedSearchNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, file.ErrSavedSearchExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, file.ErrInvalidFilter), errors.Is(err, file.ErrInvalidCategory),
+		errors.Is(err, file.ErrTooManySavedSearches):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败", "detail": err.Error()})
+	}
+}
+
+func parseSavedSearchID(c *gin.Context) (uint64, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "保存的搜索ID无效"})
+		return 0, false
+	}
+	return id, true
+}
+
+// @Summary 获取保存的搜索
+// @Description 列出当前用户保存的搜索（智能文件夹），按名称排序；counts=true 时同时返回每个搜索当前的结果数，需登录（Session）
+// @Tags 文件模块
+// @Produce json
+// @Param counts query bool false "是否统计每个搜索的结果数，默认false"
+// @Success 200 {object} map[string]interface{}
+// @Router /saved-searches [get]
+func SavedSearchListHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	searches, err := file.ListSavedSearches(db, userID)
+	if err != nil {
+		savedSearchError(c, err)
+		return
+	}
+	withCounts := c.Query("counts") == "true"
+	now := time.Now()
+	items := make([]SavedSearchItem, len(searches))
+	for i := range searches {
+		items[i].SavedSearch = searches[i]
+		if !withCounts {
+			continue
+		}
+		count, err := file.CountSavedSearch(db, &searches[i], now)
+		if err != nil {
+			savedSearchError(c, err)
+			return
+		}
+		items[i].Count = &count
+	}
+	c.JSON(http.StatusOK, gin.H{"searches": items, "total": len(items)})
+}
+
+// @Summary 保存搜索
+// @Description 将搜索条件保存为智能文件夹，条件与搜索接口的参数相同，within 为相对时间范围，每次打开时重新计算，需登录（Session）
+// @Tags 文件模块
+// @Accept json
+// @Produce json
+// @Param data body SavedSearchRequest true "名称和搜索条件"
+// @Success 200 {object} file.SavedSearch
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /saved-searches [post]
+func SavedSearchCreateHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	var req SavedSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误", "detail": err.Error()})
+		return
+	}
+	s, err := file.CreateSavedSearch(db, userID, req.Name, req.Filter)
+	if err != nil {
+		savedSearchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+// @Summary 获取一条保存的搜索
+// @Description 获取保存的搜索的名称和条件，需登录（Session）
+// @Tags 文件模块
+// @Produce json
+// @Param id path int true "保存的搜索ID"
+// @Success 200 {object} file.SavedSearch
+// @Failure 404 {object} map[string]interface{}
+// @Router /saved-searches/{id} [get]
+func SavedSearchGetHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	id, ok := parseSavedSearchID(c)
+	if !ok {
+		return
+	}
+	s, err := file.GetSavedSearch(db, id, userID)
+	if err != nil {
+		savedSearchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+// @Summary 修改保存的搜索
+// @Description 修改保存的搜索的名称和条件，需登录（Session）
+// @Tags 文件模块
+// @Accept json
+// @Produce json
+// @Param id path int true "保存的搜索ID"
+// @Param data body SavedSearchRequest true "名称和搜索条件"
+// @Success 200 {object} file.SavedSearch
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /saved-searches/{id} [put]
+func SavedSearchUpdateHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	id, ok := parseSavedSearchID(c)
+	if !ok {
+		return
+	}
+	var req SavedSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误", "detail": err.Error()})
+		return
+	}
+	s, err := file.UpdateSavedSearch(db, id, userID, req.Name, req.Filter)
+	if err != nil {
+		savedSearchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+// @Summary 删除保存的搜索
+// @Description 删除保存的搜索，不影响其中的文件，需登录（Session）
+// @Tags 文件模块
+// @Produce json
+// @Param id path int true "保存的搜索ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /saved-searches/{id} [delete]
+func SavedSearchDeleteHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	id, ok := parseSavedSearchID(c)
+	if !ok {
+		return
+	}
+	if err := file.DeleteSavedSearch(db, id, userID); err != nil {
+		savedSearchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// @Summary 打开保存的搜索
+// @Description 按保存的条件实时搜索，与搜索接口的结果格式和分页方式相同，第一页返回总数和分面统计，需登录（Session）
+// @Tags 文件模块
+// @Produce json
+// @Param id path int true "保存的搜索ID"
+// @Param cursor query string false "分页游标，取上一页返回的next_cursor，为空表示第一页"
+// @Param page_size query int false "每页数量，默认10，最大100"
+// @Success 200 {object} file.SearchResponse
+// @Failure 404 {object} map[string]interface{}
+// @Router /saved-searches/{id}/files [get]
+func SavedSearchFilesHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	id, ok := parseSavedSearchID(c)
+	if !ok {
+		return
+	}
+	s, err := file.GetSavedSearch(db, id, userID)
+	if err != nil {
+		savedSearchError(c, err)
+		return
+	}
+	searchResponse(c, db, s.Filter.Request(userID, time.Now()))
+}
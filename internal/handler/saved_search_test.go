@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"cloudDrive/internal/file"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSavedSearchHandlers(t *testing.T) {
+	db := setupTestDB(t)
+	db.AutoMigrate(&file.SavedSearch{})
+	now := time.Now()
+	for _, f := range []file.File{
+		{ID: "root", Name: "root", Type: "folder", OwnerID: 1},
+		{ID: "a", Name: "a.pdf", Hash: "big", Type: "file", ParentID: "root", OwnerID: 1, UploadTime: now},
+		{ID: "b", Name: "b.pdf", Hash: "big", Type: "file", ParentID: "root", OwnerID: 1, UploadTime: now.Add(-time.Minute)},
+		{ID: "c", Name: "c.pdf", Hash: "big", Type: "file", ParentID: "root", OwnerID: 1, UploadTime: now.AddDate(-2, 0, 0)},
+		{ID: "d", Name: "d.pdf", Hash: "small", Type: "file", ParentID: "root", OwnerID: 1, UploadTime: now},
+	} {
+		db.Create(&f)
+	}
+	db.Create(&file.FileContent{Hash: "big", Size: 20 << 20})
+	db.Create(&file.FileContent{Hash: "small", Size: 1 << 20})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("db", db)
+		c.Set("user_id", uint(1))
+		c.Next()
+	})
+	router.GET("/saved-searches", SavedSearchListHandler)
+	router.POST("/saved-searches", SavedSearchCreateHandler)
+	router.GET("/saved-searches/:id", SavedSearchGetHandler)
+	router.PUT("/saved-searches/:id", SavedSearchUpdateHandler)
+	router.DELETE("/saved-searches/:id", SavedSearchDeleteHandler)
+	router.GET("/saved-searches/:id/files", SavedSearchFilesHandler)
+
+	body := gin.H{"name": "最近30天大于10MB的PDF", "filter": gin.H{"exts": []string{"pdf"}, "min_size": 10 << 20, "within": "30d"}}
+	w := doJSON(router, "POST", "/saved-searches", body)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var saved file.SavedSearch
+	json.Unmarshal(w.Body.Bytes(), &saved)
+	path := "/saved-searches/" + strconv.FormatUint(saved.ID, 10)
+	assert.Equal(t, http.StatusConflict, doJSON(router, "POST", "/saved-searches", body).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", "/saved-searches",
+		gin.H{"name": "x", "filter": gin.H{"within": "someday"}}).Code)
+
+	// 按保存的条件实时搜索并分页
+	var page file.SearchResponse
+	w = doJSON(router, "GET", path+"/files?page_size=1", nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	json.Unmarshal(w.Body.Bytes(), &page)
+	assert.Equal(t, int64(2), page.Total)
+	if assert.Len(t, page.Files, 1) && assert.NotEmpty(t, page.NextCursor) {
+		assert.Equal(t, "a", page.Files[0].ID)
+		next := file.SearchResponse{}
+		w = doJSON(router, "GET", path+"/files?page_size=1&cursor="+page.NextCursor, nil)
+		json.Unmarshal(w.Body.Bytes(), &next)
+		if assert.Len(t, next.Files, 1) {
+			assert.Equal(t, "b", next.Files[0].ID)
+		}
+		assert.Empty(t, next.NextCursor)
+	}
+
+	var list struct {
+		Searches []SavedSearchItem `json:"searches"`
+	}
+	json.Unmarshal(doJSON(router, "GET", "/saved-searches?counts=true", nil).Body.Bytes(), &list)
+	if assert.Len(t, list.Searches, 1) && assert.NotNil(t, list.Searches[0].Count) {
+		assert.Equal(t, int64(2), *list.Searches[0].Count)
+	}
+
+	w = doJSON(router, "PUT", path, gin.H{"name": "全部PDF", "filter": gin.H{"exts": []string{"pdf"}}})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	page = file.SearchResponse{}
+	json.Unmarshal(doJSON(router, "GET", path+"/files", nil).Body.Bytes(), &page)
+	assert.Equal(t, int64(4), page.Total)
+
+	assert.Equal(t, http.StatusOK, doJSON(router, "DELETE", path, nil).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "GET", path, nil).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "GET", path+"/files", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/saved-searches/abc", nil).Code)
+}
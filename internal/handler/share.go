@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"time"
 
+	"cloudDrive/internal/cache"
 	"cloudDrive/internal/file"
 
 	"math/rand"
@@ -12,7 +13,6 @@ import (
 	"encoding/json"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -76,7 +76,7 @@ func genAccessCode() string {
 // @Router /share/public [post]
 func CreatePublicShareHandler(c *gin.Context) {
 	db := c.MustGet("db").(*gorm.DB)
-	rdb := c.MustGet("redis").(*redis.Client)
+	cc := cacheFrom(c)
 	ctx := context.Background()
 	var req PublicShareRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -116,7 +116,7 @@ func CreatePublicShareHandler(c *gin.Context) {
 		return
 	}
 	// 写入缓存
-	cacheKey := "share:" + token
+	cacheKey := cache.ShareKey(token)
 	resp := PublicShareAccessResponse{
 		ResourceID: f.ID,
 		Name:       f.Name,
@@ -127,7 +127,7 @@ func CreatePublicShareHandler(c *gin.Context) {
 	expire := time.Until(expireAt)
 	if expire > 0 {
 		if data, err := json.Marshal(resp); err == nil {
-			rdb.Set(ctx, cacheKey, data, expire)
+			cc.Set(ctx, cacheKey, data, expire)
 		}
 	}
 	// 返回分享链接
@@ -141,15 +141,15 @@ func CreatePublicShareHandler(c *gin.Context) {
 // AccessPublicShareHandler 公开分享访问接口
 func AccessPublicShareHandler(c *gin.Context) {
 	db := c.MustGet("db").(*gorm.DB)
-	rdb := c.MustGet("redis").(*redis.Client)
+	cc := cacheFrom(c)
 	ctx := context.Background()
 	token := c.Param("token")
-	cacheKey := "share:" + token
+	cacheKey := cache.ShareKey(token)
 
 	// 1. 优先查redis
-	if val, err := rdb.Get(ctx, cacheKey).Result(); err == nil && val != "" {
+	if val, ok := cc.Get(ctx, cacheKey); ok {
 		var resp PublicShareAccessResponse
-		if err := json.Unmarshal([]byte(val), &resp); err == nil {
+		if err := json.Unmarshal(val, &resp); err == nil {
 			c.JSON(http.StatusOK, resp)
 			return
 		}
@@ -182,7 +182,7 @@ func AccessPublicShareHandler(c *gin.Context) {
 	expire := time.Until(share.ExpireAt)
 	if expire > 0 {
 		if data, err := json.Marshal(resp); err == nil {
-			rdb.Set(ctx, cacheKey, data, expire)
+			cc.Set(ctx, cacheKey, data, expire)
 		}
 	}
 	c.JSON(http.StatusOK, resp)
@@ -277,7 +277,7 @@ func GetPublicShareHandler(c *gin.Context) {
 // @Router /share/private [post]
 func CreatePrivateShareHandler(c *gin.Context) {
 	db := c.MustGet("db").(*gorm.DB)
-	rdb := c.MustGet("redis").(*redis.Client)
+	cc := cacheFrom(c)
 	ctx := context.Background()
 	var req PrivateShareRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -309,7 +309,7 @@ func CreatePrivateShareHandler(c *gin.Context) {
 		return
 	}
 	// 写入缓存（不含access_code）
-	cacheKey := "share:" + token
+	cacheKey := cache.ShareKey(token)
 	resp := PublicShareAccessResponse{
 		ResourceID: f.ID,
 		Name:       f.Name,
@@ -320,7 +320,7 @@ func CreatePrivateShareHandler(c *gin.Context) {
 	expire := time.Until(expireAt)
 	if expire > 0 {
 		if data, err := json.Marshal(resp); err == nil {
-			rdb.Set(ctx, cacheKey, data, expire)
+			cc.Set(ctx, cacheKey, data, expire)
 		}
 	}
 	shareLink := c.Request.Host + "/api/share/" + token
@@ -346,15 +346,15 @@ func CreatePrivateShareHandler(c *gin.Context) {
 // @Router /share/{token} [get]
 func AccessShareHandler(c *gin.Context) {
 	db := c.MustGet("db").(*gorm.DB)
-	rdb := c.MustGet("redis").(*redis.Client)
+	cc := cacheFrom(c)
 	ctx := context.Background()
 	token := c.Param("token")
-	cacheKey := "share:" + token
+	cacheKey := cache.ShareKey(token)
 
 	// 1. 优先查redis（仅公开分享和私有分享access_code校验通过后可缓存）
-	if val, err := rdb.Get(ctx, cacheKey).Result(); err == nil && val != "" {
+	if val, ok := cc.Get(ctx, cacheKey); ok {
 		var resp PublicShareAccessResponse
-		if err := json.Unmarshal([]byte(val), &resp); err == nil {
+		if err := json.Unmarshal(val, &resp); err == nil {
 			// 私有分享需校验access_code
 			var share file.Share
 			if err := db.Where("token = ?", token).First(&share).Error; err == nil {
@@ -413,12 +413,36 @@ func AccessShareHandler(c *gin.Context) {
 	expire := time.Until(share.ExpireAt)
 	if expire > 0 {
 		if data, err := json.Marshal(resp); err == nil {
-			rdb.Set(ctx, cacheKey, data, expire)
+			cc.Set(ctx, cacheKey, data, expire)
 		}
 	}
 	c.JSON(200, resp)
 }
 
+// validShare 查找未过期的分享并校验私有分享的访问码，失败时已写入响应
+func validShare(c *gin.Context, db *gorm.DB, token, accessCode string) (*file.Share, bool) {
+	var share file.Share
+	if err := db.Where("token = ?", token).First(&share).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "分享链接不存在"})
+		return nil, false
+	}
+	if time.Now().After(share.ExpireAt) {
+		c.JSON(http.StatusGone, gin.H{"error": "分享链接已过期"})
+		return nil, false
+	}
+	if share.ShareType == "private" {
+		if accessCode == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "需要访问码"})
+			return nil, false
+		}
+		if accessCode != share.AccessCode {
+			c.JSON(http.StatusForbidden, gin.H{"error": "访问码错误"})
+			return nil, false
+		}
+	}
+	return &share, true
+}
+
 // @Summary 查询已有未过期的私有分享
 // @Description 查询指定文件的未过期私有分享链接
 // @Tags 分享
@@ -464,7 +488,7 @@ func GetPrivateShareHandler(c *gin.Context) {
 // @Router /share [delete]
 func CancelShareHandler(c *gin.Context) {
 	db := c.MustGet("db").(*gorm.DB)
-	rdb := c.MustGet("redis").(*redis.Client)
+	cc := cacheFrom(c)
 	ctx := context.Background()
 	userID := c.MustGet("user_id").(uint)
 	token := c.Query("token")
@@ -488,12 +512,11 @@ func CancelShareHandler(c *gin.Context) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "无权限取消该分享"})
 		return
 	}
-	if err := db.Delete(&share).Error; err != nil {
+	if err := db.Unscoped().Delete(&share).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消分享失败"})
 		return
 	}
 	// 删除缓存
-	cacheKey := "share:" + share.Token
-	rdb.Del(ctx, cacheKey)
+	cc.InvalidateShare(ctx, share.Token)
 	c.JSON(http.StatusOK, gin.H{"message": "取消分享成功"})
 }
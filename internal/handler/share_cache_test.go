@@ -3,12 +3,13 @@ package handler
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"testing"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/assert"
+
+	"cloudDrive/internal/cache"
 )
 
 // mockShareData 用于模拟分享信息结构
@@ -21,7 +22,7 @@ var mockShareData = map[string]interface{}{
 }
 
 func getShareCacheKey(token string) string {
-	return fmt.Sprintf("share:%s", token)
+	return cache.ShareKey(token)
 }
 
 func TestShareCache_Hit(t *testing.T) {
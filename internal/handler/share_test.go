@@ -19,7 +19,7 @@ import (
 func setupTestRouter() (*gin.Engine, *gorm.DB, *redis.Client) {
 	gin.SetMode(gin.TestMode)
 	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	db.AutoMigrate(&file.File{}, &file.Share{})
+	db.AutoMigrate(&file.File{}, &file.FileAncestor{}, &file.FileNameToken{}, &file.Tag{}, &file.FileTag{}, &file.Favorite{}, &file.FileMeta{}, &file.Share{})
 	r := gin.Default()
 	// 注入db和redis
 	rdb := redis.NewClient(&redis.Options{
@@ -0,0 +1,321 @@
+package handler
+
+import (
+	"cloudDrive/internal/file"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxLabelFiles 单次打标签、收藏的最大文件数
+const maxLabelFiles = 1000
+
+// TagRequest 创建或修改标签
+type TagRequest struct {
+	Name  string `json:"name" binding:"required"`
+	Color string `json:"color"`
+}
+
+// FileTagsRequest 批量为文件添加或移除标签
+type FileTagsRequest struct {
+	FileIDs []string `json:"file_ids" binding:"required"`
+	TagIDs  []uint64 `json:"tag_ids" binding:"required"`
+}
+
+// FavoritesRequest 批量收藏或取消收藏
+type FavoritesRequest struct {
+	FileIDs []string `json:"file_ids" binding:"required"`
+}
+
+// tagError 将标签和收藏操作的错误转换为HTTP响应
+func tagError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, file.ErrTagNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+	case errors.Is(err, file.ErrTagExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, file.ErrInvalidTag), errors.Is(err, file.ErrTooManyTags):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败", "detail": err.Error()})
+	}
+}
+
+func parseTagID(c *gin.Context) (uint64, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "标签ID无效"})
+		return 0, false
+	}
+	return id, true
+}
+
+// @Summary 获取标签
+// @Description 列出当前用户的所有标签及各自的文件数（不含回收站中的文件），按名称排序，需登录（Session）
+// @Tags 文件模块
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /tags [get]
+func TagListHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	tags, err := file.ListTags(db, userID)
+	if err != nil {
+		tagError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tags": tags, "total": len(tags)})
+}
+
+// @Summary 创建标签
+// @Description 创建标签，名称最长32个字符且不能重复，颜色可选 red、orange、yellow、green、blue、purple、gray，需登录（Session）
+// @Tags 文件模块
+// @Accept json
+// @Produce json
+// @Param data body TagRequest true "名称和颜色"
+// @Success 200 {object} file.Tag
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /tags [post]
+func TagCreateHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	var req TagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误", "detail": err.Error()})
+		return
+	}
+	tag, err := file.CreateTag(db, userID, req.Name, req.Color)
+	if err != nil {
+		tagError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tag)
+}
+
+// @Summary 修改标签
+// @Description 修改标签的名称和颜色，带有该标签的文件随之更新，需登录（Session）
+// @Tags 文件模块
+// @Accept json
+// @Produce json
+// @Param id path int true "标签ID"
+// @Param data body TagRequest true "名称和颜色"
+// @Success 200 {object} file.Tag
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /tags/{id} [put]
+func TagUpdateHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	id, ok := parseTagID(c)
+	if !ok {
+		return
+	}
+	var req TagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误", "detail": err.Error()})
+		return
+	}
+	tag, err := file.UpdateTag(db, id, userID, req.Name, req.Color)
+	if err != nil {
+		tagError(c, err)
+		return
+	}
+	cacheFrom(c).InvalidateFileLists(context.Background(), userID)
+	c.JSON(http.StatusOK, tag)
+}
+
+// @Summary 删除标签
+// @Description 删除标签并从所有文件上移除，不影响文件本身，需登录（Session）
+// @Tags 文件模块
+// @Produce json
+// @Param id path int true "标签ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /tags/{id} [delete]
+func TagDeleteHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	id, ok := parseTagID(c)
+	if !ok {
+		return
+	}
+	if err := file.DeleteTag(db, id, userID); err != nil {
+		tagError(c, err)
+		return
+	}
+	cacheFrom(c).InvalidateFileLists(context.Background(), userID)
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// @Summary 按标签列出文件
+// @Description 列出带有该标签的文件和文件夹，可叠加搜索接口的其他条件，结果格式和分页方式与搜索接口相同，需登录（Session）
+// @Tags 文件模块
+// @Produce json
+// @Param id path int true "标签ID"
+// @Param cursor query string false "分页游标，取上一页返回的next_cursor，为空表示第一页"
+// @Param page_size query int false "每页数量，默认10，最大100"
+// @Success 200 {object} file.SearchResponse
+// @Failure 404 {object} map[string]interface{}
+// @Router /tags/{id}/files [get]
+func TagFilesHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	id, ok := parseTagID(c)
+	if !ok {
+		return
+	}
+	if _, err := file.GetTag(db, id, userID); err != nil {
+		tagError(c, err)
+		return
+	}
+	filter, ok := searchFilterFrom(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	filter.TagIDs = append(filter.TagIDs, id)
+	searchResponse(c, db, filter.Request(userID, time.Now()))
+}
+
+// bindFileTags 解析批量打标签的请求，文件数超过上限时返回 false
+func bindFileTags(c *gin.Context) (FileTagsRequest, bool) {
+	var req FileTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误", "detail": err.Error()})
+		return req, false
+	}
+	if len(req.FileIDs) > maxLabelFiles {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "单次最多操作1000个文件"})
+		return req, false
+	}
+	return req, true
+}
+
+// @Summary 批量添加标签
+// @Description 为一批文件或文件夹添加一批标签，已有的标签忽略；任一文件或标签不存在时不做修改，需登录（Session）
+// @Tags 文件模块
+// @Accept json
+// @Produce json
+// @Param data body FileTagsRequest true "文件ID和标签ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /files/tags [post]
+func FileTagHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	req, ok := bindFileTags(c)
+	if !ok {
+		return
+	}
+	added, err := file.TagFiles(db, userID, req.FileIDs, req.TagIDs)
+	if err != nil {
+		tagError(c, err)
+		return
+	}
+	cacheFrom(c).InvalidateFileLists(context.Background(), userID)
+	c.JSON(http.StatusOK, gin.H{"message": "添加成功", "added": added})
+}
+
+// @Summary 批量移除标签
+// @Description 移除一批文件或文件夹上的一批标签；任一文件或标签不存在时不做修改，需登录（Session）
+// @Tags 文件模块
+// @Accept json
+// @Produce json
+// @Param data body FileTagsRequest true "文件ID和标签ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /files/tags [delete]
+func FileUntagHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	req, ok := bindFileTags(c)
+	if !ok {
+		return
+	}
+	removed, err := file.UntagFiles(db, userID, req.FileIDs, req.TagIDs)
+	if err != nil {
+		tagError(c, err)
+		return
+	}
+	cacheFrom(c).InvalidateFileLists(context.Background(), userID)
+	c.JSON(http.StatusOK, gin.H{"message": "移除成功", "removed": removed})
+}
+
+// @Summary 获取收藏
+// @Description 列出收藏的文件和文件夹，可叠加搜索接口的其他条件，结果格式和分页方式与搜索接口相同，需登录（Session）
+// @Tags 文件模块
+// @Produce json
+// @Param cursor query string false "分页游标，取上一页返回的next_cursor，为空表示第一页"
+// @Param page_size query int false "每页数量，默认10，最大100"
+// @Success 200 {object} file.SearchResponse
+// @Router /favorites [get]
+func FavoriteListHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	filter, ok := searchFilterFrom(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	filter.Starred = true
+	searchResponse(c, db, filter.Request(userID, time.Now()))
+}
+
+// setFavorites 收藏或取消收藏请求中的文件
+func setFavorites(c *gin.Context, starred bool) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	var req FavoritesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误", "detail": err.Error()})
+		return
+	}
+	if len(req.FileIDs) > maxLabelFiles {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "单次最多操作1000个文件"})
+		return
+	}
+	changed, err := file.SetFavorites(db, userID, req.FileIDs, starred)
+	if err != nil {
+		tagError(c, err)
+		return
+	}
+	cacheFrom(c).InvalidateFileLists(context.Background(), userID)
+	c.JSON(http.StatusOK, gin.H{"message": "操作成功", "changed": changed})
+}
+
+// @Summary 批量收藏
+// @Description 收藏一批文件或文件夹，已收藏的忽略；任一文件不存在时不做修改，需登录（Session）
+// @Tags 文件模块
+// @Accept json
+// @Produce json
+// @Param data body FavoritesRequest true "文件ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /favorites [post]
+func FavoriteAddHandler(c *gin.Context) {
+	setFavorites(c, true)
+}
+
+// @Summary 批量取消收藏
+// @Description 取消收藏一批文件或文件夹，需登录（Session）
+// @Tags 文件模块
+// @Accept json
+// @Produce json
+// @Param data body FavoritesRequest true "文件ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /favorites [delete]
+func FavoriteRemoveHandler(c *gin.Context) {
+	setFavorites(c, false)
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"cloudDrive/internal/file"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagAndFavoriteHandlers(t *testing.T) {
+	db := setupTestDB(t)
+	for _, f := range []file.File{
+		{ID: "root", Name: "root", Type: "folder", OwnerID: 1},
+		{ID: "a", Name: "a.pdf", Hash: "h", Type: "file", ParentID: "root", OwnerID: 1},
+		{ID: "b", Name: "b.txt", Hash: "h", Type: "file", ParentID: "root", OwnerID: 1},
+		{ID: "other", Name: "c.txt", Hash: "h", Type: "file", ParentID: "x", OwnerID: 2},
+	} {
+		db.Create(&f)
+	}
+	db.Create(&file.FileContent{Hash: "h", Size: 10})
+
+	rdb := setupTestRedis()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("db", db)
+		c.Set("redis", rdb)
+		c.Set("user_id", uint(1))
+		c.Next()
+	})
+	router.GET("/files/search", FileSearchHandler)
+	router.POST("/files/tags", FileTagHandler)
+	router.DELETE("/files/tags", FileUntagHandler)
+	router.GET("/tags", TagListHandler)
+	router.POST("/tags", TagCreateHandler)
+	router.PUT("/tags/:id", TagUpdateHandler)
+	router.DELETE("/tags/:id", TagDeleteHandler)
+	router.GET("/tags/:id/files", TagFilesHandler)
+	router.GET("/favorites", FavoriteListHandler)
+	router.POST("/favorites", FavoriteAddHandler)
+	router.DELETE("/favorites", FavoriteRemoveHandler)
+
+	w := doJSON(router, "POST", "/tags", gin.H{"name": "报销", "color": "red"})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var tag file.Tag
+	json.Unmarshal(w.Body.Bytes(), &tag)
+	path := "/tags/" + strconv.FormatUint(tag.ID, 10)
+	assert.Equal(t, http.StatusConflict, doJSON(router, "POST", "/tags", gin.H{"name": "报销"}).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", "/tags", gin.H{"name": "x", "color": "#fff"}).Code)
+
+	w = doJSON(router, "POST", "/files/tags", gin.H{"file_ids": []string{"a", "b"}, "tag_ids": []uint64{tag.ID}})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "POST", "/files/tags",
+		gin.H{"file_ids": []string{"other"}, "tag_ids": []uint64{tag.ID}}).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "POST", "/files/tags",
+		gin.H{"file_ids": []string{"a"}, "tag_ids": []uint64{999}}).Code)
+
+	var resp file.SearchResponse
+	w = doJSON(router, "GET", path+"/files?ext=pdf", nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if assert.Len(t, resp.Files, 1) && assert.Len(t, resp.Files[0].Tags, 1) {
+		assert.Equal(t, "a", resp.Files[0].ID)
+		assert.Equal(t, "red", resp.Files[0].Tags[0].Color)
+	}
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "GET", "/tags/999/files", nil).Code)
+
+	assert.Equal(t, http.StatusOK, doJSON(router, "POST", "/favorites", gin.H{"file_ids": []string{"b"}}).Code)
+	resp = file.SearchResponse{}
+	json.Unmarshal(doJSON(router, "GET", "/favorites", nil).Body.Bytes(), &resp)
+	if assert.Len(t, resp.Files, 1) {
+		assert.Equal(t, "b", resp.Files[0].ID)
+		assert.True(t, resp.Files[0].Starred)
+	}
+	resp = file.SearchResponse{}
+	json.Unmarshal(doJSON(router, "GET", "/files/search?starred=true&tags="+strconv.FormatUint(tag.ID, 10), nil).Body.Bytes(), &resp)
+	assert.Len(t, resp.Files, 1)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/files/search?tags=abc", nil).Code)
+
+	assert.Equal(t, http.StatusOK, doJSON(router, "DELETE", "/favorites", gin.H{"file_ids": []string{"b"}}).Code)
+	w = doJSON(router, "DELETE", "/files/tags", gin.H{"file_ids": []string{"a"}, "tag_ids": []uint64{tag.ID}})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var list struct {
+		Tags []file.TagSummary `json:"tags"`
+	}
+	json.Unmarshal(doJSON(router, "GET", "/tags", nil).Body.Bytes(), &list)
+	if assert.Len(t, list.Tags, 1) {
+		assert.Equal(t, int64(1), list.Tags[0].FileCount)
+	}
+	assert.Equal(t, http.StatusOK, doJSON(router, "PUT", path, gin.H{"name": "发票", "color": "green"}).Code)
+	assert.Equal(t, http.StatusOK, doJSON(router, "DELETE", path, nil).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "DELETE", path, nil).Code)
+}
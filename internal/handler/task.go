@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"cloudDrive/internal/task"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TaskManagerKey 用于在gin上下文中获取异步任务管理器的键
+const TaskManagerKey = "tasks"
+
+// @Summary 查询异步任务
+// @Description 查询异步任务的状态、进度和结果，需登录（Session）
+// @Tags 任务
+// @Produce json
+// @Param id path string true "任务ID"
+// @Success 200 {object} task.Task
+// @Failure 404 {object} map[string]interface{}
+// @Router /tasks/{id} [get]
+func TaskGetHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	t, err := task.Get(db, c.Param("id"), userID)
+	if err != nil {
+		if err == task.ErrTaskNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "任务不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询任务失败", "detail": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+// @Summary 异步任务列表
+// @Description 分页列出当前用户的异步任务，按创建时间倒序，需登录（Session）
+// @Tags 任务
+// @Produce json
+// @Param page query int false "页码，默认1"
+// @Param page_size query int false "每页数量，默认20"
+// @Success 200 {object} map[string]interface{}
+// @Router /tasks [get]
+func TaskListHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	tasks, total, err := task.List(db, userID, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询任务失败", "detail": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tasks": tasks, "total": total})
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"cloudDrive/internal/file"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type breadcrumb struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// breadcrumbsOf 返回文件从用户根目录下第一级到自身的路径及其字符串形式，用户根目录不计入
+func breadcrumbsOf(db *gorm.DB, id string) ([]breadcrumb, string, error) {
+	ancestors, err := file.Ancestors(db, id)
+	if err != nil {
+		return nil, "", err
+	}
+	crumbs := []breadcrumb{}
+	names := []string{}
+	for _, f := range ancestors {
+		if f.ParentID == "" {
+			continue
+		}
+		crumbs = append(crumbs, breadcrumb{ID: f.ID, Name: f.Name, Type: f.Type})
+		names = append(names, f.Name)
+	}
+	return crumbs, "/" + strings.Join(names, "/"), nil
+}
+
+// @Summary 按路径查找文件
+// @Description 按 /Projects/2024/report.pdf 形式的路径从根目录逐级查找文件/文件夹，返回文件信息和面包屑，需登录（Session）
+// @Tags 文件模块
+// @Produce json
+// @Param path query string true "文件路径，/ 表示根目录"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /files/resolve [get]
+func FileResolveHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	p := c.Query("path")
+	if p == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	f, err := file.ResolvePath(db, userID, p)
+	if err != nil {
+		if errors.Is(err, file.ErrPathNotFound) || errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": file.ErrPathNotFound.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查找路径失败", "detail": err.Error()})
+		return
+	}
+	crumbs, path, err := breadcrumbsOf(db, f.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查找路径失败", "detail": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"file": f, "path": path, "breadcrumbs": crumbs})
+}
+
+// ownedFile 查找当前用户的文件/文件夹，失败时已写入响应
+func ownedFile(c *gin.Context, db *gorm.DB, userID uint, id string) (*file.File, bool) {
+	var f file.File
+	if err := db.First(&f, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+		return nil, false
+	}
+	if f.OwnerID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权限访问该文件"})
+		return nil, false
+	}
+	return &f, true
+}
+
+// @Summary 面包屑导航
+// @Description 一次查询返回文件/文件夹从根目录到自身的完整路径，需登录（Session）
+// @Tags 文件模块
+// @Produce json
+// @Param id path string true "文件/文件夹ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /files/{id}/breadcrumbs [get]
+func FileBreadcrumbsHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	f, ok := ownedFile(c, db, userID, c.Param("id"))
+	if !ok {
+		return
+	}
+	crumbs, path, err := breadcrumbsOf(db, f.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询路径失败", "detail": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"path": path, "breadcrumbs": crumbs})
+}
+
+// @Summary 列出子树
+// @Description 分页列出文件夹下所有层级的文件/文件夹，按层数和名称排序，需登录（Session）
+// @Tags 文件模块
+// @Produce json
+// @Param id path string true "文件夹ID"
+// @Param depth query int false "最大层数，默认不限"
+// @Param type query string false "类型过滤：file、folder"
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量，最大1000"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /files/{id}/subtree [get]
+func FileSubtreeHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	f, ok := ownedFile(c, db, userID, c.Param("id"))
+	if !ok {
+		return
+	}
+	if f.Type != "folder" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只能列出文件夹的子树"})
+		return
+	}
+	depth, _ := strconv.Atoi(c.Query("depth"))
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "100"))
+	files, total, err := file.ListSubtree(db, file.SubtreeQuery{
+		RootID:   f.ID,
+		MaxDepth: depth,
+		Type:     c.Query("type"),
+		Page:     page,
+		PageSize: pageSize,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询子树失败", "detail": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"files": files, "total": total})
+}
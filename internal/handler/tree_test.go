@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileTreeHandlers(t *testing.T) {
+	router, _ := setupBatchTest(t, 1000)
+	router.GET("/files/resolve", FileResolveHandler)
+	router.GET("/files/:id/breadcrumbs", FileBreadcrumbsHandler)
+	router.GET("/files/:id/subtree", FileSubtreeHandler)
+
+	w := doJSON(router, "GET", "/files/resolve?path=/docs/a.txt", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resolved struct {
+		File struct {
+			ID string `json:"id"`
+		} `json:"file"`
+		Path        string       `json:"path"`
+		Breadcrumbs []breadcrumb `json:"breadcrumbs"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resolved)
+	assert.Equal(t, "docs-a", resolved.File.ID)
+	assert.Equal(t, "/docs/a.txt", resolved.Path)
+	assert.Len(t, resolved.Breadcrumbs, 2)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "GET", "/files/resolve?path=/docs/missing.txt", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/files/resolve", nil).Code)
+
+	w = doJSON(router, "GET", "/files/docs-a/breadcrumbs", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"path":"/docs/a.txt"`)
+	assert.Equal(t, http.StatusForbidden, doJSON(router, "GET", "/files/other/breadcrumbs", nil).Code)
+
+	w = doJSON(router, "GET", "/files/root/subtree?type=file", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"total":3`)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/files/a/subtree", nil).Code)
+}
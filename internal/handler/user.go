@@ -1,17 +1,15 @@
 package handler
 
 import (
+	"cloudDrive/internal/cache"
 	"cloudDrive/internal/user"
 	"net/http"
 
 	"context"
 	"encoding/json"
-	"fmt"
-	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
 )
 
@@ -37,10 +35,7 @@ func RegisterHandler(c *gin.Context) {
 		return
 	}
 	// 清理缓存
-	rdb := c.MustGet("redis").(*redis.Client)
-	ctx := context.Background()
-	cacheKey := fmt.Sprintf("user:info:%d", resp.ID)
-	rdb.Del(ctx, cacheKey)
+	cacheFrom(c).InvalidateUserInfo(context.Background(), resp.ID)
 	c.JSON(http.StatusOK, gin.H{"id": resp.ID})
 }
 
@@ -70,10 +65,7 @@ func LoginHandler(c *gin.Context) {
 	session.Set("user_id", resp.User.ID)
 	session.Save()
 	// 清理缓存
-	rdb := c.MustGet("redis").(*redis.Client)
-	ctx := context.Background()
-	cacheKey := fmt.Sprintf("user:info:%d", resp.User.ID)
-	rdb.Del(ctx, cacheKey)
+	cacheFrom(c).InvalidateUserInfo(context.Background(), resp.User.ID)
 	c.JSON(http.StatusOK, gin.H{"user": resp.User})
 }
 
@@ -104,30 +96,35 @@ func LogoutHandler(c *gin.Context) {
 // @Failure 401 {object} map[string]interface{}
 // @Router /user/storage [get]
 func UserStorageHandler(c *gin.Context) {
-	db := c.MustGet("db").(*gorm.DB)
-	rdb := c.MustGet("redis").(*redis.Client)
 	userID := c.MustGet("user_id").(uint)
-	ctx := context.Background()
-	cacheKey := fmt.Sprintf("user:info:%d", userID)
-
-	var u user.User
-	if val, err := rdb.Get(ctx, cacheKey).Result(); err == nil {
-		if err := json.Unmarshal([]byte(val), &u); err == nil {
-			c.JSON(http.StatusOK, gin.H{"storage_used": u.StorageUsed, "storage_limit": u.StorageLimit})
-			return
-		}
-	}
-	uPtr, err := user.GetUserByID(db, userID)
+	u, err := cachedUserInfo(c, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "用户不存在"})
 		return
 	}
-	u = *uPtr
-	data, _ := json.Marshal(u)
-	rdb.Set(ctx, cacheKey, data, time.Hour)
 	c.JSON(http.StatusOK, gin.H{"storage_used": u.StorageUsed, "storage_limit": u.StorageLimit})
 }
 
+// cachedUserInfo 读取用户信息，优先使用缓存
+func cachedUserInfo(c *gin.Context, userID uint) (*user.User, error) {
+	db := c.MustGet("db").(*gorm.DB)
+	data, err := cacheFrom(c).Fetch(context.Background(), cache.UserInfoKey(userID), cache.UserInfoTTL, func() ([]byte, error) {
+		u, err := user.GetUserByID(db, userID)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(u)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var u user.User
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
 // @Summary 获取当前用户信息
 // @Description 获取当前登录用户的基本信息
 // @Tags 用户模块
@@ -137,28 +134,12 @@ func UserStorageHandler(c *gin.Context) {
 // @Failure 401 {object} map[string]interface{}
 // @Router /user/me [get]
 func UserMeHandler(c *gin.Context) {
-	db := c.MustGet("db").(*gorm.DB)
-	rdb := c.MustGet("redis").(*redis.Client)
 	userID := c.MustGet("user_id").(uint)
-	ctx := context.Background()
-	cacheKey := fmt.Sprintf("user:info:%d", userID)
-
-	var u user.User
-	if val, err := rdb.Get(ctx, cacheKey).Result(); err == nil {
-		if err := json.Unmarshal([]byte(val), &u); err == nil {
-			u.Password = ""
-			c.JSON(http.StatusOK, gin.H{"user": u})
-			return
-		}
-	}
-	uPtr, err := user.GetUserByID(db, userID)
+	u, err := cachedUserInfo(c, userID)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户不存在"})
 		return
 	}
-	u = *uPtr
-	data, _ := json.Marshal(u)
-	rdb.Set(ctx, cacheKey, data, time.Hour)
 	u.Password = ""
 	c.JSON(http.StatusOK, gin.H{"user": u})
 }
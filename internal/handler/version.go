@@ -0,0 +1,294 @@
+package handler
+
+import (
+	"cloudDrive/internal/cache"
+	"cloudDrive/internal/file"
+	"cloudDrive/internal/storage"
+	"cloudDrive/internal/user"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// overwriteWithVersion 在事务中用新内容覆盖文件，原内容保存为历史版本，
+// 并按用户策略清理旧版本；配额增加新内容大小，扣除被清理版本的大小
+func overwriteWithVersion(tx *gorm.DB, f *file.File, newHash string, newSize int64) error {
+	v, err := file.OverwriteFile(tx, f, newHash)
+	if err != nil || v == nil {
+		return err
+	}
+	policy, err := file.GetVersionPolicy(tx, f.OwnerID)
+	if err != nil {
+		return err
+	}
+	freed, err := file.ApplyVersionRetention(tx, f.ID, policy, time.Now())
+	if err != nil {
+		return err
+	}
+	return user.UpdateUserStorageUsed(tx, f.OwnerID, newSize-freed)
+}
+
+// versionError 将版本操作的错误转换为HTTP响应
+func versionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+	case errors.Is(err, file.ErrVersionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "版本不存在"})
+	case errors.Is(err, file.ErrNoPermission):
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权限访问该文件"})
+	case errors.Is(err, file.ErrNotAFile):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只有文件支持历史版本"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败", "detail": err.Error()})
+	}
+}
+
+func parseVersionID(c *gin.Context) (uint64, bool) {
+	vid, err := strconv.ParseUint(c.Param("vid"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "版本ID无效"})
+		return 0, false
+	}
+	return vid, true
+}
+
+// @Summary 获取文件历史版本
+// @Description 列出文件的历史版本，按版本号倒序，需登录（Session）
+// @Tags 文件模块
+// @Produce json
+// @Param id path string true "文件ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /files/{id}/versions [get]
+func FileVersionListHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	versions, err := file.ListVersions(db, c.Param("id"), userID)
+	if err != nil {
+		versionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"versions": versions, "total": len(versions)})
+}
+
+// @Summary 下载文件历史版本
+// @Description 下载文件的指定历史版本，需登录（Session）
+// @Tags 文件模块
+// @Produce application/octet-stream
+// @Param id path string true "文件ID"
+// @Param vid path int true "版本ID"
+// @Success 200 {file} file
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /files/{id}/versions/{vid}/download [get]
+func FileVersionDownloadHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	stor := c.MustGet(StorageKey).(storage.Storage)
+	vid, ok := parseVersionID(c)
+	if !ok {
+		return
+	}
+	f, v, err := file.GetVersion(db, c.Param("id"), vid, userID)
+	if err != nil {
+		versionError(c, err)
+		return
+	}
+	rc, err := stor.Download(c.Request.Context(), v.Hash)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "版本内容不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取版本内容失败", "detail": err.Error()})
+		return
+	}
+	defer rc.Close()
+	c.DataFromReader(http.StatusOK, v.Size, "application/octet-stream", rc, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%q", f.Name),
+	})
+}
+
+// @Summary 还原文件历史版本
+// @Description 将文件还原为指定历史版本，当前内容保存为新的历史版本，需登录（Session）
+// @Tags 文件模块
+// @Produce json
+// @Param id path string true "文件ID"
+// @Param vid path int true "版本ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /files/{id}/versions/{vid}/restore [post]
+func FileVersionRestoreHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	vid, ok := parseVersionID(c)
+	if !ok {
+		return
+	}
+	var f *file.File
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		f, err = file.RestoreVersion(tx, c.Param("id"), vid, userID)
+		return err
+	})
+	if err != nil {
+		versionError(c, err)
+		return
+	}
+	clearFileCaches(c, userID, f)
+	c.JSON(http.StatusOK, gin.H{"message": "还原成功", "id": f.ID, "hash": f.Hash})
+}
+
+// @Summary 删除文件历史版本
+// @Description 删除文件的指定历史版本并释放其占用的空间，需登录（Session）
+// @Tags 文件模块
+// @Produce json
+// @Param id path string true "文件ID"
+// @Param vid path int true "版本ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /files/{id}/versions/{vid} [delete]
+func FileVersionDeleteHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	vid, ok := parseVersionID(c)
+	if !ok {
+		return
+	}
+	var freed int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		freed, err = file.DeleteVersion(tx, c.Param("id"), vid, userID)
+		if err != nil {
+			return err
+		}
+		return user.UpdateUserStorageUsed(tx, userID, -freed)
+	})
+	if err != nil {
+		versionError(c, err)
+		return
+	}
+	// 历史版本不影响目录列表，只需清理元数据和用户信息
+	cc := cacheFrom(c)
+	cc.InvalidateFileMeta(context.Background(), c.Param("id"))
+	cc.InvalidateUserInfo(context.Background(), userID)
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功", "freed": freed})
+}
+
+// @Summary 获取版本保留策略
+// @Description 获取当前用户的历史版本保留策略，未设置时返回默认策略，需登录（Session）
+// @Tags 用户模块
+// @Produce json
+// @Success 200 {object} file.VersionPolicy
+// @Router /user/version-policy [get]
+func VersionPolicyGetHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	policy, err := file.GetVersionPolicy(db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询保留策略失败", "detail": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// @Summary 设置版本保留策略
+// @Description 设置每个文件保留的历史版本数和保留天数（0表示不限制），保存后立即按新策略清理，需登录（Session）
+// @Tags 用户模块
+// @Accept json
+// @Produce json
+// @Param keep_versions body int true "每个文件最多保留的历史版本数"
+// @Param keep_days body int true "历史版本保留天数"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /user/version-policy [put]
+func VersionPolicyUpdateHandler(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := c.MustGet("user_id").(uint)
+	var req struct {
+		KeepVersions *int `json:"keep_versions"`
+		KeepDays     *int `json:"keep_days"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.KeepVersions == nil || req.KeepDays == nil ||
+		*req.KeepVersions < 0 || *req.KeepDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	var policy *file.VersionPolicy
+	var freed int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		policy, err = file.SetVersionPolicy(tx, userID, *req.KeepVersions, *req.KeepDays)
+		if err != nil {
+			return err
+		}
+		freed, err = file.PurgeExpiredVersions(tx, userID, time.Now())
+		if err != nil {
+			return err
+		}
+		return user.UpdateUserStorageUsed(tx, userID, -freed)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存保留策略失败", "detail": err.Error()})
+		return
+	}
+	if freed > 0 {
+		cacheFrom(c).InvalidateUserInfo(context.Background(), userID)
+	}
+	c.JSON(http.StatusOK, gin.H{"policy": policy, "freed": freed})
+}
+
+// PurgeExpiredVersions 对所有用户执行版本保留策略，清理过期版本并释放配额，释放了空间的用户清理用户信息缓存
+func PurgeExpiredVersions(db *gorm.DB, cc *cache.Cache) error {
+	owners, err := file.ListVersionOwners(db)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, ownerID := range owners {
+		var freed int64
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			freed, err = file.PurgeExpiredVersions(tx, ownerID, now)
+			if err != nil || freed == 0 {
+				return err
+			}
+			return user.UpdateUserStorageUsed(tx, ownerID, -freed)
+		})
+		if err != nil {
+			log.Printf("清理用户 %d 的过期版本失败: %v", ownerID, err)
+			continue
+		}
+		if freed > 0 {
+			cc.InvalidateUserInfo(context.Background(), ownerID)
+		}
+	}
+	return nil
+}
+
+// StartVersionRetention 定期清理过期的历史版本，直到ctx取消
+func StartVersionRetention(ctx context.Context, db *gorm.DB, cc *cache.Cache, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := PurgeExpiredVersions(db, cc); err != nil {
+				log.Printf("清理过期版本失败: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"cloudDrive/internal/cache"
+	"cloudDrive/internal/file"
+	"cloudDrive/internal/storage"
+	"cloudDrive/internal/user"
+)
+
+func setupVersionTest(t *testing.T) (*gin.Engine, *gorm.DB) {
+	db := setupTestDB(t)
+	db.Create(&user.User{ID: 1, Username: "testuser", StorageLimit: 1024 * 1024})
+	db.Create(&file.UserRoot{UserID: 1, RootID: "root-id", CreatedAt: time.Now()})
+
+	stor := storage.NewMemoryStorage()
+	rdb := setupTestRedis()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("db", db)
+		c.Set("redis", rdb)
+		c.Set("user_id", uint(1))
+		c.Set(StorageKey, stor)
+		c.Next()
+	})
+	router.POST("/files/upload", FileUploadHandler)
+	router.POST("/files/multipart/init", MultipartInitHandler)
+	router.GET("/files/:id/versions", FileVersionListHandler)
+	router.GET("/files/:id/versions/:vid/download", FileVersionDownloadHandler)
+	router.POST("/files/:id/versions/:vid/restore", FileVersionRestoreHandler)
+	router.DELETE("/files/:id/versions/:vid", FileVersionDeleteHandler)
+	router.PUT("/user/version-policy", VersionPolicyUpdateHandler)
+	return router, db
+}
+
+func doJSON(router *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req, _ := http.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func storageUsed(db *gorm.DB) int64 {
+	var u user.User
+	db.First(&u, 1)
+	return u.StorageUsed
+}
+
+func listVersions(t *testing.T, router *gin.Engine, fileID string) []file.FileVersion {
+	w := doJSON(router, "GET", "/files/"+fileID+"/versions", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Versions []file.FileVersion `json:"versions"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp.Versions
+}
+
+func TestFileVersions_UploadRestoreDelete(t *testing.T) {
+	router, db := setupVersionTest(t)
+	v1, v2 := []byte("first"), []byte("second version")
+
+	w := doUpload(router, "report.txt", v1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var first map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &first)
+	fileID := first["id"].(string)
+
+	t.Run("同名上传生成历史版本", func(t *testing.T) {
+		w := doUpload(router, "report.txt", v2)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		assert.Equal(t, fileID, resp["id"])
+		assert.Equal(t, true, resp["overwritten"])
+
+		var count int64
+		db.Model(&file.File{}).Where("name = ?", "report.txt").Count(&count)
+		assert.Equal(t, int64(1), count, "不应产生重复文件记录")
+		versions := listVersions(t, router, fileID)
+		assert.Len(t, versions, 1)
+		assert.Equal(t, contentHash(v1), versions[0].Hash)
+		assert.Equal(t, int64(len(v1)+len(v2)), storageUsed(db), "历史版本计入配额")
+	})
+
+	t.Run("相同内容重复上传不产生版本", func(t *testing.T) {
+		w := doUpload(router, "report.txt", v2)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, listVersions(t, router, fileID), 1)
+		assert.Equal(t, int64(len(v1)+len(v2)), storageUsed(db))
+	})
+
+	t.Run("下载历史版本", func(t *testing.T) {
+		versions := listVersions(t, router, fileID)
+		w := doJSON(router, "GET", fmt.Sprintf("/files/%s/versions/%d/download", fileID, versions[0].ID), nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, v1, w.Body.Bytes())
+	})
+
+	t.Run("还原历史版本配额不变", func(t *testing.T) {
+		versions := listVersions(t, router, fileID)
+		w := doJSON(router, "POST", fmt.Sprintf("/files/%s/versions/%d/restore", fileID, versions[0].ID), nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var f file.File
+		db.First(&f, "id = ?", fileID)
+		assert.Equal(t, contentHash(v1), f.Hash)
+		versions = listVersions(t, router, fileID)
+		assert.Len(t, versions, 1)
+		assert.Equal(t, contentHash(v2), versions[0].Hash)
+		assert.Equal(t, int64(len(v1)+len(v2)), storageUsed(db))
+	})
+
+	t.Run("删除历史版本释放配额", func(t *testing.T) {
+		versions := listVersions(t, router, fileID)
+		w := doJSON(router, "DELETE", fmt.Sprintf("/files/%s/versions/%d", fileID, versions[0].ID), nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, listVersions(t, router, fileID))
+		assert.Equal(t, int64(len(v1)), storageUsed(db))
+
+		w = doJSON(router, "DELETE", fmt.Sprintf("/files/%s/versions/%d", fileID, versions[0].ID), nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("无权限", func(t *testing.T) {
+		other := &file.File{Name: "other.txt", Hash: contentHash(v1), Type: "file", ParentID: "x", OwnerID: 2, UploadTime: time.Now()}
+		db.Create(other)
+		w := doJSON(router, "GET", "/files/"+other.ID+"/versions", nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestFileVersions_RetentionPolicy(t *testing.T) {
+	router, db := setupVersionTest(t)
+	contents := [][]byte{[]byte("a"), []byte("bb"), []byte("ccc"), []byte("dddd")}
+	var fileID string
+	for _, content := range contents {
+		w := doUpload(router, "notes.txt", content)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		fileID = resp["id"].(string)
+	}
+	assert.Len(t, listVersions(t, router, fileID), 3)
+	assert.Equal(t, int64(1+2+3+4), storageUsed(db))
+
+	t.Run("参数错误", func(t *testing.T) {
+		w := doJSON(router, "PUT", "/user/version-policy", map[string]int{"keep_versions": -1, "keep_days": 0})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("收紧策略后立即清理", func(t *testing.T) {
+		w := doJSON(router, "PUT", "/user/version-policy", map[string]int{"keep_versions": 1, "keep_days": 0})
+		assert.Equal(t, http.StatusOK, w.Code)
+		versions := listVersions(t, router, fileID)
+		assert.Len(t, versions, 1)
+		assert.Equal(t, contentHash(contents[2]), versions[0].Hash)
+		assert.Equal(t, int64(3+4), storageUsed(db))
+	})
+
+	t.Run("覆盖时按策略清理", func(t *testing.T) {
+		w := doUpload(router, "notes.txt", []byte("eeeee"))
+		assert.Equal(t, http.StatusOK, w.Code)
+		versions := listVersions(t, router, fileID)
+		assert.Len(t, versions, 1)
+		assert.Equal(t, contentHash(contents[3]), versions[0].Hash)
+		assert.Equal(t, int64(4+5), storageUsed(db))
+	})
+
+	t.Run("定期清理过期版本", func(t *testing.T) {
+		doJSON(router, "PUT", "/user/version-policy", map[string]int{"keep_versions": 0, "keep_days": 7})
+		db.Model(&file.FileVersion{}).Where("file_id = ?", fileID).Update("created_at", time.Now().AddDate(0, 0, -8))
+		rdb := &delRecordingRedis{Client: setupTestRedis()}
+		assert.NoError(t, PurgeExpiredVersions(db, cache.New(rdb)))
+		assert.Empty(t, listVersions(t, router, fileID))
+		assert.Equal(t, int64(5), storageUsed(db))
+		assert.Contains(t, rdb.deleted, cache.UserInfoKey(1), "释放配额后应清理用户信息缓存")
+	})
+}
+
+func TestMultipartInit_InstantUpload_Overwrite(t *testing.T) {
+	router, db := setupVersionTest(t)
+	old := []byte("old content")
+	w := doUpload(router, "same.txt", old)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	fileID := resp["id"].(string)
+	db.Create(&file.FileContent{Hash: "instant-hash", Size: 64})
+
+	req := map[string]interface{}{"name": "same.txt", "size": 64, "hash": "instant-hash", "total_parts": 1}
+	w = doJSON(router, "POST", "/files/multipart/init", req)
+	assert.Equal(t, http.StatusConflict, w.Code, "默认仍返回冲突")
+
+	req["overwrite"] = true
+	w = doJSON(router, "POST", "/files/multipart/init", req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, fileID, resp["file_id"])
+
+	versions := listVersions(t, router, fileID)
+	assert.Len(t, versions, 1)
+	assert.Equal(t, contentHash(old), versions[0].Hash)
+	assert.Equal(t, int64(len(old)+64), storageUsed(db))
+}
@@ -36,6 +36,12 @@ type MetricsCollector struct {
 	FileUploadSize        *prometheus.HistogramVec
 	FileDownloadSize      *prometheus.HistogramVec
 
+	// 存储读缓存指标
+	BlobCacheRequests  *prometheus.CounterVec
+	BlobCacheBytes     *prometheus.CounterVec
+	BlobCacheEvictions prometheus.Counter
+	BlobCacheSize      prometheus.Gauge
+
 	// 系统指标
 	SystemMemoryUsage prometheus.Gauge
 	SystemCPUUsage    prometheus.Gauge
@@ -188,6 +194,34 @@ func NewMetricsCollector() *MetricsCollector {
 			[]string{"user_id"},
 		),
 
+		// 存储读缓存指标
+		BlobCacheRequests: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "blob_cache_requests_total",
+				Help: "Total number of blob cache lookups",
+			},
+			[]string{"result"},
+		),
+		BlobCacheBytes: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "blob_cache_bytes_total",
+				Help: "Total bytes served from blob cache or fetched from origin storage",
+			},
+			[]string{"source"},
+		),
+		BlobCacheEvictions: promauto.NewCounter(
+			prometheus.CounterOpts{
+				Name: "blob_cache_evictions_total",
+				Help: "Total number of blobs evicted from cache",
+			},
+		),
+		BlobCacheSize: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "blob_cache_size_bytes",
+				Help: "Current blob cache size in bytes",
+			},
+		),
+
 		// 系统指标
 		SystemMemoryUsage: promauto.NewGauge(
 			prometheus.GaugeOpts{
@@ -307,6 +341,28 @@ func (c *MetricsCollector) RecordFileDownload(userID string, size int64) {
 	c.FileDownloadSize.WithLabelValues(userID).Observe(float64(size))
 }
 
+// RecordBlobCacheHit 记录读缓存命中及从缓存读取的字节数
+func (c *MetricsCollector) RecordBlobCacheHit(size int64) {
+	c.BlobCacheRequests.WithLabelValues("hit").Inc()
+	c.BlobCacheBytes.WithLabelValues("cache").Add(float64(size))
+}
+
+// RecordBlobCacheMiss 记录读缓存未命中及从源存储拉取的字节数
+func (c *MetricsCollector) RecordBlobCacheMiss(size int64) {
+	c.BlobCacheRequests.WithLabelValues("miss").Inc()
+	c.BlobCacheBytes.WithLabelValues("origin").Add(float64(size))
+}
+
+// RecordBlobCacheEviction 记录读缓存淘汰
+func (c *MetricsCollector) RecordBlobCacheEviction() {
+	c.BlobCacheEvictions.Inc()
+}
+
+// UpdateBlobCacheSize 更新读缓存当前大小
+func (c *MetricsCollector) UpdateBlobCacheSize(size int64) {
+	c.BlobCacheSize.Set(float64(size))
+}
+
 // UpdateSystemMetrics 更新系统指标
 func (c *MetricsCollector) UpdateSystemMetrics(memoryUsage uint64, cpuUsage, diskUsage float64, goroutines int) {
 	c.SystemMemoryUsage.Set(float64(memoryUsage))
@@ -154,3 +154,15 @@ func TestDefaultCollector(t *testing.T) {
 		DefaultCollector.DecActiveRequests()
 	})
 }
+
+func TestRecordBlobCache(t *testing.T) {
+	collector := GetDefaultCollector()
+
+	// 记录读缓存指标，不应该panic
+	assert.NotPanics(t, func() {
+		collector.RecordBlobCacheHit(1024)
+		collector.RecordBlobCacheMiss(2048)
+		collector.RecordBlobCacheEviction()
+		collector.UpdateBlobCacheSize(4096)
+	})
+}
@@ -0,0 +1,108 @@
+// Package pinyin 汉字转不带声调的拼音，用于文件名的全拼和首字母搜索
+//
+// pinyin.txt 每行为一个音节及读该音的汉字，收录约 1.9 万字，覆盖 GB2312 全部汉字；
+// 多音字在表中只出现一次，取最常用的读音，常见的其他读音见 heteronyms
+package pinyin
+
+import (
+	_ "embed"
+	"strings"
+	"sync"
+)
+
+//go:embed pinyin.txt
+var data string
+
+var (
+	once  sync.Once
+	table map[rune]string
+)
+
+// heteronyms 常见多音字除表中读音外的其他读音，如 银行(hang)、长大(zhang)
+var heteronyms = map[rune][]string{
+	'行': {"hang"}, '长': {"zhang"}, '重': {"chong"}, '乐': {"yue"}, '还': {"hai"},
+	'藏': {"zang"}, '朝': {"zhao"}, '传': {"zhuan"}, '单': {"shan"}, '都': {"dou"},
+	'便': {"pian"}, '差': {"chai", "ci"}, '参': {"shen", "cen"}, '大': {"dai"}, '地': {"de"},
+	'省': {"xing"}, '称': {"chen"}, '查': {"zha"}, '给': {"ji"}, '校': {"jiao"},
+	'解': {"xie"}, '薄': {"bao"}, '血': {"xie"}, '系': {"ji"}, '仇': {"qiu"},
+	'朴': {"piao"}, '奇': {"ji"}, '盛': {"cheng"}, '曾': {"zeng"}, '区': {"ou"},
+	'角': {"jue"}, '觉': {"jiao"}, '降': {"xiang"}, '了': {"liao"}, '着': {"zhao", "zhuo"},
+	'得': {"dei"}, '的': {"di"}, '调': {"tiao"}, '会': {"kuai"}, '率': {"shuai"},
+	'模': {"mu"}, '露': {"lou"}, '削': {"xue"}, '厦': {"sha"}, '什': {"shi"},
+	'拓': {"ta"}, '扎': {"za"}, '刨': {"pao"}, '粘': {"nian"}, '纤': {"qian"},
+	'谁': {"shui"}, '沈': {"chen"}, '剥': {"bao"}, '尽': {"jin"}, '数': {"shuo"},
+}
+
+func load() {
+	table = make(map[rune]string, 20000)
+	for _, line := range strings.Split(data, "\n") {
+		syllable, chars, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		for _, r := range chars {
+			table[r] = syllable
+		}
+	}
+}
+
+// Readings 返回汉字的所有读音，第一个为最常用的读音；不在表中的字返回 nil
+func Readings(r rune) []string {
+	once.Do(load)
+	s, ok := table[r]
+	if !ok {
+		return nil
+	}
+	others := heteronyms[r]
+	if len(others) == 0 {
+		return []string{s}
+	}
+	readings := make([]string, 0, len(others)+1)
+	readings = append(readings, s)
+	for _, o := range others {
+		if o != s {
+			readings = append(readings, o)
+		}
+	}
+	return readings
+}
+
+// Spell 返回一串汉字的全拼和首字母，多音字按读音展开，结果最多 limit 种，超出时舍弃靠后的读音组合；
+// 不在表中的字跳过
+func Spell(chars []rune, limit int) (full, initials []string) {
+	full, initials = []string{""}, []string{""}
+	for _, r := range chars {
+		readings := Readings(r)
+		if len(readings) == 0 {
+			continue
+		}
+		nextFull := make([]string, 0, limit)
+		nextInitials := make([]string, 0, limit)
+		for _, reading := range readings {
+			for i := range full {
+				if len(nextFull) >= limit {
+					break
+				}
+				nextFull = append(nextFull, full[i]+reading)
+				nextInitials = append(nextInitials, initials[i]+reading[:1])
+			}
+		}
+		full, initials = nextFull, nextInitials
+	}
+	if full[0] == "" {
+		return nil, nil
+	}
+	return full, dedupe(initials)
+}
+
+func dedupe(s []string) []string {
+	seen := make(map[string]bool, len(s))
+	out := s[:0]
+	for _, v := range s {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
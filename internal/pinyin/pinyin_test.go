@@ -0,0 +1,39 @@
+package pinyin
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReadings(t *testing.T) {
+	for r, want := range map[rune][]string{
+		'年': {"nian"},
+		'绿': {"lv"},
+		'行': {"xing", "hang"},
+		'a': nil,
+	} {
+		if got := Readings(r); !reflect.DeepEqual(got, want) {
+			t.Errorf("%c: got %v, want %v", r, got, want)
+		}
+	}
+}
+
+func TestSpell(t *testing.T) {
+	full, initials := Spell([]rune("年度报告"), 4)
+	if !reflect.DeepEqual(full, []string{"niandubaogao"}) || !reflect.DeepEqual(initials, []string{"ndbg"}) {
+		t.Errorf("got %v %v", full, initials)
+	}
+	full, initials = Spell([]rune("银行长"), 4)
+	if !reflect.DeepEqual(full, []string{"yinxingchang", "yinhangchang", "yinxingzhang", "yinhangzhang"}) ||
+		!reflect.DeepEqual(initials, []string{"yxc", "yhc", "yxz", "yhz"}) {
+		t.Errorf("heteronyms: %v %v", full, initials)
+	}
+	// 超出上限时舍弃靠后的读音组合
+	full, _ = Spell([]rune("长长长"), 2)
+	if !reflect.DeepEqual(full, []string{"changchangchang", "zhangchangchang"}) {
+		t.Errorf("limit: %v", full)
+	}
+	if full, initials := Spell([]rune("𠀀"), 4); full != nil || initials != nil {
+		t.Errorf("unknown: %v %v", full, initials)
+	}
+}
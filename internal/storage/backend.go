@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// MinioConfig MinIO存储配置
+type MinioConfig struct {
+	Endpoint  string `mapstructure:"endpoint"`
+	AccessKey string `mapstructure:"access_key"`
+	SecretKey string `mapstructure:"secret_key"`
+	Bucket    string `mapstructure:"bucket"`
+	UseSSL    bool   `mapstructure:"use_ssl"`
+}
+
+// ChunkServerConfig 块存储服务客户端配置
+type ChunkServerConfig struct {
+	URL     string `mapstructure:"url"`
+	TempDir string `mapstructure:"temp_dir"`
+}
+
+// BackendConfig 存储后端配置
+// Type 取值 local/minio/chunk_server/memory，memory 仅用于测试和本地开发
+type BackendConfig struct {
+	Type        string            `mapstructure:"type"`
+	LocalDir    string            `mapstructure:"local_dir"`
+	Minio       MinioConfig       `mapstructure:"minio"`
+	ChunkServer ChunkServerConfig `mapstructure:"chunk_server"`
+}
+
+// NewBackend 根据配置创建存储后端
+func NewBackend(cfg BackendConfig) (Storage, error) {
+	switch cfg.Type {
+	case "local":
+		if cfg.LocalDir == "" {
+			return nil, fmt.Errorf("本地存储目录不能为空")
+		}
+		if err := os.MkdirAll(cfg.LocalDir, 0755); err != nil {
+			return nil, fmt.Errorf("创建本地存储目录失败: %v", err)
+		}
+		return &LocalFileStorage{Dir: cfg.LocalDir}, nil
+	case "minio":
+		return NewMinioStorage(
+			cfg.Minio.Endpoint,
+			cfg.Minio.AccessKey,
+			cfg.Minio.SecretKey,
+			cfg.Minio.Bucket,
+			cfg.Minio.UseSSL,
+		)
+	case "chunk_server":
+		tempDir := cfg.ChunkServer.TempDir
+		if tempDir == "" {
+			tempDir = filepath.Join(os.TempDir(), "chunk_client")
+		}
+		if err := os.MkdirAll(tempDir, 0755); err != nil {
+			return nil, fmt.Errorf("创建块存储服务临时目录失败: %v", err)
+		}
+		return NewChunkServerStorage(cfg.ChunkServer.URL, nil, tempDir)
+	case "memory":
+		return NewMemoryStorage(), nil
+	default:
+		return nil, fmt.Errorf("不支持的存储类型: %s", cfg.Type)
+	}
+}
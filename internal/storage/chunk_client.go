@@ -15,12 +15,16 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/golang-jwt/jwt/v4"
 )
 
+// InventoryTokenScope 对象清单令牌的scope声明值
+const InventoryTokenScope = "inventory"
+
 // ChunkServerStorage 存储服务客户端
 type ChunkServerStorage struct {
 	BaseURL     string        // 存储服务基础URL
@@ -29,6 +33,8 @@ type ChunkServerStorage struct {
 	TempDir     string        // 临时目录
 	SecretKey   string        // JWT密钥
 	HTTPClient  *http.Client  // HTTP客户端
+
+	uploads sync.Map // uploadID -> fileID，用于未传入令牌时为分片上传签发令牌
 }
 
 // NewChunkServerStorage 创建存储服务客户端
@@ -63,7 +69,10 @@ func (c *ChunkServerStorage) Upload(ctx context.Context, key string, content io.
 	if err != nil {
 		return fmt.Errorf("创建临时文件失败: %v", err)
 	}
-	defer file.Close()
+	defer func() {
+		file.Close()
+		os.Remove(tempFile)
+	}()
 
 	// 将内容写入临时文件
 	if _, err := io.Copy(file, content); err != nil {
@@ -84,9 +93,6 @@ func (c *ChunkServerStorage) Upload(ctx context.Context, key string, content io.
 		return fmt.Errorf("上传文件失败: %v", err)
 	}
 
-	// 删除临时文件
-	os.Remove(tempFile)
-
 	return nil
 }
 
@@ -99,15 +105,26 @@ func (c *ChunkServerStorage) Download(ctx context.Context, key string) (io.ReadC
 	}
 
 	// 构建下载URL
-	downloadURL := fmt.Sprintf("%s/download?token=%s", c.BaseURL, url.QueryEscape(token))
+	params := url.Values{}
+	params.Set("file_id", key)
+	params.Set("token", token)
+	downloadURL := fmt.Sprintf("%s/download?%s", c.BaseURL, params.Encode())
 
 	// 发送HTTP请求
-	resp, err := c.HTTPClient.Get(downloadURL)
+	req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建下载请求失败: %v", err)
+	}
+	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("发送下载请求失败: %v", err)
 	}
 
 	// 检查响应状态
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrObjectNotFound
+	}
 	if resp.StatusCode != http.StatusOK {
 		resp.Body.Close()
 		return nil, fmt.Errorf("下载失败，状态码: %d", resp.StatusCode)
@@ -142,6 +159,112 @@ func (c *ChunkServerStorage) Delete(ctx context.Context, key string) error {
 	return nil
 }
 
+// Stat 实现Storage接口的Stat方法
+func (c *ChunkServerStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	resp, err := c.doInventoryRequest(ctx, "GET", "/api/objects/"+url.PathEscape(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrObjectNotFound
+	}
+	var result struct {
+		Code    int        `json:"code"`
+		Message string     `json:"message"`
+		Data    ObjectInfo `json:"data"`
+	}
+	if err := decodeChunkServerResponse(resp, &result); err != nil {
+		return nil, err
+	}
+	if result.Code != 0 {
+		return nil, fmt.Errorf("查询对象失败: %s", result.Message)
+	}
+	return &result.Data, nil
+}
+
+// Exists 实现Storage接口的Exists方法
+func (c *ChunkServerStorage) Exists(ctx context.Context, key string) (bool, error) {
+	resp, err := c.doInventoryRequest(ctx, "HEAD", "/api/objects/"+url.PathEscape(key), nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("查询对象失败，状态码: %d", resp.StatusCode)
+	}
+}
+
+// List 实现Storage接口的List方法
+func (c *ChunkServerStorage) List(ctx context.Context, prefix string, marker string, limit int) (*ListResult, error) {
+	params := url.Values{}
+	params.Set("prefix", prefix)
+	params.Set("marker", marker)
+	params.Set("limit", strconv.Itoa(limit))
+	resp, err := c.doInventoryRequest(ctx, "GET", "/api/objects", params)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Code    int        `json:"code"`
+		Message string     `json:"message"`
+		Data    ListResult `json:"data"`
+	}
+	if err := decodeChunkServerResponse(resp, &result); err != nil {
+		return nil, err
+	}
+	if result.Code != 0 {
+		return nil, fmt.Errorf("列举对象失败: %s", result.Message)
+	}
+	return &result.Data, nil
+}
+
+// doInventoryRequest 携带清单令牌请求块存储服务的对象清单接口
+func (c *ChunkServerStorage) doInventoryRequest(ctx context.Context, method, path string, params url.Values) (*http.Response, error) {
+	token, err := c.GenerateInventoryToken(300)
+	if err != nil {
+		return nil, fmt.Errorf("生成清单令牌失败: %v", err)
+	}
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("token", token)
+
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s%s?%s", c.BaseURL, path, params.Encode()), nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("发送请求失败: %v", err)
+	}
+	return resp, nil
+}
+
+// decodeChunkServerResponse 校验状态码并解析块存储服务的JSON响应
+func decodeChunkServerResponse(resp *http.Response, v interface{}) error {
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取响应体失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("请求失败，状态码: %d，响应: %s", resp.StatusCode, string(bodyBytes))
+	}
+	if err := json.Unmarshal(bodyBytes, v); err != nil {
+		return fmt.Errorf("解析响应失败: %v，响应内容: %s", err, string(bodyBytes))
+	}
+	return nil
+}
+
 // InitMultipartUpload 实现Storage接口的InitMultipartUpload方法
 func (c *ChunkServerStorage) InitMultipartUpload(ctx context.Context, fileID string, filename string) (string, error) {
 	// 构建初始化URL
@@ -216,6 +339,7 @@ func (c *ChunkServerStorage) InitMultipartUpload(ctx context.Context, fileID str
 		c.PublicURL = chunkServerResp.Data.ServerURL
 	}
 
+	c.uploads.Store(uploadID, fileID)
 	return uploadID, nil
 }
 
@@ -262,13 +386,25 @@ func (c *ChunkServerStorage) UploadPart(ctx context.Context, uploadID string, pa
 		return "", fmt.Errorf("添加partNumber字段失败: %v", err)
 	}
 
-	// 如果提供了token，添加token字段
+	// 优先使用调用方提供的token，否则自行签发上传令牌
+	var token string
 	if len(options) > 0 {
-		if token, ok := options[0].(string); ok && token != "" {
-			if err := writer.WriteField("token", token); err != nil {
-				return "", fmt.Errorf("添加token字段失败: %v", err)
-			}
+		token, _ = options[0].(string)
+	}
+	if token == "" {
+		fileID := uploadID
+		if v, ok := c.uploads.Load(uploadID); ok {
+			fileID = v.(string)
 		}
+		token, err = c.GenerateUploadToken(map[string]interface{}{
+			"file_id": fileID,
+		}, 3600)
+		if err != nil {
+			return "", fmt.Errorf("生成上传令牌失败: %v", err)
+		}
+	}
+	if err := writer.WriteField("token", token); err != nil {
+		return "", fmt.Errorf("添加token字段失败: %v", err)
 	}
 
 	// 添加文件字段
@@ -368,15 +504,32 @@ func (c *ChunkServerStorage) CompleteMultipartUpload(ctx context.Context, upload
 		return "", fmt.Errorf("完成分片上传失败，状态码: %d，响应: %s", resp.StatusCode, string(bodyBytes))
 	}
 
-	// 解析响应
+	// 解析响应，块存储服务将结果放在data中；兼容旧版直接返回file_hash的格式
 	var result struct {
+		Code     int    `json:"code"`
+		Message  string `json:"message"`
 		FileHash string `json:"file_hash"`
+		Data     struct {
+			FileID   string `json:"file_id"`
+			FileHash string `json:"file_hash"`
+		} `json:"data"`
 	}
 	if err := json.Unmarshal(bodyBytes, &result); err != nil {
 		return "", fmt.Errorf("解析响应失败: %v，响应内容: %s", err, string(bodyBytes))
 	}
+	if result.Code != 0 {
+		return "", fmt.Errorf("完成分片上传失败: %s", result.Message)
+	}
+	c.uploads.Delete(uploadID)
 
-	return result.FileHash, nil
+	switch {
+	case result.Data.FileID != "":
+		return result.Data.FileID, nil
+	case result.Data.FileHash != "":
+		return result.Data.FileHash, nil
+	default:
+		return result.FileHash, nil
+	}
 }
 
 // ListUploadedParts 实现Storage接口的ListUploadedParts方法
@@ -445,8 +598,9 @@ func (c *ChunkServerStorage) GenerateUploadToken(uploadInfo map[string]interface
 
 // GenerateDownloadToken 生成下载令牌
 func (c *ChunkServerStorage) GenerateDownloadToken(fileHash string, filename string, expireSeconds int) (string, error) {
-	// 创建令牌
+	// 创建令牌，块存储服务按file_id校验下载请求
 	claims := jwt.MapClaims{
+		"file_id":   fileHash,
 		"file_hash": fileHash,
 		"filename":  filename,
 		"exp":       time.Now().Add(time.Duration(expireSeconds) * time.Second).Unix(),
@@ -461,6 +615,17 @@ func (c *ChunkServerStorage) GenerateDownloadToken(fileHash string, filename str
 	return tokenString, nil
 }
 
+// GenerateInventoryToken 生成对象清单令牌，用于Stat/Exists/List等只读管理接口
+func (c *ChunkServerStorage) GenerateInventoryToken(expireSeconds int) (string, error) {
+	claims := jwt.MapClaims{
+		"scope": InventoryTokenScope,
+		"exp":   time.Now().Add(time.Duration(expireSeconds) * time.Second).Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(c.SecretKey))
+}
+
 // GetBaseURL 获取块存储服务的基础URL
 func (c *ChunkServerStorage) GetBaseURL() string {
 	return c.BaseURL
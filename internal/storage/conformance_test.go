@@ -0,0 +1,77 @@
+package storage_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"cloudDrive/internal/storage"
+	"cloudDrive/internal/storage/storagetest"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestConformance_Memory(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return storage.NewMemoryStorage()
+	})
+}
+
+func TestConformance_LocalFile(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return &storage.LocalFileStorage{Dir: t.TempDir()}
+	})
+}
+
+func TestConformance_FaultInjectingDisabled(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return storage.NewFaultInjectingStorage(storage.NewMemoryStorage(), storage.FaultConfig{})
+	})
+}
+
+func TestConformance_DualWrite(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return storage.NewDualWriteStorage(&storage.LocalFileStorage{Dir: t.TempDir()}, storage.NewMemoryStorage())
+	})
+}
+
+// TestConformance_Minio 需要可用的MinIO，通过 MINIO_TEST_ENDPOINT 等环境变量指定，未设置时跳过
+func TestConformance_Minio(t *testing.T) {
+	endpoint := os.Getenv("MINIO_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("未设置 MINIO_TEST_ENDPOINT，跳过MinIO一致性测试")
+	}
+	accessKey := os.Getenv("MINIO_TEST_ACCESS_KEY")
+	secretKey := os.Getenv("MINIO_TEST_SECRET_KEY")
+
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		bucket := fmt.Sprintf("conformance-%d", time.Now().UnixNano())
+		s, err := storage.NewMinioStorage(endpoint, accessKey, secretKey, bucket, false)
+		if err != nil {
+			t.Fatalf("连接MinIO失败: %v", err)
+		}
+		s.TmpDir = t.TempDir()
+		t.Cleanup(func() {
+			ctx := context.Background()
+			for obj := range s.Client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Recursive: true}) {
+				if obj.Err == nil {
+					s.Client.RemoveObject(ctx, bucket, obj.Key, minio.RemoveObjectOptions{})
+				}
+			}
+			s.Client.RemoveBucket(ctx, bucket)
+		})
+		return s
+	})
+}
+
+func TestConformance_DiskCache(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		s, err := storage.NewDiskCacheStorage(storage.NewMemoryStorage(), t.TempDir(), 1<<30)
+		if err != nil {
+			t.Fatalf("创建读缓存失败: %v", err)
+		}
+		return s
+	})
+}
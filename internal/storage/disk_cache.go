@@ -0,0 +1,452 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+
+	"cloudDrive/internal/metrics"
+)
+
+// ErrCacheDigestMismatch 源存储返回的内容与hash不符
+var ErrCacheDigestMismatch = errors.New("源对象内容与hash不一致")
+
+// hashKeyPattern 内容寻址的key为SHA-256十六进制串，只有这类key会被缓存
+var hashKeyPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// cacheEntry LRU中的缓存项
+type cacheEntry struct {
+	key  string
+	size int64
+}
+
+// cacheFill 进行中的缓存填充，源存储的数据边写入临时文件边提供给读取方，
+// 并发未命中的请求跟随同一次填充读取
+type cacheFill struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	tmpPath  string // 临时文件创建后才可跟随读取
+	written  int64
+	finished bool
+	err      error
+}
+
+func newCacheFill() *cacheFill {
+	fill := &cacheFill{}
+	fill.cond = sync.NewCond(&fill.mu)
+	return fill
+}
+
+// fillReader 跟随缓存填充读取临时文件，读到已写入位置时等待更多数据
+// 内容与hash不一致时，在读完已写入的数据后返回 ErrCacheDigestMismatch
+type fillReader struct {
+	ctx  context.Context
+	fill *cacheFill
+	file *os.File
+	off  int64
+	stop func() bool
+}
+
+func (r *fillReader) Read(p []byte) (int, error) {
+	fill := r.fill
+	fill.mu.Lock()
+	for r.off >= fill.written && !fill.finished && r.ctx.Err() == nil {
+		fill.cond.Wait()
+	}
+	written, err := fill.written, fill.err
+	fill.mu.Unlock()
+
+	if r.off < written {
+		if remain := written - r.off; int64(len(p)) > remain {
+			p = p[:remain]
+		}
+		n, readErr := r.file.ReadAt(p, r.off)
+		r.off += int64(n)
+		if readErr == io.EOF && n > 0 {
+			readErr = nil
+		}
+		return n, readErr
+	}
+	if ctxErr := r.ctx.Err(); ctxErr != nil {
+		return 0, ctxErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return 0, io.EOF
+}
+
+func (r *fillReader) Close() error {
+	r.stop()
+	return r.file.Close()
+}
+
+// DiskCacheStorage 基于本地磁盘的读缓存装饰器
+// 对象以hash为key且内容不可变，因此只需在本实例的写入和删除时失效；
+// 超过容量上限时按LRU淘汰，并发未命中同一对象时只从源存储拉取一次，且边拉取边返回数据
+type DiskCacheStorage struct {
+	inner    Storage
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	lru     *list.List // 头部为最近使用
+	entries map[string]*list.Element
+	size    int64
+	fills   map[string]*cacheFill
+}
+
+// NewDiskCacheStorage 创建磁盘读缓存，会加载目录中已有的缓存文件
+func NewDiskCacheStorage(inner Storage, dir string, maxBytes int64) (*DiskCacheStorage, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("缓存容量必须大于0")
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "tmp"), 0755); err != nil {
+		return nil, fmt.Errorf("创建缓存目录失败: %v", err)
+	}
+	d := &DiskCacheStorage{
+		inner:    inner,
+		dir:      dir,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+		fills:    map[string]*cacheFill{},
+	}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Unwrap 返回被缓存的源存储
+func (d *DiskCacheStorage) Unwrap() Storage {
+	return d.inner
+}
+
+// load 按修改时间恢复已有缓存文件的LRU顺序，并清理上次遗留的临时文件
+func (d *DiskCacheStorage) load() error {
+	os.RemoveAll(filepath.Join(d.dir, "tmp"))
+	if err := os.MkdirAll(filepath.Join(d.dir, "tmp"), 0755); err != nil {
+		return fmt.Errorf("创建缓存临时目录失败: %v", err)
+	}
+	files, err := os.ReadDir(d.dir)
+	if err != nil {
+		return fmt.Errorf("读取缓存目录失败: %v", err)
+	}
+	var infos []os.FileInfo
+	for _, f := range files {
+		if f.IsDir() || !hashKeyPattern.MatchString(f.Name()) {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().After(infos[j].ModTime())
+	})
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, info := range infos {
+		d.entries[info.Name()] = d.lru.PushBack(&cacheEntry{key: info.Name(), size: info.Size()})
+		d.size += info.Size()
+	}
+	d.evictLocked()
+	return nil
+}
+
+// Size 返回当前缓存占用的字节数
+func (d *DiskCacheStorage) Size() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.size
+}
+
+func (d *DiskCacheStorage) path(key string) string {
+	return filepath.Join(d.dir, key)
+}
+
+// evictLocked 淘汰最久未使用的对象直到不超过容量，调用方需持有锁
+func (d *DiskCacheStorage) evictLocked() {
+	for d.size > d.maxBytes {
+		elem := d.lru.Back()
+		if elem == nil {
+			break
+		}
+		d.removeLocked(elem)
+		metrics.DefaultCollector.RecordBlobCacheEviction()
+	}
+	metrics.DefaultCollector.UpdateBlobCacheSize(d.size)
+}
+
+// removeLocked 删除缓存项及其文件，调用方需持有锁
+// 已打开的文件句柄在删除后仍可继续读取
+func (d *DiskCacheStorage) removeLocked(elem *list.Element) {
+	entry := d.lru.Remove(elem).(*cacheEntry)
+	delete(d.entries, entry.key)
+	d.size -= entry.size
+	os.Remove(d.path(entry.key))
+}
+
+// invalidate 使缓存中的对象失效
+func (d *DiskCacheStorage) invalidate(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if elem, ok := d.entries[key]; ok {
+		d.removeLocked(elem)
+		metrics.DefaultCollector.UpdateBlobCacheSize(d.size)
+	}
+}
+
+// openCached 打开已缓存的对象并标记为最近使用
+func (d *DiskCacheStorage) openCached(key string) (io.ReadCloser, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	elem, ok := d.entries[key]
+	if !ok {
+		return nil, false
+	}
+	f, err := os.Open(d.path(key))
+	if err != nil {
+		// 缓存文件被外部删除，丢弃该项
+		d.removeLocked(elem)
+		return nil, false
+	}
+	d.lru.MoveToFront(elem)
+	metrics.DefaultCollector.RecordBlobCacheHit(elem.Value.(*cacheEntry).size)
+	return f, true
+}
+
+// Download 优先从缓存读取，未命中时边从源存储拉取边写入缓存
+// 大小未知或超过缓存容量的对象直接透传，不会为了填充缓存而多拉取一次
+func (d *DiskCacheStorage) Download(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	if !hashKeyPattern.MatchString(fileID) {
+		return d.inner.Download(ctx, fileID)
+	}
+	if rc, ok := d.openCached(fileID); ok {
+		return rc, nil
+	}
+	info, err := d.inner.Stat(ctx, fileID)
+	if err != nil || info.Size > d.maxBytes {
+		if err == nil {
+			metrics.DefaultCollector.RecordBlobCacheMiss(info.Size)
+		}
+		return d.inner.Download(ctx, fileID)
+	}
+
+	d.mu.Lock()
+	fill, inFlight := d.fills[fileID]
+	if !inFlight {
+		fill = newCacheFill()
+		d.fills[fileID] = fill
+	}
+	d.mu.Unlock()
+
+	if !inFlight {
+		if err := d.startFill(ctx, fileID, fill); err != nil {
+			return nil, err
+		}
+	}
+	return d.follow(ctx, fileID, fill)
+}
+
+// follow 跟随进行中的填充读取；填充已结束时改为读取缓存或源存储
+func (d *DiskCacheStorage) follow(ctx context.Context, key string, fill *cacheFill) (io.ReadCloser, error) {
+	fill.mu.Lock()
+	for fill.tmpPath == "" && !fill.finished {
+		fill.cond.Wait()
+	}
+	if fill.finished {
+		err := fill.err
+		fill.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		if rc, ok := d.openCached(key); ok {
+			return rc, nil
+		}
+		// 刚被淘汰，直接从源存储读取
+		return d.inner.Download(ctx, key)
+	}
+	// 完成时临时文件的改名或删除也在 fill.mu 下进行，此时路径一定有效
+	f, err := os.Open(fill.tmpPath)
+	fill.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("打开缓存文件失败: %v", err)
+	}
+	r := &fillReader{ctx: ctx, fill: fill, file: f}
+	r.stop = context.AfterFunc(ctx, func() {
+		fill.mu.Lock()
+		fill.cond.Broadcast()
+		fill.mu.Unlock()
+	})
+	return r, nil
+}
+
+// DownloadRange 已缓存时从缓存文件读取，否则直接按范围读取源存储
+// 范围读取通常只需要大对象的一小部分（如zip中央目录），不触发缓存填充
+func (d *DiskCacheStorage) DownloadRange(ctx context.Context, fileID string, offset, length int64) (io.ReadCloser, error) {
+	if hashKeyPattern.MatchString(fileID) {
+		if rc, ok := d.openCached(fileID); ok {
+			f := rc.(*os.File)
+			return readCloser{Reader: io.NewSectionReader(f, offset, length), Closer: f}, nil
+		}
+	}
+	return DownloadRange(ctx, d.inner, fileID, offset, length)
+}
+
+// startFill 创建临时文件并打开源对象，随后在后台写入缓存
+// 填充不跟随单个请求取消，避免影响跟随同一对象的其他请求
+func (d *DiskCacheStorage) startFill(ctx context.Context, key string, fill *cacheFill) error {
+	tmp, err := os.CreateTemp(filepath.Join(d.dir, "tmp"), key+"-*")
+	if err != nil {
+		err = fmt.Errorf("创建缓存文件失败: %v", err)
+		d.finishFill(key, fill, "", err)
+		return err
+	}
+	fill.mu.Lock()
+	fill.tmpPath = tmp.Name()
+	fill.cond.Broadcast()
+	fill.mu.Unlock()
+
+	rc, err := d.inner.Download(context.WithoutCancel(ctx), key)
+	if err != nil {
+		tmp.Close()
+		d.finishFill(key, fill, tmp.Name(), err)
+		return err
+	}
+	go d.runFill(key, fill, rc, tmp)
+	return nil
+}
+
+// runFill 将源对象写入临时文件并通知读取方，结束后校验内容与hash一致再放入缓存
+func (d *DiskCacheStorage) runFill(key string, fill *cacheFill, rc io.ReadCloser, tmp *os.File) {
+	defer rc.Close()
+	h := sha256.New()
+	buf := make([]byte, 32<<10)
+	var err error
+	for {
+		n, readErr := rc.Read(buf)
+		if n > 0 {
+			if _, werr := tmp.Write(buf[:n]); werr != nil {
+				err = fmt.Errorf("写入缓存文件失败: %v", werr)
+				break
+			}
+			h.Write(buf[:n])
+			fill.mu.Lock()
+			fill.written += int64(n)
+			fill.cond.Broadcast()
+			fill.mu.Unlock()
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			err = readErr
+			break
+		}
+	}
+	if closeErr := tmp.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("写入缓存文件失败: %v", closeErr)
+	}
+	if err == nil {
+		metrics.DefaultCollector.RecordBlobCacheMiss(fill.written)
+		if hex.EncodeToString(h.Sum(nil)) != key {
+			err = ErrCacheDigestMismatch
+		}
+	}
+	d.finishFill(key, fill, tmp.Name(), err)
+}
+
+// finishFill 结束填充：成功时把临时文件放入缓存，否则删除，并唤醒所有读取方
+func (d *DiskCacheStorage) finishFill(key string, fill *cacheFill, tmpPath string, err error) {
+	fill.mu.Lock()
+	defer fill.mu.Unlock()
+	d.mu.Lock()
+	delete(d.fills, key)
+	cached := false
+	if err == nil && fill.written <= d.maxBytes {
+		if renameErr := os.Rename(tmpPath, d.path(key)); renameErr != nil {
+			log.Printf("写入读缓存失败: %v", renameErr)
+		} else {
+			if elem, ok := d.entries[key]; ok {
+				d.removeLocked(elem)
+			}
+			d.entries[key] = d.lru.PushFront(&cacheEntry{key: key, size: fill.written})
+			d.size += fill.written
+			d.evictLocked()
+			cached = true
+		}
+	}
+	d.mu.Unlock()
+	if !cached && tmpPath != "" {
+		os.Remove(tmpPath)
+	}
+	fill.finished = true
+	fill.err = err
+	fill.cond.Broadcast()
+}
+
+// Upload 写入源存储，并使缓存中的同名对象失效
+func (d *DiskCacheStorage) Upload(ctx context.Context, fileID string, reader io.Reader) error {
+	defer d.invalidate(fileID)
+	return d.inner.Upload(ctx, fileID, reader)
+}
+
+// Delete 删除源存储中的对象，并使缓存失效
+func (d *DiskCacheStorage) Delete(ctx context.Context, fileID string) error {
+	d.invalidate(fileID)
+	return d.inner.Delete(ctx, fileID)
+}
+
+// Stat 查询对象元信息
+func (d *DiskCacheStorage) Stat(ctx context.Context, fileID string) (*ObjectInfo, error) {
+	return d.inner.Stat(ctx, fileID)
+}
+
+// Exists 判断对象是否存在
+func (d *DiskCacheStorage) Exists(ctx context.Context, fileID string) (bool, error) {
+	return d.inner.Exists(ctx, fileID)
+}
+
+// List 分页列举对象
+func (d *DiskCacheStorage) List(ctx context.Context, prefix string, marker string, limit int) (*ListResult, error) {
+	return d.inner.List(ctx, prefix, marker, limit)
+}
+
+// InitMultipartUpload 初始化分片上传
+func (d *DiskCacheStorage) InitMultipartUpload(ctx context.Context, fileID string, filename string) (string, error) {
+	return d.inner.InitMultipartUpload(ctx, fileID, filename)
+}
+
+// UploadPart 上传分片
+func (d *DiskCacheStorage) UploadPart(ctx context.Context, uploadID string, partNumber int, partData io.Reader, options ...interface{}) (string, error) {
+	return d.inner.UploadPart(ctx, uploadID, partNumber, partData, options...)
+}
+
+// CompleteMultipartUpload 完成分片上传，并使缓存中的目标对象失效
+func (d *DiskCacheStorage) CompleteMultipartUpload(ctx context.Context, uploadID string, parts []PartInfo) (string, error) {
+	fileID, err := d.inner.CompleteMultipartUpload(ctx, uploadID, parts)
+	if fileID != "" {
+		d.invalidate(fileID)
+	}
+	return fileID, err
+}
+
+// ListUploadedParts 查询已上传分片
+func (d *DiskCacheStorage) ListUploadedParts(ctx context.Context, uploadID string) ([]int, error) {
+	return d.inner.ListUploadedParts(ctx, uploadID)
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+)
+
+// DualWriteStorage 双写存储装饰器，用于存储后端迁移的切换窗口
+// 读操作只访问主存储；写操作先写主存储，成功后再从主存储复制一份到副存储。
+// 副存储写入失败只记录日志，不影响请求结果，遗漏的对象由迁移工具的对账报告补齐。
+type DualWriteStorage struct {
+	Primary   Storage
+	Secondary Storage
+}
+
+// NewDualWriteStorage 创建双写存储
+func NewDualWriteStorage(primary, secondary Storage) *DualWriteStorage {
+	return &DualWriteStorage{
+		Primary:   primary,
+		Secondary: secondary,
+	}
+}
+
+// Upload 上传文件到主存储，并同步到副存储
+func (d *DualWriteStorage) Upload(ctx context.Context, fileID string, reader io.Reader) error {
+	if err := d.Primary.Upload(ctx, fileID, reader); err != nil {
+		return err
+	}
+	d.replicate(ctx, fileID)
+	return nil
+}
+
+// Download 从主存储下载文件
+func (d *DualWriteStorage) Download(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	return d.Primary.Download(ctx, fileID)
+}
+
+// DownloadRange 从主存储按范围下载文件
+func (d *DualWriteStorage) DownloadRange(ctx context.Context, fileID string, offset, length int64) (io.ReadCloser, error) {
+	return DownloadRange(ctx, d.Primary, fileID, offset, length)
+}
+
+// Delete 同时从主、副存储删除文件，以主存储结果为准
+func (d *DualWriteStorage) Delete(ctx context.Context, fileID string) error {
+	if err := d.Primary.Delete(ctx, fileID); err != nil {
+		return err
+	}
+	if err := d.Secondary.Delete(ctx, fileID); err != nil && !errors.Is(err, ErrObjectNotFound) && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("双写: 删除副存储对象 %s 失败: %v", fileID, err)
+	}
+	return nil
+}
+
+// Stat 查询主存储对象元信息
+func (d *DualWriteStorage) Stat(ctx context.Context, fileID string) (*ObjectInfo, error) {
+	return d.Primary.Stat(ctx, fileID)
+}
+
+// Exists 判断主存储对象是否存在
+func (d *DualWriteStorage) Exists(ctx context.Context, fileID string) (bool, error) {
+	return d.Primary.Exists(ctx, fileID)
+}
+
+// List 列举主存储对象
+func (d *DualWriteStorage) List(ctx context.Context, prefix string, marker string, limit int) (*ListResult, error) {
+	return d.Primary.List(ctx, prefix, marker, limit)
+}
+
+// InitMultipartUpload 在主存储初始化分片上传
+func (d *DualWriteStorage) InitMultipartUpload(ctx context.Context, fileID string, filename string) (string, error) {
+	return d.Primary.InitMultipartUpload(ctx, fileID, filename)
+}
+
+// UploadPart 上传分片到主存储
+func (d *DualWriteStorage) UploadPart(ctx context.Context, uploadID string, partNumber int, partData io.Reader, options ...interface{}) (string, error) {
+	return d.Primary.UploadPart(ctx, uploadID, partNumber, partData, options...)
+}
+
+// CompleteMultipartUpload 在主存储完成分片上传，并将合并后的对象同步到副存储
+func (d *DualWriteStorage) CompleteMultipartUpload(ctx context.Context, uploadID string, parts []PartInfo) (string, error) {
+	fileID, err := d.Primary.CompleteMultipartUpload(ctx, uploadID, parts)
+	if err != nil {
+		return "", err
+	}
+	d.replicate(ctx, fileID)
+	return fileID, nil
+}
+
+// ListUploadedParts 查询主存储已上传分片
+func (d *DualWriteStorage) ListUploadedParts(ctx context.Context, uploadID string) ([]int, error) {
+	return d.Primary.ListUploadedParts(ctx, uploadID)
+}
+
+// replicate 将主存储中的对象复制到副存储
+func (d *DualWriteStorage) replicate(ctx context.Context, fileID string) {
+	reader, err := d.Primary.Download(ctx, fileID)
+	if err != nil {
+		log.Printf("双写: 读取主存储对象 %s 失败: %v", fileID, err)
+		return
+	}
+	defer reader.Close()
+	if err := d.Secondary.Upload(ctx, fileID, reader); err != nil {
+		log.Printf("双写: 写入副存储对象 %s 失败: %v", fileID, err)
+	}
+}
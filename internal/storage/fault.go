@@ -0,0 +1,381 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// ErrInjectedFault 故障注入产生的错误
+var ErrInjectedFault = errors.New("注入的存储故障")
+
+// 可注入故障的操作名，OpAll 对所有未单独配置的操作生效
+const (
+	OpAll               = "*"
+	OpUpload            = "upload"
+	OpDownload          = "download"
+	OpDelete            = "delete"
+	OpStat              = "stat"
+	OpExists            = "exists"
+	OpList              = "list"
+	OpInitMultipart     = "init_multipart"
+	OpUploadPart        = "upload_part"
+	OpCompleteMultipart = "complete_multipart"
+	OpListParts         = "list_parts"
+)
+
+// FaultRule 单个操作的故障规则，各比例取值 0~1
+// ShortReadRate 仅对下载生效，TruncateWriteRate 仅对上传和上传分片生效，BitFlipRate 对上传和下载生效
+type FaultRule struct {
+	Latency           time.Duration `mapstructure:"latency"`
+	ErrorRate         float64       `mapstructure:"error_rate"`
+	ShortReadRate     float64       `mapstructure:"short_read_rate"`
+	TruncateWriteRate float64       `mapstructure:"truncate_write_rate"`
+	BitFlipRate       float64       `mapstructure:"bit_flip_rate"`
+}
+
+// FaultConfig 故障注入配置
+type FaultConfig struct {
+	Enabled    bool                 `mapstructure:"enabled"`
+	Seed       int64                `mapstructure:"seed"`
+	Operations map[string]FaultRule `mapstructure:"operations"`
+}
+
+// FaultInjectingStorage 故障注入存储装饰器，用于弹性测试
+// 可按操作注入延迟、错误、短读、截断写入和比特翻转
+type FaultInjectingStorage struct {
+	inner Storage
+
+	mu     sync.RWMutex
+	config FaultConfig
+	rngMu  sync.Mutex
+	rng    *rand.Rand
+}
+
+// NewFaultInjectingStorage 创建故障注入存储
+func NewFaultInjectingStorage(inner Storage, config FaultConfig) *FaultInjectingStorage {
+	f := &FaultInjectingStorage{inner: inner}
+	f.SetConfig(config)
+	return f
+}
+
+// Unwrap 返回被注入故障的底层存储
+func (f *FaultInjectingStorage) Unwrap() Storage {
+	return f.inner
+}
+
+// ParseFaultConfig 解析YAML格式的故障注入配置
+func ParseFaultConfig(data []byte) (FaultConfig, error) {
+	var config FaultConfig
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return config, err
+	}
+	err := v.Unmarshal(&config)
+	return config, err
+}
+
+// SetConfig 替换故障注入配置，可在运行时调用
+func (f *FaultInjectingStorage) SetConfig(config FaultConfig) {
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	f.mu.Lock()
+	f.config = config
+	f.mu.Unlock()
+	f.rngMu.Lock()
+	f.rng = rand.New(rand.NewSource(seed))
+	f.rngMu.Unlock()
+}
+
+// Config 返回当前故障注入配置
+func (f *FaultInjectingStorage) Config() FaultConfig {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.config
+}
+
+// WatchEtcd 监听etcd中的故障注入配置（YAML格式），变更后立即生效，直到ctx取消
+func (f *FaultInjectingStorage) WatchEtcd(ctx context.Context, endpoints []string, key string) error {
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		return err
+	}
+
+	apply := func(value []byte) {
+		config, err := ParseFaultConfig(value)
+		if err != nil {
+			log.Printf("解析故障注入配置失败: %v", err)
+			return
+		}
+		f.SetConfig(config)
+		log.Printf("故障注入配置已更新，enabled=%v", config.Enabled)
+	}
+
+	getCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	resp, err := cli.Get(getCtx, key)
+	cancel()
+	if err != nil {
+		cli.Close()
+		return err
+	}
+	if len(resp.Kvs) > 0 {
+		apply(resp.Kvs[0].Value)
+	}
+
+	go func() {
+		defer cli.Close()
+		for wresp := range cli.Watch(ctx, key) {
+			for _, ev := range wresp.Events {
+				if ev.Type == clientv3.EventTypeDelete {
+					f.SetConfig(FaultConfig{})
+					log.Printf("故障注入配置已删除，停止注入")
+					continue
+				}
+				apply(ev.Kv.Value)
+			}
+		}
+	}()
+	return nil
+}
+
+// rule 返回指定操作生效的规则
+func (f *FaultInjectingStorage) rule(op string) (FaultRule, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if !f.config.Enabled {
+		return FaultRule{}, false
+	}
+	if r, ok := f.config.Operations[op]; ok {
+		return r, true
+	}
+	r, ok := f.config.Operations[OpAll]
+	return r, ok
+}
+
+// hit 按比例判定是否触发
+func (f *FaultInjectingStorage) hit(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	f.rngMu.Lock()
+	defer f.rngMu.Unlock()
+	return f.rng.Float64() < rate
+}
+
+func (f *FaultInjectingStorage) intn(n int) int {
+	f.rngMu.Lock()
+	defer f.rngMu.Unlock()
+	return f.rng.Intn(n)
+}
+
+// before 注入延迟和错误
+func (f *FaultInjectingStorage) before(ctx context.Context, op string) (FaultRule, error) {
+	r, ok := f.rule(op)
+	if !ok {
+		return r, nil
+	}
+	if r.Latency > 0 {
+		select {
+		case <-time.After(r.Latency):
+		case <-ctx.Done():
+			return r, ctx.Err()
+		}
+	}
+	if f.hit(r.ErrorRate) {
+		return r, ErrInjectedFault
+	}
+	return r, nil
+}
+
+// flipBit 随机翻转一个比特
+func (f *FaultInjectingStorage) flipBit(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	i := f.intn(len(data))
+	data[i] ^= 1 << uint(f.intn(8))
+}
+
+// write 对写入内容注入比特翻转或截断，truncated 为 true 时调用方应在写入后返回错误
+func (f *FaultInjectingStorage) write(r FaultRule, reader io.Reader) (io.Reader, bool, error) {
+	truncate := f.hit(r.TruncateWriteRate)
+	flip := f.hit(r.BitFlipRate)
+	if !truncate && !flip {
+		return reader, false, nil
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, false, err
+	}
+	if flip {
+		f.flipBit(data)
+	}
+	if truncate {
+		data = data[:len(data)/2]
+	}
+	return bytes.NewReader(data), truncate, nil
+}
+
+// Upload 上传文件
+func (f *FaultInjectingStorage) Upload(ctx context.Context, fileID string, reader io.Reader) error {
+	r, err := f.before(ctx, OpUpload)
+	if err != nil {
+		return err
+	}
+	reader, truncated, err := f.write(r, reader)
+	if err != nil {
+		return err
+	}
+	if err := f.inner.Upload(ctx, fileID, reader); err != nil {
+		return err
+	}
+	if truncated {
+		return ErrInjectedFault
+	}
+	return nil
+}
+
+// Download 下载文件
+func (f *FaultInjectingStorage) Download(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	r, err := f.before(ctx, OpDownload)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := f.inner.Download(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	shortRead := f.hit(r.ShortReadRate)
+	flip := f.hit(r.BitFlipRate)
+	if !shortRead && !flip {
+		return rc, nil
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	if flip {
+		f.flipBit(data)
+	}
+	if shortRead {
+		return io.NopCloser(io.MultiReader(
+			bytes.NewReader(data[:len(data)/2]),
+			&errReader{err: io.ErrUnexpectedEOF},
+		)), nil
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// DownloadRange 按范围下载文件，与 Download 共用下载故障规则中的错误和延迟
+func (f *FaultInjectingStorage) DownloadRange(ctx context.Context, fileID string, offset, length int64) (io.ReadCloser, error) {
+	if _, err := f.before(ctx, OpDownload); err != nil {
+		return nil, err
+	}
+	return DownloadRange(ctx, f.inner, fileID, offset, length)
+}
+
+// errReader 读取时总是返回指定错误
+type errReader struct {
+	err error
+}
+
+func (e *errReader) Read(p []byte) (int, error) {
+	return 0, e.err
+}
+
+// Delete 删除文件
+func (f *FaultInjectingStorage) Delete(ctx context.Context, fileID string) error {
+	if _, err := f.before(ctx, OpDelete); err != nil {
+		return err
+	}
+	return f.inner.Delete(ctx, fileID)
+}
+
+// Stat 查询对象元信息
+func (f *FaultInjectingStorage) Stat(ctx context.Context, fileID string) (*ObjectInfo, error) {
+	if _, err := f.before(ctx, OpStat); err != nil {
+		return nil, err
+	}
+	return f.inner.Stat(ctx, fileID)
+}
+
+// Exists 判断对象是否存在
+func (f *FaultInjectingStorage) Exists(ctx context.Context, fileID string) (bool, error) {
+	if _, err := f.before(ctx, OpExists); err != nil {
+		return false, err
+	}
+	return f.inner.Exists(ctx, fileID)
+}
+
+// List 分页列举对象
+func (f *FaultInjectingStorage) List(ctx context.Context, prefix string, marker string, limit int) (*ListResult, error) {
+	if _, err := f.before(ctx, OpList); err != nil {
+		return nil, err
+	}
+	return f.inner.List(ctx, prefix, marker, limit)
+}
+
+// InitMultipartUpload 初始化分片上传
+func (f *FaultInjectingStorage) InitMultipartUpload(ctx context.Context, fileID string, filename string) (string, error) {
+	if _, err := f.before(ctx, OpInitMultipart); err != nil {
+		return "", err
+	}
+	return f.inner.InitMultipartUpload(ctx, fileID, filename)
+}
+
+// UploadPart 上传分片
+func (f *FaultInjectingStorage) UploadPart(ctx context.Context, uploadID string, partNumber int, partData io.Reader, options ...interface{}) (string, error) {
+	r, err := f.before(ctx, OpUploadPart)
+	if err != nil {
+		return "", err
+	}
+	partData, truncated, err := f.write(r, partData)
+	if err != nil {
+		return "", err
+	}
+	etag, err := f.inner.UploadPart(ctx, uploadID, partNumber, partData, options...)
+	if err != nil {
+		return "", err
+	}
+	if truncated {
+		return "", ErrInjectedFault
+	}
+	return etag, nil
+}
+
+// CompleteMultipartUpload 完成分片上传
+func (f *FaultInjectingStorage) CompleteMultipartUpload(ctx context.Context, uploadID string, parts []PartInfo) (string, error) {
+	if _, err := f.before(ctx, OpCompleteMultipart); err != nil {
+		return "", err
+	}
+	return f.inner.CompleteMultipartUpload(ctx, uploadID, parts)
+}
+
+// ListUploadedParts 查询已上传分片
+func (f *FaultInjectingStorage) ListUploadedParts(ctx context.Context, uploadID string) ([]int, error) {
+	if _, err := f.before(ctx, OpListParts); err != nil {
+		return nil, err
+	}
+	return f.inner.ListUploadedParts(ctx, uploadID)
+}
+
+// IsInjectedFault 判断错误是否来自故障注入
+func IsInjectedFault(err error) bool {
+	return err != nil && (errors.Is(err, ErrInjectedFault) || strings.Contains(err.Error(), ErrInjectedFault.Error()))
+}
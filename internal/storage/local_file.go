@@ -4,11 +4,15 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
 )
 
 // LocalFileStorage 实现 Storage 接口，基于本地文件系统
@@ -27,25 +31,162 @@ func (l *LocalFileStorage) Upload(ctx context.Context, fileID string, reader io.
 // Download 下载文件
 func (l *LocalFileStorage) Download(ctx context.Context, fileID string) (io.ReadCloser, error) {
 	filePath := filepath.Join(l.Dir, fileID)
-	return os.Open(filePath)
+	f, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil, ErrObjectNotFound
+	}
+	return f, err
+}
+
+// DownloadRange 按范围下载文件
+func (l *LocalFileStorage) DownloadRange(ctx context.Context, fileID string, offset, length int64) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(l.Dir, fileID))
+	if os.IsNotExist(err) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return readCloser{Reader: io.NewSectionReader(f, offset, length), Closer: f}, nil
 }
 
-// Delete 删除文件
+// Delete 删除文件，文件不存在时不报错
 func (l *LocalFileStorage) Delete(ctx context.Context, fileID string) error {
 	filePath := filepath.Join(l.Dir, fileID)
-	return os.Remove(filePath)
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Stat 查询对象元信息，不计算内容摘要，需要摘要时使用 StatWithDigest
+func (l *LocalFileStorage) Stat(ctx context.Context, fileID string) (*ObjectInfo, error) {
+	fi, err := os.Stat(filepath.Join(l.Dir, fileID))
+	if os.IsNotExist(err) || (err == nil && fi.IsDir()) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectInfo{
+		Key:     fileID,
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+	}, nil
+}
+
+// Exists 判断对象是否存在
+func (l *LocalFileStorage) Exists(ctx context.Context, fileID string) (bool, error) {
+	fi, err := os.Stat(filepath.Join(l.Dir, fileID))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !fi.IsDir(), nil
+}
+
+// List 按key字典序分页列举对象，跳过分片临时目录，不计算摘要
+// 从 marker 处按序遍历，凑满一页即停止，不必每页遍历整个目录树
+func (l *LocalFileStorage) List(ctx context.Context, prefix string, marker string, limit int) (*ListResult, error) {
+	limit = normalizeListLimit(limit)
+	var objects []ObjectInfo
+	// 多取一个用于判断是否还有下一页
+	if err := l.listDir(ctx, "", prefix, marker, limit+1, &objects); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	result := &ListResult{Objects: []ObjectInfo{}}
+	if len(objects) > limit {
+		objects = objects[:limit]
+		result.NextMarker = objects[limit-1].Key
+	}
+	result.Objects = append(result.Objects, objects...)
+	return result, nil
+}
+
+// listDir 按key字典序深度优先遍历 dir（以 / 结尾的key前缀，根目录为空）下的对象，
+// 收集 prefix 下、marker 之后的对象，凑满 max 个即停止
+// 子目录按“目录名/”参与排序，使遍历顺序与key的字典序一致，并可整体跳过位于 marker 之前或与 prefix 无关的子目录
+func (l *LocalFileStorage) listDir(ctx context.Context, dir, prefix, marker string, max int, objects *[]ObjectInfo) error {
+	entries, err := os.ReadDir(filepath.Join(l.Dir, filepath.FromSlash(dir)))
+	if err != nil {
+		return err
+	}
+	keys := make([]string, len(entries))
+	for i, e := range entries {
+		keys[i] = dir + e.Name()
+		if e.IsDir() {
+			keys[i] += "/"
+		}
+	}
+	sort.Sort(entriesByKey{entries: entries, keys: keys})
+	for i, e := range entries {
+		if len(*objects) >= max {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		key := keys[i]
+		if e.IsDir() {
+			// 子目录中的key都以 key 开头
+			if key == "multipart/" ||
+				!strings.HasPrefix(key, prefix) && !strings.HasPrefix(prefix, key) ||
+				marker > key && !strings.HasPrefix(marker, key) {
+				continue
+			}
+			// 遍历期间被删除的子目录直接跳过
+			if err := l.listDir(ctx, key, prefix, marker, max, objects); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		if !strings.HasPrefix(key, prefix) || key <= marker {
+			continue
+		}
+		fi, err := e.Info()
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		*objects = append(*objects, ObjectInfo{
+			Key:     key,
+			Size:    fi.Size(),
+			ModTime: fi.ModTime(),
+		})
+	}
+	return nil
+}
+
+// entriesByKey 按key对目录项排序
+type entriesByKey struct {
+	entries []fs.DirEntry
+	keys    []string
+}
+
+func (s entriesByKey) Len() int           { return len(s.keys) }
+func (s entriesByKey) Less(i, j int) bool { return s.keys[i] < s.keys[j] }
+func (s entriesByKey) Swap(i, j int) {
+	s.entries[i], s.entries[j] = s.entries[j], s.entries[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
 }
 
 // InitMultipartUpload 初始化分片上传
 func (l *LocalFileStorage) InitMultipartUpload(ctx context.Context, fileID string, filename string) (string, error) {
-	uploadID := fmt.Sprintf("%s_%d", fileID, os.Getpid())
+	uploadID := fmt.Sprintf("%s_%s", fileID, uuid.New().String())
 	dir := filepath.Join(l.Dir, "multipart", uploadID)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return "", err
 	}
-	// 创建一个元数据文件，记录文件名
+	// 元数据文件记录合并后的目标fileID，与MinioStorage保持一致；原始文件名单独记录
 	metaPath := filepath.Join(dir, "meta")
-	if err := ioutil.WriteFile(metaPath, []byte(filename), 0644); err != nil {
+	if err := ioutil.WriteFile(metaPath, []byte(fileID), 0644); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "filename"), []byte(filename), 0644); err != nil {
 		return "", err
 	}
 	return uploadID, nil
@@ -77,19 +218,19 @@ func (l *LocalFileStorage) UploadPart(ctx context.Context, uploadID string, part
 func (l *LocalFileStorage) CompleteMultipartUpload(ctx context.Context, uploadID string, parts []PartInfo) (string, error) {
 	dir := filepath.Join(l.Dir, "multipart", uploadID)
 
-	// 读取元数据文件获取原始文件名
+	// 读取元数据文件获取目标fileID
 	metaPath := filepath.Join(dir, "meta")
 	metaData, err := ioutil.ReadFile(metaPath)
 	if err != nil {
 		return "", fmt.Errorf("读取上传元数据失败: %v", err)
 	}
 
-	// 使用fileID作为目标文件名
 	fileID := string(metaData)
 	targetPath := filepath.Join(l.Dir, fileID)
 
-	// 创建目标文件
-	out, err := os.Create(targetPath)
+	// 先合并到临时目录内，全部成功后再移动到目标位置，避免失败时留下不完整的对象
+	mergedPath := filepath.Join(dir, "merged")
+	out, err := os.Create(mergedPath)
 	if err != nil {
 		return "", err
 	}
@@ -114,6 +255,15 @@ func (l *LocalFileStorage) CompleteMultipartUpload(ctx context.Context, uploadID
 		}
 		in.Close()
 	}
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(mergedPath, targetPath); err != nil {
+		return "", err
+	}
 
 	// 清理临时目录
 	if err := os.RemoveAll(dir); err != nil {
@@ -189,7 +339,7 @@ func (l *LocalFileStorage) ListUploadedParts(ctx context.Context, uploadId strin
 	if err != nil {
 		return nil, err
 	}
-	var parts []int
+	parts := []int{}
 	for _, f := range files {
 		if !f.IsDir() {
 			n, err := strconv.Atoi(f.Name())
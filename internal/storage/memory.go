@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// memoryObject 内存中的对象
+type memoryObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+// memoryUpload 进行中的分片上传
+type memoryUpload struct {
+	fileID string
+	parts  map[int][]byte
+}
+
+// MemoryStorage 实现 Storage 接口，数据保存在内存中，用于测试和本地开发
+type MemoryStorage struct {
+	mu      sync.RWMutex
+	objects map[string]*memoryObject
+	uploads map[string]*memoryUpload
+}
+
+// NewMemoryStorage 创建内存存储
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		objects: map[string]*memoryObject{},
+		uploads: map[string]*memoryUpload{},
+	}
+}
+
+// Upload 上传文件，已存在时覆盖
+func (m *MemoryStorage) Upload(ctx context.Context, fileID string, reader io.Reader) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[fileID] = &memoryObject{data: data, modTime: time.Now()}
+	return nil
+}
+
+// Download 下载文件
+func (m *MemoryStorage) Download(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	obj, ok := m.objects[fileID]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+	return io.NopCloser(bytes.NewReader(obj.data)), nil
+}
+
+// DownloadRange 按范围下载文件
+func (m *MemoryStorage) DownloadRange(ctx context.Context, fileID string, offset, length int64) (io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	obj, ok := m.objects[fileID]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+	return sliceRange(obj.data, offset, length), nil
+}
+
+// Delete 删除文件
+func (m *MemoryStorage) Delete(ctx context.Context, fileID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, fileID)
+	return nil
+}
+
+// Stat 查询对象元信息
+func (m *MemoryStorage) Stat(ctx context.Context, fileID string) (*ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	obj, ok := m.objects[fileID]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+	digest, _ := digestReader(bytes.NewReader(obj.data))
+	return &ObjectInfo{
+		Key:     fileID,
+		Size:    int64(len(obj.data)),
+		ModTime: obj.modTime,
+		Digest:  digest,
+	}, nil
+}
+
+// Exists 判断对象是否存在
+func (m *MemoryStorage) Exists(ctx context.Context, fileID string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.objects[fileID]
+	return ok, nil
+}
+
+// List 按key字典序分页列举对象
+func (m *MemoryStorage) List(ctx context.Context, prefix string, marker string, limit int) (*ListResult, error) {
+	limit = normalizeListLimit(limit)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := make([]string, 0, len(m.objects))
+	for key := range m.objects {
+		if strings.HasPrefix(key, prefix) && key > marker {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	result := &ListResult{Objects: []ObjectInfo{}}
+	if len(keys) > limit {
+		keys = keys[:limit]
+		result.NextMarker = keys[limit-1]
+	}
+	for _, key := range keys {
+		obj := m.objects[key]
+		result.Objects = append(result.Objects, ObjectInfo{
+			Key:     key,
+			Size:    int64(len(obj.data)),
+			ModTime: obj.modTime,
+		})
+	}
+	return result, nil
+}
+
+// InitMultipartUpload 初始化分片上传
+func (m *MemoryStorage) InitMultipartUpload(ctx context.Context, fileID string, filename string) (string, error) {
+	uploadID := fmt.Sprintf("%s_%s", fileID, uuid.New().String())
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.uploads[uploadID] = &memoryUpload{fileID: fileID, parts: map[int][]byte{}}
+	return uploadID, nil
+}
+
+// UploadPart 上传分片，同一分片重复上传时覆盖
+func (m *MemoryStorage) UploadPart(ctx context.Context, uploadID string, partNumber int, partData io.Reader, options ...interface{}) (string, error) {
+	data, err := io.ReadAll(partData)
+	if err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	upload, ok := m.uploads[uploadID]
+	if !ok {
+		return "", fmt.Errorf("分片上传不存在: %s", uploadID)
+	}
+	upload.parts[partNumber] = data
+	return fmt.Sprintf("%s-%d", uploadID, partNumber), nil
+}
+
+// CompleteMultipartUpload 按分片序号合并为对象，返回fileID
+func (m *MemoryStorage) CompleteMultipartUpload(ctx context.Context, uploadID string, parts []PartInfo) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	upload, ok := m.uploads[uploadID]
+	if !ok {
+		return "", fmt.Errorf("读取上传元数据失败: 分片上传不存在: %s", uploadID)
+	}
+	sorted := append([]PartInfo(nil), parts...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].PartNumber < sorted[j].PartNumber
+	})
+	var buf bytes.Buffer
+	for _, part := range sorted {
+		data, ok := upload.parts[part.PartNumber]
+		if !ok {
+			return "", fmt.Errorf("打开分片 %d 失败: 分片不存在", part.PartNumber)
+		}
+		buf.Write(data)
+	}
+	m.objects[upload.fileID] = &memoryObject{data: buf.Bytes(), modTime: time.Now()}
+	delete(m.uploads, uploadID)
+	return upload.fileID, nil
+}
+
+// ListUploadedParts 查询已上传分片序号，上传不存在时返回空
+func (m *MemoryStorage) ListUploadedParts(ctx context.Context, uploadID string) ([]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	parts := []int{}
+	if upload, ok := m.uploads[uploadID]; ok {
+		for n := range upload.parts {
+			parts = append(parts, n)
+		}
+	}
+	sort.Ints(parts)
+	return parts, nil
+}
@@ -1,7 +1,10 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
@@ -63,7 +66,49 @@ func (m *MinioStorage) Upload(ctx context.Context, fileID string, reader io.Read
 
 // Download 下载文件
 func (m *MinioStorage) Download(ctx context.Context, fileID string) (io.ReadCloser, error) {
-	return m.Client.GetObject(ctx, m.Bucket, fileID, minio.GetObjectOptions{})
+	obj, err := m.Client.GetObject(ctx, m.Bucket, fileID, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject 不会立即发起请求，先Stat一次以便对象不存在时返回统一的错误
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
+// DownloadRange 按范围下载文件，使用HTTP Range请求只传输所需部分
+func (m *MinioStorage) DownloadRange(ctx context.Context, fileID string, offset, length int64) (io.ReadCloser, error) {
+	if length <= 0 {
+		if _, err := m.Stat(ctx, fileID); err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(offset, offset+length-1); err != nil {
+		return nil, err
+	}
+	obj, err := m.Client.GetObject(ctx, m.Bucket, fileID, opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		switch minio.ToErrorResponse(err).Code {
+		case "NoSuchKey":
+			return nil, ErrObjectNotFound
+		case "InvalidRange":
+			// 起始位置超出对象末尾
+			return io.NopCloser(bytes.NewReader(nil)), nil
+		}
+		return nil, err
+	}
+	return obj, nil
 }
 
 // Delete 删除文件
@@ -71,6 +116,63 @@ func (m *MinioStorage) Delete(ctx context.Context, fileID string) error {
 	return m.Client.RemoveObject(ctx, m.Bucket, fileID, minio.RemoveObjectOptions{})
 }
 
+// Stat 查询对象元信息，摘要取自对象元数据中记录的值，未记录时为空
+func (m *MinioStorage) Stat(ctx context.Context, fileID string) (*ObjectInfo, error) {
+	oi, err := m.Client.StatObject(ctx, m.Bucket, fileID, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return &ObjectInfo{
+		Key:     fileID,
+		Size:    oi.Size,
+		ModTime: oi.LastModified,
+		Digest:  oi.UserMetadata["Sha256"],
+	}, nil
+}
+
+// Exists 判断对象是否存在
+func (m *MinioStorage) Exists(ctx context.Context, fileID string) (bool, error) {
+	_, err := m.Client.StatObject(ctx, m.Bucket, fileID, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// List 按key字典序分页列举对象，不计算摘要
+func (m *MinioStorage) List(ctx context.Context, prefix string, marker string, limit int) (*ListResult, error) {
+	limit = normalizeListLimit(limit)
+	listCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	result := &ListResult{Objects: []ObjectInfo{}}
+	for obj := range m.Client.ListObjects(listCtx, m.Bucket, minio.ListObjectsOptions{
+		Prefix:     prefix,
+		StartAfter: marker,
+		Recursive:  true,
+		MaxKeys:    limit,
+	}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		if len(result.Objects) == limit {
+			result.NextMarker = result.Objects[limit-1].Key
+			break
+		}
+		result.Objects = append(result.Objects, ObjectInfo{
+			Key:     obj.Key,
+			Size:    obj.Size,
+			ModTime: obj.LastModified,
+		})
+	}
+	return result, nil
+}
+
 // InitMultipartUpload 初始化分片上传
 func (m *MinioStorage) InitMultipartUpload(ctx context.Context, fileID string, filename string) (string, error) {
 	// 创建一个唯一的上传ID，使用绝对值确保是正数
@@ -146,7 +248,9 @@ func (m *MinioStorage) CompleteMultipartUpload(ctx context.Context, uploadID str
 		return parts[i].PartNumber < parts[j].PartNumber
 	})
 
-	// 合并所有分片
+	// 合并所有分片，同时计算摘要写入对象元数据
+	hash := sha256.New()
+	w := io.MultiWriter(out, hash)
 	for _, part := range parts {
 		partPath := filepath.Join(dir, fmt.Sprintf("%d", part.PartNumber))
 		in, err := os.Open(partPath)
@@ -154,7 +258,7 @@ func (m *MinioStorage) CompleteMultipartUpload(ctx context.Context, uploadID str
 			return "", fmt.Errorf("打开分片 %d 失败: %v", part.PartNumber, err)
 		}
 
-		if _, err := io.Copy(out, in); err != nil {
+		if _, err := io.Copy(w, in); err != nil {
 			in.Close()
 			return "", err
 		}
@@ -176,7 +280,9 @@ func (m *MinioStorage) CompleteMultipartUpload(ctx context.Context, uploadID str
 		fileID,
 		mergedFile,
 		-1,
-		minio.PutObjectOptions{},
+		minio.PutObjectOptions{
+			UserMetadata: map[string]string{"Sha256": hex.EncodeToString(hash.Sum(nil))},
+		},
 	)
 	if err != nil {
 		return "", err
@@ -288,7 +394,7 @@ func (m *MinioStorage) ListUploadedParts(ctx context.Context, uploadId string) (
 		return nil, err
 	}
 
-	var parts []int
+	parts := []int{}
 	for _, f := range files {
 		if !f.IsDir() {
 			n, err := strconv.Atoi(f.Name())
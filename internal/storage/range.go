@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// RangeReader 由支持按范围读取的存储实现
+// DownloadRange 返回对象 [offset, offset+length) 范围的内容，超出对象末尾的部分被截断，
+// offset 不小于对象大小时返回空内容；对象不存在时返回 ErrObjectNotFound
+type RangeReader interface {
+	DownloadRange(ctx context.Context, fileID string, offset, length int64) (io.ReadCloser, error)
+}
+
+// DownloadRange 按范围读取对象，存储未实现 RangeReader 时退化为完整下载并跳过前面的内容
+func DownloadRange(ctx context.Context, s Storage, fileID string, offset, length int64) (io.ReadCloser, error) {
+	if rr, ok := s.(RangeReader); ok {
+		return rr.DownloadRange(ctx, fileID, offset, length)
+	}
+	rc, err := s.Download(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, rc, offset); err != nil && err != io.EOF {
+		rc.Close()
+		return nil, err
+	}
+	return readCloser{Reader: io.LimitReader(rc, length), Closer: rc}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// sliceRange 截取内存中的对象内容
+func sliceRange(data []byte, offset, length int64) io.ReadCloser {
+	size := int64(len(data))
+	if offset >= size || length <= 0 {
+		return io.NopCloser(bytes.NewReader(nil))
+	}
+	end := offset + length
+	if end > size {
+		end = size
+	}
+	return io.NopCloser(bytes.NewReader(data[offset:end]))
+}
+
+// readAheadSize ReaderAt 每次范围读取的最小长度，减少读取zip中央目录等小块数据时的请求数
+const readAheadSize = 64 << 10
+
+// ReaderAt 基于范围读取实现 io.ReaderAt，用于不下载整个对象而随机读取其中一部分
+// 每次至少读取 readAheadSize 字节并缓存最近一块，可安全并发使用
+type ReaderAt struct {
+	ctx    context.Context
+	s      Storage
+	fileID string
+	size   int64
+
+	mu       sync.Mutex
+	blockOff int64
+	block    []byte
+}
+
+// NewReaderAt 创建对象的 ReaderAt，size 为对象大小
+func NewReaderAt(ctx context.Context, s Storage, fileID string, size int64) *ReaderAt {
+	return &ReaderAt{ctx: ctx, s: s, fileID: fileID, size: size}
+}
+
+// Size 返回对象大小
+func (r *ReaderAt) Size() int64 {
+	return r.size
+}
+
+// ReadAt 实现 io.ReaderAt
+func (r *ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for n < len(p) && off < r.size {
+		if off < r.blockOff || off >= r.blockOff+int64(len(r.block)) {
+			if err := r.fetch(off, int64(len(p)-n)); err != nil {
+				return n, err
+			}
+		}
+		c := copy(p[n:], r.block[off-r.blockOff:])
+		n += c
+		off += int64(c)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// fetch 从 off 开始读取至少 want 字节到缓存块
+func (r *ReaderAt) fetch(off, want int64) error {
+	if want < readAheadSize {
+		want = readAheadSize
+	}
+	if off+want > r.size {
+		want = r.size - off
+	}
+	rc, err := DownloadRange(r.ctx, r.s, r.fileID, off, want)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	buf := make([]byte, want)
+	if _, err := io.ReadFull(rc, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	r.blockOff, r.block = off, buf
+	return nil
+}
@@ -2,9 +2,20 @@ package storage
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
+	"time"
 )
 
+// ErrObjectNotFound 对象不存在
+var ErrObjectNotFound = errors.New("对象不存在")
+
+// DefaultListLimit 列举对象时的默认分页大小
+const DefaultListLimit = 1000
+
 // FileInfo 表示key/value结构
 // Key 为唯一标识，Content 为内容
 type FileInfo struct {
@@ -18,20 +29,66 @@ type PartInfo struct {
 	ETag       string `json:"etag"`
 }
 
+// ObjectInfo 表示存储中对象的元信息
+// Digest 为对象内容的SHA-256摘要（十六进制），只在存储能直接提供时（如对象元数据中记录的）返回，
+// Stat 和列举都不会为此读取对象内容，需要摘要时使用 StatWithDigest
+type ObjectInfo struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Digest  string    `json:"digest,omitempty"`
+}
+
+// ListResult 表示一页列举结果
+// NextMarker 不为空时表示还有下一页，作为下次请求的 marker 传入
+type ListResult struct {
+	Objects    []ObjectInfo `json:"objects"`
+	NextMarker string       `json:"next_marker,omitempty"`
+}
+
 // Storage 定义通用的存储接口
+// 各实现需通过 storagetest.Run 一致性测试，保证语义一致
 type Storage interface {
 	// 基本文件操作
+	// Download 对象不存在时返回 ErrObjectNotFound；Delete 对象不存在时不报错
 	Upload(ctx context.Context, fileID string, reader io.Reader) error
 	Download(ctx context.Context, fileID string) (io.ReadCloser, error)
 	Delete(ctx context.Context, fileID string) error
 
+	// 对象清单相关方法
+	Stat(ctx context.Context, fileID string) (*ObjectInfo, error)
+	Exists(ctx context.Context, fileID string) (bool, error)
+	List(ctx context.Context, prefix string, marker string, limit int) (*ListResult, error)
+
 	// 分片上传相关方法
+	// CompleteMultipartUpload 以初始化时的fileID保存合并结果并返回该fileID
 	InitMultipartUpload(ctx context.Context, fileID string, filename string) (string, error)
 	UploadPart(ctx context.Context, uploadID string, partNumber int, partData io.Reader, options ...interface{}) (string, error)
 	CompleteMultipartUpload(ctx context.Context, uploadID string, parts []PartInfo) (string, error)
 	ListUploadedParts(ctx context.Context, uploadID string) ([]int, error)
 }
 
+// Unwrapper 由存储装饰器实现，返回被包装的存储
+type Unwrapper interface {
+	Unwrap() Storage
+}
+
+// AsChunkServer 逐层剥离装饰器，返回底层的块存储服务客户端
+// 令牌签发等块存储专有能力需通过它获取，而不是直接断言具体类型
+func AsChunkServer(s Storage) (*ChunkServerStorage, bool) {
+	for s != nil {
+		if chunkStorage, ok := s.(*ChunkServerStorage); ok {
+			return chunkStorage, true
+		}
+		u, ok := s.(Unwrapper)
+		if !ok {
+			break
+		}
+		s = u.Unwrap()
+	}
+	return nil, false
+}
+
 // 兼容旧版接口的方法
 type LegacyStorage interface {
 	Save(key string, content io.Reader) error
@@ -44,3 +101,37 @@ type LegacyStorage interface {
 	ListUploadedParts(uploadId string) ([]int, error)
 	RemoveUploadTemp(uploadId string) error
 }
+
+// StatWithDigest 查询对象元信息，存储未提供摘要时读取对象内容计算
+func StatWithDigest(ctx context.Context, s Storage, fileID string) (*ObjectInfo, error) {
+	info, err := s.Stat(ctx, fileID)
+	if err != nil || info.Digest != "" {
+		return info, err
+	}
+	rc, err := s.Download(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	if info.Digest, err = digestReader(rc); err != nil {
+		return nil, fmt.Errorf("计算摘要失败: %v", err)
+	}
+	return info, nil
+}
+
+// digestReader 计算reader内容的SHA-256摘要
+func digestReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// normalizeListLimit 规范化分页大小
+func normalizeListLimit(limit int) int {
+	if limit <= 0 || limit > DefaultListLimit {
+		return DefaultListLimit
+	}
+	return limit
+}
@@ -3,9 +3,15 @@ package storage
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"io"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // 定义一个通用的key/value结构体用于测试
@@ -83,3 +89,554 @@ func TestLegacyStorageInterface(t *testing.T) {
 		}
 	})
 }
+
+func TestLocalFileStorageInventory(t *testing.T) {
+	dir, err := os.MkdirTemp("", "localfilestorage-inventory-test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &LocalFileStorage{Dir: dir}
+	ctx := context.Background()
+	for _, key := range []string{"b", "a", "c", "ab"} {
+		if err := s.Upload(ctx, key, bytes.NewReader([]byte(key))); err != nil {
+			t.Fatalf("上传文件失败: %v", err)
+		}
+	}
+	// 分片临时目录不应出现在列举结果中
+	if err := s.SavePart("upload1", 1, []byte("part")); err != nil {
+		t.Fatalf("保存分片失败: %v", err)
+	}
+
+	t.Run("查询元信息", func(t *testing.T) {
+		info, err := s.Stat(ctx, "ab")
+		if err != nil {
+			t.Fatalf("查询元信息失败: %v", err)
+		}
+		// Stat 不读取内容计算摘要
+		if info.Size != 2 || info.Digest != "" {
+			t.Errorf("元信息不符: %+v", info)
+		}
+		info, err = StatWithDigest(ctx, s, "ab")
+		// sha256("ab")
+		if err != nil || info.Digest != "fb8e20fc2e4c3f248c60c39bd652f3c1347298bb977b8b4d5903b85055620603" {
+			t.Errorf("摘要不符: %+v %v", info, err)
+		}
+		if _, err := s.Stat(ctx, "missing"); err != ErrObjectNotFound {
+			t.Errorf("期望ErrObjectNotFound，实际: %v", err)
+		}
+	})
+
+	t.Run("判断存在", func(t *testing.T) {
+		if ok, err := s.Exists(ctx, "a"); err != nil || !ok {
+			t.Errorf("a应存在: %v %v", ok, err)
+		}
+		if ok, err := s.Exists(ctx, "missing"); err != nil || ok {
+			t.Errorf("missing不应存在: %v %v", ok, err)
+		}
+	})
+
+	t.Run("分页列举", func(t *testing.T) {
+		page, err := s.List(ctx, "", "", 2)
+		if err != nil {
+			t.Fatalf("列举失败: %v", err)
+		}
+		if len(page.Objects) != 2 || page.Objects[0].Key != "a" || page.Objects[1].Key != "ab" || page.NextMarker != "ab" {
+			t.Fatalf("第一页不符: %+v", page)
+		}
+		page, err = s.List(ctx, "", page.NextMarker, 2)
+		if err != nil {
+			t.Fatalf("列举失败: %v", err)
+		}
+		if len(page.Objects) != 2 || page.Objects[0].Key != "b" || page.Objects[1].Key != "c" || page.NextMarker != "" {
+			t.Fatalf("第二页不符: %+v", page)
+		}
+		page, err = s.List(ctx, "a", "", 10)
+		if err != nil {
+			t.Fatalf("列举失败: %v", err)
+		}
+		if len(page.Objects) != 2 {
+			t.Errorf("前缀过滤不符: %+v", page)
+		}
+	})
+}
+
+func TestLocalFileStorageList_NestedKeys(t *testing.T) {
+	s := &LocalFileStorage{Dir: t.TempDir()}
+	ctx := context.Background()
+	// 子目录的遍历顺序与key的字典序不同：'-' 排在 '/' 之前
+	keys := []string{"a/b", "a-b", "a/c/d", "a", "b/x", "ab", "multipart-x"}
+	for _, key := range keys {
+		if err := s.Upload(ctx, key+"/f", bytes.NewReader([]byte(key))); err != nil {
+			t.Fatalf("上传文件失败: %v", err)
+		}
+	}
+	if err := s.SavePart("upload1", 1, []byte("part")); err != nil {
+		t.Fatalf("保存分片失败: %v", err)
+	}
+	want := []string{"a-b/f", "a/b/f", "a/c/d/f", "a/f", "ab/f", "b/x/f", "multipart-x/f"}
+
+	var got []string
+	marker := ""
+	for {
+		page, err := s.List(ctx, "", marker, 2)
+		if err != nil {
+			t.Fatalf("列举失败: %v", err)
+		}
+		for _, o := range page.Objects {
+			got = append(got, o.Key)
+		}
+		if page.NextMarker == "" {
+			break
+		}
+		marker = page.NextMarker
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("分页列举顺序不符: %v", got)
+	}
+
+	page, err := s.List(ctx, "a/", "a/b/f", 10)
+	if err != nil {
+		t.Fatalf("列举失败: %v", err)
+	}
+	if len(page.Objects) != 2 || page.Objects[0].Key != "a/c/d/f" || page.Objects[1].Key != "a/f" {
+		t.Errorf("前缀和marker过滤不符: %+v", page)
+	}
+}
+
+func TestDualWriteStorage(t *testing.T) {
+	primary := &LocalFileStorage{Dir: t.TempDir()}
+	secondary := &LocalFileStorage{Dir: t.TempDir()}
+	s := NewDualWriteStorage(primary, secondary)
+	ctx := context.Background()
+
+	if err := s.Upload(ctx, testFile.Key, bytes.NewReader(testFile.Content)); err != nil {
+		t.Fatalf("上传文件失败: %v", err)
+	}
+	data, err := secondary.Read(testFile.Key)
+	if err != nil || string(data) != string(testFile.Content) {
+		t.Fatalf("副存储内容不符: %s %v", data, err)
+	}
+
+	if err := s.Delete(ctx, testFile.Key); err != nil {
+		t.Fatalf("删除文件失败: %v", err)
+	}
+	if ok, _ := secondary.Exists(ctx, testFile.Key); ok {
+		t.Errorf("副存储对象应被删除")
+	}
+}
+
+func TestFaultInjectingStorage(t *testing.T) {
+	dir, err := os.MkdirTemp("", "fault-storage-test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	inner := &LocalFileStorage{Dir: dir}
+	ctx := context.Background()
+	content := []byte("fault injection content")
+	if err := inner.Upload(ctx, "obj", bytes.NewReader(content)); err != nil {
+		t.Fatalf("准备对象失败: %v", err)
+	}
+
+	t.Run("未启用时透传", func(t *testing.T) {
+		s := NewFaultInjectingStorage(inner, FaultConfig{
+			Operations: map[string]FaultRule{OpAll: {ErrorRate: 1}},
+		})
+		if ok, err := s.Exists(ctx, "obj"); err != nil || !ok {
+			t.Errorf("未启用时应透传，ok=%v err=%v", ok, err)
+		}
+	})
+
+	t.Run("注入错误", func(t *testing.T) {
+		s := NewFaultInjectingStorage(inner, FaultConfig{
+			Enabled:    true,
+			Operations: map[string]FaultRule{OpAll: {ErrorRate: 1}, OpStat: {}},
+		})
+		if _, err := s.Download(ctx, "obj"); !IsInjectedFault(err) {
+			t.Errorf("期望注入错误，实际: %v", err)
+		}
+		if _, err := s.Stat(ctx, "obj"); err != nil {
+			t.Errorf("单独配置的操作不应使用通配规则: %v", err)
+		}
+	})
+
+	t.Run("截断写入", func(t *testing.T) {
+		s := NewFaultInjectingStorage(inner, FaultConfig{
+			Enabled:    true,
+			Operations: map[string]FaultRule{OpUpload: {TruncateWriteRate: 1}},
+		})
+		if err := s.Upload(ctx, "truncated", bytes.NewReader(content)); !IsInjectedFault(err) {
+			t.Fatalf("期望注入错误，实际: %v", err)
+		}
+		info, err := inner.Stat(ctx, "truncated")
+		if err != nil {
+			t.Fatalf("查询截断对象失败: %v", err)
+		}
+		if info.Size != int64(len(content)/2) {
+			t.Errorf("截断后大小应为 %d，实际 %d", len(content)/2, info.Size)
+		}
+	})
+
+	t.Run("短读", func(t *testing.T) {
+		s := NewFaultInjectingStorage(inner, FaultConfig{
+			Enabled:    true,
+			Operations: map[string]FaultRule{OpDownload: {ShortReadRate: 1}},
+		})
+		rc, err := s.Download(ctx, "obj")
+		if err != nil {
+			t.Fatalf("下载失败: %v", err)
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("期望 ErrUnexpectedEOF，实际: %v", err)
+		}
+		if len(data) != len(content)/2 {
+			t.Errorf("短读长度应为 %d，实际 %d", len(content)/2, len(data))
+		}
+	})
+
+	t.Run("比特翻转", func(t *testing.T) {
+		s := NewFaultInjectingStorage(inner, FaultConfig{
+			Enabled:    true,
+			Seed:       42,
+			Operations: map[string]FaultRule{OpDownload: {BitFlipRate: 1}},
+		})
+		rc, err := s.Download(ctx, "obj")
+		if err != nil {
+			t.Fatalf("下载失败: %v", err)
+		}
+		defer rc.Close()
+		data, _ := io.ReadAll(rc)
+		if len(data) != len(content) || bytes.Equal(data, content) {
+			t.Errorf("期望长度不变且内容被篡改，实际: %q", data)
+		}
+	})
+
+	t.Run("解析YAML配置", func(t *testing.T) {
+		config, err := ParseFaultConfig([]byte("enabled: true\noperations:\n  download:\n    latency: 20ms\n    error_rate: 0.5\n"))
+		if err != nil {
+			t.Fatalf("解析配置失败: %v", err)
+		}
+		rule := config.Operations[OpDownload]
+		if !config.Enabled || rule.Latency.Milliseconds() != 20 || rule.ErrorRate != 0.5 {
+			t.Errorf("配置解析结果不正确: %+v", config)
+		}
+	})
+}
+
+// countingStorage 统计下载次数，可通过gate阻塞下载以模拟并发未命中
+type countingStorage struct {
+	*MemoryStorage
+	mu        sync.Mutex
+	downloads int
+	gate      chan struct{}
+}
+
+func (c *countingStorage) Download(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	c.mu.Lock()
+	c.downloads++
+	c.mu.Unlock()
+	if c.gate != nil {
+		<-c.gate
+	}
+	return c.MemoryStorage.Download(ctx, fileID)
+}
+
+// slowStorage 下载时先返回前10个字节，release关闭后才返回其余内容
+type slowStorage struct {
+	*MemoryStorage
+	release chan struct{}
+}
+
+func (s *slowStorage) Download(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	rc, err := s.MemoryStorage.Download(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write(data[:10])
+		<-s.release
+		pw.Write(data[10:])
+		pw.Close()
+	}()
+	return pr, nil
+}
+
+func (c *countingStorage) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.downloads
+}
+
+func hashOf(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestDiskCacheStorage(t *testing.T) {
+	ctx := context.Background()
+	readAll := func(t *testing.T, s Storage, key string) []byte {
+		t.Helper()
+		rc, err := s.Download(ctx, key)
+		if err != nil {
+			t.Fatalf("下载失败: %v", err)
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("读取失败: %v", err)
+		}
+		return data
+	}
+
+	t.Run("命中后不再访问源存储", func(t *testing.T) {
+		inner := &countingStorage{MemoryStorage: NewMemoryStorage()}
+		content := []byte("hot blob")
+		key := hashOf(content)
+		inner.Upload(ctx, key, bytes.NewReader(content))
+		cache, err := NewDiskCacheStorage(inner, t.TempDir(), 1024)
+		if err != nil {
+			t.Fatalf("创建读缓存失败: %v", err)
+		}
+		for i := 0; i < 3; i++ {
+			if got := readAll(t, cache, key); !bytes.Equal(got, content) {
+				t.Fatalf("内容不一致: %q", got)
+			}
+		}
+		if inner.count() != 1 {
+			t.Errorf("源存储应只被访问一次，实际 %d 次", inner.count())
+		}
+		if cache.Size() != int64(len(content)) {
+			t.Errorf("缓存大小应为 %d，实际 %d", len(content), cache.Size())
+		}
+	})
+
+	t.Run("并发未命中只拉取一次", func(t *testing.T) {
+		inner := &countingStorage{MemoryStorage: NewMemoryStorage(), gate: make(chan struct{})}
+		content := bytes.Repeat([]byte("x"), 4096)
+		key := hashOf(content)
+		inner.MemoryStorage.Upload(ctx, key, bytes.NewReader(content))
+		cache, err := NewDiskCacheStorage(inner, t.TempDir(), 1<<20)
+		if err != nil {
+			t.Fatalf("创建读缓存失败: %v", err)
+		}
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rc, err := cache.Download(ctx, key)
+				if err != nil {
+					errs <- err
+					return
+				}
+				defer rc.Close()
+				data, _ := io.ReadAll(rc)
+				if !bytes.Equal(data, content) {
+					errs <- fmt.Errorf("内容不一致")
+				}
+			}()
+		}
+		time.Sleep(50 * time.Millisecond)
+		close(inner.gate)
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Errorf("并发下载失败: %v", err)
+		}
+		if inner.count() != 1 {
+			t.Errorf("并发未命中应只拉取一次，实际 %d 次", inner.count())
+		}
+	})
+
+	t.Run("超过容量按LRU淘汰", func(t *testing.T) {
+		inner := &countingStorage{MemoryStorage: NewMemoryStorage()}
+		var keys []string
+		for _, s := range []string{"aaaa", "bbbb", "cccc"} {
+			content := bytes.Repeat([]byte(s), 25) // 100字节
+			key := hashOf(content)
+			inner.Upload(ctx, key, bytes.NewReader(content))
+			keys = append(keys, key)
+		}
+		cache, err := NewDiskCacheStorage(inner, t.TempDir(), 250)
+		if err != nil {
+			t.Fatalf("创建读缓存失败: %v", err)
+		}
+		readAll(t, cache, keys[0])
+		readAll(t, cache, keys[1])
+		readAll(t, cache, keys[0]) // keys[0] 成为最近使用
+		readAll(t, cache, keys[2]) // 淘汰 keys[1]
+		if cache.Size() != 200 {
+			t.Errorf("缓存大小应为200，实际 %d", cache.Size())
+		}
+		before := inner.count()
+		readAll(t, cache, keys[0])
+		if inner.count() != before {
+			t.Errorf("最近使用的对象不应被淘汰")
+		}
+		readAll(t, cache, keys[1])
+		if inner.count() != before+1 {
+			t.Errorf("最久未使用的对象应已被淘汰")
+		}
+	})
+
+	t.Run("超过容量的对象不缓存", func(t *testing.T) {
+		inner := &countingStorage{MemoryStorage: NewMemoryStorage()}
+		content := bytes.Repeat([]byte("big"), 100)
+		key := hashOf(content)
+		inner.Upload(ctx, key, bytes.NewReader(content))
+		cache, err := NewDiskCacheStorage(inner, t.TempDir(), 100)
+		if err != nil {
+			t.Fatalf("创建读缓存失败: %v", err)
+		}
+		if got := readAll(t, cache, key); !bytes.Equal(got, content) {
+			t.Fatalf("内容不一致")
+		}
+		if cache.Size() != 0 {
+			t.Errorf("超大对象不应进入缓存，当前大小 %d", cache.Size())
+		}
+		if inner.count() != 1 {
+			t.Errorf("超大对象应直接透传，只拉取一次，实际 %d 次", inner.count())
+		}
+	})
+
+	t.Run("填充完成前即可读取", func(t *testing.T) {
+		release := make(chan struct{})
+		inner := &slowStorage{MemoryStorage: NewMemoryStorage(), release: release}
+		content := bytes.Repeat([]byte("stream"), 100)
+		key := hashOf(content)
+		inner.Upload(ctx, key, bytes.NewReader(content))
+		cache, err := NewDiskCacheStorage(inner, t.TempDir(), 1<<20)
+		if err != nil {
+			t.Fatalf("创建读缓存失败: %v", err)
+		}
+		rc, err := cache.Download(ctx, key)
+		if err != nil {
+			t.Fatalf("下载失败: %v", err)
+		}
+		defer rc.Close()
+		head := make([]byte, 10)
+		if _, err := io.ReadFull(rc, head); err != nil || !bytes.Equal(head, content[:10]) {
+			t.Fatalf("源存储未读完时应已能读到开头的数据: %q %v", head, err)
+		}
+		close(release)
+		rest, err := io.ReadAll(rc)
+		if err != nil || !bytes.Equal(append(head, rest...), content) {
+			t.Fatalf("内容不一致: %v", err)
+		}
+		if got := readAll(t, cache, key); !bytes.Equal(got, content) {
+			t.Fatalf("缓存内容不一致")
+		}
+		if cache.Size() != int64(len(content)) {
+			t.Errorf("读完后应已进入缓存，当前大小 %d", cache.Size())
+		}
+	})
+
+	t.Run("内容与hash不一致时不缓存", func(t *testing.T) {
+		inner := &countingStorage{MemoryStorage: NewMemoryStorage()}
+		key := hashOf([]byte("expected"))
+		inner.Upload(ctx, key, bytes.NewReader([]byte("corrupted")))
+		cache, err := NewDiskCacheStorage(inner, t.TempDir(), 1024)
+		if err != nil {
+			t.Fatalf("创建读缓存失败: %v", err)
+		}
+		rc, err := cache.Download(ctx, key)
+		if err != nil {
+			t.Fatalf("下载失败: %v", err)
+		}
+		if _, err := io.ReadAll(rc); err != ErrCacheDigestMismatch {
+			t.Errorf("期望读取结束时返回 ErrCacheDigestMismatch，实际: %v", err)
+		}
+		rc.Close()
+		if cache.Size() != 0 {
+			t.Errorf("损坏的对象不应进入缓存")
+		}
+	})
+
+	t.Run("重启后恢复缓存", func(t *testing.T) {
+		inner := &countingStorage{MemoryStorage: NewMemoryStorage()}
+		content := []byte("persisted blob")
+		key := hashOf(content)
+		inner.Upload(ctx, key, bytes.NewReader(content))
+		dir := t.TempDir()
+		cache, _ := NewDiskCacheStorage(inner, dir, 1024)
+		readAll(t, cache, key)
+
+		reopened, err := NewDiskCacheStorage(inner, dir, 1024)
+		if err != nil {
+			t.Fatalf("重新打开读缓存失败: %v", err)
+		}
+		readAll(t, reopened, key)
+		if inner.count() != 1 {
+			t.Errorf("重启后应命中已有缓存，源存储访问 %d 次", inner.count())
+		}
+		if err := reopened.Delete(ctx, key); err != nil {
+			t.Fatalf("删除失败: %v", err)
+		}
+		if reopened.Size() != 0 {
+			t.Errorf("删除后缓存应失效")
+		}
+	})
+}
+
+func TestAsChunkServer(t *testing.T) {
+	chunkStorage, _ := NewChunkServerStorage("http://chunkserver:8081", nil, t.TempDir())
+	cache, err := NewDiskCacheStorage(chunkStorage, t.TempDir(), 1024)
+	if err != nil {
+		t.Fatalf("创建读缓存失败: %v", err)
+	}
+	if got, ok := AsChunkServer(cache); !ok || got != chunkStorage {
+		t.Errorf("应能穿过读缓存取得块存储客户端")
+	}
+	fault := NewFaultInjectingStorage(cache, FaultConfig{Enabled: true})
+	if got, ok := AsChunkServer(fault); !ok || got != chunkStorage {
+		t.Errorf("应能穿过故障注入和读缓存取得块存储客户端")
+	}
+	if _, ok := AsChunkServer(NewMemoryStorage()); ok {
+		t.Errorf("内存存储不应被识别为块存储")
+	}
+}
+
+// downloadOnly 隐藏底层存储的范围读取能力，用于测试退化路径
+type downloadOnly struct {
+	Storage
+}
+
+func TestReaderAt(t *testing.T) {
+	ctx := context.Background()
+	content := make([]byte, 300<<10)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	mem := NewMemoryStorage()
+	mem.Upload(ctx, "obj", bytes.NewReader(content))
+
+	for name, s := range map[string]Storage{"范围读取": mem, "退化为完整下载": downloadOnly{mem}} {
+		t.Run(name, func(t *testing.T) {
+			ra := NewReaderAt(ctx, s, "obj", int64(len(content)))
+			for _, tc := range []struct{ off, n int }{{0, 10}, {5, 100 << 10}, {200 << 10, 4096}, {1, 1}, {290 << 10, 10 << 10}} {
+				buf := make([]byte, tc.n)
+				n, err := ra.ReadAt(buf, int64(tc.off))
+				if err != nil || n != tc.n || !bytes.Equal(buf, content[tc.off:tc.off+tc.n]) {
+					t.Errorf("ReadAt(%d, %d) = %d, %v", tc.off, tc.n, n, err)
+				}
+			}
+			buf := make([]byte, 100)
+			n, err := ra.ReadAt(buf, int64(len(content)-40))
+			if n != 40 || err != io.EOF || !bytes.Equal(buf[:n], content[len(content)-40:]) {
+				t.Errorf("读取末尾应返回剩余内容和EOF，实际 %d, %v", n, err)
+			}
+			if _, err := ra.ReadAt(buf, int64(len(content))); err != io.EOF {
+				t.Errorf("超出末尾应返回EOF，实际 %v", err)
+			}
+		})
+	}
+}
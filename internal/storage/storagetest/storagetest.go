@@ -0,0 +1,326 @@
+// Package storagetest 提供 storage.Storage 的一致性测试套件
+//
+// 所有存储后端都应通过 Run，以保证上层代码切换后端时语义一致：
+//   - Upload 覆盖同名对象，Download 不存在的对象返回 storage.ErrObjectNotFound
+//   - Delete 不存在的对象不报错
+//   - Stat 返回对象大小与SHA-256摘要，List 按key字典序分页且不包含分片临时数据
+//   - InitMultipartUpload 每次返回不同的uploadID，CompleteMultipartUpload 按分片序号合并、
+//     以初始化时的fileID保存并返回该fileID，完成后该上传的分片列表为空
+//   - 分片缺失或uploadID未知时完成失败，且不会留下目标对象
+//   - storage.DownloadRange 返回指定范围的内容，超出末尾的部分被截断
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"cloudDrive/internal/storage"
+)
+
+// Factory 为每个子测试创建一个空的存储实例
+type Factory func(t *testing.T) storage.Storage
+
+// Run 对存储实现运行一致性测试
+func Run(t *testing.T, newStorage Factory) {
+	ctx := context.Background()
+
+	t.Run("上传下载往返", func(t *testing.T) {
+		s := newStorage(t)
+		content := randomBytes(t, 1<<20+17)
+		mustUpload(t, s, "conf-roundtrip", content)
+		assertContent(t, s, "conf-roundtrip", content)
+	})
+
+	t.Run("覆盖写入", func(t *testing.T) {
+		s := newStorage(t)
+		mustUpload(t, s, "conf-overwrite", []byte("first version"))
+		mustUpload(t, s, "conf-overwrite", []byte("v2"))
+		assertContent(t, s, "conf-overwrite", []byte("v2"))
+	})
+
+	t.Run("空对象", func(t *testing.T) {
+		s := newStorage(t)
+		mustUpload(t, s, "conf-empty", nil)
+		assertContent(t, s, "conf-empty", []byte{})
+		info, err := s.Stat(ctx, "conf-empty")
+		if err != nil {
+			t.Fatalf("查询空对象失败: %v", err)
+		}
+		if info.Size != 0 {
+			t.Errorf("空对象大小应为0，实际 %d", info.Size)
+		}
+	})
+
+	t.Run("下载不存在的对象", func(t *testing.T) {
+		s := newStorage(t)
+		rc, err := s.Download(ctx, "conf-missing")
+		if err == nil {
+			rc.Close()
+		}
+		if !errors.Is(err, storage.ErrObjectNotFound) {
+			t.Errorf("期望 ErrObjectNotFound，实际: %v", err)
+		}
+	})
+
+	t.Run("范围读取", func(t *testing.T) {
+		s := newStorage(t)
+		content := randomBytes(t, 200<<10)
+		mustUpload(t, s, "conf-range", content)
+		cases := []struct{ offset, length, start, end int64 }{
+			{0, 10, 0, 10},
+			{100 << 10, 4096, 100 << 10, 100<<10 + 4096},
+			{190 << 10, 64 << 10, 190 << 10, 200 << 10},
+			{200 << 10, 10, 200 << 10, 200 << 10},
+		}
+		for _, tc := range cases {
+			rc, err := storage.DownloadRange(ctx, s, "conf-range", tc.offset, tc.length)
+			if err != nil {
+				t.Fatalf("范围读取 [%d,+%d) 失败: %v", tc.offset, tc.length, err)
+			}
+			got, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatalf("读取范围内容失败: %v", err)
+			}
+			if !bytes.Equal(got, content[tc.start:tc.end]) {
+				t.Errorf("范围 [%d,+%d) 内容不一致，长度 %d", tc.offset, tc.length, len(got))
+			}
+		}
+		rc, err := storage.DownloadRange(ctx, s, "conf-range-missing", 0, 10)
+		if err == nil {
+			rc.Close()
+		}
+		if !errors.Is(err, storage.ErrObjectNotFound) {
+			t.Errorf("期望 ErrObjectNotFound，实际: %v", err)
+		}
+	})
+
+	t.Run("删除", func(t *testing.T) {
+		s := newStorage(t)
+		mustUpload(t, s, "conf-delete", []byte("to be deleted"))
+		if err := s.Delete(ctx, "conf-delete"); err != nil {
+			t.Fatalf("删除失败: %v", err)
+		}
+		if ok, err := s.Exists(ctx, "conf-delete"); err != nil || ok {
+			t.Errorf("删除后对象不应存在，ok=%v err=%v", ok, err)
+		}
+		if _, err := s.Download(ctx, "conf-delete"); !errors.Is(err, storage.ErrObjectNotFound) {
+			t.Errorf("删除后下载应返回 ErrObjectNotFound，实际: %v", err)
+		}
+		if err := s.Delete(ctx, "conf-delete"); err != nil {
+			t.Errorf("删除不存在的对象不应报错: %v", err)
+		}
+	})
+
+	t.Run("元信息", func(t *testing.T) {
+		s := newStorage(t)
+		content := []byte("stat me")
+		mustUpload(t, s, "conf-stat", content)
+		info, err := s.Stat(ctx, "conf-stat")
+		if err != nil {
+			t.Fatalf("查询元信息失败: %v", err)
+		}
+		// 摘要只在存储能直接提供时返回，StatWithDigest 总能得到摘要
+		if info.Key != "conf-stat" || info.Size != int64(len(content)) || (info.Digest != "" && info.Digest != digest(content)) {
+			t.Errorf("元信息不正确: %+v", info)
+		}
+		if info, err := storage.StatWithDigest(ctx, s, "conf-stat"); err != nil || info.Digest != digest(content) {
+			t.Errorf("摘要不正确: %+v %v", info, err)
+		}
+		if ok, err := s.Exists(ctx, "conf-stat"); err != nil || !ok {
+			t.Errorf("对象应存在，ok=%v err=%v", ok, err)
+		}
+		if _, err := s.Stat(ctx, "conf-stat-missing"); !errors.Is(err, storage.ErrObjectNotFound) {
+			t.Errorf("期望 ErrObjectNotFound，实际: %v", err)
+		}
+		if ok, err := s.Exists(ctx, "conf-stat-missing"); err != nil || ok {
+			t.Errorf("对象不应存在，ok=%v err=%v", ok, err)
+		}
+	})
+
+	t.Run("分页列举", func(t *testing.T) {
+		s := newStorage(t)
+		for _, key := range []string{"conf-list-c", "conf-list-a", "conf-list-b", "other"} {
+			mustUpload(t, s, key, []byte(key))
+		}
+		page, err := s.List(ctx, "conf-list-", "", 2)
+		if err != nil {
+			t.Fatalf("列举失败: %v", err)
+		}
+		if got := keys(page); !reflect.DeepEqual(got, []string{"conf-list-a", "conf-list-b"}) || page.NextMarker != "conf-list-b" {
+			t.Fatalf("第一页不正确: %v, next=%q", got, page.NextMarker)
+		}
+		page, err = s.List(ctx, "conf-list-", page.NextMarker, 2)
+		if err != nil {
+			t.Fatalf("列举失败: %v", err)
+		}
+		if got := keys(page); !reflect.DeepEqual(got, []string{"conf-list-c"}) || page.NextMarker != "" {
+			t.Errorf("第二页不正确: %v, next=%q", got, page.NextMarker)
+		}
+		if page.Objects[0].Size != int64(len("conf-list-c")) {
+			t.Errorf("列举结果大小不正确: %d", page.Objects[0].Size)
+		}
+	})
+
+	t.Run("分片上传", func(t *testing.T) {
+		s := newStorage(t)
+		uploadID, err := s.InitMultipartUpload(ctx, "conf-multipart", "original name.bin")
+		if err != nil {
+			t.Fatalf("初始化分片上传失败: %v", err)
+		}
+		parts := [][]byte{randomBytes(t, 4096), randomBytes(t, 4096), []byte("tail")}
+		for _, n := range []int{2, 3, 1} {
+			if _, err := s.UploadPart(ctx, uploadID, n, bytes.NewReader(parts[n-1])); err != nil {
+				t.Fatalf("上传分片 %d 失败: %v", n, err)
+			}
+		}
+		uploaded, err := s.ListUploadedParts(ctx, uploadID)
+		if err != nil {
+			t.Fatalf("查询已上传分片失败: %v", err)
+		}
+		if !reflect.DeepEqual(uploaded, []int{1, 2, 3}) {
+			t.Errorf("已上传分片应为 [1 2 3]，实际 %v", uploaded)
+		}
+
+		// 上传进行中的临时数据不应出现在列举结果中
+		page, err := s.List(ctx, "", "", 0)
+		if err != nil {
+			t.Fatalf("列举失败: %v", err)
+		}
+		if len(page.Objects) != 0 {
+			t.Errorf("分片临时数据不应被列举: %v", keys(page))
+		}
+
+		fileID, err := s.CompleteMultipartUpload(ctx, uploadID, []storage.PartInfo{
+			{PartNumber: 3}, {PartNumber: 1}, {PartNumber: 2},
+		})
+		if err != nil {
+			t.Fatalf("完成分片上传失败: %v", err)
+		}
+		if fileID != "conf-multipart" {
+			t.Errorf("完成后应返回初始化时的fileID，实际 %q", fileID)
+		}
+		assertContent(t, s, "conf-multipart", bytes.Join(parts, nil))
+
+		uploaded, err = s.ListUploadedParts(ctx, uploadID)
+		if err != nil || len(uploaded) != 0 {
+			t.Errorf("完成后分片列表应为空，parts=%v err=%v", uploaded, err)
+		}
+	})
+
+	t.Run("分片重复上传覆盖", func(t *testing.T) {
+		s := newStorage(t)
+		uploadID, err := s.InitMultipartUpload(ctx, "conf-part-retry", "retry.bin")
+		if err != nil {
+			t.Fatalf("初始化分片上传失败: %v", err)
+		}
+		if _, err := s.UploadPart(ctx, uploadID, 1, bytes.NewReader([]byte("broken part"))); err != nil {
+			t.Fatalf("上传分片失败: %v", err)
+		}
+		if _, err := s.UploadPart(ctx, uploadID, 1, bytes.NewReader([]byte("good"))); err != nil {
+			t.Fatalf("重传分片失败: %v", err)
+		}
+		if _, err := s.CompleteMultipartUpload(ctx, uploadID, []storage.PartInfo{{PartNumber: 1}}); err != nil {
+			t.Fatalf("完成分片上传失败: %v", err)
+		}
+		assertContent(t, s, "conf-part-retry", []byte("good"))
+	})
+
+	t.Run("同一文件多次初始化", func(t *testing.T) {
+		s := newStorage(t)
+		first, err := s.InitMultipartUpload(ctx, "conf-same-file", "a.bin")
+		if err != nil {
+			t.Fatalf("初始化分片上传失败: %v", err)
+		}
+		second, err := s.InitMultipartUpload(ctx, "conf-same-file", "a.bin")
+		if err != nil {
+			t.Fatalf("初始化分片上传失败: %v", err)
+		}
+		if first == "" || first == second {
+			t.Errorf("每次初始化应返回不同的uploadID: %q, %q", first, second)
+		}
+	})
+
+	t.Run("未知上传", func(t *testing.T) {
+		s := newStorage(t)
+		parts, err := s.ListUploadedParts(ctx, "conf-unknown-upload")
+		if err != nil || len(parts) != 0 {
+			t.Errorf("未知上传的分片列表应为空，parts=%v err=%v", parts, err)
+		}
+		if _, err := s.UploadPart(ctx, "conf-unknown-upload", 1, bytes.NewReader([]byte("x"))); err == nil {
+			t.Errorf("向未知上传写入分片应失败")
+		}
+		if _, err := s.CompleteMultipartUpload(ctx, "conf-unknown-upload", []storage.PartInfo{{PartNumber: 1}}); err == nil {
+			t.Errorf("完成未知上传应失败")
+		}
+	})
+
+	t.Run("分片缺失时完成失败", func(t *testing.T) {
+		s := newStorage(t)
+		uploadID, err := s.InitMultipartUpload(ctx, "conf-missing-part", "m.bin")
+		if err != nil {
+			t.Fatalf("初始化分片上传失败: %v", err)
+		}
+		if _, err := s.UploadPart(ctx, uploadID, 1, bytes.NewReader([]byte("only part"))); err != nil {
+			t.Fatalf("上传分片失败: %v", err)
+		}
+		if _, err := s.CompleteMultipartUpload(ctx, uploadID, []storage.PartInfo{{PartNumber: 1}, {PartNumber: 2}}); err == nil {
+			t.Fatalf("缺少分片时完成应失败")
+		}
+		if ok, err := s.Exists(ctx, "conf-missing-part"); err != nil || ok {
+			t.Errorf("完成失败后不应留下目标对象，ok=%v err=%v", ok, err)
+		}
+	})
+}
+
+func mustUpload(t *testing.T, s storage.Storage, key string, content []byte) {
+	t.Helper()
+	if err := s.Upload(context.Background(), key, bytes.NewReader(content)); err != nil {
+		t.Fatalf("上传 %s 失败: %v", key, err)
+	}
+}
+
+func assertContent(t *testing.T, s storage.Storage, key string, want []byte) {
+	t.Helper()
+	rc, err := s.Download(context.Background(), key)
+	if err != nil {
+		t.Fatalf("下载 %s 失败: %v", key, err)
+	}
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("读取 %s 失败: %v", key, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s 内容不一致: 期望 %d 字节，实际 %d 字节", key, len(want), len(got))
+	}
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("生成随机数据失败: %v", err)
+	}
+	return b
+}
+
+func digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func keys(page *storage.ListResult) []string {
+	out := []string{}
+	for _, obj := range page.Objects {
+		out = append(out, obj.Key)
+	}
+	return out
+}
@@ -0,0 +1,20 @@
+// Package strutil 提供各模块共用的字符串处理函数
+package strutil
+
+import "unicode/utf8"
+
+// Truncate 将字符串截断到不超过 maxBytes 字节，不会截断多字节字符
+// 用于写入按字节限制长度的字段（如 MySQL utf8mb4 的 varchar），截断半个字符会导致严格模式下写入失败
+func Truncate(s string, maxBytes int) string {
+	if maxBytes <= 0 {
+		return ""
+	}
+	if len(s) <= maxBytes {
+		return s
+	}
+	// s[maxBytes] 是被截掉的第一个字节，它不是字符开头时说明截断点在字符中间，回退到该字符开头
+	for maxBytes > 0 && !utf8.RuneStart(s[maxBytes]) {
+		maxBytes--
+	}
+	return s[:maxBytes]
+}
@@ -0,0 +1,29 @@
+package strutil
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		s    string
+		max  int
+		want string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 3, "hel"},
+		{"解压失败", 6, "解压"},
+		{"解压失败", 7, "解压"},
+		{"解压失败", 8, "解压"},
+		{"解压失败", 9, "解压失"},
+		{"a解", 2, "a"},
+		{"解压", 0, ""},
+	}
+	for _, c := range cases {
+		got := Truncate(c.s, c.max)
+		if got != c.want || !utf8.ValidString(got) {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", c.s, c.max, got, c.want)
+		}
+	}
+}
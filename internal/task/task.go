@@ -0,0 +1,225 @@
+// Package task 提供持久化到数据库的异步任务，用于解压、复制等耗时操作
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"cloudDrive/internal/strutil"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 任务状态
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+var ErrTaskNotFound = errors.New("任务不存在")
+
+// 异步任务表
+// Total/Done 为进度，单位由任务类型决定（如字节数）；Result 为成功后的JSON结果
+type Task struct {
+	ID        string    `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	Type      string    `gorm:"size:32" json:"type"`
+	Status    string    `gorm:"size:16;index" json:"status"`
+	Total     int64     `json:"total"`
+	Done      int64     `json:"done"`
+	Message   string    `gorm:"size:255" json:"message"`
+	Result    string    `gorm:"type:text" json:"result,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (t *Task) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID == "" {
+		t.ID = uuid.New().String()
+	}
+	return
+}
+
+// progressFlushInterval 完成量写入数据库的最小间隔，任务结束时写入最终值
+const progressFlushInterval = time.Second
+
+// Progress 任务进度上报，总量立即写入数据库，完成量按 progressFlushInterval 节流写入
+type Progress struct {
+	db        *gorm.DB
+	taskID    string
+	mu        sync.Mutex
+	total     int64
+	done      int64
+	flushedAt time.Time
+}
+
+// SetTotal 设置任务总量
+func (p *Progress) SetTotal(total int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total = total
+	p.db.Model(&Task{}).Where("id = ?", p.taskID).Update("total", total)
+}
+
+// Add 增加已完成量，距上次写入不足 progressFlushInterval 时只记录在内存中
+func (p *Progress) Add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done += n
+	if time.Since(p.flushedAt) < progressFlushInterval {
+		return
+	}
+	p.flushedAt = time.Now()
+	p.db.Model(&Task{}).Where("id = ?", p.taskID).Update("done", p.done)
+}
+
+// Done 当前的完成量
+func (p *Progress) Done() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.done
+}
+
+// SetMessage 更新任务的当前状态说明
+func (p *Progress) SetMessage(msg string) {
+	p.db.Model(&Task{}).Where("id = ?", p.taskID).Update("message", msg)
+}
+
+// Func 任务执行函数，返回值序列化为JSON保存到 Result
+type Func func(ctx context.Context, p *Progress) (interface{}, error)
+
+// Manager 异步任务管理器，限制同时执行的任务数
+type Manager struct {
+	db     *gorm.DB
+	sem    chan struct{}
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewManager 创建任务管理器，workers 为最大并发任务数
+func NewManager(db *gorm.DB, workers int) *Manager {
+	if workers <= 0 {
+		workers = 2
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{db: db, sem: make(chan struct{}, workers), ctx: ctx, cancel: cancel}
+}
+
+// RecoverInterrupted 将上次进程退出时未完成的任务标记为失败
+func (m *Manager) RecoverInterrupted() error {
+	return m.db.Model(&Task{}).Where("status IN ?", []string{StatusPending, StatusRunning}).
+		Updates(map[string]interface{}{"status": StatusFailed, "message": "服务重启，任务中断"}).Error
+}
+
+// Submit 创建任务记录并在后台执行
+func (m *Manager) Submit(userID uint, taskType string, fn Func) (*Task, error) {
+	t := &Task{UserID: userID, Type: taskType, Status: StatusPending}
+	if err := m.db.Create(t).Error; err != nil {
+		return nil, err
+	}
+	m.wg.Add(1)
+	go m.run(t.ID, fn)
+	return t, nil
+}
+
+func (m *Manager) run(taskID string, fn Func) {
+	defer m.wg.Done()
+	select {
+	case m.sem <- struct{}{}:
+		defer func() { <-m.sem }()
+	case <-m.ctx.Done():
+		m.finish(taskID, nil, nil, m.ctx.Err())
+		return
+	}
+	m.db.Model(&Task{}).Where("id = ?", taskID).Update("status", StatusRunning)
+
+	var result interface{}
+	var err error
+	p := &Progress{db: m.db, taskID: taskID}
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("任务异常: %v", r)
+			}
+		}()
+		result, err = fn(m.ctx, p)
+	}()
+	m.finish(taskID, p, result, err)
+}
+
+// finish 保存任务的最终状态，p 不为空时一并写入节流中尚未写入的完成量
+func (m *Manager) finish(taskID string, p *Progress, result interface{}, err error) {
+	updates := map[string]interface{}{"status": StatusSucceeded, "message": ""}
+	if p != nil {
+		updates["done"] = p.Done()
+	}
+	if err != nil {
+		updates["status"] = StatusFailed
+		// message 按字节限制长度，不能截断多字节字符，否则 utf8mb4 严格模式下整条更新会失败
+		updates["message"] = strutil.Truncate(err.Error(), 255)
+	} else if result != nil {
+		data, _ := json.Marshal(result)
+		updates["result"] = string(data)
+	}
+	e := m.db.Model(&Task{}).Where("id = ?", taskID).Updates(updates).Error
+	if e == nil {
+		return
+	}
+	log.Printf("更新任务 %s 状态失败: %v", taskID, e)
+	// 结果无法保存时仍要结束任务，避免一直停留在执行中
+	if e := m.db.Model(&Task{}).Where("id = ?", taskID).
+		Updates(map[string]interface{}{"status": StatusFailed, "message": "保存任务结果失败"}).Error; e != nil {
+		log.Printf("标记任务 %s 失败出错: %v", taskID, e)
+	}
+}
+
+// Wait 等待所有已提交的任务结束
+func (m *Manager) Wait() {
+	m.wg.Wait()
+}
+
+// Shutdown 取消正在执行的任务并等待其退出
+func (m *Manager) Shutdown() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// Get 获取用户的任务
+func Get(db *gorm.DB, taskID string, userID uint) (*Task, error) {
+	var t Task
+	err := db.First(&t, "id = ? AND user_id = ?", taskID, userID).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrTaskNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// List 分页列出用户的任务，按创建时间倒序
+func List(db *gorm.DB, userID uint, page, pageSize int) ([]Task, int64, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+	var total int64
+	query := db.Model(&Task{}).Where("user_id = ?", userID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	tasks := []Task{}
+	err := query.Order("created_at desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&tasks).Error
+	return tasks, total, err
+}
@@ -0,0 +1,124 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"unicode/utf8"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTaskDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect database: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&Task{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return db
+}
+
+func TestManager_Submit(t *testing.T) {
+	db := setupTaskDB(t)
+	m := NewManager(db, 2)
+	defer m.Shutdown()
+
+	ok, _ := m.Submit(1, "demo", func(ctx context.Context, p *Progress) (interface{}, error) {
+		p.SetTotal(10)
+		p.Add(4)
+		p.Add(6)
+		return map[string]int{"n": 1}, nil
+	})
+	failed, _ := m.Submit(1, "demo", func(ctx context.Context, p *Progress) (interface{}, error) {
+		return nil, errors.New("出错了")
+	})
+	panicked, _ := m.Submit(1, "demo", func(ctx context.Context, p *Progress) (interface{}, error) {
+		panic("boom")
+	})
+	m.Wait()
+
+	got, err := Get(db, ok.ID, 1)
+	if err != nil || got.Status != StatusSucceeded || got.Total != 10 || got.Done != 10 || got.Result != `{"n":1}` {
+		t.Errorf("unexpected task: %+v, %v", got, err)
+	}
+	if got, _ := Get(db, failed.ID, 1); got.Status != StatusFailed || got.Message != "出错了" {
+		t.Errorf("unexpected failed task: %+v", got)
+	}
+	if got, _ := Get(db, panicked.ID, 1); got.Status != StatusFailed {
+		t.Errorf("panic should fail the task: %+v", got)
+	}
+	if _, err := Get(db, ok.ID, 2); err != ErrTaskNotFound {
+		t.Errorf("other users should not see the task, got %v", err)
+	}
+	if tasks, total, _ := List(db, 1, 1, 2); total != 3 || len(tasks) != 2 {
+		t.Errorf("unexpected list: %d tasks, total %d", len(tasks), total)
+	}
+}
+
+func TestManager_RecoverInterrupted(t *testing.T) {
+	db := setupTaskDB(t)
+	db.Create(&Task{ID: "a", UserID: 1, Status: StatusRunning})
+	db.Create(&Task{ID: "b", UserID: 1, Status: StatusSucceeded})
+	if err := NewManager(db, 1).RecoverInterrupted(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := Get(db, "a", 1); got.Status != StatusFailed {
+		t.Errorf("interrupted task should be failed: %+v", got)
+	}
+	if got, _ := Get(db, "b", 1); got.Status != StatusSucceeded {
+		t.Errorf("finished task should be untouched: %+v", got)
+	}
+}
+
+func TestManager_FailureMessageKeepsUTF8(t *testing.T) {
+	db := setupTaskDB(t)
+	m := NewManager(db, 1)
+	defer m.Shutdown()
+
+	// 每个汉字3字节，255字节恰好截在字符中间
+	long := strings.Repeat("解", 84) + "ab" + strings.Repeat("压", 10)
+	failed, _ := m.Submit(1, "demo", func(ctx context.Context, p *Progress) (interface{}, error) {
+		return nil, errors.New(long)
+	})
+	m.Wait()
+
+	got, _ := Get(db, failed.ID, 1)
+	if got.Status != StatusFailed || !utf8.ValidString(got.Message) || len(got.Message) > 255 {
+		t.Errorf("unexpected failed task: status %s, message %d bytes, valid %v", got.Status, len(got.Message), utf8.ValidString(got.Message))
+	}
+	if got.Message != strings.Repeat("解", 84)+"ab" {
+		t.Errorf("message should be cut at a character boundary: %q", got.Message)
+	}
+}
+
+func TestProgress_ThrottlesWrites(t *testing.T) {
+	db := setupTaskDB(t)
+	m := NewManager(db, 1)
+	defer m.Shutdown()
+
+	var updates int64
+	db.Callback().Update().After("gorm:update").Register("count_updates", func(tx *gorm.DB) {
+		atomic.AddInt64(&updates, 1)
+	})
+	task, _ := m.Submit(1, "demo", func(ctx context.Context, p *Progress) (interface{}, error) {
+		for i := 0; i < 1000; i++ {
+			p.Add(1)
+		}
+		return nil, nil
+	})
+	m.Wait()
+
+	if n := atomic.LoadInt64(&updates); n > 5 {
+		t.Errorf("progress should be throttled, got %d writes for 1000 entries", n)
+	}
+	if got, _ := Get(db, task.ID, 1); got.Done != 1000 || got.Status != StatusSucceeded {
+		t.Errorf("final progress should be flushed on finish: %+v", got)
+	}
+}